@@ -0,0 +1,83 @@
+// ABOUTME: Candidates subcommand ranking the files most often mixed with other changes
+// ABOUTME: Suggests targets worth extracting before running the tool on them
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/obra/git-rebase-extract-file/internal/rebase"
+	"github.com/spf13/cobra"
+)
+
+var (
+	candidatesFormat string
+	candidatesLimit  int
+)
+
+var candidatesCmd = &cobra.Command{
+	Use:   "candidates <previous-rev>",
+	Short: "Rank the files in a range by how often they are mixed with other changes",
+	Long: `List the files changed in <previous-rev>..HEAD, ranked by how many commits
+change them together with other files. Files near the top keep riding along
+in unrelated commits and are good targets to extract.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := changeDirectory(); err != nil {
+			return err
+		}
+		if err := useGit(cmd.Context()); err != nil {
+			return err
+		}
+		if candidatesFormat != "text" && candidatesFormat != "json" {
+			return fmt.Errorf("invalid format %q: must be \"text\" or \"json\"", candidatesFormat)
+		}
+
+		candidates, err := rankCandidates(cmd.Context(), args[0])
+		if err != nil {
+			return err
+		}
+		if candidatesLimit > 0 && len(candidates) > candidatesLimit {
+			candidates = candidates[:candidatesLimit]
+		}
+
+		if candidatesFormat == "json" {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(candidates)
+		}
+		if len(candidates) == 0 {
+			fmt.Fprintln(cmd.OutOrStdout(), "No files changed in the range")
+			return nil
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "MIXED\tCOMMITS\t  FILE")
+		for _, candidate := range candidates {
+			fmt.Fprintf(w, "%d\t%d\t  %s\n", candidate.MixedCommits, candidate.Commits, candidate.Path)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	candidatesCmd.Flags().StringVar(&candidatesFormat, "format", "text", "Output format (text|json)")
+	candidatesCmd.Flags().IntVarP(&candidatesLimit, "limit", "n", 0, "Only list the first n files")
+	rootCmd.AddCommand(candidatesCmd)
+}
+
+// rankCandidates analyzes base..HEAD and ranks the files it changes
+func rankCandidates(ctx context.Context, base string) ([]rebase.FileCandidate, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	commits, err := rebase.NewAnalyzer(wd).AnalyzeRange(ctx, base, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze commits: %w", err)
+	}
+	return rebase.RankCandidates(commits), nil
+}
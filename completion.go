@@ -0,0 +1,119 @@
+// ABOUTME: Shell completion subcommand and positional argument completion
+// ABOUTME: Completes revisions for the first argument and repository paths for the rest
+
+package main
+
+import (
+	"context"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for the given shell. For example:
+
+  # bash
+  source <(git-rebase-extract-file completion bash)
+
+  # zsh
+  git-rebase-extract-file completion zsh > "${fpath[1]}/_git-rebase-extract-file"
+
+  # fish
+  git-rebase-extract-file completion fish > ~/.config/fish/completions/git-rebase-extract-file.fish
+
+  # powershell
+  git-rebase-extract-file completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.ValidArgsFunction = completeArgs
+}
+
+// completeArgs completes a revision for the first argument and paths in the
+// repository for the rest
+func completeArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if err := changeDirectory(); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	if gitPath != "" && git.SetExecutable(gitPath) != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	if len(args) == 0 {
+		return completeRevisions(cmd.Context(), toComplete), cobra.ShellCompDirectiveNoFileComp
+	}
+
+	paths := completePaths(cmd.Context(), toComplete)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "/") {
+			// Let the user keep descending into directories
+			return paths, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		}
+	}
+	return paths, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRevisions lists branches, tags, and HEAD matching prefix
+func completeRevisions(ctx context.Context, prefix string) []string {
+	output, err := git.NewRepository("").Command(ctx, "for-each-ref", "--format=%(refname:short)", "refs/heads", "refs/tags", "refs/remotes").Output()
+	if err != nil {
+		return nil
+	}
+
+	var revisions []string
+	for _, rev := range append([]string{"HEAD"}, strings.Fields(string(output))...) {
+		if strings.HasPrefix(rev, prefix) {
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions
+}
+
+// completePaths lists repository-relative paths at HEAD matching prefix, one
+// directory level at a time; directories end in "/" since they are valid targets
+func completePaths(ctx context.Context, prefix string) []string {
+	output, err := git.NewRepository("").Command(ctx, "ls-tree", "-r", "-z", "--name-only", "--full-tree", "HEAD").Output()
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+		// Stop at the next directory below what has been typed
+		if slash := strings.Index(file[len(prefix):], "/"); slash >= 0 {
+			file = file[:len(prefix)+slash+1]
+		}
+		seen[file] = true
+	}
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,139 @@
+// ABOUTME: Defaults read from git config under the rebaseExtract section
+// ABOUTME: Fills in flags left unset on the command line, so per-repo and per-user settings work like git's own
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"github.com/spf13/pflag"
+)
+
+// configFlag ties a rebaseExtract.* key to the flag it provides a default for
+type configFlag struct {
+	key    string // lowercased, as git config reports it
+	flag   string
+	invert bool // for --no-* flags of boolean settings
+	isBool bool
+}
+
+var configFlags = []configFlag{
+	{key: "autostash", flag: "autostash", isBool: true},
+	{key: "fastpath", flag: "no-fast-path", invert: true, isBool: true},
+	{key: "rerere", flag: "no-rerere", invert: true, isBool: true},
+	{key: "verify", flag: "no-verify", invert: true, isBool: true},
+	{key: "follow", flag: "no-follow", invert: true, isBool: true},
+	{key: "progress", flag: "no-progress", invert: true, isBool: true},
+	{key: "emoji", flag: "no-emoji", invert: true, isBool: true},
+	{key: "rewriteothers", flag: "rewrite-others", isBool: true},
+	{key: "requiresignatures", flag: "require-signatures", isBool: true},
+	{key: "rebasedependents", flag: "rebase-dependents", isBool: true},
+	{key: "confirm", flag: "confirm", isBool: true},
+	{key: "deferhooks", flag: "defer-hooks", isBool: true},
+	{key: "strictpaths", flag: "strict-paths", isBool: true},
+	{key: "annotatenotes", flag: "annotate-notes", isBool: true},
+	{key: "mapnotes", flag: "map-notes", isBool: true},
+	{key: "strategyoption", flag: "strategy-option"},
+	{key: "emptycommits", flag: "empty-commits"},
+	{key: "copynotes", flag: "copy-notes"},
+	{key: "stacktrailers", flag: "stack-trailers"},
+	{key: "backend", flag: "backend"},
+	{key: "gitpath", flag: "git-path"},
+	{key: "presplit", flag: "pre-split"},
+	{key: "postsplit", flag: "post-split"},
+	{key: "backupprefix", flag: "backup-prefix"},
+	{key: "remainingtemplate", flag: "remaining-template"},
+	{key: "extractedtemplate", flag: "extracted-template"},
+	{key: "color", flag: "color"},
+}
+
+// gitConfig holds the rebaseExtract.* settings, keyed without the section
+// name; values of multi-valued keys are kept in order
+type gitConfig map[string][]string
+
+// loadGitConfig reads every rebaseExtract.* setting visible from the current directory
+func loadGitConfig(ctx context.Context) (gitConfig, error) {
+	output, err := git.NewRepository("").Command(ctx, "config", "-z", "--get-regexp", `^rebaseextract\.`).Output()
+	if errors.Is(err, exec.ErrNotFound) && withoutGit() {
+		// A dry run with go-git does without git, and so without its config
+		return gitConfig{}, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// Nothing configured
+		return gitConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	config := gitConfig{}
+	for _, entry := range strings.Split(strings.TrimSuffix(string(output), "\x00"), "\x00") {
+		// A key without a value is a bare boolean, which git reads as true
+		key, value, found := strings.Cut(entry, "\n")
+		if !found {
+			value = "true"
+		}
+		key = strings.TrimPrefix(key, "rebaseextract.")
+		config[key] = append(config[key], value)
+	}
+	return config, nil
+}
+
+// get returns the last value of a key, which is the one git gives precedence
+func (c gitConfig) get(key string) (string, bool) {
+	values := c[key]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// hasSection reports whether any rebaseExtract.<name>.* key is set
+func (c gitConfig) hasSection(name string) bool {
+	for key := range c {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTo sets each flag the command line left unset from the config;
+// prefix selects a subsection such as a preset ("lockfiles.")
+func (c gitConfig) applyTo(flags *pflag.FlagSet, prefix string) error {
+	for _, setting := range configFlags {
+		value, ok := c.get(prefix + setting.key)
+		if !ok || flags.Changed(setting.flag) {
+			continue
+		}
+		if setting.isBool {
+			enabled, err := parseGitBool(value)
+			if err != nil {
+				return fmt.Errorf("rebaseExtract.%s%s: %w", prefix, setting.key, err)
+			}
+			value = fmt.Sprint(enabled != setting.invert)
+		}
+		if err := flags.Set(setting.flag, value); err != nil {
+			return fmt.Errorf("rebaseExtract.%s%s: %w", prefix, setting.key, err)
+		}
+	}
+	return nil
+}
+
+// parseGitBool parses a boolean the way git config does
+func parseGitBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "", "false", "no", "off", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
@@ -0,0 +1,152 @@
+// ABOUTME: Tests for the defaults read from git config under the rebaseExtract section
+// ABOUTME: Covers git's boolean spellings and the precedence of the command line, presets, and config
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/obra/git-rebase-extract-file/internal/testutils"
+	"github.com/spf13/pflag"
+)
+
+func TestParseGitBool(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{value: "true", want: true},
+		{value: "Yes", want: true},
+		{value: "ON", want: true},
+		{value: "1", want: true},
+		{value: "false", want: false},
+		{value: "no", want: false},
+		{value: "off", want: false},
+		{value: "0", want: false},
+		{value: "", want: false},
+		{value: "2", wantErr: true},
+		{value: "enabled", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseGitBool(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseGitBool(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseGitBool(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+// newConfigFlags returns the flags config can set, parsed from args
+func newConfigFlags(t *testing.T, args ...string) *pflag.FlagSet {
+	t.Helper()
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Bool("autostash", false, "")
+	flags.Bool("no-fast-path", false, "")
+	flags.Bool("no-verify", false, "")
+	flags.String("strategy-option", "", "")
+	flags.String("empty-commits", "keep", "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatalf("Failed to parse %q: %v", args, err)
+	}
+	return flags
+}
+
+func TestGitConfigApplyTo(t *testing.T) {
+	config := gitConfig{
+		"autostash":              {"true"},
+		"fastpath":               {"false"},
+		"verify":                 {"yes"},
+		"strategyoption":         {"theirs", "ours"},
+		"emptycommits":           {"drop"},
+		"lockfiles.autostash":    {"false"},
+		"lockfiles.emptycommits": {"keep"},
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		preset string
+		want   map[string]string
+	}{
+		{
+			name: "config fills unset flags",
+			want: map[string]string{"autostash": "true", "no-fast-path": "true", "no-verify": "false", "strategy-option": "ours", "empty-commits": "drop"},
+		},
+		{
+			name: "command line wins",
+			args: []string{"--autostash=false", "--no-fast-path=false", "--strategy-option", "theirs"},
+			want: map[string]string{"autostash": "false", "no-fast-path": "false", "no-verify": "false", "strategy-option": "theirs", "empty-commits": "drop"},
+		},
+		{
+			name:   "preset wins over the section",
+			preset: "lockfiles",
+			want:   map[string]string{"autostash": "false", "no-fast-path": "true", "no-verify": "false", "strategy-option": "ours", "empty-commits": "keep"},
+		},
+		{
+			name:   "command line wins over the preset",
+			args:   []string{"--empty-commits", "drop"},
+			preset: "lockfiles",
+			want:   map[string]string{"autostash": "false", "no-fast-path": "true", "no-verify": "false", "strategy-option": "ours", "empty-commits": "drop"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := newConfigFlags(t, tt.args...)
+			// run applies the preset first, then the section itself
+			if tt.preset != "" {
+				if err := config.applyTo(flags, tt.preset+"."); err != nil {
+					t.Fatalf("applyTo(%q) failed: %v", tt.preset, err)
+				}
+			}
+			if err := config.applyTo(flags, ""); err != nil {
+				t.Fatalf("applyTo failed: %v", err)
+			}
+			for name, want := range tt.want {
+				if got := flags.Lookup(name).Value.String(); got != want {
+					t.Errorf("Expected --%s=%s, got %s", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGitConfigApplyTo_RejectsInvalidBooleans(t *testing.T) {
+	config := gitConfig{"autostash": {"sometimes"}}
+	err := config.applyTo(newConfigFlags(t), "")
+	if err == nil || !strings.Contains(err.Error(), `rebaseExtract.autostash: invalid boolean "sometimes"`) {
+		t.Errorf("Expected an error naming the setting, got %v", err)
+	}
+}
+
+func TestLoadGitConfig(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+	repo.Git("config", "rebaseExtract.autostash", "true")
+	repo.Git("config", "--add", "rebaseExtract.lockfiles.path", "package-lock.json")
+	repo.Git("config", "--add", "rebaseExtract.lockfiles.path", "yarn.lock")
+	t.Chdir(repo.Dir)
+
+	config, err := loadGitConfig(t.Context())
+	if err != nil {
+		t.Fatalf("loadGitConfig failed: %v", err)
+	}
+	if value, ok := config.get("autostash"); !ok || value != "true" {
+		t.Errorf("Expected autostash to be true, got %q", value)
+	}
+	if paths := strings.Join(config["lockfiles.path"], ","); paths != "package-lock.json,yarn.lock" {
+		t.Errorf("Expected both preset paths in order, got %q", paths)
+	}
+	if !config.hasSection("lockfiles") || config.hasSection("lock") {
+		t.Error("Expected only the lockfiles preset to exist")
+	}
+}
@@ -0,0 +1,145 @@
+// ABOUTME: Backend abstractions over the repository: the read side used for analysis,
+// ABOUTME: and GitBackend, which adds the status, staging, commit, ref, and rebase steps of a rewrite
+
+package git
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrNotCommit is returned when a revision names an object that isn't a commit
+var ErrNotCommit = errors.New("not a commit")
+
+// Commit holds the metadata of a commit needed for analysis
+type Commit struct {
+	Hash    string
+	Message string
+	Author  string
+	Parents []string
+	Files   []string
+}
+
+// TreeEntry is a single non-directory entry of a recursive tree listing
+type TreeEntry struct {
+	Mode string
+	OID  string
+	Path string
+}
+
+// Rename is a file renamed by a commit
+type Rename struct {
+	From string
+	To   string
+}
+
+// FileStat is the number of lines a diff adds and removes in one file
+type FileStat struct {
+	Path       string
+	Insertions int
+	Deletions  int
+	// Binary files have no line counts
+	Binary bool
+}
+
+// Backend provides the read-only operations used for analysis and dry runs
+type Backend interface {
+	// ResolveCommit returns the full hash of the commit rev names, failing
+	// with ErrNotCommit if rev names another kind of object
+	ResolveCommit(ctx context.Context, rev string) (string, error)
+	// RevList returns the commits in from..to, oldest first
+	RevList(ctx context.Context, from, to string) ([]string, error)
+	// ReadCommit returns the metadata and changed files of a commit
+	ReadCommit(ctx context.Context, hash string) (Commit, error)
+	// CatCommit returns the metadata of a commit, without its files
+	CatCommit(ctx context.Context, hash string) (Commit, error)
+	// ListTree returns every non-directory entry in the tree of a revision
+	ListTree(ctx context.Context, rev string) ([]TreeEntry, error)
+	// Renames returns the file renames of the commits in from..to, oldest
+	// first, as git log -M finds them
+	Renames(ctx context.Context, from, to string) ([]Rename, error)
+	// NumStat returns the lines added and removed per file between two
+	// revisions, without rename detection; an empty from diffs to against
+	// the empty tree
+	NumStat(ctx context.Context, from, to string) ([]FileStat, error)
+	// BlobSize returns the size of path in the tree of rev
+	BlobSize(ctx context.Context, rev, path string) (int64, error)
+	// CurrentBranch returns the short name of the branch HEAD points at,
+	// or "" when HEAD is detached
+	CurrentBranch(ctx context.Context) (string, error)
+	// RefsContaining returns the full names of the refs whose history
+	// includes the commit hash, sorted
+	RefsContaining(ctx context.Context, hash string) ([]string, error)
+	// Config returns the value of a config key such as user.email, failing
+	// if it isn't set
+	Config(ctx context.Context, key string) (string, error)
+}
+
+// StatusEntry is one path in the status of the working tree and index
+type StatusEntry struct {
+	// XY is the two-letter status code of git status --porcelain, "??"
+	// for untracked files
+	XY   string
+	Path string
+	// Orig is the source path of a rename or copy
+	Orig string
+}
+
+// Untracked reports whether the entry is an untracked file
+func (s StatusEntry) Untracked() bool {
+	return s.XY == "??"
+}
+
+// Conflicted reports whether the entry has unresolved conflicts
+func (s StatusEntry) Conflicted() bool {
+	return strings.Contains(s.XY, "U") || s.XY == "AA" || s.XY == "DD"
+}
+
+// String renders the entry as a line of git status --porcelain
+func (s StatusEntry) String() string {
+	return s.XY + " " + s.Path
+}
+
+// NewCommit describes a commit for GitBackend.CommitTree to create
+type NewCommit struct {
+	Tree    string
+	Parents []string
+	Message string
+	// The author identity and its raw date ("<unix time> <zone>"); the
+	// committer comes from the environment as with git commit
+	AuthorName  string
+	AuthorEmail string
+	AuthorDate  string
+	// Sign signs the commit with the configured key
+	Sign bool
+}
+
+// RebaseOptions are the settings a rebase command runs with
+type RebaseOptions struct {
+	// Config holds key=value overrides passed as git -c
+	Config []string
+	// Env is added to the environment, e.g. for GIT_SEQUENCE_EDITOR
+	Env []string
+}
+
+// GitBackend covers the operations the rewrite engine performs: reading
+// history, checking the working tree, building trees and commits from
+// objects, moving refs, and driving rebases. Repository implements it with
+// the git binary; other implementations can record or simulate a run.
+type GitBackend interface {
+	Backend
+	// Status lists changed and untracked paths in the working tree and index
+	Status(ctx context.Context) ([]StatusEntry, error)
+	// Stage returns the tree of base with entries staged over it, built in
+	// a throwaway index. An entry without an OID removes its path.
+	Stage(ctx context.Context, base string, entries []TreeEntry) (string, error)
+	// CommitTree creates a commit without touching any ref and returns its hash
+	CommitTree(ctx context.Context, commit NewCommit) (string, error)
+	// UpdateRef points ref at newValue, failing unless it is at oldValue
+	// when that is given, and logs reason in the reflog when it is given
+	UpdateRef(ctx context.Context, ref, newValue, oldValue, reason string) error
+	// Rebase runs git rebase with args, such as "-i <base>", "--continue",
+	// or "--abort"
+	Rebase(ctx context.Context, options RebaseOptions, args ...string) error
+}
@@ -0,0 +1,89 @@
+// ABOUTME: Long-lived git cat-file --batch process for object lookups
+// ABOUTME: Avoids a fork/exec per query, which is expensive where process creation is slow
+
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrObjectNotFound is returned when a queried object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// catFile is a running git cat-file --batch process
+type catFile struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// startCatFile starts git cat-file --batch in dir, running until ctx is
+// canceled or the process is closed
+func startCatFile(ctx context.Context, dir string) (*catFile, error) {
+	cmd := exec.CommandContext(ctx, Executable(), "cat-file", "--batch")
+	cmd.Dir = dir
+	cmd.Env = withCLocale(Environ())
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cat-file stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cat-file stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git cat-file: %w", err)
+	}
+
+	return &catFile{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// object reads an object by name, returning its type and contents
+func (c *catFile) object(name string) (string, []byte, error) {
+	if strings.ContainsAny(name, "\n") {
+		return "", nil, fmt.Errorf("invalid object name %q", name)
+	}
+	if _, err := fmt.Fprintln(c.stdin, name); err != nil {
+		return "", nil, fmt.Errorf("failed to query cat-file: %w", err)
+	}
+	return readBatchObject(c.stdout, name)
+}
+
+// readBatchObject reads the cat-file --batch answer for the object name
+func readBatchObject(stdout *bufio.Reader, name string) (string, []byte, error) {
+	// Header: <oid> SP <type> SP <size> LF, or <name> SP missing LF
+	header, err := stdout.ReadString('\n')
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read cat-file header: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return "", nil, fmt.Errorf("%s: %w", name, ErrObjectNotFound)
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed cat-file header %q", strings.TrimSpace(header))
+	}
+
+	// Contents are followed by a trailing LF
+	content := make([]byte, size+1)
+	if _, err := io.ReadFull(stdout, content); err != nil {
+		return "", nil, fmt.Errorf("failed to read object %s: %w", name, err)
+	}
+
+	return fields[1], content[:size], nil
+}
+
+// close stops the process
+func (c *catFile) close() error {
+	_ = c.stdin.Close()
+	return c.cmd.Wait()
+}
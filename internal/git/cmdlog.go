@@ -0,0 +1,213 @@
+// ABOUTME: Structured log of every git command the tool runs
+// ABOUTME: Writes one JSON record per command so a failed run can be reconstructed afterwards
+// ABOUTME: Commands are also logged through slog at debug level when a logger is set
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// maxLoggedOutput bounds the output kept per command in the log
+const maxLoggedOutput = 4096
+
+// cancelGracePeriod is how long a canceled command has to exit after being
+// interrupted before it is killed
+const cancelGracePeriod = 5 * time.Second
+
+// interrupt asks a process to stop, falling back to killing it where
+// interrupts can't be sent (Windows)
+func interrupt(process *os.Process) error {
+	if err := process.Signal(os.Interrupt); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return process.Kill()
+	}
+	return nil
+}
+
+// CommandLog records git commands as JSON lines
+type CommandLog struct {
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File
+}
+
+// CommandRecord is one line of the command log
+type CommandRecord struct {
+	Time       time.Time `json:"time"`
+	Args       []string  `json:"args"`
+	Dir        string    `json:"dir,omitempty"`
+	ExitCode   int       `json:"exitCode"`
+	DurationMS int64     `json:"durationMs"`
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// OpenCommandLog creates (or truncates) a command log at path
+func OpenCommandLog(path string) (*CommandLog, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open debug log: %w", err)
+	}
+	return &CommandLog{w: file, file: file}, nil
+}
+
+// NewCommandLog creates a command log writing to w
+func NewCommandLog(w io.Writer) *CommandLog {
+	return &CommandLog{w: w}
+}
+
+// Close closes the log file, if the log owns one
+func (l *CommandLog) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// record writes a record, ignoring write failures so logging never breaks a run
+func (l *CommandLog) record(rec CommandRecord) {
+	if l == nil {
+		return
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(line, '\n'))
+}
+
+// Cmd is a git command that is recorded in a CommandLog and logged to a
+// slog.Logger when it runs. It embeds exec.Cmd, so Dir, Env, and Stdin are
+// set as usual.
+type Cmd struct {
+	*exec.Cmd
+	ctx    context.Context
+	log    *CommandLog
+	logger *slog.Logger
+	runner CommandRunner
+}
+
+// Command creates a git command that runs in the repository and is
+// recorded in its command log, if one is set. Canceling ctx interrupts the
+// command, giving git the chance to remove its lock files, and kills it if
+// it hasn't exited shortly after.
+func (r *Repository) Command(ctx context.Context, args ...string) *Cmd {
+	cmd := exec.CommandContext(ctx, Executable(), args...)
+	cmd.Dir = r.Dir
+	cmd.Env = Environ()
+	cmd.Cancel = func() error { return interrupt(cmd.Process) }
+	cmd.WaitDelay = cancelGracePeriod
+	return &Cmd{Cmd: cmd, ctx: ctx, log: r.log, logger: r.logger, runner: r.runner}
+}
+
+// SetCommandLog records every git command run through the repository in log
+func (r *Repository) SetCommandLog(log *CommandLog) {
+	r.log = log
+}
+
+// SetLogger logs every git command run through the repository to logger at
+// debug level, with its arguments in "git-args"
+func (r *Repository) SetLogger(logger *slog.Logger) {
+	r.logger = logger
+}
+
+// recorded reports whether running the command records it anywhere
+func (c *Cmd) recorded() bool {
+	return c.log != nil || (c.logger != nil && c.logger.Enabled(c.ctx, slog.LevelDebug))
+}
+
+// Run runs the command like exec.Cmd.Run, recording it
+func (c *Cmd) Run() error {
+	if !c.recorded() {
+		return c.run()
+	}
+	// Unset streams are discarded by exec anyway; capture them for the log
+	var stdout, stderr bytes.Buffer
+	if c.Stdout == nil {
+		c.Stdout = &stdout
+	}
+	if c.Stderr == nil {
+		c.Stderr = &stderr
+	}
+	started := time.Now()
+	err := c.run()
+	c.finish(started, stdout.Bytes(), stderr.Bytes(), err)
+	return err
+}
+
+// Output runs the command like exec.Cmd.Output, recording it
+func (c *Cmd) Output() ([]byte, error) {
+	if !c.recorded() {
+		return c.output()
+	}
+	started := time.Now()
+	output, err := c.output()
+	var stderr []byte
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		stderr = exitErr.Stderr
+	}
+	c.finish(started, output, stderr, err)
+	return output, err
+}
+
+// CombinedOutput runs the command like exec.Cmd.CombinedOutput, recording it
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if !c.recorded() {
+		return c.combinedOutput()
+	}
+	started := time.Now()
+	output, err := c.combinedOutput()
+	c.finish(started, output, nil, err)
+	return output, err
+}
+
+// finish records a completed command
+func (c *Cmd) finish(started time.Time, stdout, stderr []byte, err error) {
+	rec := CommandRecord{
+		Time:       started,
+		Args:       c.Args,
+		Dir:        c.Dir,
+		DurationMS: time.Since(started).Milliseconds(),
+		Stdout:     truncate(stdout),
+		Stderr:     truncate(stderr),
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		rec.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		rec.ExitCode = -1
+		rec.Error = err.Error()
+	}
+	c.log.record(rec)
+	if c.logger != nil {
+		c.logger.LogAttrs(c.ctx, slog.LevelDebug, "git",
+			slog.Any("git-args", c.Args[1:]),
+			slog.String("dir", c.Dir),
+			slog.Int("exit-code", rec.ExitCode),
+			slog.Duration("duration", time.Since(started)),
+		)
+	}
+}
+
+// truncate bounds logged output, noting how much was dropped
+func truncate(output []byte) string {
+	if len(output) <= maxLoggedOutput {
+		return string(output)
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", output[:maxLoggedOutput], len(output)-maxLoggedOutput)
+}
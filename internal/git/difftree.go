@@ -0,0 +1,95 @@
+// ABOUTME: Long-lived git diff-tree --stdin process listing the files commits change
+// ABOUTME: Avoids a fork/exec per commit when a range is analyzed, like the cat-file process does for objects
+
+package git
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// diffTreeArgs list the files a commit changes the way git show --name-only
+// does: recursively, with renames detected, root commits against the empty
+// tree, and merges as a dense combined diff
+var diffTreeArgs = []string{"diff-tree", "--stdin", "-z", "-r", "--name-only", "--no-commit-id", "--root", "-M", "--cc"}
+
+// diffTreeEnd is written after each commit. diff-tree echoes lines that are
+// not object ids, so it marks the end of the commit's files; no path in a
+// tree starts with a slash.
+const diffTreeEnd = "/end"
+
+// diffTree is a running git diff-tree --stdin process
+type diffTree struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// startDiffTree starts git diff-tree --stdin in dir, running until ctx is
+// canceled or the process is closed
+func startDiffTree(ctx context.Context, dir string) (*diffTree, error) {
+	cmd := exec.CommandContext(ctx, Executable(), diffTreeArgs...)
+	cmd.Dir = dir
+	cmd.Env = withCLocale(Environ())
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open diff-tree stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open diff-tree stdout: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start git diff-tree: %w", err)
+	}
+
+	return &diffTree{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}, nil
+}
+
+// files lists the files the commit with the full object id hash changes
+func (d *diffTree) files(hash string) ([]string, error) {
+	if _, err := io.WriteString(d.stdin, diffTreeInput(hash)); err != nil {
+		return nil, fmt.Errorf("failed to query diff-tree: %w", err)
+	}
+	return readDiffTreeFiles(d.stdout)
+}
+
+// diffTreeInput is what diff-tree --stdin is given to list the files of hash
+func diffTreeInput(hash string) string {
+	return hash + "\n" + diffTreeEnd + "\n"
+}
+
+// readDiffTreeFiles reads the NUL-terminated paths diff-tree lists for one
+// commit, up to the echoed diffTreeEnd
+func readDiffTreeFiles(stdout *bufio.Reader) ([]string, error) {
+	var files []string
+	for {
+		next, err := stdout.Peek(1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read diff-tree output: %w", err)
+		}
+		if next[0] == '/' {
+			line, err := stdout.ReadString('\n')
+			if err != nil || line != diffTreeEnd+"\n" {
+				return nil, fmt.Errorf("unexpected diff-tree output %q", line)
+			}
+			return files, nil
+		}
+		file, err := stdout.ReadString(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read diff-tree output: %w", err)
+		}
+		files = append(files, strings.TrimSuffix(file, "\x00"))
+	}
+}
+
+// close stops the process
+func (d *diffTree) close() error {
+	_ = d.stdin.Close()
+	return d.cmd.Wait()
+}
@@ -0,0 +1,96 @@
+// ABOUTME: Controlled environment for every process the tool starts
+// ABOUTME: Drops inherited GIT_* variables that would change what our git commands do, keeping those that locate and reach the repository
+
+package git
+
+import (
+	"os"
+	"slices"
+	"strings"
+)
+
+// inheritedVars are the GIT_* variables passed on to child processes. They
+// say where the repository is, how to reach remotes, and how to trace git,
+// none of which we set ourselves.
+var inheritedVars = map[string]bool{
+	"GIT_DIR":                          true,
+	"GIT_WORK_TREE":                    true,
+	"GIT_COMMON_DIR":                   true,
+	"GIT_OBJECT_DIRECTORY":             true,
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES": true,
+	"GIT_CEILING_DIRECTORIES":          true,
+	"GIT_DISCOVERY_ACROSS_FILESYSTEM":  true,
+	"GIT_NO_REPLACE_OBJECTS":           true,
+	"GIT_EXEC_PATH":                    true,
+	"GIT_CONFIG_GLOBAL":                true,
+	"GIT_CONFIG_SYSTEM":                true,
+	"GIT_CONFIG_NOSYSTEM":              true,
+	"GIT_CONFIG_COUNT":                 true,
+	"GIT_CONFIG_PARAMETERS":            true,
+	"GIT_SSH":                          true,
+	"GIT_SSH_COMMAND":                  true,
+	"GIT_SSH_VARIANT":                  true,
+	"GIT_ASKPASS":                      true,
+	"GIT_TERMINAL_PROMPT":              true,
+	"GIT_PROXY_COMMAND":                true,
+	"GIT_ALLOW_PROTOCOL":               true,
+	"GIT_SSL_NO_VERIFY":                true,
+	"GIT_SSL_CAINFO":                   true,
+	"GIT_SSL_CAPATH":                   true,
+	"GIT_HTTP_USER_AGENT":              true,
+	"GIT_CURL_VERBOSE":                 true,
+	"GIT_REDACT_COOKIES":               true,
+	"GIT_COMMITTER_NAME":               true,
+	"GIT_COMMITTER_EMAIL":              true,
+	"GIT_COMMITTER_DATE":               true,
+}
+
+// inheritedPrefixes are the prefixes of further GIT_* variables passed on
+var inheritedPrefixes = []string{"GIT_CONFIG_KEY_", "GIT_CONFIG_VALUE_", "GIT_TRACE", "GIT_LFS_"}
+
+// cLocale has git print untranslated messages in the format we parse,
+// whatever the user's language. Hooks and user commands, which get
+// Environ, keep the user's locale.
+var cLocale = []string{"LC_ALL=C", "LANG=C"}
+
+// withCLocale returns env, or Environ if it is nil, set to the C locale for
+// a git command. Later entries win, so any locale in env is overridden.
+func withCLocale(env []string) []string {
+	if env == nil {
+		env = Environ()
+	}
+	return append(slices.Clip(env), cLocale...)
+}
+
+// Environ returns our environment for a child process: everything but the
+// GIT_* variables that would change what our git commands do, such as
+// GIT_INDEX_FILE, GIT_EDITOR, GIT_SEQUENCE_EDITOR, or GIT_AUTHOR_NAME. The
+// commands that need one of those set it themselves.
+func Environ() []string {
+	return FilterEnv(os.Environ())
+}
+
+// FilterEnv returns env without the GIT_* variables Environ drops
+func FilterEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		if inherited(name) {
+			filtered = append(filtered, variable)
+		}
+	}
+	return filtered
+}
+
+// inherited reports whether the variable name is passed on to child processes
+func inherited(name string) bool {
+	if !strings.HasPrefix(name, "GIT_") || inheritedVars[name] {
+		return true
+	}
+	for _, prefix := range inheritedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
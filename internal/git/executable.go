@@ -0,0 +1,56 @@
+// ABOUTME: Selects the git binary every git command runs
+// ABOUTME: An explicitly chosen binary wins, then the one in GIT_EXEC_PATH, then git from PATH
+
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	executableMu sync.Mutex
+	executable   string
+)
+
+// SetExecutable makes every following git command run path, which may be a
+// path to the binary or a name looked up in PATH. It fails if there is no
+// such executable.
+func SetExecutable(path string) error {
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return fmt.Errorf("git executable %q not found: %w", path, err)
+	}
+	// Commands run with their own working directory, so a relative path
+	// would find a different binary, or none
+	if resolved, err = filepath.Abs(resolved); err != nil {
+		return fmt.Errorf("failed to resolve git executable %q: %w", path, err)
+	}
+
+	executableMu.Lock()
+	defer executableMu.Unlock()
+	executable = resolved
+	return nil
+}
+
+// Executable returns the git binary commands run: the one given to
+// SetExecutable, or else the git in GIT_EXEC_PATH, so that the binary and
+// the programs it runs from there come from the same release, or else git
+// from PATH
+func Executable() string {
+	executableMu.Lock()
+	defer executableMu.Unlock()
+	if executable != "" {
+		return executable
+	}
+	if execPath := os.Getenv("GIT_EXEC_PATH"); execPath != "" {
+		// LookPath adds .exe on Windows
+		if path, err := exec.LookPath(filepath.Join(execPath, "git")); err == nil {
+			return path
+		}
+	}
+	return "git"
+}
@@ -5,12 +5,26 @@
 package git
 
 import (
-	"os/exec"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
 )
 
 // Repository represents a git repository
 type Repository struct {
 	Dir string
+
+	mu      sync.Mutex
+	batches processPool[*catFile]
+	diffs   processPool[*diffTree]
+	version *Version
+	log     *CommandLog
+	logger  *slog.Logger
+	runner  CommandRunner
+	tempDir string
 }
 
 // NewRepository creates a new repository instance
@@ -19,21 +33,188 @@ func NewRepository(dir string) *Repository {
 }
 
 // RunGit executes a git command in the repository
-func (r *Repository) RunGit(args ...string) error {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = r.Dir
-	return cmd.Run()
+func (r *Repository) RunGit(ctx context.Context, args ...string) error {
+	return r.Command(ctx, args...).Run()
 }
 
 // GitOutput executes a git command and returns its output
-func (r *Repository) GitOutput(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
-	cmd.Dir = r.Dir
-
-	output, err := cmd.Output()
+func (r *Repository) GitOutput(ctx context.Context, args ...string) (string, error) {
+	output, err := r.Command(ctx, args...).Output()
 	if err != nil {
 		return "", err
 	}
 
 	return string(output), nil
 }
+
+// RevList returns the commits in from..to, oldest first, in the topological
+// order git rebase replays them in
+func (r *Repository) RevList(ctx context.Context, from, to string) ([]string, error) {
+	output, err := r.GitOutput(ctx, "rev-list", "--reverse", "--topo-order", from+".."+to)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(output), nil
+}
+
+// ReadCommit returns the metadata and changed files of a commit
+func (r *Repository) ReadCommit(ctx context.Context, hash string) (Commit, error) {
+	commit, err := r.CatCommit(ctx, hash)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	files, err := r.ChangedFiles(ctx, hash)
+	if err != nil {
+		return Commit{}, fmt.Errorf("failed to get commit files: %w", err)
+	}
+	commit.Files = files
+
+	return commit, nil
+}
+
+// ChangedFiles lists the files a commit changes, as git show --name-only
+// would, using a long-lived git diff-tree --stdin process. Like ReadObject's
+// processes, one is started per concurrent query and tied to the context of
+// the query that started it.
+func (r *Repository) ChangedFiles(ctx context.Context, rev string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	// diff-tree --stdin only takes full object ids
+	hash := rev
+	if !isObjectID(rev) {
+		var err error
+		if hash, err = r.ResolveCommit(ctx, rev); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	runner := r.runner
+	r.mu.Unlock()
+	if runner != nil {
+		return r.changedFilesOnce(ctx, hash)
+	}
+
+	diffs, err := r.diffs.get(func() (*diffTree, error) { return startDiffTree(ctx, r.Dir) })
+	if err != nil {
+		return nil, err
+	}
+	files, err := diffs.files(hash)
+	if err != nil {
+		// The stream is out of sync; a new process answers the next query
+		_ = diffs.close()
+		return nil, err
+	}
+	r.diffs.put(diffs)
+	return files, nil
+}
+
+// isObjectID reports whether s is a full SHA-1 or SHA-256 object id
+func isObjectID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	return strings.Trim(s, "0123456789abcdef") == ""
+}
+
+// SplitNul splits the output of a git command run with -z into its
+// NUL-terminated records. Paths in it are neither quoted nor escaped.
+func SplitNul(output string) []string {
+	var records []string
+	for _, record := range strings.Split(output, "\x00") {
+		if record != "" {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// ReadObject returns the type and contents of an object using a long-lived
+// git cat-file --batch process. Concurrent queries each get a process of
+// their own from a pool. A process is tied to the context of the query that
+// started it, and replaced once that is canceled.
+func (r *Repository) ReadObject(ctx context.Context, name string) (string, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	r.mu.Lock()
+	runner := r.runner
+	r.mu.Unlock()
+	if runner != nil {
+		return r.readObjectOnce(ctx, name)
+	}
+
+	batch, err := r.batches.get(func() (*catFile, error) { return startCatFile(ctx, r.Dir) })
+	if err != nil {
+		return "", nil, err
+	}
+	typ, content, err := batch.object(name)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		// The stream is out of sync; a new process answers the next query
+		_ = batch.close()
+		return "", nil, err
+	}
+	r.batches.put(batch)
+	return typ, content, err
+}
+
+// CatCommit reads a commit object and parses its metadata
+func (r *Repository) CatCommit(ctx context.Context, hash string) (Commit, error) {
+	typ, content, err := r.ReadObject(ctx, hash)
+	if err != nil {
+		return Commit{}, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	if typ != "commit" {
+		return Commit{}, fmt.Errorf("object %s is a %s, not a commit", hash, typ)
+	}
+	return ParseCommit(hash, content), nil
+}
+
+// Close stops any long-lived git processes
+func (r *Repository) Close() error {
+	return errors.Join(r.batches.close(), r.diffs.close())
+}
+
+// ParseCommit parses a raw commit object into its metadata
+func ParseCommit(hash string, raw []byte) Commit {
+	header, message, _ := strings.Cut(string(raw), "\n\n")
+	commit := Commit{Hash: hash, Message: strings.TrimSpace(message), Parents: []string{}}
+
+	for _, line := range strings.Split(header, "\n") {
+		if parent, ok := strings.CutPrefix(line, "parent "); ok {
+			commit.Parents = append(commit.Parents, parent)
+		}
+		if author, ok := strings.CutPrefix(line, "author "); ok {
+			// Drop the trailing timestamp and timezone
+			if end := strings.LastIndex(author, ">"); end >= 0 {
+				commit.Author = author[:end+1]
+			}
+		}
+	}
+
+	return commit
+}
+
+// ListTree returns every non-directory entry in the tree of a revision
+func (r *Repository) ListTree(ctx context.Context, rev string) ([]TreeEntry, error) {
+	output, err := r.GitOutput(ctx, "ls-tree", "-r", "-z", "--full-tree", rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TreeEntry
+	for _, record := range strings.Split(output, "\x00") {
+		// Format: <mode> SP <type> SP <object> TAB <path>
+		info, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(info)
+		if len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, TreeEntry{Mode: fields[0], OID: fields[2], Path: path})
+	}
+	return entries, nil
+}
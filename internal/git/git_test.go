@@ -0,0 +1,438 @@
+// ABOUTME: Tests for git repository operations
+// ABOUTME: Covers the long-lived cat-file and diff-tree processes, commit parsing, the go-git reads, and the rewrite backend
+
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/obra/git-rebase-extract-file/internal/testutils"
+)
+
+func TestReadObject_ReusesBatchProcess(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	first := repo.Commit("Initial commit")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	second := repo.Commit("Add main function\n\nWith a body")
+
+	r := NewRepository(repo.Dir)
+	defer r.Close()
+
+	commit, err := r.CatCommit(t.Context(), second)
+	if err != nil {
+		t.Fatalf("CatCommit failed: %v", err)
+	}
+	if commit.Message != "Add main function\n\nWith a body" {
+		t.Errorf("Unexpected message %q", commit.Message)
+	}
+	if commit.Author != "Test User <test@example.com>" {
+		t.Errorf("Unexpected author %q", commit.Author)
+	}
+	if len(commit.Parents) != 1 || commit.Parents[0] != first {
+		t.Errorf("Expected parent %s, got %v", first, commit.Parents)
+	}
+	batch := r.batches.idle[0]
+
+	// A missing object is reported without breaking the stream
+	if _, _, err := r.ReadObject(t.Context(), strings.Repeat("0", 40)); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+
+	typ, content, err := r.ReadObject(t.Context(), second+":main.go")
+	if err != nil {
+		t.Fatalf("ReadObject failed: %v", err)
+	}
+	if typ != "blob" || string(content) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("Unexpected object %s %q", typ, string(content))
+	}
+	if r.batches.size() != 1 || r.batches.idle[0] != batch {
+		t.Error("Expected all queries to share one cat-file process")
+	}
+}
+
+func TestReadObject_BusyProcessDoesNotBlock(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+	repo.WriteFile("main.go", "package main\n")
+	commit := repo.Commit("Initial commit")
+
+	r := NewRepository(repo.Dir)
+	defer r.Close()
+	if _, err := r.CatCommit(t.Context(), commit); err != nil {
+		t.Fatalf("CatCommit failed: %v", err)
+	}
+
+	// Another worker holds the only process, so this query starts its own
+	busy, err := r.batches.get(nil)
+	if err != nil {
+		t.Fatalf("Failed to take the idle process: %v", err)
+	}
+	if _, err := r.CatCommit(t.Context(), commit); err != nil {
+		t.Fatalf("CatCommit failed: %v", err)
+	}
+	r.batches.put(busy)
+	if size := r.batches.size(); size != 2 {
+		t.Errorf("Expected a process per concurrent query, got %d", size)
+	}
+}
+
+func TestChangedFiles_ReusesDiffTreeProcess(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("a file.txt", "a\n")
+	repo.WriteFile("dir/nested.txt", "nested\n")
+	root := repo.Commit("Initial commit")
+	repo.Rename("a file.txt", "renamed.txt")
+	renamed := repo.Commit("Rename a file")
+	repo.Branch("side", root)
+	repo.WriteFile("side.txt", "side\n")
+	repo.Commit("Add side")
+	repo.Git("checkout", "-q", "master")
+	merge := repo.Merge("Merge side", "side")
+
+	r := NewRepository(repo.Dir)
+	defer r.Close()
+
+	tests := []struct {
+		rev  string
+		want []string
+	}{
+		{rev: root, want: []string{"a file.txt", "dir/nested.txt"}},
+		{rev: renamed, want: []string{"renamed.txt"}},
+		// A clean merge resolved nothing, as with git show
+		{rev: merge, want: nil},
+		// Other revisions are resolved to the object ids diff-tree takes
+		{rev: "HEAD^2", want: []string{"side.txt"}},
+	}
+	var diffs *diffTree
+	for _, tt := range tests {
+		files, err := r.ChangedFiles(t.Context(), tt.rev)
+		if err != nil {
+			t.Fatalf("ChangedFiles(%s) failed: %v", tt.rev, err)
+		}
+		if !slices.Equal(files, tt.want) {
+			t.Errorf("ChangedFiles(%s) = %q, want %q", tt.rev, files, tt.want)
+		}
+		if diffs == nil {
+			diffs = r.diffs.idle[0]
+		}
+		if r.diffs.size() != 1 || r.diffs.idle[0] != diffs {
+			t.Error("Expected all queries to share one diff-tree process")
+		}
+	}
+}
+
+func TestGoGit_ReadsLikeExec(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("a file.txt", "a\nb\nc\n")
+	repo.WriteFile("shared.txt", "shared\n")
+	repo.WriteBinaryFile("image.bin", 64, 3)
+	root := repo.Commit("Initial commit")
+	repo.Rename("a file.txt", "dir/renamed.txt")
+	repo.WriteFile("dir/renamed.txt", "a\nb\nc\nd\n")
+	repo.WriteBinaryFile("image.bin", 96, 5)
+	renamed := repo.Commit("Rename a file")
+	repo.Tag("v1", renamed, "Release")
+
+	repo.Branch("side", root)
+	repo.WriteFile("side.txt", "side\n")
+	repo.Commit("Add side")
+	repo.Git("checkout", "-q", "master")
+	// The merge itself changes shared.txt, which differs from both parents,
+	// while side.txt only differs from the first
+	repo.Git("merge", "-q", "--no-ff", "--no-commit", "side")
+	repo.WriteFile("shared.txt", "resolved\n")
+	merge := repo.Commit("Merge side")
+
+	exec := NewRepository(repo.Dir)
+	defer exec.Close()
+	goGit, err := OpenGoGit(repo.Dir)
+	if err != nil {
+		t.Fatalf("OpenGoGit failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		read func(Backend) (any, error)
+	}{
+		{"ReadCommit root", func(b Backend) (any, error) { return b.ReadCommit(t.Context(), root) }},
+		{"ReadCommit rename", func(b Backend) (any, error) { return b.ReadCommit(t.Context(), renamed) }},
+		{"ReadCommit merge", func(b Backend) (any, error) { return b.ReadCommit(t.Context(), merge) }},
+		{"CatCommit", func(b Backend) (any, error) { return b.CatCommit(t.Context(), merge) }},
+		{"ResolveCommit", func(b Backend) (any, error) { return b.ResolveCommit(t.Context(), "v1") }},
+		{"Renames", func(b Backend) (any, error) { return b.Renames(t.Context(), root, "HEAD") }},
+		{"NumStat", func(b Backend) (any, error) { return b.NumStat(t.Context(), root, renamed) }},
+		{"NumStat root", func(b Backend) (any, error) { return b.NumStat(t.Context(), "", root) }},
+		{"BlobSize", func(b Backend) (any, error) { return b.BlobSize(t.Context(), renamed, "image.bin") }},
+		{"CurrentBranch", func(b Backend) (any, error) { return b.CurrentBranch(t.Context()) }},
+		{"RefsContaining", func(b Backend) (any, error) { return b.RefsContaining(t.Context(), renamed) }},
+		{"Config", func(b Backend) (any, error) { return b.Config(t.Context(), "user.email") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tt.read(exec)
+			if err != nil {
+				t.Fatalf("exec failed: %v", err)
+			}
+			got, err := tt.read(goGit)
+			if err != nil {
+				t.Fatalf("go-git failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("go-git read %+v, exec %+v", got, want)
+			}
+		})
+	}
+
+	// Both tell a revision that isn't a commit from one that doesn't exist
+	for _, backend := range []Backend{exec, goGit} {
+		if _, err := backend.ResolveCommit(t.Context(), repo.Git("rev-parse", "HEAD^{tree}")); !errors.Is(err, ErrNotCommit) {
+			t.Errorf("%T: expected ErrNotCommit for a tree, got %v", backend, err)
+		}
+		if _, err := backend.ResolveCommit(t.Context(), "missing"); err == nil || errors.Is(err, ErrNotCommit) {
+			t.Errorf("%T: expected a plain error for a missing revision, got %v", backend, err)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   Version
+	}{
+		{output: "git version 2.39.5\n", want: Version{2, 39, 5}},
+		{output: "git version 2.39.3 (Apple Git-146)\n", want: Version{2, 39, 3}},
+		{output: "git version 2.45.1.windows.1\n", want: Version{2, 45, 1}},
+		{output: "git version 2.46.0-rc1\n", want: Version{2, 46, 0}},
+		{output: "git version 2.38\n", want: Version{2, 38, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.output)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) failed: %v", tt.output, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+
+	if _, err := ParseVersion("hub version 2.14.2"); err == nil {
+		t.Error("Expected an error for unrecognized output")
+	}
+}
+
+func TestVersion_Require(t *testing.T) {
+	old := Version{2, 37, 1}
+	if err := old.Require(FeatureRebaseEmpty); err != nil {
+		t.Errorf("Expected git %s to support %s: %v", old, FeatureRebaseEmpty.Name, err)
+	}
+
+	err := old.Require(FeatureMergeTreeWriteTree)
+	if err == nil {
+		t.Fatal("Expected git 2.37.1 to lack merge-tree --write-tree")
+	}
+	if !strings.Contains(err.Error(), "git >= 2.38.0 is required for conflict prediction") {
+		t.Errorf("Expected an actionable error, got: %v", err)
+	}
+}
+
+// TestVersion_UnderTest checks that "make test-git-versions" really runs the
+// suite against the git it announces in GIT_REBASE_EXTRACT_TEST_GIT
+func TestVersion_UnderTest(t *testing.T) {
+	want := os.Getenv("GIT_REBASE_EXTRACT_TEST_GIT")
+	if want == "" {
+		t.Skip("GIT_REBASE_EXTRACT_TEST_GIT is only set by make test-git-versions")
+	}
+	expected, err := ParseVersion(want)
+	if err != nil {
+		t.Fatalf("Failed to parse GIT_REBASE_EXTRACT_TEST_GIT: %v", err)
+	}
+
+	version, err := NewRepository(t.TempDir()).Version(t.Context())
+	if err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	if version != expected {
+		t.Errorf("Expected the tests to run git %s, got git %s", expected, version)
+	}
+	if !version.AtLeast(MinimumVersion) {
+		t.Errorf("git %s is older than the minimum supported git %s", version, MinimumVersion)
+	}
+}
+
+func TestExecutable(t *testing.T) {
+	t.Cleanup(func() { executable = "" })
+	execPath := t.TempDir()
+	t.Setenv("GIT_EXEC_PATH", execPath)
+
+	if got := Executable(); got != "git" {
+		t.Errorf("Expected git from PATH when GIT_EXEC_PATH has no git, got %q", got)
+	}
+
+	// The git of GIT_EXEC_PATH is preferred over the one in PATH
+	fake := filepath.Join(execPath, "git")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho git version 2.99.1\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake git: %v", err)
+	}
+	if got := Executable(); got != fake {
+		t.Errorf("Expected %q, got %q", fake, got)
+	}
+	version, err := NewRepository(t.TempDir()).Version(t.Context())
+	if err != nil {
+		t.Fatalf("Version failed: %v", err)
+	}
+	if version != (Version{2, 99, 1}) {
+		t.Errorf("Expected the version of the fake git, got %s", version)
+	}
+
+	// An explicit choice wins, and is resolved to an absolute path
+	if err := SetExecutable("git"); err != nil {
+		t.Fatalf("SetExecutable failed: %v", err)
+	}
+	if got := Executable(); got == fake || !filepath.IsAbs(got) {
+		t.Errorf("Expected the absolute path of git from PATH, got %q", got)
+	}
+	if err := SetExecutable(filepath.Join(execPath, "missing")); err == nil {
+		t.Error("Expected an error for a missing git executable")
+	}
+}
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/me",
+		"GIT_DIR=/repo/.git",
+		"GIT_WORK_TREE=/repo",
+		"GIT_SSH_COMMAND=ssh -i key",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=core.editor",
+		"GIT_CONFIG_VALUE_0=vi",
+		"GIT_TRACE2_EVENT=/tmp/trace",
+		"GIT_COMMITTER_DATE=2024-01-01T00:00:00Z",
+		"GIT_INDEX_FILE=/tmp/other-index",
+		"GIT_EDITOR=false",
+		"GIT_SEQUENCE_EDITOR=false",
+		"GIT_AUTHOR_NAME=Someone Else",
+		"GIT_REFLOG_ACTION=rebase",
+	}
+	want := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/me",
+		"GIT_DIR=/repo/.git",
+		"GIT_WORK_TREE=/repo",
+		"GIT_SSH_COMMAND=ssh -i key",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=core.editor",
+		"GIT_CONFIG_VALUE_0=vi",
+		"GIT_TRACE2_EVENT=/tmp/trace",
+		"GIT_COMMITTER_DATE=2024-01-01T00:00:00Z",
+	}
+	if got := FilterEnv(env); !slices.Equal(got, want) {
+		t.Errorf("FilterEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestCommand_RunsInCLocale(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+	repo.WriteFile("main.go", "package main\n")
+	repo.Commit("Initial commit")
+
+	// LANGUAGE picks git's translations in any locale but C
+	t.Setenv("LC_ALL", "C.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	t.Setenv("LANGUAGE", "de")
+
+	output, err := NewRepository(repo.Dir).Command(t.Context(), "checkout", "no-such-path").CombinedOutput()
+	if err == nil {
+		t.Fatal("Expected checkout of a missing path to fail")
+	}
+	if !strings.Contains(string(output), "did not match any file(s) known to git") {
+		t.Errorf("Expected git's untranslated message, got: %s", output)
+	}
+}
+
+func TestCommandLog_RecordsCommands(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	head := repo.Commit("Initial commit")
+
+	var buf bytes.Buffer
+	r := NewRepository(repo.Dir)
+	r.SetCommandLog(NewCommandLog(&buf))
+
+	if _, err := r.GitOutput(t.Context(), "rev-parse", "HEAD"); err != nil {
+		t.Fatalf("GitOutput failed: %v", err)
+	}
+	if err := r.RunGit(t.Context(), "rev-parse", "--verify", "missing"); err == nil {
+		t.Fatal("Expected rev-parse of a missing ref to fail")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 records, got %d:\n%s", len(lines), buf.String())
+	}
+	var ok, failed CommandRecord
+	if err := json.Unmarshal([]byte(lines[0]), &ok); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+
+	if strings.Join(ok.Args, " ") != "git rev-parse HEAD" || ok.ExitCode != 0 || ok.Stdout != head+"\n" {
+		t.Errorf("Unexpected record for successful command: %+v", ok)
+	}
+	if failed.ExitCode == 0 || failed.Stderr == "" {
+		t.Errorf("Expected exit code and stderr for failed command, got %+v", failed)
+	}
+}
+
+func TestStatusAndStage(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("old.txt", "old\n")
+	repo.WriteFile("keep.txt", "keep\n")
+	base := repo.Commit("Initial commit")
+
+	repo.Git("mv", "old.txt", "new.txt")
+	repo.WriteFile("untracked.txt", "new\n")
+
+	r := NewRepository(repo.Dir)
+	defer r.Close()
+
+	entries, err := r.Status(t.Context())
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	want := []StatusEntry{{XY: "R ", Path: "new.txt", Orig: "old.txt"}, {XY: "??", Path: "untracked.txt"}}
+	if len(entries) != len(want) || entries[0] != want[0] || entries[1] != want[1] || !entries[1].Untracked() {
+		t.Errorf("Unexpected status %+v, want %+v", entries, want)
+	}
+
+	// Stage one path over the base and drop another, leaving the index alone
+	entriesBefore := repo.Git("ls-files", "-s")
+	keep := strings.Fields(repo.Git("ls-tree", base, "keep.txt"))[2]
+	tree, err := r.Stage(t.Context(), base, []TreeEntry{{Mode: "100755", OID: keep, Path: "bin/tool"}, {Path: "old.txt"}})
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if listing := repo.Git("ls-tree", "-r", "--name-only", tree); listing != "bin/tool\nkeep.txt" {
+		t.Errorf("Unexpected staged tree:\n%s", listing)
+	}
+	if after := repo.Git("ls-files", "-s"); after != entriesBefore {
+		t.Errorf("Expected the index to be untouched, got:\n%s", after)
+	}
+}
@@ -0,0 +1,514 @@
+// ABOUTME: In-process read-side backend built on go-git
+// ABOUTME: Serves analysis and dry runs without spawning git processes
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	format "github.com/go-git/go-git/v5/plumbing/format/config"
+	"github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// GoGitRepository implements Backend using go-git
+type GoGitRepository struct {
+	repo *gogit.Repository
+}
+
+// OpenGoGit opens the repository containing dir with go-git, or the one
+// GIT_DIR names, as git would
+func OpenGoGit(dir string) (*GoGitRepository, error) {
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+		// go-git opens a directory without a .git inside as a bare repository
+		dir = gitDir
+	}
+	repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+	return &GoGitRepository{repo: repo}, nil
+}
+
+// WorkTree returns the top of the working tree
+func (g *GoGitRepository) WorkTree() (string, error) {
+	worktree, err := g.repo.Worktree()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the working tree: %w", err)
+	}
+	return worktree.Filesystem.Root(), nil
+}
+
+// RevList returns the commits in from..to, oldest first, parents before children
+func (g *GoGitRepository) RevList(ctx context.Context, from, to string) ([]string, error) {
+	fromCommit, err := g.resolve(from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := g.resolve(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Everything reachable from the base is excluded
+	hidden := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(fromCommit, nil, nil).ForEach(func(c *object.Commit) error {
+		hidden[c.Hash] = true
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk history of %s: %w", from, err)
+	}
+
+	// Iterative post-order walk so parents are emitted before their children
+	type frame struct {
+		commit   *object.Commit
+		expanded bool
+	}
+	var hashes []string
+	visited := make(map[plumbing.Hash]bool)
+	stack := []frame{{commit: toCommit}}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.expanded {
+			hashes = append(hashes, top.commit.Hash.String())
+			continue
+		}
+		if hidden[top.commit.Hash] || visited[top.commit.Hash] {
+			continue
+		}
+		visited[top.commit.Hash] = true
+		stack = append(stack, frame{commit: top.commit, expanded: true})
+
+		// Push parents in reverse so the first parent is visited first
+		for i := len(top.commit.ParentHashes) - 1; i >= 0; i-- {
+			parent, err := g.repo.CommitObject(top.commit.ParentHashes[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to read commit %s: %w", top.commit.ParentHashes[i], err)
+			}
+			stack = append(stack, frame{commit: parent})
+		}
+	}
+
+	return hashes, nil
+}
+
+// ReadCommit returns the metadata and changed files of a commit
+func (g *GoGitRepository) ReadCommit(ctx context.Context, hash string) (Commit, error) {
+	commit, err := g.resolve(hash)
+	if err != nil {
+		return Commit{}, err
+	}
+	files, err := g.changedFiles(ctx, commit)
+	if err != nil {
+		return Commit{}, err
+	}
+
+	metadata := commitMetadata(commit)
+	metadata.Files = files
+	return metadata, nil
+}
+
+// CatCommit returns the metadata of a commit, without its files
+func (g *GoGitRepository) CatCommit(ctx context.Context, hash string) (Commit, error) {
+	commit, err := g.resolve(hash)
+	if err != nil {
+		return Commit{}, err
+	}
+	return commitMetadata(commit), nil
+}
+
+// commitMetadata returns what ParseCommit reads from a commit object
+func commitMetadata(commit *object.Commit) Commit {
+	parents := make([]string, 0, len(commit.ParentHashes))
+	for _, parent := range commit.ParentHashes {
+		parents = append(parents, parent.String())
+	}
+	return Commit{
+		Hash:    commit.Hash.String(),
+		Message: strings.TrimSpace(commit.Message),
+		Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Parents: parents,
+	}
+}
+
+// renameOptions detect renames with git's default similarity of 50%
+var renameOptions = &object.DiffTreeOptions{DetectRenames: true, RenameScore: 50}
+
+// changedFiles lists the files a commit changes following the rules of
+// diffTreeArgs: a root commit is diffed against the empty tree, a rename is
+// listed by its new name, and a merge only lists the files that differ from
+// every parent, as a combined diff does
+func (g *GoGitRepository) changedFiles(ctx context.Context, commit *object.Commit) ([]string, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of %s: %w", commit.Hash, err)
+	}
+	parentTrees := []*object.Tree{{}}
+	if commit.NumParents() > 0 {
+		parentTrees = nil
+		for i := 0; i < commit.NumParents(); i++ {
+			parent, err := commit.Parent(i)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read parent of %s: %w", commit.Hash, err)
+			}
+			parentTree, err := parent.Tree()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read parent tree of %s: %w", commit.Hash, err)
+			}
+			parentTrees = append(parentTrees, parentTree)
+		}
+	}
+
+	// counts holds how many of the parents each file differs from
+	counts := make(map[string]int)
+	for _, parentTree := range parentTrees {
+		changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, renameOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff commit %s: %w", commit.Hash, err)
+		}
+		for _, change := range changes {
+			name := change.To.Name
+			if name == "" {
+				name = change.From.Name
+			}
+			counts[name]++
+		}
+	}
+	var files []string
+	for name, count := range counts {
+		if count == len(parentTrees) {
+			files = append(files, name)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ListTree returns every non-directory entry in the tree of a revision
+func (g *GoGitRepository) ListTree(ctx context.Context, rev string) ([]TreeEntry, error) {
+	commit, err := g.resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of %s: %w", rev, err)
+	}
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	var entries []TreeEntry
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk tree of %s: %w", rev, err)
+		}
+		if entry.Mode == filemode.Dir {
+			continue
+		}
+		entries = append(entries, TreeEntry{
+			Mode: fmt.Sprintf("%06o", uint32(entry.Mode)),
+			OID:  entry.Hash.String(),
+			Path: name,
+		})
+	}
+	return entries, nil
+}
+
+// ResolveCommit returns the full hash of the commit rev names
+func (g *GoGitRepository) ResolveCommit(ctx context.Context, rev string) (string, error) {
+	commit, err := g.resolve(rev)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// Renames returns the file renames of the commits in from..to, oldest first.
+// Like git log, it leaves out merges, which have no single diff to look in.
+func (g *GoGitRepository) Renames(ctx context.Context, from, to string) ([]Rename, error) {
+	hashes, err := g.RevList(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var renames []Rename
+	for _, hash := range hashes {
+		commit, err := g.repo.CommitObject(plumbing.NewHash(hash))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		if commit.NumParents() != 1 {
+			continue
+		}
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parent of %s: %w", hash, err)
+		}
+		changes, err := g.diffCommits(ctx, parent, commit, renameOptions)
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			if change.From.Name != "" && change.To.Name != "" && change.From.Name != change.To.Name {
+				renames = append(renames, Rename{From: change.From.Name, To: change.To.Name})
+			}
+		}
+	}
+	return renames, nil
+}
+
+// NumStat returns the lines added and removed per file between two revisions
+func (g *GoGitRepository) NumStat(ctx context.Context, from, to string) ([]FileStat, error) {
+	toCommit, err := g.resolve(to)
+	if err != nil {
+		return nil, err
+	}
+	var fromCommit *object.Commit
+	if from != "" {
+		if fromCommit, err = g.resolve(from); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := g.diffCommits(ctx, fromCommit, toCommit, nil)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := changes.PatchContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s: %w", to, err)
+	}
+
+	var stats []FileStat
+	for _, filePatch := range patch.FilePatches() {
+		fromFile, toFile := filePatch.Files()
+		var stat FileStat
+		switch {
+		case toFile != nil:
+			stat.Path = toFile.Path()
+		case fromFile != nil:
+			stat.Path = fromFile.Path()
+		default:
+			continue
+		}
+		if filePatch.IsBinary() {
+			stat.Binary = true
+			stats = append(stats, stat)
+			continue
+		}
+		for _, chunk := range filePatch.Chunks() {
+			lines := strings.Count(chunk.Content(), "\n")
+			// The last line of a file may lack its newline
+			if content := chunk.Content(); content != "" && !strings.HasSuffix(content, "\n") {
+				lines++
+			}
+			switch chunk.Type() {
+			case diff.Add:
+				stat.Insertions += lines
+			case diff.Delete:
+				stat.Deletions += lines
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// diffCommits diffs the trees of two commits, from the empty tree when from
+// is nil, detecting renames if options ask for it
+func (g *GoGitRepository) diffCommits(ctx context.Context, from, to *object.Commit, options *object.DiffTreeOptions) (object.Changes, error) {
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of %s: %w", to.Hash, err)
+	}
+	fromTree := &object.Tree{}
+	if from != nil {
+		if fromTree, err = from.Tree(); err != nil {
+			return nil, fmt.Errorf("failed to read tree of %s: %w", from.Hash, err)
+		}
+	}
+	if options == nil {
+		options = &object.DiffTreeOptions{}
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, fromTree, toTree, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s: %w", to.Hash, err)
+	}
+	return changes, nil
+}
+
+// BlobSize returns the size of path in the tree of rev
+func (g *GoGitRepository) BlobSize(ctx context.Context, rev, path string) (int64, error) {
+	commit, err := g.resolve(rev)
+	if err != nil {
+		return 0, err
+	}
+	file, err := commit.File(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the size of %s in %s: %w", path, rev, err)
+	}
+	return file.Size, nil
+}
+
+// CurrentBranch returns the short name of the branch HEAD points at, or ""
+// when HEAD is detached
+func (g *GoGitRepository) CurrentBranch(ctx context.Context) (string, error) {
+	head, err := g.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	if head.Type() != plumbing.SymbolicReference {
+		return "", nil
+	}
+	return head.Target().Short(), nil
+}
+
+// RefsContaining returns the full names of the refs whose history includes
+// the commit hash, sorted
+func (g *GoGitRepository) RefsContaining(ctx context.Context, hash string) ([]string, error) {
+	target, err := g.resolve(hash)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := g.repo.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	var names []string
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := ref.Name()
+		if !strings.HasPrefix(name.String(), "refs/") {
+			return nil
+		}
+		// Refs that point at trees or blobs, or at nothing, contain no commits
+		commit, err := g.resolve(name.String())
+		if err != nil {
+			return nil
+		}
+		contains := commit.Hash == target.Hash
+		if !contains {
+			if contains, err = target.IsAncestor(commit); err != nil {
+				return fmt.Errorf("failed to walk history of %s: %w", name, err)
+			}
+		}
+		if contains {
+			names = append(names, name.String())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Config returns the value of a config key, failing if it isn't set. The
+// repository's own config takes precedence over the user's, and the user's
+// over the system's.
+func (g *GoGitRepository) Config(ctx context.Context, key string) (string, error) {
+	local, err := g.repo.Config()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	scopes := []*config.Config{local}
+	for _, scope := range []config.Scope{config.GlobalScope, config.SystemScope} {
+		cfg, err := config.LoadConfig(scope)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		scopes = append(scopes, cfg)
+	}
+	for _, cfg := range scopes {
+		if value, ok := configOption(cfg.Raw, key); ok {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("failed to read %s: not set", key)
+}
+
+// configOption looks up a key of the form section.name or
+// section.subsection.name
+func configOption(raw *format.Config, key string) (string, bool) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first < 0 || !raw.HasSection(key[:first]) {
+		return "", false
+	}
+	section := raw.Section(key[:first])
+	name := key[last+1:]
+	if first == last {
+		return section.Option(name), section.HasOption(name)
+	}
+	subsection := key[first+1 : last]
+	if !section.HasSubsection(subsection) {
+		return "", false
+	}
+	return section.Subsection(subsection).Option(name), section.Subsection(subsection).HasOption(name)
+}
+
+// resolve resolves a revision expression to a commit
+func (g *GoGitRepository) resolve(rev string) (*object.Commit, error) {
+	hash, err := g.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		if g.namesObject(rev) {
+			return nil, fmt.Errorf("revision %s is %w", rev, ErrNotCommit)
+		}
+		return nil, fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+	commit, err := g.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", rev, err)
+	}
+	return commit, nil
+}
+
+// namesObject reports whether rev is the id or the ref of an object.
+// ResolveRevision only resolves to commits, so it can't tell a ref to a
+// tree or blob from one that doesn't exist.
+func (g *GoGitRepository) namesObject(rev string) bool {
+	if plumbing.IsHash(rev) {
+		return g.repo.Storer.HasEncodedObject(plumbing.NewHash(rev)) == nil
+	}
+	// The places git looks for a ref, in the order it looks
+	for _, format := range []string{"%s", "refs/%s", "refs/tags/%s", "refs/heads/%s", "refs/remotes/%s", "refs/remotes/%s/HEAD"} {
+		if _, err := g.repo.Reference(plumbing.ReferenceName(fmt.Sprintf(format, rev)), true); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+var _ Backend = (*GoGitRepository)(nil)
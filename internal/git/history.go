@@ -0,0 +1,122 @@
+// ABOUTME: Read-side Backend queries for Repository beyond listing commits and trees
+// ABOUTME: Revision lookup, renames, diffstats, blob sizes, branches, refs, and config, each one git command
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ResolveCommit returns the full hash of the commit rev names
+func (r *Repository) ResolveCommit(ctx context.Context, rev string) (string, error) {
+	output, err := r.GitOutput(ctx, "rev-parse", "--verify", rev+"^{commit}")
+	if err != nil {
+		if _, objectErr := r.GitOutput(ctx, "rev-parse", "--verify", "--quiet", rev); objectErr == nil {
+			return "", fmt.Errorf("revision %s is %w", rev, ErrNotCommit)
+		}
+		return "", fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Renames returns the file renames of the commits in from..to, oldest first
+func (r *Repository) Renames(ctx context.Context, from, to string) ([]Rename, error) {
+	output, err := r.GitOutput(ctx, "log", "--reverse", "-M", "--diff-filter=R", "--name-status", "-z", "--format=", from+".."+to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list renames in %s..%s: %w", from, to, err)
+	}
+	return ParseRenames(output), nil
+}
+
+// ParseRenames parses renames from -z --name-status output: each is a status
+// record (R and a similarity score) followed by the old and new paths
+func ParseRenames(output string) []Rename {
+	records := SplitNul(output)
+	var renames []Rename
+	for i := 0; i+2 < len(records); i++ {
+		if status := strings.TrimLeft(records[i], "\n"); strings.HasPrefix(status, "R") {
+			renames = append(renames, Rename{From: records[i+1], To: records[i+2]})
+			i += 2
+		}
+	}
+	return renames
+}
+
+// NumStat returns the lines added and removed per file between two revisions
+func (r *Repository) NumStat(ctx context.Context, from, to string) ([]FileStat, error) {
+	args := []string{"diff-tree", "-r", "-z", "--numstat", "--no-commit-id"}
+	if from == "" {
+		args = append(args, "--root", to)
+	} else {
+		args = append(args, from, to)
+	}
+	output, err := r.GitOutput(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diffstat of %s: %w", to, err)
+	}
+
+	var stats []FileStat
+	for _, record := range SplitNul(output) {
+		fields := strings.SplitN(record, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		stat := FileStat{Path: fields[2]}
+		// Binary files report "-" for both counts
+		if fields[0] == "-" && fields[1] == "-" {
+			stat.Binary = true
+		} else {
+			stat.Insertions, _ = strconv.Atoi(fields[0])
+			stat.Deletions, _ = strconv.Atoi(fields[1])
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// BlobSize returns the size of path in the tree of rev
+func (r *Repository) BlobSize(ctx context.Context, rev, path string) (int64, error) {
+	output, err := r.GitOutput(ctx, "cat-file", "-s", rev+":"+path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the size of %s in %s: %w", path, rev, err)
+	}
+	return strconv.ParseInt(strings.TrimSpace(output), 10, 64)
+}
+
+// CurrentBranch returns the short name of the branch HEAD points at, or ""
+// when HEAD is detached
+func (r *Repository) CurrentBranch(ctx context.Context) (string, error) {
+	output, err := r.GitOutput(ctx, "symbolic-ref", "-q", "--short", "HEAD")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get current branch: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// RefsContaining returns the full names of the refs whose history includes
+// the commit hash, sorted
+func (r *Repository) RefsContaining(ctx context.Context, hash string) ([]string, error) {
+	output, err := r.GitOutput(ctx, "for-each-ref", "--format=%(refname)", "--contains", hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs containing %s: %w", hash, err)
+	}
+	return strings.Fields(output), nil
+}
+
+// Config returns the value of a config key, failing if it isn't set
+func (r *Repository) Config(ctx context.Context, key string) (string, error) {
+	output, err := r.GitOutput(ctx, "config", "--get", key)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,61 @@
+// ABOUTME: Pool of long-lived git processes shared by concurrent queries
+// ABOUTME: Hands each query an idle process, starting another when all are busy, so parallel analysis isn't serialized
+
+package git
+
+import (
+	"errors"
+	"sync"
+)
+
+// process is a long-lived git process answering one query at a time
+type process interface {
+	close() error
+}
+
+// processPool holds the idle processes of one kind. It grows to the number
+// of queries run at once, one process per analysis worker.
+type processPool[P process] struct {
+	mu   sync.Mutex
+	idle []P
+}
+
+// get takes an idle process, or starts one with start if there is none
+func (p *processPool[P]) get(start func() (P, error)) (P, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		proc := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return proc, nil
+	}
+	p.mu.Unlock()
+	return start()
+}
+
+// put returns a process to the pool once its query is answered
+func (p *processPool[P]) put(proc P) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idle = append(p.idle, proc)
+}
+
+// size returns the number of idle processes
+func (p *processPool[P]) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// close stops every idle process
+func (p *processPool[P]) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for _, proc := range p.idle {
+		errs = append(errs, proc.close())
+	}
+	p.idle = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,118 @@
+// ABOUTME: Injectable runner for the git commands a Repository runs
+// ABOUTME: Lets unit tests check exact invocations and answer them without a real repository
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommandRunner runs the git commands of a Repository in place of os/exec,
+// so tests can check the exact arguments and answer with canned output. It
+// is called concurrently during analysis.
+type CommandRunner interface {
+	// Run runs cmd to completion. Its Args, Dir, Env, and Stdin are set, and
+	// its output belongs in Stdout and Stderr, either of which may be nil to
+	// discard it.
+	Run(cmd *exec.Cmd) error
+}
+
+// CommandRunnerFunc adapts a function to a CommandRunner
+type CommandRunnerFunc func(cmd *exec.Cmd) error
+
+// Run calls f(cmd)
+func (f CommandRunnerFunc) Run(cmd *exec.Cmd) error {
+	return f(cmd)
+}
+
+// SetCommandRunner runs every git command of the repository through runner.
+// Objects and the files of commits are then read with one cat-file --batch
+// or diff-tree --stdin command each rather than long-lived processes, so the
+// runner sees those reads too.
+func (r *Repository) SetCommandRunner(runner CommandRunner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.runner = runner
+	_ = r.batches.close()
+	_ = r.diffs.close()
+}
+
+// run runs the command through the runner, if one is set
+func (c *Cmd) run() error {
+	c.Env = withCLocale(c.Env)
+	if c.runner == nil {
+		return c.Cmd.Run()
+	}
+	return c.runner.Run(c.Cmd)
+}
+
+// output runs the command like exec.Cmd.Output
+func (c *Cmd) output() ([]byte, error) {
+	c.Env = withCLocale(c.Env)
+	if c.runner == nil {
+		return c.Cmd.Output()
+	}
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	if c.Stderr == nil {
+		c.Stderr = &stderr
+	}
+	err := c.runner.Run(c.Cmd)
+	// Mirror exec, which keeps the error output of a failed command
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.Stderr == nil {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// combinedOutput runs the command like exec.Cmd.CombinedOutput
+func (c *Cmd) combinedOutput() ([]byte, error) {
+	c.Env = withCLocale(c.Env)
+	if c.runner == nil {
+		return c.Cmd.CombinedOutput()
+	}
+	if c.Stdout != nil || c.Stderr != nil {
+		return nil, errors.New("exec: Stdout or Stderr already set")
+	}
+	var output bytes.Buffer
+	c.Stdout = &output
+	c.Stderr = &output
+	err := c.runner.Run(c.Cmd)
+	return output.Bytes(), err
+}
+
+// readObjectOnce reads an object with a cat-file --batch command of its own
+func (r *Repository) readObjectOnce(ctx context.Context, name string) (string, []byte, error) {
+	if strings.ContainsAny(name, "\n") {
+		return "", nil, fmt.Errorf("invalid object name %q", name)
+	}
+	cmd := r.Command(ctx, "cat-file", "--batch")
+	cmd.Stdin = strings.NewReader(name + "\n")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to run git cat-file: %w", err)
+	}
+	return readBatchObject(bufio.NewReader(bytes.NewReader(output)), name)
+}
+
+// changedFilesOnce lists the files of a commit with a diff-tree --stdin
+// command of its own
+func (r *Repository) changedFilesOnce(ctx context.Context, hash string) ([]string, error) {
+	cmd := r.Command(ctx, diffTreeArgs...)
+	cmd.Stdin = strings.NewReader(diffTreeInput(hash))
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run git diff-tree: %w", err)
+	}
+	return readDiffTreeFiles(bufio.NewReader(bytes.NewReader(output)))
+}
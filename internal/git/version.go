@@ -0,0 +1,109 @@
+// ABOUTME: Git version probing and feature gates
+// ABOUTME: Maps optional features to the git release that introduced them
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a git release number
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// Feature is a git capability the tool relies on
+type Feature struct {
+	Name  string
+	Since Version
+}
+
+// MinimumVersion is the oldest git the tool runs against at all; it needs
+// "rev-parse --absolute-git-dir" and "stash push". CI tests against it, so
+// keep the git-versions matrix in .github/workflows/ci.yml in step.
+var MinimumVersion = Version{2, 13, 0}
+
+// Optional features, enabled only when the installed git supports them
+var (
+	FeatureRebaseMerges       = Feature{Name: "preserving merges (rebase --rebase-merges)", Since: Version{2, 18, 0}}
+	FeatureRebaseEmpty        = Feature{Name: "handling emptied commits (rebase --empty)", Since: Version{2, 26, 0}}
+	FeatureMergeTreeWriteTree = Feature{Name: "conflict prediction (merge-tree --write-tree)", Since: Version{2, 38, 0}}
+)
+
+// ParseVersion parses the output of "git --version", ignoring vendor suffixes
+// such as "(Apple Git-146)" or ".windows.1"
+func ParseVersion(output string) (Version, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return Version{}, fmt.Errorf("unrecognized git version output %q", strings.TrimSpace(output))
+	}
+
+	var numbers [3]int
+	for i, part := range strings.SplitN(fields[2], ".", 4) {
+		if i == len(numbers) {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			if i < 2 {
+				return Version{}, fmt.Errorf("unrecognized git version %q", fields[2])
+			}
+			break // Release candidates like 2.45.0-rc1 have no numeric patch level
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2]}, nil
+}
+
+// String formats the version like git does
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast reports whether v is the same as or newer than other
+func (v Version) AtLeast(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// Supports reports whether git at version v has feature
+func (v Version) Supports(feature Feature) bool {
+	return v.AtLeast(feature.Since)
+}
+
+// Require returns an actionable error if git at version v lacks feature
+func (v Version) Require(feature Feature) error {
+	if v.Supports(feature) {
+		return nil
+	}
+	return fmt.Errorf("git >= %s is required for %s, but git %s is installed", feature.Since, feature.Name, v)
+}
+
+// Version returns the version of the git binary, probing it once
+func (r *Repository) Version(ctx context.Context) (Version, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.version != nil {
+		return *r.version, nil
+	}
+
+	output, err := r.Command(ctx, "--version").Output()
+	if err != nil {
+		return Version{}, fmt.Errorf("failed to run git --version: %w", err)
+	}
+	version, err := ParseVersion(string(output))
+	if err != nil {
+		return Version{}, err
+	}
+	r.version = &version
+	return version, nil
+}
@@ -0,0 +1,144 @@
+// ABOUTME: GitBackend implementation for Repository on top of the git binary
+// ABOUTME: Status, throwaway-index staging, commit-tree, update-ref, and rebase commands
+
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// zeroOID is the object id git uses to remove an index entry via --index-info
+const zeroOID = "0000000000000000000000000000000000000000"
+
+// Status lists changed and untracked paths in the working tree and index
+func (r *Repository) Status(ctx context.Context) ([]StatusEntry, error) {
+	output, err := r.GitOutput(ctx, "status", "--porcelain", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check git status: %w", err)
+	}
+
+	var entries []StatusEntry
+	records := SplitNul(output)
+	for i := 0; i < len(records); i++ {
+		// XY SP path, followed by the source path of a rename or copy as its own record
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+		entry := StatusEntry{XY: record[:2], Path: record[3:]}
+		if (entry.XY[0] == 'R' || entry.XY[0] == 'C') && i+1 < len(records) {
+			i++
+			entry.Orig = records[i]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SetTempDir makes the repository create its temporary files in dir rather
+// than the system's temporary directory; "" restores the default
+func (r *Repository) SetTempDir(dir string) {
+	r.tempDir = dir
+}
+
+// Stage returns the tree of base with entries staged over it, built in a
+// throwaway index. An entry without an OID removes its path.
+func (r *Repository) Stage(ctx context.Context, base string, entries []TreeEntry) (string, error) {
+	indexDir, err := os.MkdirTemp(r.tempDir, "git-rebase-extract-index-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	defer os.RemoveAll(indexDir)
+	indexEnv := append(Environ(), "GIT_INDEX_FILE="+filepath.Join(indexDir, "index"))
+
+	cmd := r.Command(ctx, "read-tree", base)
+	cmd.Env = indexEnv
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to read tree of %s: %w, output: %s", base, err, string(output))
+	}
+
+	var indexInfo strings.Builder
+	for _, entry := range entries {
+		if entry.OID == "" {
+			fmt.Fprintf(&indexInfo, "0 %s\t%s\x00", zeroOID, entry.Path)
+		} else {
+			fmt.Fprintf(&indexInfo, "%s %s\t%s\x00", entry.Mode, entry.OID, entry.Path)
+		}
+	}
+	cmd = r.Command(ctx, "update-index", "-z", "--index-info")
+	cmd.Env = indexEnv
+	cmd.Stdin = strings.NewReader(indexInfo.String())
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to update temporary index: %w, output: %s", err, string(output))
+	}
+
+	cmd = r.Command(ctx, "write-tree")
+	cmd.Env = indexEnv
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CommitTree creates a commit without touching any ref and returns its hash
+func (r *Repository) CommitTree(ctx context.Context, commit NewCommit) (string, error) {
+	args := []string{"commit-tree", commit.Tree}
+	for _, parent := range commit.Parents {
+		args = append(args, "-p", parent)
+	}
+	if commit.Sign {
+		args = append(args, "-S")
+	}
+	cmd := r.Command(ctx, args...)
+	cmd.Env = append(Environ(),
+		"GIT_AUTHOR_NAME="+commit.AuthorName,
+		"GIT_AUTHOR_EMAIL="+commit.AuthorEmail,
+		"GIT_AUTHOR_DATE="+commit.AuthorDate,
+	)
+	cmd.Stdin = strings.NewReader(commit.Message)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// UpdateRef points ref at newValue, failing unless it is at oldValue when
+// that is given, and logs reason in the reflog when it is given
+func (r *Repository) UpdateRef(ctx context.Context, ref, newValue, oldValue, reason string) error {
+	args := []string{"update-ref"}
+	if reason != "" {
+		args = append(args, "-m", reason)
+	}
+	args = append(args, ref, newValue)
+	if oldValue != "" {
+		args = append(args, oldValue)
+	}
+	if output, err := r.Command(ctx, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to update %s: %w, output: %s", ref, err, string(output))
+	}
+	return nil
+}
+
+// Rebase runs git rebase with args, such as "-i <base>", "--continue", or
+// "--abort". Its output is only kept in the error when it fails.
+func (r *Repository) Rebase(ctx context.Context, options RebaseOptions, args ...string) error {
+	var command []string
+	for _, config := range options.Config {
+		command = append(command, "-c", config)
+	}
+	command = append(command, "rebase")
+	cmd := r.Command(ctx, append(command, args...)...)
+	cmd.Env = append(Environ(), options.Env...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git rebase %s: %w, output: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+var _ GitBackend = (*Repository)(nil)
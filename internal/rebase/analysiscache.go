@@ -0,0 +1,157 @@
+// ABOUTME: On-disk cache of commit analysis shared between a dry run and the real run
+// ABOUTME: Keyed by the resolved range and targets, which fully determine the result
+
+package rebase
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// analysisCacheFileName is the name of the analysis cache inside the git directory
+const analysisCacheFileName = "extract-file-analysis"
+
+// analysisCacheVersion changes whenever CommitInfo or the analysis rules
+// change. 2: targets are followed through renames and resolved per commit,
+// as a file in some commits and a directory in others.
+const analysisCacheVersion = 2
+
+// analysisCache is the cached analysis of one range. Backend is the type of
+// the backend that read the history, which need not agree on every commit's
+// files.
+type analysisCache struct {
+	Version int          `json:"version"`
+	Backend string       `json:"backend"`
+	From    string       `json:"from"`
+	To      string       `json:"to"`
+	Targets []string     `json:"targets"`
+	Commits []CommitInfo `json:"commits"`
+}
+
+// analyze returns the analysis of from..to, reusing the result of an earlier
+// run over the same commits and targets when one was cached
+func (e *Extractor) analyze(from, to string) ([]CommitInfo, error) {
+	if err := e.checkRevisions(from, to); err != nil {
+		return nil, err
+	}
+	if err := e.checkHistory(from, to); err != nil {
+		return nil, err
+	}
+	if err := e.checkMerges(from, to); err != nil {
+		return nil, err
+	}
+	if err := e.prefetchRange(from, to); err != nil {
+		return nil, err
+	}
+	e.followRenames(from, to)
+
+	// The cache lives in the git directory, which only git can locate
+	if e.withoutGit {
+		return e.analyzeUncached(from, to)
+	}
+	path, key, err := e.analysisCacheKey(from, to)
+	if err != nil {
+		// Without resolved commits there is nothing safe to key the cache on
+		e.logWarn("analysis cache unavailable", err)
+		return e.analyzeUncached(from, to)
+	}
+
+	if commits, ok := loadAnalysis(path, key); ok {
+		e.verbosef("Reusing cached analysis of %s..%s\n", key.From[:7], key.To[:7])
+		if err := e.checkMergeSplits(commits); err != nil {
+			return nil, err
+		}
+		return commits, nil
+	}
+
+	commits, err := e.analyzeUncached(from, to)
+	if err != nil {
+		return nil, err
+	}
+	key.Commits = commits
+	if err := saveAnalysis(path, key); err != nil {
+		e.logWarn("failed to cache analysis", err, "path", path)
+	}
+	return commits, nil
+}
+
+// analyzeUncached analyzes from..to without consulting the cache
+func (e *Extractor) analyzeUncached(from, to string) ([]CommitInfo, error) {
+	commits, err := e.newAnalyzer().AnalyzeRange(e.ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkMergeSplits(commits); err != nil {
+		return nil, err
+	}
+	return commits, nil
+}
+
+// analysisCacheKey resolves the range and returns the cache path and key
+func (e *Extractor) analysisCacheKey(from, to string) (string, analysisCache, error) {
+	gitDir, err := e.gitDir()
+	if err != nil {
+		return "", analysisCache{}, err
+	}
+	fromHash, err := e.resolveCommit(from)
+	if err != nil {
+		return "", analysisCache{}, err
+	}
+	toHash, err := e.resolveCommit(to)
+	if err != nil {
+		return "", analysisCache{}, err
+	}
+
+	key := analysisCache{
+		Version: analysisCacheVersion,
+		Backend: fmt.Sprintf("%T", e.backend),
+		From:    fromHash,
+		To:      toHash,
+		Targets: e.matchTargets(),
+	}
+	return filepath.Join(gitDir, analysisCacheFileName), key, nil
+}
+
+// loadAnalysis returns the cached commits if the cache at path matches key
+func loadAnalysis(path string, key analysisCache) ([]CommitInfo, bool) {
+	content, err := os.ReadFile(path) // #nosec G304 -- path is inside the git directory
+	if err != nil {
+		return nil, false
+	}
+
+	var cached analysisCache
+	if err := json.Unmarshal(content, &cached); err != nil {
+		return nil, false
+	}
+	if cached.Version != key.Version || cached.Backend != key.Backend || cached.From != key.From || cached.To != key.To ||
+		!slices.Equal(cached.Targets, key.Targets) {
+		return nil, false
+	}
+	return cached.Commits, true
+}
+
+// saveAnalysis writes the cache atomically so a reader never sees a partial file
+func saveAnalysis(path string, cache analysisCache) error {
+	content, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("failed to encode analysis: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("failed to write analysis cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write analysis cache: %w", err)
+	}
+	return nil
+}
+
+// removeAnalysisCache deletes the cache once the history it describes is rewritten
+func removeAnalysisCache(gitDir string) {
+	_ = os.Remove(filepath.Join(gitDir, analysisCacheFileName)) // A stale cache never matches a new range
+}
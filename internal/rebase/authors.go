@@ -0,0 +1,66 @@
+// ABOUTME: Guard against silently rewriting commits authored by other people
+// ABOUTME: Compares commit author emails with the configured user.email
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetRewriteOthers allows rewriting commits authored by someone other than the configured user
+func (e *Extractor) SetRewriteOthers(rewriteOthers bool) {
+	e.rewriteOthers = rewriteOthers
+}
+
+// foreignCommits returns the commits the rewrite would touch that were
+// authored by someone other than the configured user
+func (e *Extractor) foreignCommits(commits []CommitInfo) []CommitInfo {
+	email, err := e.history().Config(e.ctx, "user.email")
+	if err != nil {
+		// Without a configured identity there is nobody to compare against
+		return nil
+	}
+	userEmail := strings.ToLower(email)
+
+	var foreign []CommitInfo
+	rewritten := false
+	for _, commit := range commits {
+		// Commits before the first split keep their hashes
+		rewritten = rewritten || commit.NeedsSplit
+		if rewritten && strings.ToLower(authorEmail(commit.Author)) != userEmail {
+			foreign = append(foreign, commit)
+		}
+	}
+	return foreign
+}
+
+// checkForeignAuthors warns about rewriting other people's commits and
+// refuses unless explicitly allowed
+func (e *Extractor) checkForeignAuthors(commits []CommitInfo) error {
+	foreign := e.foreignCommits(commits)
+	if len(foreign) == 0 {
+		return nil
+	}
+
+	e.warnf("This will rewrite commits authored by others:\n")
+	for _, commit := range foreign {
+		e.infof("  - %s %s\n", commit.Hash[:7], commit.Author)
+	}
+	e.infof("\n")
+
+	if !e.rewriteOthers {
+		return fmt.Errorf("%w: %d commits are authored by others; pass --rewrite-others to proceed", ErrProtectedBranch, len(foreign))
+	}
+	return nil
+}
+
+// authorEmail extracts the email from a "Name <email>" author string
+func authorEmail(author string) string {
+	start := strings.LastIndex(author, "<")
+	end := strings.LastIndex(author, ">")
+	if start < 0 || end < start {
+		return author
+	}
+	return author[start+1 : end]
+}
@@ -0,0 +1,51 @@
+// ABOUTME: Autostash support for running extraction on a dirty working tree
+// ABOUTME: Stashes uncommitted changes before the rebase and reapplies them afterwards
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// autostashMessage identifies stash entries created by this tool
+const autostashMessage = "git-rebase-extract-file autostash"
+
+// stashChanges stashes uncommitted changes to tracked files and returns the
+// stash commit; untracked files stay in place, as with git rebase --autostash
+func (e *Extractor) stashChanges() (string, error) {
+	cmd := e.repo.Command(e.ctx, "stash", "push", "-m", autostashMessage)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to autostash changes: %w, output: %s", err, string(output))
+	}
+
+	cmd = e.repo.Command(e.ctx, "rev-parse", "stash@{0}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve autostash commit: %w", err)
+	}
+
+	stash := strings.TrimSpace(string(output))
+	e.infof("Created autostash: %s\n", stash[:7])
+	return stash, nil
+}
+
+// restoreStash reapplies the autostash unless a rebase was left in progress.
+// It runs even when the run was canceled, so the changes aren't left behind.
+func (e *Extractor) restoreStash(stash string) {
+	e.keepRunning()
+	if inProgress, _ := e.checkRebaseConflicts(); inProgress {
+		e.errorf("Your uncommitted changes are kept in the stash. Once the rebase is resolved, run:\n")
+		e.errorf("  git stash pop\n")
+		return
+	}
+
+	cmd := e.repo.Command(e.ctx, "stash", "pop")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		e.logWarn("autostash pop failed", err, "stash", stash, "output", string(output))
+		e.errorf("%s%s Your changes are safe in the stash.\n", e.style.glyph("⚠️  "), e.style.paint(ansiYellow, "Applying autostash resulted in conflicts."))
+		e.errorf("You can run \"git stash pop\" or \"git stash drop\" at any time (stash commit %s).\n", stash[:7])
+		return
+	}
+	e.infof("Applied autostash.\n")
+}
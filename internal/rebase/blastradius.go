@@ -0,0 +1,78 @@
+// ABOUTME: Blast-radius report describing what a rewrite affects beyond the current branch
+// ABOUTME: Counts rewritten commits and finds branches, tags, and remotes that contain them
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BlastRadius summarizes the references affected by rewriting a range
+type BlastRadius struct {
+	Rewritten int      `json:"rewritten"`
+	Branches  []string `json:"branches"`
+	Tags      []string `json:"tags"`
+	Remotes   []string `json:"remotes"`
+}
+
+// computeBlastRadius finds everything that still points at the commits the
+// rewrite will replace
+func (e *Extractor) computeBlastRadius(commits []CommitInfo) (BlastRadius, error) {
+	var radius BlastRadius
+
+	// Commits before the first split keep their hashes
+	first := -1
+	for i, commit := range commits {
+		if commit.NeedsSplit {
+			first = i
+			break
+		}
+	}
+	if first < 0 {
+		return radius, nil
+	}
+	radius.Rewritten = len(commits) - first
+	oldest := commits[first].Hash
+
+	currentBranch, err := e.history().CurrentBranch(e.ctx)
+	if err != nil {
+		return radius, err
+	}
+	refs, err := e.history().RefsContaining(e.ctx, oldest)
+	if err != nil {
+		return radius, fmt.Errorf("failed to list refs containing rewritten commits: %w", err)
+	}
+
+	radius.Branches, radius.Tags, radius.Remotes = []string{}, []string{}, []string{}
+	for _, ref := range refs {
+		if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok && branch != currentBranch {
+			radius.Branches = append(radius.Branches, branch)
+		} else if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			radius.Tags = append(radius.Tags, tag)
+		} else if remote, ok := strings.CutPrefix(ref, "refs/remotes/"); ok {
+			radius.Remotes = append(radius.Remotes, remote)
+		}
+	}
+
+	return radius, nil
+}
+
+// String renders the report for display before a rewrite
+func (r BlastRadius) String() string {
+	var output strings.Builder
+	fmt.Fprintf(&output, "Blast radius:\n")
+	fmt.Fprintf(&output, "  Commits rewritten: %d\n", r.Rewritten)
+	fmt.Fprintf(&output, "  Other local branches containing them: %s\n", joinOrNone(r.Branches))
+	fmt.Fprintf(&output, "  Tags containing them: %s\n", joinOrNone(r.Tags))
+	fmt.Fprintf(&output, "  Already on remotes: %s\n", joinOrNone(r.Remotes))
+	return output.String()
+}
+
+// joinOrNone joins names for display, using "none" for an empty list
+func joinOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
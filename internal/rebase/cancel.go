@@ -0,0 +1,37 @@
+// ABOUTME: Cancellation of a running extraction through its context
+// ABOUTME: Aborts a stopped rebase and moves the branch back, so a canceled run leaves history as it was
+
+package rebase
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// keepRunning stops cancellation of the run's context from failing the git
+// commands that cleanup still has to run
+func (e *Extractor) keepRunning() {
+	e.ctx = context.WithoutCancel(e.ctx)
+}
+
+// cancelRewrite undoes a rewrite interrupted by canceling the context: a
+// rebase left in progress is aborted and the branch moved back to
+// originalHead. The plumbing path may not have moved the branch yet, which
+// makes the rollback a no-op.
+func (e *Extractor) cancelRewrite(originalHead string) error {
+	cause := e.ctx.Err()
+	e.keepRunning()
+
+	if inProgress, _ := e.checkRebaseConflicts(); inProgress {
+		if err := e.gitBackend.Rebase(e.ctx, git.RebaseOptions{}, "--abort"); err != nil {
+			return fmt.Errorf("rewrite canceled, and the rebase could not be aborted: %v: %w", err, cause)
+		}
+	}
+	if err := e.rollBack(originalHead); err != nil {
+		return fmt.Errorf("rewrite canceled, %v: %w", err, cause)
+	}
+	e.errorf("\n%s%s\n", e.style.glyph("🚨 "), e.style.paint(ansiRed, "Canceled; the rewrite was rolled back."))
+	return fmt.Errorf("rewrite canceled and rolled back to %s: %w", originalHead[:7], cause)
+}
@@ -0,0 +1,50 @@
+// ABOUTME: Ranking of the files changed in a range by how often they are mixed with other changes
+// ABOUTME: Helps choose targets: files that keep riding along in unrelated commits rank first
+
+package rebase
+
+import "sort"
+
+// FileCandidate is a file changed in a range and how often it was changed
+// together with other files
+type FileCandidate struct {
+	Path string `json:"path"`
+	// Commits is the number of commits that change the file
+	Commits int `json:"commits"`
+	// MixedCommits is the number of those commits that also change other files
+	MixedCommits int `json:"mixedCommits"`
+}
+
+// RankCandidates ranks the files changed by commits, most often mixed first
+func RankCandidates(commits []CommitInfo) []FileCandidate {
+	byPath := make(map[string]*FileCandidate)
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			candidate, ok := byPath[file]
+			if !ok {
+				candidate = &FileCandidate{Path: file}
+				byPath[file] = candidate
+			}
+			candidate.Commits++
+			if len(commit.Files) > 1 {
+				candidate.MixedCommits++
+			}
+		}
+	}
+
+	candidates := make([]FileCandidate, 0, len(byPath))
+	for _, candidate := range byPath {
+		candidates = append(candidates, *candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.MixedCommits != b.MixedCommits {
+			return a.MixedCommits > b.MixedCommits
+		}
+		if a.Commits != b.Commits {
+			return a.Commits > b.Commits
+		}
+		return a.Path < b.Path
+	})
+	return candidates
+}
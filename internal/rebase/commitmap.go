@@ -0,0 +1,45 @@
+// ABOUTME: Writes the old-to-new commit mapping in git filter-repo's commit-map format
+// ABOUTME: Lets scripts written for filter-repo maps consume a run's rewrites unchanged
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SetCommitMapPath sets a file to write the mapping of original to new
+// commits to after a successful run, in the format of git filter-repo's
+// .git/filter-repo/commit-map
+func (e *Extractor) SetCommitMapPath(path string) {
+	e.commitMapPath = path
+}
+
+// writeCommitMap writes the commit map of the commits in base..HEAD. The
+// format is one-to-one, so a split commit maps to the half that carries its
+// tree, the same commit git rebase reports as its rewrite. Dropped empty
+// commits map to the null id, as filter-repo records pruned commits.
+func (e *Extractor) writeCommitMap(base string, commits []CommitInfo) error {
+	if e.commitMapPath == "" {
+		return nil
+	}
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return fmt.Errorf("failed to map rewritten commits: %w", err)
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "%-40s %s\n", "old", "new")
+	for _, mapping := range mappings {
+		tip := e.rewrittenTip(mapping)
+		if mapping.Dropped {
+			tip = nullOID
+		}
+		fmt.Fprintf(&content, "%s %s\n", mapping.Original, tip)
+	}
+	if err := os.WriteFile(e.commitMapPath, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write commit map: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+// ABOUTME: Conflict prediction by simulating the rewrite with git merge-tree
+// ABOUTME: Replays the planned splits and recreated merges as throwaway commits, without touching the worktree or refs
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// simulationIdentity is used for the throwaway commits created during simulation
+var simulationIdentity = []string{
+	"GIT_AUTHOR_NAME=git-rebase-extract-file",
+	"GIT_AUTHOR_EMAIL=git-rebase-extract-file@localhost",
+	"GIT_AUTHOR_DATE=1970-01-01T00:00:00Z",
+	"GIT_COMMITTER_NAME=git-rebase-extract-file",
+	"GIT_COMMITTER_EMAIL=git-rebase-extract-file@localhost",
+	"GIT_COMMITTER_DATE=1970-01-01T00:00:00Z",
+}
+
+// predictConflicts simulates the planned rewrite with throwaway commits and
+// returns the conflicted files keyed by commit hash. Each split commit is
+// picked as its two halves, in the order the split creates them, and each
+// merge above a rewritten commit is merged again from its rewritten
+// parents, as --rebase-merges does.
+func (e *Extractor) predictConflicts(commits []CommitInfo) (map[string][]string, error) {
+	if e.withoutGit {
+		return nil, errors.New("conflicts are predicted with git merge-tree, and this dry run doesn't run git (--backend go-git)")
+	}
+	if err := e.requireFeature(git.FeatureMergeTreeWriteTree); err != nil {
+		return nil, err
+	}
+	// The halves staged for the simulation aren't actions on the repository
+	defer func(recorded int) { e.transcript = e.transcript[:recorded] }(len(e.transcript))
+
+	conflicts := make(map[string][]string)
+	// rewritten maps each commit of the range to its simulated counterpart;
+	// commits below the range stay as they are
+	rewritten := make(map[string]string)
+
+	for _, commit := range commits {
+		parents, err := e.commitParents(commit.Hash)
+		if err != nil {
+			return nil, err
+		}
+		onto := make([]string, len(parents))
+		moved := false
+		for i, parent := range parents {
+			onto[i] = parent
+			if simulated, ok := rewritten[parent]; ok {
+				onto[i] = simulated
+			}
+			moved = moved || onto[i] != parent
+		}
+
+		dropped, err := e.dropsCommit(commit.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		var result string
+		var files []string
+		switch {
+		case dropped:
+			rewritten[commit.Hash] = onto[0]
+			continue
+		case len(parents) == 0 || (!moved && !commit.NeedsSplit):
+			// Root commits and commits on an unchanged parent are kept as they are
+			rewritten[commit.Hash] = commit.Hash
+			continue
+		case len(parents) > 1:
+			result, files, err = e.simulateMerge(onto)
+		case commit.NeedsSplit:
+			result, files, err = e.simulateSplit(commit, parents[0], onto[0])
+		default:
+			result, files, err = e.simulatePick(commit.Hash, parents[0], onto[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to simulate commit %s: %w", commit.Hash[:7], err)
+		}
+		if len(files) > 0 {
+			conflicts[commit.Hash] = files
+			// Assume the user resolves to the original content
+			if result, err = e.simulationCommit(commit.Hash+"^{tree}", onto...); err != nil {
+				return nil, err
+			}
+		}
+		rewritten[commit.Hash] = result
+	}
+
+	return conflicts, nil
+}
+
+// simulateSplit picks the two halves of a split of commit, whose original
+// parent is parent, onto the simulated commit onto, returning the second
+// half and the files either pick conflicts in
+func (e *Extractor) simulateSplit(commit CommitInfo, parent, onto string) (string, []string, error) {
+	firstTree, _, _, err := e.splitLayout(commit, commit.Hash, parent)
+	if err != nil {
+		return "", nil, err
+	}
+	first, err := e.simulationCommit(firstTree, parent)
+	if err != nil {
+		return "", nil, err
+	}
+	second, err := e.simulationCommit(commit.Hash+"^{tree}", first)
+	if err != nil {
+		return "", nil, err
+	}
+
+	picked, files, err := e.simulatePick(first, parent, onto)
+	if err != nil || len(files) > 0 {
+		return picked, files, err
+	}
+	return e.simulatePick(second, first, picked)
+}
+
+// simulatePick replays commit, whose original parent is parent, onto the
+// simulated commit onto, returning the resulting commit and any conflicted
+// files
+func (e *Extractor) simulatePick(commit, parent, onto string) (string, []string, error) {
+	tree, files, err := e.replayTree(commit, parent, onto)
+	if err != nil || len(files) > 0 {
+		return "", files, err
+	}
+	result, err := e.simulationCommit(tree, onto)
+	return result, nil, err
+}
+
+// replayTree cherry-picks commit, whose original parent is parent, onto the
+// commit onto in memory, returning the resulting tree and any conflicted files
+func (e *Extractor) replayTree(commit, parent, onto string) (string, []string, error) {
+	// Wrap the rewritten tree in a commit whose parent is the original
+	// parent, so merge-tree uses that parent as the merge base exactly as
+	// cherry-pick would
+	wrapped, err := e.simulationCommit(onto+"^{tree}", parent)
+	if err != nil {
+		return "", nil, err
+	}
+	return e.simulateMergeTree(wrapped, commit)
+}
+
+// simulateMerge merges the simulated parents of a merge again, returning
+// the resulting commit and any conflicted files
+func (e *Extractor) simulateMerge(parents []string) (string, []string, error) {
+	tree, files, err := e.simulateMergeTree(parents...)
+	if err != nil || len(files) > 0 {
+		return "", files, err
+	}
+	result, err := e.simulationCommit(tree, parents...)
+	return result, nil, err
+}
+
+// simulateMergeTree merges commits in memory with git merge-tree, returning
+// the resulting tree and any conflicted files
+func (e *Extractor) simulateMergeTree(commits ...string) (string, []string, error) {
+	args := append([]string{"merge-tree", "--write-tree", "-z", "--name-only", "--no-messages"}, commits...)
+	output, err := e.repo.Command(e.ctx, args...).Output()
+
+	var exitErr *exec.ExitError
+	conflicted := errors.As(err, &exitErr) && exitErr.ExitCode() == 1
+	if err != nil && !conflicted {
+		return "", nil, fmt.Errorf("git merge-tree failed: %w", err)
+	}
+
+	records := git.SplitNul(string(output))
+	if len(records) == 0 {
+		return "", nil, fmt.Errorf("git merge-tree printed no tree")
+	}
+	tree := records[0]
+	if !conflicted {
+		return tree, nil, nil
+	}
+
+	var files []string
+	for _, file := range records[1:] {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	return tree, files, nil
+}
+
+// simulationCommit creates a throwaway commit of tree with the given parents
+func (e *Extractor) simulationCommit(tree string, parents ...string) (string, error) {
+	args := []string{"commit-tree", tree, "-m", "simulated rewrite"}
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+	cmd := e.repo.Command(e.ctx, args...)
+	cmd.Env = append(git.Environ(), simulationIdentity...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to create simulation commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// commitParents returns the parent hashes of a commit
+func (e *Extractor) commitParents(hash string) ([]string, error) {
+	commit, err := e.history().CatCommit(e.ctx, hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get parents of %s: %w", hash, err)
+	}
+	return commit.Parents, nil
+}
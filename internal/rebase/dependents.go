@@ -0,0 +1,134 @@
+// ABOUTME: Moves other local branches built on rewritten commits onto the new history
+// ABOUTME: Replays their own commits with merge-tree so no working tree is touched
+
+package rebase
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetRebaseDependents moves other local branches that contain rewritten
+// commits onto the commits that replaced them
+func (e *Extractor) SetRebaseDependents(rebaseDependents bool) {
+	e.rebaseDependents = rebaseDependents
+}
+
+// rebaseDependentBranches replays every other local branch containing
+// rewritten commits onto the new history. A branch that can't be moved
+// cleanly is left alone with a warning.
+func (e *Extractor) rebaseDependentBranches(base, originalHead, backupBranch string, commits []CommitInfo) error {
+	if err := e.requireFeature(git.FeatureMergeTreeWriteTree); err != nil {
+		return err
+	}
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return fmt.Errorf("failed to map rewritten commits: %w", err)
+	}
+	tips := make(map[string]string)
+	oldest := ""
+	for _, mapping := range mappings {
+		if mapping.Split || mapping.Remaining != mapping.Original {
+			tips[mapping.Original] = e.rewrittenTip(mapping)
+			if oldest == "" {
+				oldest = mapping.Original
+			}
+		}
+	}
+	if oldest == "" {
+		return nil
+	}
+
+	// Empty when HEAD is detached
+	current, _ := e.repo.GitOutput(e.ctx, "symbolic-ref", "-q", "HEAD")
+	branches, err := e.repo.GitOutput(e.ctx, "for-each-ref", "--format=%(refname)", "--contains", oldest, "refs/heads/")
+	if err != nil {
+		return fmt.Errorf("failed to list dependent branches: %w", err)
+	}
+	checkedOut, err := e.checkedOutBranches()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range strings.Fields(branches) {
+		name := strings.TrimPrefix(ref, "refs/heads/")
+		if ref == strings.TrimSpace(current) || name == backupBranch {
+			continue
+		}
+		if slices.Contains(checkedOut, ref) {
+			e.warnf("Not rebasing %s: it is checked out in another worktree\n", name)
+			continue
+		}
+		newTip, err := e.rebaseDependent(ref, originalHead, tips)
+		if err != nil {
+			e.warnf("Not rebasing %s: %v\n", name, err)
+			continue
+		}
+		e.infof("Rebased %s onto the new history (now %s)\n", name, newTip[:7])
+	}
+	return nil
+}
+
+// rebaseDependent replays the commits of ref that aren't part of the
+// original history onto the replacement of its fork point and moves ref
+func (e *Extractor) rebaseDependent(ref, originalHead string, tips map[string]string) (string, error) {
+	oldTip, err := e.resolveCommit(ref)
+	if err != nil {
+		return "", err
+	}
+	forkPoint, err := e.repo.GitOutput(e.ctx, "merge-base", oldTip, originalHead)
+	if err != nil {
+		return "", fmt.Errorf("failed to find fork point: %w", err)
+	}
+	forkPoint = strings.TrimSpace(forkPoint)
+	newTip, ok := tips[forkPoint]
+	if !ok {
+		return "", fmt.Errorf("it forks from %s, which wasn't rewritten", forkPoint[:7])
+	}
+
+	own, err := e.repo.RevList(e.ctx, forkPoint, oldTip)
+	if err != nil {
+		return "", err
+	}
+	for _, commit := range own {
+		parents, err := e.commitParents(commit)
+		if err != nil {
+			return "", err
+		}
+		if len(parents) != 1 {
+			return "", fmt.Errorf("commit %s is a merge", commit[:7])
+		}
+		tree, conflicts, err := e.replayTree(commit, parents[0], newTip)
+		if err != nil {
+			return "", err
+		}
+		if len(conflicts) > 0 {
+			return "", fmt.Errorf("commit %s conflicts in %s", commit[:7], strings.Join(conflicts, ", "))
+		}
+		meta, err := e.readCommitMeta(commit)
+		if err != nil {
+			return "", err
+		}
+		if newTip, err = e.commitTree(tree, newTip, meta, meta.message); err != nil {
+			return "", err
+		}
+	}
+
+	if err := e.gitBackend.UpdateRef(e.ctx, ref, newTip, oldTip, "git-rebase-extract-file: rebase dependent branch"); err != nil {
+		return "", err
+	}
+	e.record(ResetEvent{Ref: ref, From: oldTip, To: newTip})
+	return newTip, nil
+}
+
+// rewrittenTip returns the new commit that carries the original commit's
+// tree: the second half of a split, or the rewritten commit itself
+func (e *Extractor) rewrittenTip(mapping CommitMapping) string {
+	if mapping.Split && !e.extractedFirst(CommitInfo{Hash: mapping.Original}) {
+		return mapping.Extracted
+	}
+	return mapping.Remaining
+}
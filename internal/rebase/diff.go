@@ -0,0 +1,187 @@
+// ABOUTME: Patch and diffstat previews of planned splits
+// ABOUTME: Shows how big each half of a split is, and with --show-diff exactly what lands where
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffStat summarizes the size of a commit, like the last line of git diff --stat
+type DiffStat struct {
+	Files      int            `json:"files"`
+	Insertions int            `json:"insertions"`
+	Deletions  int            `json:"deletions"`
+	Binary     []BinaryChange `json:"binary,omitempty"`
+}
+
+// BinaryChange is a change to a binary file, which has no line counts.
+// A size is absent when the file didn't exist on that side.
+type BinaryChange struct {
+	Path    string `json:"path"`
+	OldSize *int64 `json:"oldSize,omitempty"`
+	NewSize *int64 `json:"newSize,omitempty"`
+}
+
+// String renders the change with its sizes, e.g. "logo.png 1.2 KiB -> 3.4 KiB"
+func (c BinaryChange) String() string {
+	size := func(n *int64) string {
+		if n == nil {
+			return "none"
+		}
+		return formatSize(*n)
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Path, size(c.OldSize), size(c.NewSize))
+}
+
+// String renders the stat like git does, e.g. "2 files changed, 5 insertions(+), 1 deletion(-)",
+// followed by the sizes of any binary files
+func (s DiffStat) String() string {
+	plural := func(n int, one, many string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, one)
+		}
+		return fmt.Sprintf("%d %s", n, many)
+	}
+	stat := fmt.Sprintf("%s, %s, %s", plural(s.Files, "file changed", "files changed"),
+		plural(s.Insertions, "insertion(+)", "insertions(+)"), plural(s.Deletions, "deletion(-)", "deletions(-)"))
+	for _, change := range s.Binary {
+		stat += "; binary " + change.String()
+	}
+	return stat
+}
+
+// formatSize renders a byte count in binary units, e.g. "512 B" or "1.2 KiB"
+func formatSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n)
+	unit := ""
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		value /= 1024
+		unit = u
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+// splitStats returns the diffstats of the remaining and extracted commits of
+// a split. The split is by path, so each file's numbers land in exactly one half.
+func (e *Extractor) splitStats(commit CommitInfo) (DiffStat, DiffStat, error) {
+	parents, err := e.commitParents(commit.Hash)
+	if err != nil {
+		return DiffStat{}, DiffStat{}, err
+	}
+	// Merges are flattened onto their first parent
+	parent := ""
+	if len(parents) > 0 {
+		parent = parents[0]
+	}
+	stats, err := e.history().NumStat(e.ctx, parent, commit.Hash)
+	if err != nil {
+		return DiffStat{}, DiffStat{}, fmt.Errorf("failed to get diffstat of %s: %w", commit.Hash[:7], err)
+	}
+
+	var remaining, extracted DiffStat
+	analyzer := e.newAnalyzer().forCommit(commit.Files)
+	for _, file := range stats {
+		stat := &remaining
+		if analyzer.isTargetFile(file.Path) {
+			stat = &extracted
+		}
+		stat.Files++
+		if file.Binary {
+			change := BinaryChange{Path: file.Path}
+			if parent != "" {
+				change.OldSize = e.blobSize(parent, file.Path)
+			}
+			change.NewSize = e.blobSize(commit.Hash, file.Path)
+			stat.Binary = append(stat.Binary, change)
+			continue
+		}
+		stat.Insertions += file.Insertions
+		stat.Deletions += file.Deletions
+	}
+	return remaining, extracted, nil
+}
+
+// blobSize returns the size of path in commit, or nil if it doesn't exist there
+func (e *Extractor) blobSize(commit, path string) *int64 {
+	size, err := e.history().BlobSize(e.ctx, commit, path)
+	if err != nil {
+		return nil
+	}
+	return &size
+}
+
+// SetShowDiff sets whether previews include the patches of both halves of each split
+func (e *Extractor) SetShowDiff(showDiff bool) {
+	e.showDiff = showDiff
+}
+
+// splitDiffs returns the patches that would land in the remaining and
+// extracted commits of a split, computed from the trees the split builds
+func (e *Extractor) splitDiffs(commit CommitInfo) (string, string, error) {
+	parents, err := e.commitParents(commit.Hash)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parents) == 0 {
+		return "", "", fmt.Errorf("commit %s has no parent to diff against", commit.Hash[:7])
+	}
+
+	tree, _, _, err := e.splitLayout(commit, commit.Hash, parents[0])
+	if err != nil {
+		return "", "", err
+	}
+	first, err := e.treeDiff(parents[0], tree)
+	if err != nil {
+		return "", "", err
+	}
+	second, err := e.treeDiff(tree, commit.Hash)
+	if err != nil {
+		return "", "", err
+	}
+
+	if e.extractedFirst(commit) {
+		return second, first, nil
+	}
+	return first, second, nil
+}
+
+// treeDiff returns the patch between two tree-ishes, with non-ASCII paths
+// in its headers left readable rather than octal-escaped
+func (e *Extractor) treeDiff(from, to string) (string, error) {
+	cmd := e.repo.Command(e.ctx, "-c", "core.quotePath=false", "diff-tree", "-p", "--no-color", "--no-commit-id", from, to)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s..%s: %w", from, to, err)
+	}
+	return string(output), nil
+}
+
+// renderPatch writes a patch indented under a split, coloring added and removed lines
+func renderPatch(output *strings.Builder, s style, title, patch string) {
+	fmt.Fprintf(output, "   %s\n", s.paint(ansiBold, title))
+	if patch == "" {
+		fmt.Fprintf(output, "   (empty)\n")
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			line = s.paint(ansiBold, line)
+		case strings.HasPrefix(line, "+"):
+			line = s.paint(ansiGreen, line)
+		case strings.HasPrefix(line, "-"):
+			line = s.paint(ansiRed, line)
+		case strings.HasPrefix(line, "@@"):
+			line = s.paint(ansiCyan, line)
+		}
+		fmt.Fprintf(output, "   %s\n", line)
+	}
+}
@@ -0,0 +1,56 @@
+// ABOUTME: Handling of commits in the range that were empty to begin with
+// ABOUTME: Keeps them by default, matching the plumbing path, or drops them from the rewritten history
+
+package rebase
+
+import (
+	"fmt"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetEmptyCommits sets what happens to commits in the range that change
+// nothing when the range is rewritten: "keep" (the default) carries them
+// over and "drop" leaves them out. Commits are only ever dropped by a
+// rewrite, so a range with nothing to split keeps them either way.
+func (e *Extractor) SetEmptyCommits(mode string) error {
+	switch mode {
+	case "", "keep":
+		e.dropEmpty = false
+		return nil
+	case "drop":
+		e.dropEmpty = true
+		return nil
+	default:
+		return fmt.Errorf("invalid empty commits mode %q: must be \"keep\" or \"drop\"", mode)
+	}
+}
+
+// emptyRebaseArgs returns the git rebase options that apply the empty
+// commits mode. Git releases before 2.26 drop empty commits from an
+// interactive rebase unless told otherwise, so both modes are spelled out;
+// those releases don't know --empty, which covers commits a rebase empties.
+func (e *Extractor) emptyRebaseArgs() []string {
+	args := []string{"--keep-empty", "--empty=keep"}
+	if e.dropEmpty {
+		args = []string{"--no-keep-empty", "--empty=drop"}
+	}
+	if e.requireFeature(git.FeatureRebaseEmpty) != nil {
+		return args[:1]
+	}
+	return args
+}
+
+// dropsCommit reports whether the rewrite leaves commit out: it is dropped
+// when empty commits are being dropped and it has the same tree as its
+// only parent
+func (e *Extractor) dropsCommit(commit string) (bool, error) {
+	if !e.dropEmpty {
+		return false, nil
+	}
+	parents, err := e.commitParents(commit)
+	if err != nil || len(parents) != 1 {
+		return false, err
+	}
+	return e.sameTree(commit, parents[0])
+}
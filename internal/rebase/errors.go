@@ -0,0 +1,64 @@
+// ABOUTME: Error kinds callers can branch on with errors.Is and errors.As
+// ABOUTME: Sentinels for refusals before rewriting and ConflictError for splits stopped on conflicts
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrDirtyWorktree is wrapped by the error returned when tracked files
+	// have uncommitted changes and autostash is off
+	ErrDirtyWorktree = errors.New("working directory is not clean")
+
+	// ErrConflicts matches a ConflictError with errors.Is
+	ErrConflicts = errors.New("splitting stopped on conflicts")
+
+	// ErrNothingToSplit is wrapped by the error returned when there is no
+	// history to split, such as on a branch without commits. A range whose
+	// commits don't touch the targets isn't an error; Extract leaves it alone
+	// and returns nil.
+	ErrNothingToSplit = errors.New("nothing to split")
+
+	// ErrProtectedBranch is wrapped by the errors refusing to rewrite history
+	// that isn't only the user's to rewrite: commits by other authors without
+	// SetRewriteOthers, and signed commits with SetRequireSignatures
+	ErrProtectedBranch = errors.New("refusing to rewrite protected history")
+
+	// ErrRebaseInProgress is wrapped by the error returned when a rebase this
+	// tool didn't start is stopped in the repository
+	ErrRebaseInProgress = errors.New("a rebase is already in progress")
+)
+
+// ConflictError reports a split that stopped on conflicts. With
+// SetNonInteractive the rebase was aborted and the branch rolled back;
+// otherwise the rebase is left stopped for the conflicts to be resolved.
+type ConflictError struct {
+	// Commit is the original commit being split
+	Commit string
+	// Files are the conflicted paths, relative to the top of the working tree
+	Files []string
+	// Aborted is set once the rebase has been aborted
+	Aborted bool
+
+	status string
+}
+
+func (e *ConflictError) Error() string {
+	status := e.status
+	if status == "" && len(e.Files) > 0 {
+		status = "Merge conflicts in: " + strings.Join(e.Files, ", ")
+	}
+	if e.Aborted {
+		return fmt.Sprintf("%v:\n%s", ErrConflicts, status)
+	}
+	return fmt.Sprintf("rebase stopped due to conflicts:\n%s\n\nTo resolve:\n1. Manually resolve conflicts in the affected files\n2. Run: git add <resolved-files>\n3. Run: git rebase --continue\n4. Or run: git rebase --abort to cancel", status)
+}
+
+// Is makes every ConflictError match ErrConflicts
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflicts
+}
@@ -0,0 +1,85 @@
+// ABOUTME: Machine-readable progress events for editor and GUI integrations
+// ABOUTME: Emits one JSON object per line as a run analyzes, splits, and finishes
+
+package rebase
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Event types, in the order a run emits them
+const (
+	EventAnalysisStarted = "analysis-started"
+	EventCommitAnalyzed  = "commit-analyzed"
+	EventSplitStarted    = "split-started"
+	EventConflict        = "conflict"
+	EventSplitFinished   = "split-finished"
+	EventDone            = "done"
+)
+
+// Event is one line of the progress stream. Fields are only set for the
+// event types they apply to; a done event without an error is a success.
+type Event struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Commit    string    `json:"commit,omitempty"`
+	Index     int       `json:"index,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Split     bool      `json:"split,omitempty"`
+	Files     []string  `json:"files,omitempty"`
+	Remaining string    `json:"remaining,omitempty"`
+	Extracted string    `json:"extracted,omitempty"`
+	Head      string    `json:"head,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// eventStream is the Observer writing progress events as JSON lines
+type eventStream struct {
+	encoder *json.Encoder
+}
+
+// SetEventStream writes progress events to w as JSON lines
+func (e *Extractor) SetEventStream(w io.Writer) {
+	e.events = &eventStream{encoder: json.NewEncoder(w)}
+	e.AddObserver(e.events)
+}
+
+// emit writes an event to the stream
+func (s *eventStream) emit(event Event) {
+	event.Time = time.Now()
+	// A consumer that went away shouldn't abort the rewrite
+	_ = s.encoder.Encode(event)
+}
+
+// analysisStarted reports that the range from..to is being analyzed
+func (s *eventStream) analysisStarted(from, to string) {
+	s.emit(Event{Event: EventAnalysisStarted, From: from, To: to})
+}
+
+func (s *eventStream) OnAnalyzeCommit(commit CommitInfo, index, total int) {
+	s.emit(Event{Event: EventCommitAnalyzed, Commit: commit.Hash, Index: index, Total: total, Split: commit.NeedsSplit, Files: commit.Files})
+}
+
+func (s *eventStream) OnSplitStart(commit CommitInfo, index, total int) {
+	s.emit(Event{Event: EventSplitStarted, Commit: commit.Hash, Index: index, Total: total})
+}
+
+func (s *eventStream) OnSplitDone(commit CommitInfo, remaining, extracted string) {
+	s.emit(Event{Event: EventSplitFinished, Commit: commit.Hash, Remaining: remaining, Extracted: extracted})
+}
+
+func (s *eventStream) OnConflict(commit CommitInfo, files []string) {
+	s.emit(Event{Event: EventConflict, Commit: commit.Hash, Files: files})
+}
+
+func (s *eventStream) OnComplete(head string, err error) {
+	done := Event{Event: EventDone, Head: head}
+	if err != nil {
+		done.Error = err.Error()
+	}
+	s.emit(done)
+}
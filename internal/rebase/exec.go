@@ -0,0 +1,92 @@
+// ABOUTME: --exec support: runs a command on every commit a split created, like git rebase --exec
+// ABOUTME: Checks each new commit out in turn and rolls the whole rewrite back if the command fails on any
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetExec sets a shell command that must succeed on every commit created by
+// a split. After the rewrite, each such commit is checked out in turn and the
+// command run from the top of the working tree; if it fails on any of them,
+// the branch is reset to where it started.
+func (e *Extractor) SetExec(command string) {
+	e.exec = command
+}
+
+// runExec runs the --exec command on both halves of every split commit, in
+// history order, and undoes the rewrite if it fails
+func (e *Extractor) runExec(base, originalHead string, commits []CommitInfo) error {
+	if e.exec == "" {
+		return nil
+	}
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return fmt.Errorf("failed to find the split commits: %w", err)
+	}
+	var created []string
+	for i, mapping := range mappings {
+		if !mapping.Split {
+			continue
+		}
+		if e.extractedFirst(commits[i]) {
+			created = append(created, mapping.Extracted, mapping.Remaining)
+		} else {
+			created = append(created, mapping.Remaining, mapping.Extracted)
+		}
+	}
+
+	// Come back to the branch, or the detached HEAD, the rewrite ended on
+	var back []string
+	if branch := e.currentBranch(); branch != "" {
+		back = []string{branch}
+	} else {
+		head, err := e.resolveCommit("HEAD")
+		if err != nil {
+			return err
+		}
+		back = []string{"--detach", head}
+	}
+
+	failed := ""
+	var execErr error
+	for _, hash := range created {
+		e.infof("Executing: %s (at %s)\n", e.exec, hash[:7])
+		if execErr = e.checkout("--detach", hash); execErr != nil {
+			break
+		}
+		if err := e.runUserCommand(e.exec, git.Environ()); err != nil {
+			failed, execErr = hash, err
+			break
+		}
+	}
+
+	if err := e.checkout(back...); err != nil {
+		return fmt.Errorf("failed to return to the rewritten history after --exec: %w", err)
+	}
+	if execErr == nil {
+		return nil
+	}
+
+	// The rewritten history has the original's final tree, so this only moves the branch
+	if err := e.rollBack(originalHead); err != nil {
+		return fmt.Errorf("--exec failed (%v) and the rewrite could not be undone: %w", execErr, err)
+	}
+	if failed == "" {
+		return fmt.Errorf("--exec could not check out a split commit, rewrite undone: %w", execErr)
+	}
+	return fmt.Errorf("--exec %q failed on %s, rewrite undone: %w", e.exec, failed[:7], execErr)
+}
+
+// checkout runs git checkout quietly with args
+func (e *Extractor) checkout(args ...string) error {
+	cmd := e.repo.Command(e.ctx, append([]string{"checkout", "-q"}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git checkout %s failed: %w, output: %s", strings.Join(args, " "), err, string(output))
+	}
+	return nil
+}
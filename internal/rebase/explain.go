@@ -0,0 +1,45 @@
+// ABOUTME: Reasons behind the per-commit decisions of a plan
+// ABOUTME: Explains why each commit in the range is split or left alone
+
+package rebase
+
+import "fmt"
+
+// SetExplain makes the dry-run preview list every commit with the reason for its classification
+func (e *Extractor) SetExplain(explain bool) {
+	e.explain = explain
+}
+
+// explainCommit returns why commit is split or left alone
+func (e *Extractor) explainCommit(commit CommitInfo) string {
+	analyzer := e.newAnalyzer().forCommit(commit.Files)
+	targets, others := 0, 0
+	for _, file := range commit.Files {
+		if analyzer.isTargetFile(file) {
+			targets++
+		} else {
+			others++
+		}
+	}
+
+	switch {
+	case len(commit.Files) == 0:
+		return "skipped: no files changed"
+	case targets == 0:
+		return "skipped: no target files"
+	case others == 0:
+		return "skipped: only target files"
+	case e.override(commit.Hash).Skip:
+		return fmt.Sprintf("skipped: kept whole by the plan (%s + %s)", countOf(targets, "target file"), countOf(others, "other"))
+	default:
+		return fmt.Sprintf("split: %s + %s", countOf(targets, "target file"), countOf(others, "other"))
+	}
+}
+
+// countOf formats n with noun, pluralized by adding an s
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
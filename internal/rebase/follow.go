@@ -0,0 +1,106 @@
+// ABOUTME: Follows target files through renames in the range, like git log --follow
+// ABOUTME: Commits on both sides of a rename see the target under the name it had at the time
+
+package rebase
+
+import (
+	"fmt"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetFollow sets whether targets are followed through renames in the range.
+// It is on by default.
+func (e *Extractor) SetFollow(follow bool) {
+	e.follow = follow
+}
+
+// matchTargets returns the targets plus the other names they had in the range
+func (e *Extractor) matchTargets() []string {
+	targets := append([]string{}, e.targetFiles...)
+	for _, target := range e.targetFiles {
+		targets = append(targets, e.followedNames[target]...)
+	}
+	return targets
+}
+
+// targetNames returns target plus the other names it had in the range
+func (e *Extractor) targetNames(target string) []string {
+	return append([]string{target}, e.followedNames[target]...)
+}
+
+// followedTarget returns the target that path is, or was renamed from or to
+func (e *Extractor) followedTarget(path string) string {
+	for _, target := range e.targetFiles {
+		if NewAnalyzer(e.repoDir, e.targetNames(target)...).isTargetFile(path) {
+			return target
+		}
+	}
+	return ""
+}
+
+// followRenames records the other names the target files had in from..to,
+// in either direction, so a target given by its old or its new name is
+// matched on both sides of the rename
+func (e *Extractor) followRenames(from, to string) {
+	e.followedNames = make(map[string][]string)
+	if !e.follow {
+		return
+	}
+
+	renames, err := e.listRenames(from, to)
+	if err != nil {
+		// Only the renamed halves are missed; every target is still matched by name
+		e.logWarn("not following renames", err)
+		return
+	}
+
+	for changed := true; changed; {
+		changed = false
+		analyzer := NewAnalyzer(e.repoDir, e.matchTargets()...)
+		for _, r := range renames {
+			fromMatches, toMatches := analyzer.isTargetFile(r.From), analyzer.isTargetFile(r.To)
+			var known, name string
+			switch {
+			case fromMatches && !toMatches:
+				e.verbosef("Following %s, renamed to %s\n", r.From, r.To)
+				known, name = r.From, r.To
+			case toMatches && !fromMatches:
+				e.verbosef("Following %s, renamed from %s\n", r.To, r.From)
+				known, name = r.To, r.From
+			default:
+				continue
+			}
+			target := e.followedTarget(known)
+			e.followedNames[target] = append(e.followedNames[target], name)
+			changed = true
+			break
+		}
+	}
+}
+
+// listRenames lists the file renames in from..to, oldest first
+func (e *Extractor) listRenames(from, to string) ([]git.Rename, error) {
+	return e.history().Renames(e.ctx, from, to)
+}
+
+// renamePartners returns the other side of every rename of a target file
+// between parent and commit
+func (e *Extractor) renamePartners(parent, commit string) ([]string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "diff-tree", "-r", "-M", "--diff-filter=R", "--name-status", "-z", parent, commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find renames in %s: %w", commit[:7], err)
+	}
+
+	analyzer := e.newAnalyzer()
+	var partners []string
+	for _, r := range git.ParseRenames(output) {
+		fromMatches, toMatches := analyzer.isTargetFile(r.From), analyzer.isTargetFile(r.To)
+		if fromMatches && !toMatches {
+			partners = append(partners, r.To)
+		} else if toMatches && !fromMatches {
+			partners = append(partners, r.From)
+		}
+	}
+	return partners, nil
+}
@@ -0,0 +1,115 @@
+// ABOUTME: Fuzz targets for split message generation and target path matching
+// ABOUTME: Run with "go test ./internal/rebase -run '^$' -fuzz FuzzSplitMessages" (or FuzzMatchTargets)
+
+package rebase
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func FuzzSplitMessages(f *testing.F) {
+	for _, seed := range []struct{ message, target string }{
+		{"Fix user authentication bug", "target.txt"},
+		{"Subject\n\nBody line\n\nSigned-off-by: A <a@example.com>\nChange-Id: I0123456789abcdef0123456789abcdef01234567", "config/"},
+		{"Subject\n\nChange-Id: Iaaaa\n\nChange-Id: Ibbbb\n", "a b/c.txt"},
+		{"ghstack-source-id: 1\n\ncommit-id: abcd\nPull-Request: https://example.com/1", "\"quoted.txt\""},
+		{"Ünïcödé ✓ 修复\r\n\r\nCRLF body\r\n", "docs/ünï.md"},
+		{"\n\n\n", "../outside.txt"},
+		{"", "./dot.txt"},
+		{"\xff\xfe invalid utf-8", "dir\\ with\\ escapes/"},
+		{strings.Repeat("A long line of commit message text. ", 3000), "target.txt"},
+	} {
+		f.Add(seed.message, seed.target)
+	}
+
+	f.Fuzz(func(t *testing.T, message, target string) {
+		first, second := GenerateSplitMessages(message, []string{target})
+		if !strings.HasPrefix(first, message) || !strings.HasSuffix(second, message) {
+			t.Fatalf("Expected both messages to keep the original:\n%q\n%q", first, second)
+		}
+
+		e := NewExtractor("", target)
+		remaining, extracted := e.splitMessages(CommitInfo{Message: message})
+		if utf8.ValidString(message) && utf8.ValidString(target) && (!utf8.ValidString(remaining) || !utf8.ValidString(extracted)) {
+			t.Fatalf("Expected valid UTF-8 messages, got %q and %q", remaining, extracted)
+		}
+
+		// The remaining commit keeps every line of the original, with the
+		// stack trailers moved to its last paragraph
+		remainingLines := make(map[string]bool)
+		for _, line := range strings.Split(remaining, "\n") {
+			remainingLines[line] = true
+		}
+		for _, line := range strings.Split(message, "\n") {
+			if !remainingLines[line] {
+				t.Fatalf("Expected the remaining message to keep %q, got %q", line, remaining)
+			}
+		}
+		rest, trailers := cutStackTrailers(message)
+		if len(trailers) > 0 {
+			if !strings.HasSuffix(remaining, "\n\n"+strings.Join(trailers, "\n")) {
+				t.Fatalf("Expected the stack trailers %q to end the remaining message, got %q", trailers, remaining)
+			}
+			if !strings.HasSuffix(extracted, rest) {
+				t.Fatalf("Expected the extracted message to drop only the stack trailers, got %q", extracted)
+			}
+		}
+	})
+}
+
+func FuzzMatchTargets(f *testing.F) {
+	for _, seed := range []struct{ file, other, target string }{
+		{"target.txt", "main.go", "target.txt"},
+		{"config/settings.json", "main.go", "config/"},
+		{"config", "config/settings.json", "config/"},
+		{"a b/c d.txt", "main.go", "a b/"},
+		{"\"quoted\".txt", "main.go", "\"quoted\".txt"},
+		{"dir\\ with\\ escapes/file", "main.go", "dir\\ with\\ escapes/"},
+		{"../outside.txt", "main.go", "../outside.txt"},
+		{"src/target.txt", "main.go", "./src/target.txt"},
+		{"docs/Ünïcödé.md", "DOCS/ünïcödé.md", "docs/ünïcödé.md"},
+		{"\xff\xfe", "\xfe", "\xff/"},
+	} {
+		f.Add(seed.file, seed.other, seed.target)
+	}
+
+	f.Fuzz(func(t *testing.T, file, other, target string) {
+		if file == "" || other == "" || file == other {
+			t.Skip()
+		}
+		files := []string{file, other}
+		analyzer := NewAnalyzer("", target).forCommit(files)
+
+		for _, f := range files {
+			if !matchesTarget(f, target) {
+				continue
+			}
+			// A target only names itself, or what is under it if it ends in "/"
+			if f != target && !(strings.HasSuffix(target, "/") && strings.HasPrefix(f, target)) {
+				t.Fatalf("Expected %q not to match %q", f, target)
+			}
+			if !analyzer.isTargetFile(f) {
+				t.Fatalf("Expected %q to stay a target within the commit", f)
+			}
+		}
+
+		commits := []CommitInfo{{Hash: "0000000", Files: files}}
+		unmatched := findUnmatchedTargets([]string{target}, nil, commits)
+		if matched := slices.ContainsFunc(files, analyzer.isTargetFile); matched != (len(unmatched) == 0) {
+			t.Fatalf("Expected %q to be unmatched only when it matches neither %q nor %q", target, file, other)
+		}
+
+		// Taking a suggestion makes the target match
+		for _, target := range unmatched {
+			for _, suggestion := range target.Suggestions {
+				suggested := NewAnalyzer("", suggestion).forCommit(files)
+				if !slices.ContainsFunc(files, suggested.isTargetFile) {
+					t.Fatalf("Suggestion %q for %q matches neither %q nor %q", suggestion, target.Target, file, other)
+				}
+			}
+		}
+	})
+}
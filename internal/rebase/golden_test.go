@@ -0,0 +1,151 @@
+// ABOUTME: Golden-file tests for the text, JSON, and markdown renderings of dry runs and run reports
+// ABOUTME: Run "go test ./internal/rebase -run Golden -update" to rewrite testdata/*.golden after a deliberate change
+
+package rebase
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"github.com/obra/git-rebase-extract-file/internal/testutils"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got with testdata/name, or rewrites the file with -update
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to update %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path) // #nosec G304 -- path is inside testdata
+	if err != nil {
+		t.Fatalf("Failed to read %s (run with -update to create it): %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("Output differs from %s (run with -update to accept it):\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// goldenRepo builds a history whose commit hashes are the same on every run:
+// a mixed commit, an unrelated one, a commit by someone else, and a commit
+// touching only the target. It returns the base commit.
+func goldenRepo(t *testing.T) (*testutils.TestRepo, string) {
+	repo := testutils.NewTestRepo(t)
+	clock := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	commit := func(message string, opts testutils.CommitOptions) string {
+		clock = clock.Add(time.Hour)
+		opts.AuthorDate, opts.CommitterDate = clock, clock
+		return repo.CommitWith(message, opts)
+	}
+
+	repo.WriteFile("main.go", "package main\n")
+	repo.WriteFile("config/settings.json", "{}\n")
+	base := commit("Initial commit", testutils.CommitOptions{})
+
+	repo.WriteFile("config/settings.json", "{\"debug\": true}\n")
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	commit("Add main | enable debug\n\nThe body explains why.", testutils.CommitOptions{})
+
+	repo.WriteFile("README.md", "# Project\n")
+	commit("Add README", testutils.CommitOptions{})
+
+	repo.WriteFile("config/settings.json", "{\"debug\": false}\n")
+	repo.WriteFile("util.go", "package main\n\nfunc util() {}\n")
+	commit("Add util", testutils.CommitOptions{AuthorName: "Teammate", AuthorEmail: "teammate@example.com"})
+
+	repo.WriteFile("config/settings.json", "{\"debug\": false, \"port\": 8080}\n")
+	commit("Set the port", testutils.CommitOptions{})
+
+	// Rewritten commits get the same committer date as well
+	t.Setenv("GIT_COMMITTER_DATE", clock.Add(time.Hour).Format(time.RFC3339))
+	return repo, base
+}
+
+func TestGolden_DryRun(t *testing.T) {
+	// The reports include conflict prediction
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+	repo, base := goldenRepo(t)
+
+	extractor := NewExtractor(repo.Dir, "config/")
+	report, err := extractor.DryRun(t.Context(), base, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	encoded, err := extractor.RenderJSON(report)
+	if err != nil {
+		t.Fatalf("RenderJSON failed: %v", err)
+	}
+
+	assertGolden(t, "dry-run.txt.golden", extractor.Render(report))
+	assertGolden(t, "dry-run.json.golden", string(encoded))
+	assertGolden(t, "dry-run.md.golden", extractor.RenderMarkdown(report))
+
+	extractor.SetExplain(true)
+	extractor.SetShowDiff(true)
+	report, err = extractor.DryRun(t.Context(), base, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	assertGolden(t, "dry-run-explain-diff.txt.golden", extractor.Render(report))
+}
+
+// runDuration matches the only part of a run report that changes between runs
+var runDuration = regexp.MustCompile(`"durationMs": \d+`)
+
+func TestGolden_RunReport(t *testing.T) {
+	// The report names the plumbing engine, which conflict prediction enables
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+	for _, format := range []string{"json", "markdown"} {
+		t.Run(format, func(t *testing.T) {
+			repo, base := goldenRepo(t)
+			reportPath := filepath.Join(t.TempDir(), "report")
+
+			extractor := NewExtractor(repo.Dir, "config/")
+			extractor.SetVerbosity(VerbosityQuiet)
+			extractor.SetRewriteOthers(true)
+			extractor.SetBackupPrefix("golden/")
+			extractor.SetReportPath(reportPath)
+			if err := extractor.SetReportFormat(format); err != nil {
+				t.Fatalf("SetReportFormat failed: %v", err)
+			}
+			if err := extractor.Extract(t.Context(), base, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			content, err := os.ReadFile(reportPath) // #nosec G304 -- path is inside the test's temp dir
+			if err != nil {
+				t.Fatalf("Failed to read report: %v", err)
+			}
+			// The backup branch is named after the branch git init created
+			backup := strings.TrimSpace(repo.Git("branch", "--list", "--format=%(refname:short)", "golden/*"))
+			output := strings.ReplaceAll(string(content), backup, "golden/BRANCH")
+
+			if format == "json" {
+				var report RunReport
+				if err := json.Unmarshal(content, &report); err != nil {
+					t.Fatalf("Failed to decode report: %v", err)
+				}
+				assertGolden(t, "run-report.json.golden", runDuration.ReplaceAllString(output, `"durationMs": 0`))
+				return
+			}
+			assertGolden(t, "run-report.md.golden", output)
+		})
+	}
+}
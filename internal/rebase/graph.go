@@ -0,0 +1,60 @@
+// ABOUTME: Before/after commit graph of a planned rewrite for --dry-run --graph
+// ABOUTME: Shows how much the branch grows and where the extracted commits land
+
+package rebase
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Graph renders the commit graph of from..to as it is now, followed by the
+// history the planned rewrite in report would produce
+func (e *Extractor) Graph(ctx context.Context, from, to string, report *DryRunReport) (string, error) {
+	e.ctx = ctx
+	cmd := e.repo.Command(e.ctx, "log", "--graph", "--oneline", "--no-decorate", "--no-color", from+".."+to)
+	before, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit graph: %w", err)
+	}
+
+	// Commits up to the first split keep their hashes; everything after is
+	// rewritten, marked with a prime as in the usual before/after notation
+	var after []string
+	rewritten := false
+	for _, commit := range report.Commits {
+		if !commit.Split {
+			hash := commit.Hash[:7]
+			if rewritten {
+				hash += "'"
+			}
+			after = append(after, fmt.Sprintf("%s %s", e.style.paint(ansiYellow, hash), subject(commit.Message)))
+			continue
+		}
+		rewritten = true
+		remaining := fmt.Sprintf("%s %s", e.style.paint(ansiYellow, commit.Hash[:7]+"'"), subject(commit.RemainingMessage))
+		extracted := fmt.Sprintf("%s %s %s", e.style.paint(ansiYellow, "(new)   "), subject(commit.ExtractedMessage), e.style.paint(ansiCyan, "[extracted]"))
+		if commit.ExtractedFirst {
+			after = append(after, extracted, remaining)
+		} else {
+			after = append(after, remaining, extracted)
+		}
+	}
+
+	var output strings.Builder
+	fmt.Fprintf(&output, "%s\n", e.style.paint(ansiBold, fmt.Sprintf("Before (%d commits):", len(report.Commits))))
+	output.Write(before)
+	fmt.Fprintf(&output, "\n%s\n", e.style.paint(ansiBold, fmt.Sprintf("After (%d commits, +%d):", len(after), len(after)-len(report.Commits))))
+	// Newest first, like git log
+	for i := len(after) - 1; i >= 0; i-- {
+		fmt.Fprintf(&output, "* %s\n", after[i])
+	}
+	return output.String(), nil
+}
+
+// subject returns the first line of a commit message
+func subject(message string) string {
+	first, _, _ := strings.Cut(message, "\n")
+	return first
+}
@@ -0,0 +1,112 @@
+// ABOUTME: Detects local changes hidden by the skip-worktree and assume-unchanged bits
+// ABOUTME: Refuses to run a rebase that would check files out over them
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// hiddenChange is a file whose local changes git doesn't report
+type hiddenChange struct {
+	path string
+	bit  string
+}
+
+// checkHiddenChanges refuses to rebase when a file the range changes has
+// local changes hidden by skip-worktree or assume-unchanged: git status
+// doesn't show them, so the clean-tree check passes, and checking commits
+// out during the rebase would then fail partway or overwrite them. The plumbing path never
+// touches the working tree, so it doesn't need this.
+func (e *Extractor) checkHiddenChanges(commits []CommitInfo) error {
+	hidden, err := e.hiddenChanges(commits)
+	if err != nil || len(hidden) == 0 {
+		return err
+	}
+
+	var list, clear strings.Builder
+	for _, change := range hidden {
+		fmt.Fprintf(&list, "  %s (%s)\n", change.path, change.bit)
+		fmt.Fprintf(&clear, "  git update-index --no-%s -- %s\n", change.bit, change.path)
+	}
+	return fmt.Errorf("these files have local changes that git has been told to ignore, which the rebase could overwrite:\n%s"+
+		"Clear the bits and commit or stash the changes (or rerun with --autostash), then set the bits again afterwards:\n%s",
+		list.String(), strings.TrimSuffix(clear.String(), "\n"))
+}
+
+// hiddenChanges lists the files changed in the range whose skip-worktree or
+// assume-unchanged bit hides a difference between the working tree and the
+// index. Files a sparse checkout left out of the working tree are fine.
+func (e *Extractor) hiddenChanges(commits []CommitInfo) ([]hiddenChange, error) {
+	touched := make(map[string]bool)
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			touched[file] = true
+		}
+	}
+
+	output, err := e.repo.GitOutput(e.ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the working tree: %w", err)
+	}
+	toplevel := strings.TrimSpace(output)
+
+	// -v tags skip-worktree entries with S and assume-unchanged ones in
+	// lowercase; paths are listed from the top so they match commit files
+	cmd := e.repo.Command(e.ctx, "ls-files", "-v", "-z")
+	cmd.Dir = toplevel
+	entries, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list index entries: %w", err)
+	}
+
+	var hidden []hiddenChange
+	for _, record := range git.SplitNul(string(entries)) {
+		if len(record) < 3 {
+			continue
+		}
+		tag, path := record[0], record[2:]
+		bit := ""
+		switch {
+		case tag == 'S':
+			bit = "skip-worktree"
+		case tag >= 'a' && tag <= 'z':
+			bit = "assume-unchanged"
+		}
+		if bit == "" || !touched[path] {
+			continue
+		}
+		if _, err := os.Lstat(filepath.Join(toplevel, path)); err != nil {
+			continue
+		}
+		changed, err := e.differsFromIndex(toplevel, path)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			hidden = append(hidden, hiddenChange{path: path, bit: bit})
+		}
+	}
+	return hidden, nil
+}
+
+// differsFromIndex reports whether the working tree copy of path, cleaned
+// the way git add would, differs from its index entry
+func (e *Extractor) differsFromIndex(toplevel, path string) (bool, error) {
+	staged, err := e.repo.GitOutput(e.ctx, "rev-parse", ":"+path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the index entry of %s: %w", path, err)
+	}
+	cmd := e.repo.Command(e.ctx, "hash-object", "--", path)
+	cmd.Dir = toplevel
+	worktree, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return strings.TrimSpace(staged) != strings.TrimSpace(string(worktree)), nil
+}
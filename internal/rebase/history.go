@@ -0,0 +1,89 @@
+// ABOUTME: Checks for history rewritten on the fly by replace refs, grafts, and shallow boundaries
+// ABOUTME: Refuses ranges where the analysis and the rebase would see different parents
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// checkHistory refuses ranges whose history git presents differently
+// depending on how it is read: the analysis lists commits with replacements
+// and grafts applied, but rewritten commits are built on the real parents
+func (e *Extractor) checkHistory(from, to string) error {
+	// Without git, the backend reads the real parents, ignoring grafts and
+	// replacements, and fails on the missing ones of a shallow clone
+	if e.withoutGit {
+		return nil
+	}
+	// Both live in the common directory, shared by linked worktrees
+	grafts, err := e.gitPath("info/grafts")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(grafts); err == nil {
+		return fmt.Errorf("%s rewrites parents in a way the rebase can't reproduce; remove it, or convert it with \"git replace --convert-graft-file\" and retry with GIT_NO_REPLACE_OBJECTS=1", grafts)
+	}
+
+	commits, err := e.repo.RevList(e.ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to list commits in %s..%s: %w", from, to, err)
+	}
+
+	shallow, err := e.gitPath("shallow")
+	if err != nil {
+		return err
+	}
+	if err := checkShallow(shallow, commits); err != nil {
+		return err
+	}
+	// With replacements disabled every command agrees on the real history
+	if os.Getenv("GIT_NO_REPLACE_OBJECTS") != "" {
+		return nil
+	}
+	return e.checkReplaceRefs(from, to, commits)
+}
+
+// checkShallow refuses ranges that reach the boundary of a shallow clone,
+// whose shallow file lists the commits that have parents that aren't there
+func checkShallow(shallow string, commits []string) error {
+	content, err := os.ReadFile(shallow) // #nosec G304 -- path is inside the git directory
+	if err != nil {
+		return nil
+	}
+	for _, boundary := range strings.Fields(string(content)) {
+		if slices.Contains(commits, boundary) {
+			return fmt.Errorf("commit %.7s in the range is at the boundary of this shallow clone, so its parents are missing; fetch more history first (git fetch --deepen=<n> or --unshallow)", boundary)
+		}
+	}
+	return nil
+}
+
+// checkReplaceRefs refuses ranges that refs/replace/* changes
+func (e *Extractor) checkReplaceRefs(from, to string, commits []string) error {
+	output, err := e.repo.GitOutput(e.ctx, "for-each-ref", "--format=%(refname:strip=2)", "refs/replace/")
+	if err != nil {
+		return fmt.Errorf("failed to list replace refs: %w", err)
+	}
+	replaced := strings.Fields(output)
+	if len(replaced) == 0 {
+		return nil
+	}
+
+	for _, commit := range commits {
+		if slices.Contains(replaced, commit) {
+			return fmt.Errorf("refs/replace/%s replaces commit %.7s in the range, so the analysis and the rebase would disagree about history; remove it with \"git replace -d %.7s\" or set GIT_NO_REPLACE_OBJECTS=1 to ignore replacements", commit, commit, commit)
+		}
+	}
+	unreplaced, err := e.repo.GitOutput(e.ctx, "--no-replace-objects", "rev-list", "--reverse", from+".."+to)
+	if err != nil {
+		return fmt.Errorf("failed to list commits without replacements: %w", err)
+	}
+	if !slices.Equal(strings.Fields(unreplaced), commits) {
+		return fmt.Errorf("replace refs change which commits are in %s..%s, so the analysis and the rebase would disagree about history; remove them (git replace -d) or set GIT_NO_REPLACE_OBJECTS=1 to ignore replacements", from, to)
+	}
+	return nil
+}
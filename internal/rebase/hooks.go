@@ -0,0 +1,294 @@
+// ABOUTME: Runs the repository's git hooks around commits and rewrites git itself doesn't see
+// ABOUTME: Gives split commits the commit hooks of git commit and reports the rewrites git misses to post-rewrite
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// errHookChangedTree stops the plumbing rewrite once the pre-commit hook
+// changes a split commit: only a rebase carries such changes into the
+// commits that follow
+var errHookChangedTree = errors.New("the pre-commit hook changed a split commit")
+
+// rewrite pairs an original commit with one of the commits that replaced it
+type rewrite struct {
+	old string
+	new string
+}
+
+// hookPath returns the path of the named hook, or "" if it isn't installed
+// and executable. git resolves core.hooksPath for us.
+func (e *Extractor) hookPath(name string) (string, error) {
+	path, err := e.gitPath("hooks/" + name)
+	if err != nil {
+		return "", err
+	}
+	// Windows reports no execute bits, so hooks, which need git's bundled
+	// shell there, are never run
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+		return "", nil
+	}
+	return path, nil
+}
+
+// SetNoVerify skips the pre-commit and commit-msg hooks for split commits,
+// like git commit --no-verify
+func (e *Extractor) SetNoVerify(noVerify bool) {
+	e.noVerify = noVerify
+}
+
+// SetDeferHooks holds the repository's hooks back until the rewrite is done,
+// for repositories whose hooks are too slow to run on every split commit.
+// While splitting, git runs with core.hooksPath pointing nowhere and only
+// commit-msg, which shapes the messages, runs for split commits. Afterwards
+// pre-commit checks the final tree, undoing the rewrite if it fails, and
+// post-rewrite hears about the whole rewrite at once.
+func (e *Extractor) SetDeferHooks(deferHooks bool) {
+	e.deferHooks = deferHooks
+}
+
+// runHook runs the named hook, if installed, from the top of the working
+// tree with input on stdin and env as its environment (nil for git.Environ).
+// Its output goes to the error output, as git does.
+func (e *Extractor) runHook(name, input string, env []string, args ...string) error {
+	top, err := e.workTree()
+	if err != nil {
+		return err
+	}
+	return e.runHookIn(top, name, input, env, args...)
+}
+
+// runHookIn runs the named hook like runHook, but from dir
+func (e *Extractor) runHookIn(dir, name, input string, env []string, args ...string) error {
+	path, err := e.hookPath(name)
+	if err != nil || path == "" {
+		return err
+	}
+
+	e.debug("running hook", "hook", name)
+	cmd := exec.CommandContext(e.ctx, path, args...) // #nosec G204 -- the hook is configured by the repository owner
+	cmd.Dir = dir
+	if env == nil {
+		env = git.Environ()
+	}
+	cmd.Env = env
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Stdout = e.errOut
+	cmd.Stderr = e.errOut
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %w", name, err)
+	}
+	return nil
+}
+
+// runPostRewrite passes rewrites to the post-rewrite hook as "git rebase"
+// would. Like git, a failing hook doesn't fail the run.
+func (e *Extractor) runPostRewrite(rewrites []rewrite) {
+	if len(rewrites) == 0 {
+		return
+	}
+	var input strings.Builder
+	for _, r := range rewrites {
+		fmt.Fprintf(&input, "%s %s\n", r.old, r.new)
+	}
+	if err := e.runHook("post-rewrite", input.String(), nil, "rebase"); err != nil {
+		e.warnf("%v\n", err)
+	}
+}
+
+// commitSplit creates one half of a split like commitTree, running the
+// commit hooks git commit would: pre-commit against tree on parent, whose
+// result is committed, then commit-msg, then post-commit. It returns the
+// commit and its tree, which is tree itself unless pre-commit changed files.
+func (e *Extractor) commitSplit(tree, parent string, meta commitMeta, message string) (string, string, error) {
+	var err error
+	if !e.noVerify && !e.deferHooks {
+		if tree, err = e.runPreCommit(tree, parent); err != nil {
+			return "", "", err
+		}
+	}
+	if !e.noVerify {
+		if message, err = e.runCommitMsg(message); err != nil {
+			return "", "", err
+		}
+	}
+
+	hash, err := e.commitTree(tree, parent, meta, message)
+	if err != nil {
+		return "", "", err
+	}
+	// As with git commit, post-commit can't undo the commit
+	if !e.deferHooks {
+		if err := e.runHook("post-commit", "", nil); err != nil {
+			e.warnf("%v\n", err)
+		}
+	}
+	return hash, tree, nil
+}
+
+// afterHookedHalf returns the tree of the second half of a split whose first
+// half, meant to have firstTree, was committed with hooked, which pre-commit
+// changed: hooked with every path the second half changes taken from source.
+// Starting from the original tree instead would undo the hook's changes.
+func (e *Extractor) afterHookedHalf(firstTree, hooked, source string) (string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "diff-tree", "-r", "-z", "--name-only", firstTree, source+"^{tree}")
+	if err != nil {
+		return "", fmt.Errorf("failed to compare the halves of %s: %w", source[:7], err)
+	}
+	changed := git.SplitNul(output)
+	listing, err := e.backend.ListTree(e.ctx, source)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tree of %s: %w", source[:7], err)
+	}
+
+	var staged []git.TreeEntry
+	for _, path := range changed {
+		// Paths missing from source are staged as deletions
+		entry := git.TreeEntry{Path: path}
+		if i := slices.IndexFunc(listing, func(entry git.TreeEntry) bool { return entry.Path == path }); i >= 0 {
+			entry = listing[i]
+		}
+		staged = append(staged, entry)
+	}
+	tree, err := e.gitBackend.Stage(e.ctx, hooked, staged)
+	if err != nil {
+		return "", err
+	}
+	e.record(StagedEvent{Base: hooked, Tree: tree, Paths: changed})
+	return tree, nil
+}
+
+// runDeferredHooks runs the hooks SetDeferHooks held back. post-rewrite
+// gets every rewrite of the run if git rebase, whose own call was
+// suppressed, did the rewriting. pre-commit then checks the final tree;
+// the rewrite is undone if it fails, and changes it makes aren't committed.
+func (e *Extractor) runDeferredHooks(base, originalHead string, commits []CommitInfo, engine string) error {
+	if !e.deferHooks {
+		return nil
+	}
+	if engine == "rebase" {
+		rewrites, err := e.runRewrites(base, commits)
+		if err != nil {
+			e.warnf("post-rewrite hook not run: %v\n", err)
+		}
+		e.runPostRewrite(rewrites)
+	}
+	if e.noVerify {
+		return nil
+	}
+
+	tree, err := e.repo.GitOutput(e.ctx, "rev-parse", "HEAD^{tree}")
+	if err != nil {
+		return fmt.Errorf("failed to read the rewritten tree: %w", err)
+	}
+	tree = strings.TrimSpace(tree)
+	e.verbosef("Running the pre-commit hook on the rewritten HEAD\n")
+	// The hook gets HEAD at the base, so it sees the whole rewrite as staged
+	checked, hookErr := e.runPreCommit(tree, base)
+	if hookErr == nil {
+		if checked != tree {
+			e.warnf("The pre-commit hook changed files in the rewritten HEAD; its changes were not committed\n")
+		}
+		return nil
+	}
+	if err := e.rollBack(originalHead); err != nil {
+		return fmt.Errorf("%v, and the rewrite could not be undone: %w", hookErr, err)
+	}
+	return fmt.Errorf("%w, rewrite undone", hookErr)
+}
+
+// runRewrites lists the rewrite of every commit of the run as git rebase
+// reports them, with both halves of a split against the original
+func (e *Extractor) runRewrites(base string, commits []CommitInfo) ([]rewrite, error) {
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return nil, err
+	}
+	var rewrites []rewrite
+	for i, mapping := range mappings {
+		switch {
+		case mapping.Dropped || mapping.Remaining == mapping.Original:
+			continue
+		case !mapping.Split:
+			rewrites = append(rewrites, rewrite{old: mapping.Original, new: mapping.Remaining})
+		case e.extractedFirst(commits[i]):
+			rewrites = append(rewrites, rewrite{old: mapping.Original, new: mapping.Extracted}, rewrite{old: mapping.Original, new: mapping.Remaining})
+		default:
+			rewrites = append(rewrites, rewrite{old: mapping.Original, new: mapping.Remaining}, rewrite{old: mapping.Original, new: mapping.Extracted})
+		}
+	}
+	return rewrites, nil
+}
+
+// runPreCommit runs the pre-commit hook as git commit would for a commit of
+// tree on parent, and returns the tree of the index the hook leaves behind,
+// with the file modes of tree. That is tree itself when the hook changed
+// nothing. The hook runs in a worktree of its own, so git diff --cached
+// shows the commit's changes and files it fixes up are the commit's own.
+func (e *Extractor) runPreCommit(tree, parent string) (string, error) {
+	if path, err := e.hookPath("pre-commit"); err != nil || path == "" {
+		return tree, err
+	}
+
+	worktree, err := e.addHookWorktree(tree, parent)
+	if err != nil {
+		return "", err
+	}
+	defer worktree.remove()
+	if err := e.runHookIn(worktree.dir, "pre-commit", "", worktree.env); err != nil {
+		return "", fmt.Errorf("%w (use --no-verify to skip it)", err)
+	}
+	if err := e.restoreModes(tree, worktree.dir, worktree.env); err != nil {
+		return "", err
+	}
+
+	written, err := worktree.output(e, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	original, err := worktree.output(e, "rev-parse", tree+"^{tree}")
+	if err != nil || written == original {
+		return tree, err
+	}
+	return written, nil
+}
+
+// runCommitMsg passes message to the commit-msg hook in a file and returns
+// the message as the hook leaves it
+func (e *Extractor) runCommitMsg(message string) (string, error) {
+	if path, err := e.hookPath("commit-msg"); err != nil || path == "" {
+		return message, err
+	}
+
+	file, err := os.CreateTemp(e.tempDir, "git-rebase-extract-msg-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create message file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(message)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write message file: %w", err)
+	}
+
+	if err := e.runHook("commit-msg", "", nil, file.Name()); err != nil {
+		return "", fmt.Errorf("%w (use --no-verify to skip it)", err)
+	}
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", fmt.Errorf("failed to read message file: %w", err)
+	}
+	return string(edited), nil
+}
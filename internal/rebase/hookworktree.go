@@ -0,0 +1,100 @@
+// ABOUTME: Throwaway worktree the pre-commit hook of a split commit runs in
+// ABOUTME: Puts HEAD at the commit's parent with its tree checked out and staged, as git commit would leave them
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// hookWorktree is a linked worktree set up for one run of a commit hook
+type hookWorktree struct {
+	// dir is the top of the worktree, where the hook runs
+	dir string
+	// gitDir is the worktree's own git directory, which git keeps under the
+	// common directory
+	gitDir string
+	// indexDir holds the index, which is kept with our other temporary files
+	indexDir string
+	// env is the environment for the hook and git commands in the worktree
+	env []string
+}
+
+// addHookWorktree creates a worktree with HEAD detached at parent and tree
+// in its index and files. Our own worktree keeps the state of the rebase or
+// the original HEAD, so git diff --cached there shows the wrong changes.
+func (e *Extractor) addHookWorktree(tree, parent string) (*hookWorktree, error) {
+	dir, err := os.MkdirTemp(e.tempDir, "git-rebase-extract-hook-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hook worktree: %w", err)
+	}
+	// --no-checkout skips the checkout of parent and, with it, post-checkout
+	cmd := e.repo.Command(e.ctx, "worktree", "add", "-q", "--detach", "--no-checkout", dir, parent)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to add hook worktree: %w, output: %s", err, string(output))
+	}
+	// git finds the worktree from its directory, so the variables that
+	// point at ours are dropped
+	worktree := &hookWorktree{dir: dir, env: withoutEnv(git.Environ(), "GIT_DIR", "GIT_WORK_TREE", "GIT_COMMON_DIR")}
+
+	gitDir, err := worktree.output(e, "rev-parse", "--absolute-git-dir")
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	worktree.gitDir = gitDir
+	// The hook sees the index in GIT_INDEX_FILE, as with git commit
+	if worktree.indexDir, err = os.MkdirTemp(e.tempDir, "git-rebase-extract-index-*"); err != nil {
+		worktree.remove()
+		return nil, fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	worktree.env = append(worktree.env, "GIT_INDEX_FILE="+filepath.Join(worktree.indexDir, "index"))
+	if _, err := worktree.output(e, "read-tree", "--reset", "-u", tree); err != nil {
+		worktree.remove()
+		return nil, err
+	}
+	return worktree, nil
+}
+
+// output runs a git command in the worktree and returns its trimmed output
+func (w *hookWorktree) output(e *Extractor, args ...string) (string, error) {
+	cmd := e.repo.Command(e.ctx, args...)
+	cmd.Dir = w.dir
+	cmd.Env = w.env
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed in the hook worktree: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// remove deletes the worktree along with git's record of it, as git
+// worktree prune would once the directory is gone
+func (w *hookWorktree) remove() {
+	_ = os.RemoveAll(w.dir)
+	if w.gitDir != "" {
+		_ = os.RemoveAll(w.gitDir)
+	}
+	if w.indexDir != "" {
+		_ = os.RemoveAll(w.indexDir)
+	}
+}
+
+// withoutEnv returns env without the named variables
+func withoutEnv(env []string, names ...string) []string {
+	var filtered []string
+	for _, variable := range env {
+		name, _, _ := strings.Cut(variable, "=")
+		if !slices.Contains(names, name) {
+			filtered = append(filtered, variable)
+		}
+	}
+	return filtered
+}
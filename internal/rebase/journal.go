@@ -0,0 +1,144 @@
+// ABOUTME: Append-only journal of completed splits for resuming after a crash
+// ABOUTME: Records the run parameters and the HEAD reached after each split, fsynced per entry
+
+package rebase
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// journalFileName is the name of the journal file inside the git directory
+const journalFileName = "extract-file-journal"
+
+// journalEntry is a single line of the journal
+type journalEntry struct {
+	Event        string   `json:"event"`
+	From         string   `json:"from,omitempty"`
+	OriginalHead string   `json:"originalHead,omitempty"`
+	BackupBranch string   `json:"backupBranch,omitempty"`
+	Targets      []string `json:"targets,omitempty"`
+	Commit       string   `json:"commit,omitempty"`
+	Head         string   `json:"head,omitempty"`
+}
+
+// journal tracks the progress of a run so it can be resumed
+type journal struct {
+	path   string
+	start  journalEntry
+	splits []journalEntry
+}
+
+// loadJournal reads an existing journal from gitDir, returning nil if none exists
+func loadJournal(gitDir string) (*journal, error) {
+	path := filepath.Join(gitDir, journalFileName)
+
+	file, err := os.Open(path) // #nosec G304 -- path is inside the git directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	j := &journal{path: path}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn final line means the process died mid-write; the split
+			// it described never completed from our point of view
+			break
+		}
+		switch entry.Event {
+		case "start":
+			j.start = entry
+		case "split":
+			j.splits = append(j.splits, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	if j.start.Event == "" {
+		return nil, fmt.Errorf("journal %s is corrupt; remove it to start over", path)
+	}
+
+	return j, nil
+}
+
+// startJournal creates a new journal in gitDir recording the run parameters
+func startJournal(gitDir string, start journalEntry) (*journal, error) {
+	start.Event = "start"
+	j := &journal{path: filepath.Join(gitDir, journalFileName), start: start}
+	if err := j.append(start); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// recordSplit appends a completed split and the HEAD it produced
+func (j *journal) recordSplit(commit, head string) error {
+	entry := journalEntry{Event: "split", Commit: commit, Head: head}
+	if err := j.append(entry); err != nil {
+		return err
+	}
+	j.splits = append(j.splits, entry)
+	return nil
+}
+
+// append writes an entry and syncs it to disk before returning
+func (j *journal) append(entry journalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	return nil
+}
+
+// lastHead returns the HEAD the repository should be at when resuming
+func (j *journal) lastHead() string {
+	if len(j.splits) == 0 {
+		return j.start.OriginalHead
+	}
+	return j.splits[len(j.splits)-1].Head
+}
+
+// completed reports whether the given original commit was already split
+func (j *journal) completed(hash string) bool {
+	for _, split := range j.splits {
+		if split.Commit == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the journal was written for the same invocation
+func (j *journal) matches(from string, targets []string) bool {
+	return j.start.From == from && slices.Equal(j.start.Targets, targets)
+}
+
+// remove deletes the journal once the run no longer needs resuming
+func (j *journal) remove() {
+	_ = os.Remove(j.path) // A leftover journal is detected and verified on the next run
+}
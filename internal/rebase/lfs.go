@@ -0,0 +1,67 @@
+// ABOUTME: Detection of Git LFS tracked files in the range
+// ABOUTME: Warns when LFS is required but missing; pointers themselves are moved between trees untouched
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lfsPaths returns the files changed by commits that .gitattributes routes
+// through the LFS filter
+func (e *Extractor) lfsPaths(commits []CommitInfo) ([]string, error) {
+	seen := make(map[string]bool)
+	var input strings.Builder
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			if !seen[file] {
+				seen[file] = true
+				input.WriteString(file + "\x00")
+			}
+		}
+	}
+	if input.Len() == 0 {
+		return nil, nil
+	}
+
+	cmd := e.repo.Command(e.ctx, "check-attr", "-z", "--stdin", "filter")
+	cmd.Stdin = strings.NewReader(input.String())
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attributes: %w", err)
+	}
+
+	// -z output is path, attribute, value triples
+	var paths []string
+	fields := strings.Split(string(output), "\x00")
+	for i := 0; i+2 < len(fields); i += 3 {
+		if fields[i+2] == "lfs" {
+			paths = append(paths, fields[i])
+		}
+	}
+	return paths, nil
+}
+
+// checkLFS warns when the range has LFS tracked files but git lfs isn't
+// installed. Splits copy the pointer blobs between trees, so only the
+// checkouts of a rebase go through the LFS filters.
+func (e *Extractor) checkLFS(commits []CommitInfo) {
+	paths, err := e.lfsPaths(commits)
+	if err != nil {
+		e.logWarn("could not check for Git LFS files", err)
+		return
+	}
+	if len(paths) == 0 {
+		return
+	}
+	e.verbosef("%d files in the range are tracked by Git LFS; their pointers are kept as they are\n", len(paths))
+	if err := e.repo.Command(e.ctx, "lfs", "version").Run(); err != nil {
+		tracked := paths[0] + " is"
+		if len(paths) > 1 {
+			tracked = fmt.Sprintf("%s and %d other files are", paths[0], len(paths)-1)
+		}
+		e.warnf("%s tracked by Git LFS, but git lfs isn't installed; "+
+			"checkouts during a rebase may fail or leave pointer files in the working tree\n", tracked)
+	}
+}
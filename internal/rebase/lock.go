@@ -0,0 +1,95 @@
+// ABOUTME: Per-repository lock preventing concurrent extract runs
+// ABOUTME: Stores owner pid, host, user, and start time so a blocked run can report who holds it
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// lockFileName is the name of the lock file inside the git directory
+const lockFileName = "extract-file.lock"
+
+// repoLock represents a held lock on a repository
+type repoLock struct {
+	path string
+}
+
+// acquireLock creates the lock file in gitDir, failing if another run holds it
+func acquireLock(gitDir string) (*repoLock, error) {
+	path := filepath.Join(gitDir, lockFileName)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("another git-rebase-extract-file run is in progress (%s)\n"+
+				"If that run is no longer active, remove the stale lock: rm %s", describeLock(path), path)
+		}
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+
+	if _, err := file.WriteString(lockOwnerInfo()); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("failed to write lock file: %w", err)
+	}
+
+	return &repoLock{path: path}, nil
+}
+
+// release removes the lock file
+func (l *repoLock) release() {
+	_ = os.Remove(l.path) // A leftover lock is reported on the next run
+}
+
+// lockOwnerInfo describes the current process for the lock file contents
+func lockOwnerInfo() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	username := "unknown"
+	if u, err := user.Current(); err == nil {
+		username = u.Username
+	}
+
+	return fmt.Sprintf("pid=%d\nhost=%s\nuser=%s\nstarted=%s\n",
+		os.Getpid(), host, username, time.Now().Format(time.RFC3339))
+}
+
+// describeLock summarizes the owner recorded in an existing lock file
+func describeLock(path string) string {
+	content, err := os.ReadFile(path) // #nosec G304 -- path is inside the git directory
+	if err != nil {
+		return "owner unknown"
+	}
+
+	fields := make(map[string]string)
+	for _, line := range strings.Split(string(content), "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			fields[key] = value
+		}
+	}
+
+	return fmt.Sprintf("pid %s on %s by %s, started %s",
+		orUnknown(fields["pid"]), orUnknown(fields["host"]), orUnknown(fields["user"]), orUnknown(fields["started"]))
+}
+
+// orUnknown substitutes a placeholder for missing lock fields
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
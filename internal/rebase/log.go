@@ -0,0 +1,117 @@
+// ABOUTME: Leveled output for the Extractor
+// ABOUTME: Routes messages by verbosity, from quiet (errors only) to the full debug trace
+// ABOUTME: The debug trace is structured: slog records with commit, step, and git-args fields
+
+package rebase
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Verbosity controls how much the Extractor prints while it works
+type Verbosity int
+
+const (
+	// VerbosityQuiet prints errors only
+	VerbosityQuiet Verbosity = iota
+	// VerbosityNormal prints progress, warnings, and recovery instructions
+	VerbosityNormal
+	// VerbosityVerbose adds each decision and rewritten commit
+	VerbosityVerbose
+	// VerbosityDebug adds the debug trace, printed as text unless a logger
+	// is set with SetLogger
+	VerbosityDebug
+)
+
+// SetVerbosity sets how much output the Extractor produces
+func (e *Extractor) SetVerbosity(verbosity Verbosity) {
+	e.verbosity = verbosity
+}
+
+// SetOutput sets where regular output goes (stdout by default)
+func (e *Extractor) SetOutput(w io.Writer) {
+	e.out = w
+}
+
+// SetErrorOutput sets where progress and failure details go (stderr by default)
+func (e *Extractor) SetErrorOutput(w io.Writer) {
+	e.errOut = w
+}
+
+// SetDebug enables or disables debug output
+func (e *Extractor) SetDebug(debug bool) {
+	if debug {
+		e.verbosity = VerbosityDebug
+	} else if e.verbosity == VerbosityDebug {
+		e.verbosity = VerbosityNormal
+	}
+}
+
+// SetLogger sends the debug trace to logger instead of the regular output,
+// whatever the verbosity. Records carry their details as attributes, such as
+// "commit" and "step", and every git command the Extractor runs is logged at
+// debug level with its "git-args", directory, exit code, and duration.
+func (e *Extractor) SetLogger(logger *slog.Logger) {
+	e.logger = logger
+	e.repo.SetLogger(logger)
+}
+
+// log returns the logger for the debug trace: the one set with SetLogger,
+// or at VerbosityDebug one printing text to the regular output
+func (e *Extractor) log() *slog.Logger {
+	if e.logger != nil {
+		return e.logger
+	}
+	if e.verbosity < VerbosityDebug {
+		return slog.New(slog.DiscardHandler)
+	}
+	return slog.New(slog.NewTextHandler(e.out, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		// Timestamps only add noise next to the rest of the output
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
+
+// debug records a step of the run in the debug trace
+func (e *Extractor) debug(msg string, args ...any) {
+	e.log().DebugContext(e.ctx, msg, args...)
+}
+
+// logWarn records a failure the run carries on from in the debug trace
+func (e *Extractor) logWarn(msg string, err error, args ...any) {
+	e.log().WarnContext(e.ctx, msg, append(args, "error", err)...)
+}
+
+// logf prints the message if the verbosity is at least level
+func (e *Extractor) logf(level Verbosity, format string, args ...interface{}) {
+	if e.verbosity >= level {
+		fmt.Fprintf(e.out, format, args...)
+	}
+}
+
+// infof prints regular output
+func (e *Extractor) infof(format string, args ...interface{}) {
+	e.logf(VerbosityNormal, format, args...)
+}
+
+// warnf prints a warning
+func (e *Extractor) warnf(format string, args ...interface{}) {
+	e.logf(VerbosityNormal, e.style.glyph("⚠️  ")+e.style.paint(ansiYellow, "Warning:")+" "+format, args...)
+}
+
+// verbosef prints detail shown with --verbose
+func (e *Extractor) verbosef(format string, args ...interface{}) {
+	e.logf(VerbosityVerbose, format, args...)
+}
+
+// errorf prints failure details, such as how to recover, at every verbosity
+func (e *Extractor) errorf(format string, args ...interface{}) {
+	fmt.Fprintf(e.errOut, format, args...)
+}
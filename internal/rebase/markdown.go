@@ -0,0 +1,106 @@
+// ABOUTME: Markdown rendering of the run and dry-run reports for pull request descriptions
+// ABOUTME: Tabulates each original commit next to the commits that replaced it, or would
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderMarkdown renders a run report as a paste-ready summary
+func (e *Extractor) renderMarkdown(report RunReport, commits []CommitInfo) string {
+	var output strings.Builder
+	fmt.Fprintf(&output, "## Extracted %s into separate commits\n\n", e.markdownTargets())
+	fmt.Fprintf(&output, "Split %d of %d commits, so the branch now has %d commits in place of %d.",
+		report.Stats.Split, report.Stats.Commits, report.Stats.Commits+report.Stats.Split-report.Stats.Dropped, report.Stats.Commits)
+	if report.BackupBranch != "" {
+		fmt.Fprintf(&output, " The original history is kept in `%s`.", report.BackupBranch)
+	}
+	output.WriteString("\n\n")
+
+	output.WriteString("| Original | Remaining | Extracted |\n")
+	output.WriteString("| --- | --- | --- |\n")
+	for i, mapping := range report.Commits {
+		commit := commits[i]
+		remainingMsg, extractedMsg := commit.Message, ""
+		if mapping.Split {
+			remainingMsg, extractedMsg = e.splitMessages(commit)
+		}
+		row := []string{markdownCommit(mapping.Original, commit.Message), markdownCommit(mapping.Remaining, remainingMsg), ""}
+		if mapping.Dropped {
+			row[1] = "dropped (empty)"
+		}
+		if mapping.Split {
+			row[2] = markdownCommit(mapping.Extracted, extractedMsg)
+			if remaining, extracted, err := e.splitStats(commit); err == nil {
+				row[1] += " (" + remaining.short() + ")"
+				row[2] += " (" + extracted.short() + ")"
+			}
+		}
+		fmt.Fprintf(&output, "| %s |\n", strings.Join(row, " | "))
+	}
+	return output.String()
+}
+
+// RenderMarkdown renders a dry-run report as a paste-ready proposal
+func (e *Extractor) RenderMarkdown(report *DryRunReport) string {
+	var output strings.Builder
+	fmt.Fprintf(&output, "## Extract %s into separate commits\n\n", e.markdownTargets())
+	fmt.Fprintf(&output, "Would split %d of %d commits.", report.SplitCount, len(report.Commits))
+	if report.BlastRadius != nil {
+		fmt.Fprintf(&output, " %d commits would be rewritten.", report.BlastRadius.Rewritten)
+	}
+	output.WriteString("\n")
+	if report.SplitCount == 0 {
+		return output.String()
+	}
+
+	output.WriteString("\n| Original | Remaining | Extracted | Predicted conflicts |\n")
+	output.WriteString("| --- | --- | --- | --- |\n")
+	for _, commit := range report.Commits {
+		if !commit.Split {
+			continue
+		}
+		row := []string{
+			markdownCommit(commit.Hash, commit.Message),
+			markdownCell(subject(commit.RemainingMessage)),
+			markdownCell(subject(commit.ExtractedMessage)),
+			markdownCell(strings.Join(commit.PredictedConflicts, ", ")),
+		}
+		if commit.RemainingStat != nil && commit.ExtractedStat != nil {
+			row[1] += " (" + commit.RemainingStat.short() + ")"
+			row[2] += " (" + commit.ExtractedStat.short() + ")"
+		}
+		fmt.Fprintf(&output, "| %s |\n", strings.Join(row, " | "))
+	}
+	return output.String()
+}
+
+// markdownTargets lists the targets as inline code
+func (e *Extractor) markdownTargets() string {
+	targets := make([]string, len(e.targetFiles))
+	for i, target := range e.targetFiles {
+		targets[i] = "`" + target + "`"
+	}
+	return strings.Join(targets, ", ")
+}
+
+// markdownCommit renders a commit as its short hash and subject, escaped for a table cell
+func markdownCommit(hash, message string) string {
+	return fmt.Sprintf("`%s` %s", hash[:7], markdownCell(subject(message)))
+}
+
+// markdownCell escapes text for a table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
+
+// short renders the stat compactly, e.g. "2 files, +5 -1"
+func (s DiffStat) short() string {
+	files := "files"
+	if s.Files == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%d %s, +%d -%d", s.Files, files, s.Insertions, s.Deletions)
+}
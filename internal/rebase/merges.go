@@ -0,0 +1,130 @@
+// ABOUTME: Refuses ranges with merges that can't be replayed onto a rewritten history
+// ABOUTME: Octopus merges, merges of commits from before the range, and merges that need splitting are named up front
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// checkMerges refuses ranges containing octopus merges, or merges with a
+// parent from outside the range other than the base: replaying either
+// linearizes the history or stops partway through. Other merges are
+// recreated by rebasing with --rebase-merges, which needs git 2.18, and
+// are refused with older releases.
+func (e *Extractor) checkMerges(from, to string) error {
+	base, err := e.resolveCommit(from)
+	if err != nil {
+		return err
+	}
+	commits, err := e.history().RevList(e.ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to list commits in %s..%s: %w", from, to, err)
+	}
+	inRange := make(map[string]bool, len(commits)+1)
+	inRange[base] = true
+	for _, hash := range commits {
+		inRange[hash] = true
+	}
+
+	var problems []string
+	merges := 0
+	for _, hash := range commits {
+		commit, err := e.history().CatCommit(e.ctx, hash)
+		if err != nil {
+			return err
+		}
+		if len(commit.Parents) < 2 {
+			continue
+		}
+		merges++
+		name := fmt.Sprintf("%s \"%s\"", hash[:7], subject(commit.Message))
+		if len(commit.Parents) > 2 {
+			problems = append(problems, fmt.Sprintf("%s is an octopus merge of %d parents", name, len(commit.Parents)))
+			continue
+		}
+		for _, parent := range commit.Parents {
+			if !inRange[parent] {
+				problems = append(problems, fmt.Sprintf("%s merges %s, which is outside the range", name, parent[:7]))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the range contains merges that can't be replayed:\n  %s\nchoose a base after them, or split the commits on either side separately", strings.Join(problems, "\n  "))
+	}
+	// Merges are recreated with --rebase-merges. A dry run without git
+	// can't ask which release the rebase would run with.
+	if merges > 0 && !e.withoutGit {
+		if err := e.requireFeature(git.FeatureRebaseMerges); err != nil {
+			return fmt.Errorf("the range contains merges: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkMergeSplits refuses ranges in which a merge would have to be split.
+// Such a merge changes both targets and other files itself, typically
+// resolving conflicts in both, and the rebase can only recreate it whole.
+func (e *Extractor) checkMergeSplits(commits []CommitInfo) error {
+	var problems []string
+	for _, commit := range commits {
+		if !commit.NeedsSplit {
+			continue
+		}
+		parents, err := e.commitParents(commit.Hash)
+		if err != nil {
+			return err
+		}
+		if len(parents) > 1 {
+			problems = append(problems, fmt.Sprintf("%s \"%s\"", commit.Hash[:7], subject(commit.Message)))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("these merges change target and other files themselves, and merges can't be split:\n  %s\nchoose a base after them", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkMergesKept fails if base..HEAD has fewer merges than
+// base..originalHead, which a rebase that flattened the history leaves
+func (e *Extractor) checkMergesKept(base, originalHead string) error {
+	count := func(head string) (string, error) {
+		output, err := e.repo.GitOutput(e.ctx, "rev-list", "--merges", "--count", base+".."+head)
+		if err != nil {
+			return "", fmt.Errorf("failed to count merges in %s..%s: %w", base[:7], head, err)
+		}
+		return strings.TrimSpace(output), nil
+	}
+	original, err := count(originalHead)
+	if err != nil {
+		return err
+	}
+	rewritten, err := count("HEAD")
+	if err != nil {
+		return err
+	}
+	if rewritten != original {
+		return fmt.Errorf("the rewritten history has %s merges where the original had %s", rewritten, original)
+	}
+	return nil
+}
+
+// mergeRebaseArgs returns --rebase-merges when from..HEAD contains merges,
+// so the rebase recreates them instead of flattening the history
+func (e *Extractor) mergeRebaseArgs(from string) ([]string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "rev-list", "--merges", "-n", "1", from+"..HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look for merges in the range: %w", err)
+	}
+	if strings.TrimSpace(output) == "" {
+		return nil, nil
+	}
+	if err := e.requireFeature(git.FeatureRebaseMerges); err != nil {
+		return nil, err
+	}
+	return []string{"--rebase-merges"}, nil
+}
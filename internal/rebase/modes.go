@@ -0,0 +1,74 @@
+// ABOUTME: Keeps the executable bit of split files when a hook re-adds them
+// ABOUTME: Corrects modes a filesystem without exec bits lost with update-index --chmod
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// restoreModes resets the executable bit of every regular file in the index
+// of the worktree at dir, used with env, to its mode in tree. A pre-commit hook that formats and
+// re-adds files on a filesystem that can't represent the bit (FAT volumes,
+// some container mounts) stages them as 100644, which would silently turn
+// a script non-executable in the split commit.
+func (e *Extractor) restoreModes(tree, dir string, env []string) error {
+	output, err := e.repo.GitOutput(e.ctx, "ls-tree", "-r", "-z", "--full-tree", tree)
+	if err != nil {
+		return fmt.Errorf("failed to list tree %s: %w", tree, err)
+	}
+	modes := make(map[string]string)
+	for _, record := range git.SplitNul(output) {
+		// <mode> SP <type> SP <oid> TAB <path>
+		info, path, ok := strings.Cut(record, "\t")
+		if ok {
+			modes[path], _, _ = strings.Cut(info, " ")
+		}
+	}
+
+	// Paths are listed and updated from the top so they match the tree's
+	cmd := e.repo.Command(e.ctx, "ls-files", "-s", "-z")
+	cmd.Dir = dir
+	cmd.Env = env
+	staged, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list the index: %w", err)
+	}
+	chmod := map[string][]string{}
+	for _, record := range git.SplitNul(string(staged)) {
+		// <mode> SP <oid> SP <stage> TAB <path>
+		info, path, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		mode, _, _ := strings.Cut(info, " ")
+		want := modes[path]
+		if mode == want || !isRegularMode(mode) || !isRegularMode(want) {
+			continue
+		}
+		e.verbosef("Restoring mode %s of %s after the pre-commit hook staged it as %s\n", want, path, mode)
+		if want == "100755" {
+			chmod["+x"] = append(chmod["+x"], path)
+		} else {
+			chmod["-x"] = append(chmod["-x"], path)
+		}
+	}
+
+	for bit, paths := range chmod {
+		cmd := e.repo.Command(e.ctx, append([]string{"update-index", "--chmod=" + bit, "--"}, paths...)...)
+		cmd.Dir = dir
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to restore file modes: %w, output: %s", err, string(output))
+		}
+	}
+	return nil
+}
+
+// isRegularMode reports whether mode is that of a regular file, executable or not
+func isRegularMode(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
@@ -0,0 +1,47 @@
+// ABOUTME: Non-interactive mode for automation: no editors and no rebase left stopped on conflicts
+// ABOUTME: A conflict aborts the rebase and undoes the rewrite, reported as an aborted ConflictError
+
+package rebase
+
+import (
+	"fmt"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetNonInteractive makes conflicts abort the rebase instead of leaving it
+// stopped for manual resolution, and keeps git from opening an editor
+func (e *Extractor) SetNonInteractive(nonInteractive bool) {
+	e.nonInteractive = nonInteractive
+}
+
+// conflictError returns the error for a rebase stopped on conflicts while
+// splitting commit. In non-interactive mode the rebase is aborted first.
+func (e *Extractor) conflictError(commit CommitInfo, conflictMsg string) error {
+	// Listing the conflicts is best effort; the status message still describes them
+	files, _ := e.conflictedFiles()
+	e.notify(func(o Observer) { o.OnConflict(commit, files) })
+	conflict := &ConflictError{Commit: commit.Hash, Files: files, status: conflictMsg}
+	if !e.nonInteractive {
+		return conflict
+	}
+	if err := e.gitBackend.Rebase(e.ctx, git.RebaseOptions{}, "--abort"); err != nil {
+		return fmt.Errorf("%w, and the rebase could not be aborted: %v", conflict, err)
+	}
+	conflict.Aborted = true
+	return conflict
+}
+
+// rollBack moves the branch back to originalHead, keeping the working tree
+// in step, after a run that was stopped or failed its checks. The working
+// tree has to be clean or match HEAD, as after an aborted rebase.
+func (e *Extractor) rollBack(originalHead string) error {
+	// A HEAD that can't be read leaves the reset without a starting point
+	head, _ := e.resolveCommit("HEAD")
+	cmd := e.repo.Command(e.ctx, "reset", "-q", "--keep", originalHead)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to roll back to %s: %w, output: %s", originalHead[:7], err, string(output))
+	}
+	e.record(ResetEvent{Ref: "HEAD", From: head, To: originalHead})
+	return nil
+}
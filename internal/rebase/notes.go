@@ -0,0 +1,150 @@
+// ABOUTME: Carries git notes of rewritten commits over to the commits that replace them
+// ABOUTME: Copies every notes ref to one or both halves of a split, and can record the rewrite map as notes
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MapNotesRef is the notes ref the rewrite map is recorded under
+const MapNotesRef = "refs/notes/extract-file"
+
+// SetCopyNotes chooses which half of a split receives the notes of the
+// original commit: both, remaining, extracted, or none (which also leaves
+// the notes of commits that were only replayed behind)
+func (e *Extractor) SetCopyNotes(mode string) error {
+	switch mode {
+	case "both", "remaining", "extracted", "none":
+		e.copyNotesTo = mode
+		return nil
+	default:
+		return fmt.Errorf("invalid notes target %q: must be \"both\", \"remaining\", \"extracted\", or \"none\"", mode)
+	}
+}
+
+// SetAnnotateNotes adds the original commit's hash to every copied note
+func (e *Extractor) SetAnnotateNotes(annotate bool) {
+	e.annotateNotes = annotate
+}
+
+// SetMapNotes records, for every new commit, the original commit it replaces
+// as a note under MapNotesRef
+func (e *Extractor) SetMapNotes(mapNotes bool) {
+	e.mapNotes = mapNotes
+}
+
+// updateNotes copies the notes of every rewritten commit in base..HEAD, under
+// every notes ref, to the commits that replaced it, then records the rewrite
+// map when asked to
+func (e *Extractor) updateNotes(base string, commits []CommitInfo) error {
+	var refs []string
+	if e.copyNotesTo != "none" {
+		output, err := e.repo.GitOutput(e.ctx, "for-each-ref", "--format=%(refname)", "refs/notes/")
+		if err != nil {
+			return fmt.Errorf("failed to list notes refs: %w", err)
+		}
+		refs = strings.Fields(output)
+	}
+	if len(refs) == 0 && !e.mapNotes {
+		return nil
+	}
+
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return fmt.Errorf("failed to map rewritten commits: %w", err)
+	}
+	for _, ref := range refs {
+		notes, err := e.listNotes(ref)
+		if err != nil {
+			return err
+		}
+		for _, mapping := range mappings {
+			if _, ok := notes[mapping.Original]; !ok {
+				continue
+			}
+			for _, target := range e.noteTargets(mapping) {
+				if err := e.copyNote(ref, mapping.Original, target); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if e.mapNotes {
+		return e.writeMapNotes(mappings)
+	}
+	return nil
+}
+
+// listNotes returns the commits annotated under ref, mapped to their note blobs
+func (e *Extractor) listNotes(ref string) (map[string]string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "notes", "--ref", ref, "list")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes in %s: %w", ref, err)
+	}
+	notes := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if blob, commit, ok := strings.Cut(line, " "); ok {
+			notes[commit] = blob
+		}
+	}
+	return notes, nil
+}
+
+// noteTargets returns the new commits that receive the notes of an original one
+func (e *Extractor) noteTargets(mapping CommitMapping) []string {
+	switch {
+	case mapping.Dropped, !mapping.Split && mapping.Remaining == mapping.Original:
+		return nil
+	case !mapping.Split:
+		return []string{mapping.Remaining}
+	case e.copyNotesTo == "remaining":
+		return []string{mapping.Remaining}
+	case e.copyNotesTo == "extracted":
+		return []string{mapping.Extracted}
+	default:
+		return []string{mapping.Remaining, mapping.Extracted}
+	}
+}
+
+// copyNote copies the note of original under ref to target
+func (e *Extractor) copyNote(ref, original, target string) error {
+	if !e.annotateNotes {
+		if output, err := e.repo.Command(e.ctx, "notes", "--ref", ref, "copy", "-f", original, target).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to copy note of %s in %s: %w, output: %s", original[:7], ref, err, string(output))
+		}
+		return nil
+	}
+
+	note, err := e.repo.GitOutput(e.ctx, "notes", "--ref", ref, "show", original)
+	if err != nil {
+		return fmt.Errorf("failed to read note of %s in %s: %w", original[:7], ref, err)
+	}
+	cmd := e.repo.Command(e.ctx, "notes", "--ref", ref, "add", "-f", "-F", "-", target)
+	cmd.Stdin = strings.NewReader(strings.TrimRight(note, "\n") + "\n\n(copied from " + original + ")\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to add note to %s in %s: %w, output: %s", target[:7], ref, err, string(output))
+	}
+	return nil
+}
+
+// writeMapNotes notes the original commit and role of every new commit under MapNotesRef
+func (e *Extractor) writeMapNotes(mappings []CommitMapping) error {
+	for _, mapping := range mappings {
+		roles := [][2]string{{mapping.Remaining, "rewritten"}}
+		if mapping.Split {
+			roles = [][2]string{{mapping.Remaining, "remaining"}, {mapping.Extracted, "extracted"}}
+		} else if mapping.Dropped || mapping.Remaining == mapping.Original {
+			continue
+		}
+		for _, role := range roles {
+			cmd := e.repo.Command(e.ctx, "notes", "--ref", MapNotesRef, "add", "-f", "-F", "-", role[0])
+			cmd.Stdin = strings.NewReader(fmt.Sprintf("Original: %s\nRole: %s\n", mapping.Original, role[1]))
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to record original of %s: %w, output: %s", role[0][:7], err, string(output))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// ABOUTME: Observer interface behind the progress display and the JSON event stream
+// ABOUTME: The Extractor reports analysis, each split, conflicts, and completion to every observer
+
+package rebase
+
+// Observer is told about a run as it goes. The Extractor calls observers
+// from the goroutine running Extract, in the order they were added, so a
+// slow observer slows down the run. Embed NopObserver to implement only
+// some of the methods.
+type Observer interface {
+	// OnAnalyzeCommit is called for each commit in the range, oldest first,
+	// once analysis has decided whether it needs splitting. index counts
+	// from 1.
+	OnAnalyzeCommit(commit CommitInfo, index, total int)
+	// OnSplitStart is called before each split. index counts from 1 up to
+	// the number of commits being split.
+	OnSplitStart(commit CommitInfo, index, total int)
+	// OnSplitDone is called with the two commits a split produced
+	OnSplitDone(commit CommitInfo, remaining, extracted string)
+	// OnConflict is called when a split stops on conflicts in files
+	OnConflict(commit CommitInfo, files []string)
+	// OnComplete is called once as Extract returns, with the resulting HEAD
+	// on success or the error it returns
+	OnComplete(head string, err error)
+}
+
+// NopObserver implements Observer with methods that do nothing
+type NopObserver struct{}
+
+// OnAnalyzeCommit does nothing
+func (NopObserver) OnAnalyzeCommit(CommitInfo, int, int) {}
+
+// OnSplitStart does nothing
+func (NopObserver) OnSplitStart(CommitInfo, int, int) {}
+
+// OnSplitDone does nothing
+func (NopObserver) OnSplitDone(CommitInfo, string, string) {}
+
+// OnConflict does nothing
+func (NopObserver) OnConflict(CommitInfo, []string) {}
+
+// OnComplete does nothing
+func (NopObserver) OnComplete(string, error) {}
+
+// AddObserver reports the progress of every following run to observer
+func (e *Extractor) AddObserver(observer Observer) {
+	e.observers = append(e.observers, observer)
+}
+
+// observe adds observer for the rest of a run, returning the function that
+// removes it again
+func (e *Extractor) observe(observer Observer) func() {
+	e.observers = append(e.observers, observer)
+	return func() {
+		for i, o := range e.observers {
+			if o == observer {
+				e.observers = append(e.observers[:i:i], e.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify calls report with every observer
+func (e *Extractor) notify(report func(Observer)) {
+	for _, observer := range e.observers {
+		report(observer)
+	}
+}
+
+// notifyAnalyzed reports the result of analyzing every commit in the range
+func (e *Extractor) notifyAnalyzed(commits []CommitInfo) {
+	for i, commit := range commits {
+		e.notify(func(o Observer) { o.OnAnalyzeCommit(commit, i+1, len(commits)) })
+	}
+}
+
+// notifySplitDone reports the two commits a split produced, given in history order
+func (e *Extractor) notifySplitDone(commit CommitInfo, first, second string) {
+	remaining, extracted := first, second
+	if e.extractedFirst(commit) {
+		remaining, extracted = second, first
+	}
+	e.notify(func(o Observer) { o.OnSplitDone(commit, remaining, extracted) })
+}
@@ -0,0 +1,71 @@
+// ABOUTME: Per-commit overrides applied on top of the generated plan
+// ABOUTME: Lets an edited plan skip splits, replace messages, and put the extracted commit first
+
+package rebase
+
+// SplitOverride customizes how one commit of the plan is split
+type SplitOverride struct {
+	// Skip keeps the commit whole even though it mixes target and other files
+	Skip bool
+	// RemainingMessage replaces the generated message of the commit without the targets
+	RemainingMessage string
+	// ExtractedMessage replaces the generated message of the commit with only the targets
+	ExtractedMessage string
+	// ExtractedFirst places the extracted commit before the remaining one
+	ExtractedFirst bool
+}
+
+// SetOverrides sets per-commit overrides, keyed by the full hash of the original commit
+func (e *Extractor) SetOverrides(overrides map[string]SplitOverride) {
+	e.overrides = overrides
+}
+
+// override returns the override for a commit: the one the running plan
+// sets, or else the one set with SetOverrides
+func (e *Extractor) override(hash string) SplitOverride {
+	if e.planned != nil {
+		return e.planned[hash]
+	}
+	return e.overrides[hash]
+}
+
+// applyOverrides drops the splits that overrides skip
+func (e *Extractor) applyOverrides(commits []CommitInfo) {
+	for i, commit := range commits {
+		if e.override(commit.Hash).Skip {
+			e.verbosef("Keeping %s whole as requested\n", commit.Hash[:7])
+			commits[i].NeedsSplit = false
+		}
+	}
+}
+
+// splitMessages returns the remaining and extracted messages for a commit,
+// honoring the templates, the stack trailer policy, and any override
+func (e *Extractor) splitMessages(commit CommitInfo) (string, string) {
+	// Stack trailers have to stay the last paragraph of the remaining commit
+	message, trailers := cutStackTrailers(commit.Message)
+	remaining, extracted := GenerateSplitMessages(message, e.targetFiles)
+	if e.templates.Remaining != "" {
+		remaining = expandTemplate(e.templates.Remaining, message, e.targetFiles)
+	}
+	if e.templates.Extracted != "" {
+		extracted = expandTemplate(e.templates.Extracted, message, e.targetFiles)
+	}
+	remaining = appendTrailers(remaining, trailers)
+	if e.stackTrailers == "regenerate" {
+		extracted = appendTrailers(extracted, regenerateStackTrailers(trailers))
+	}
+	override := e.override(commit.Hash)
+	if override.RemainingMessage != "" {
+		remaining = override.RemainingMessage
+	}
+	if override.ExtractedMessage != "" {
+		extracted = override.ExtractedMessage
+	}
+	return remaining, extracted
+}
+
+// extractedFirst reports whether the extracted half of commit comes first
+func (e *Extractor) extractedFirst(commit CommitInfo) bool {
+	return e.override(commit.Hash).ExtractedFirst
+}
@@ -0,0 +1,35 @@
+// ABOUTME: Converts operating system paths to the slash-separated form git uses
+// ABOUTME: Lets targets typed in PowerShell or cmd.exe match the paths git reports on Windows
+
+package rebase
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// TargetPath converts a target path given on the command line to the form
+// git reports paths in: separated by forward slashes, without a leading
+// "./". A trailing separator, which marks a directory, is kept as "/".
+func TargetPath(path string) string {
+	return targetPath(path, filepath.Separator)
+}
+
+// targetPath is TargetPath for an operating system whose paths are
+// separated by separator
+func targetPath(path string, separator rune) string {
+	path = toSlash(path, separator)
+	for strings.HasPrefix(path, "./") && len(path) > 2 {
+		path = strings.TrimLeft(path[2:], "/")
+	}
+	return path
+}
+
+// toSlash is filepath.ToSlash for an operating system whose paths are
+// separated by separator, so Windows paths can be handled on any platform
+func toSlash(path string, separator rune) string {
+	if separator == '/' {
+		return path
+	}
+	return strings.ReplaceAll(path, string(separator), "/")
+}
@@ -0,0 +1,115 @@
+// ABOUTME: Plan files that record a reviewed split plan for later execution
+// ABOUTME: Pins the plan to the commits it was made for so it can't be applied to moved history
+
+package rebase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// planVersion changes whenever the plan file format changes
+const planVersion = 1
+
+// Plan is a split plan that can be reviewed and edited before it is applied
+type Plan struct {
+	Version int          `json:"version"`
+	Base    string       `json:"base"`
+	Head    string       `json:"head"`
+	Targets []string     `json:"targets"`
+	Commits []PlanCommit `json:"commits"`
+}
+
+// PlanCommit is one commit the plan would split. Setting Split to false
+// keeps it whole; the messages and ordering can be edited freely.
+type PlanCommit struct {
+	Hash             string `json:"hash"`
+	Subject          string `json:"subject"`
+	Split            bool   `json:"split"`
+	RemainingMessage string `json:"remainingMessage"`
+	ExtractedMessage string `json:"extractedMessage"`
+	ExtractedFirst   bool   `json:"extractedFirst"`
+}
+
+// NewPlan records the splits of a dry-run report of from..to as a plan
+func (e *Extractor) NewPlan(ctx context.Context, from, to string, report *DryRunReport) (*Plan, error) {
+	e.ctx = ctx
+	base, err := e.resolveCommit(from)
+	if err != nil {
+		return nil, err
+	}
+	head, err := e.resolveCommit(to)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Version: planVersion, Base: base, Head: head, Targets: e.targetFiles, Commits: []PlanCommit{}}
+	for _, commit := range report.Commits {
+		if !commit.Split {
+			continue
+		}
+		plan.Commits = append(plan.Commits, PlanCommit{
+			Hash:             commit.Hash,
+			Subject:          subject(commit.Message),
+			Split:            true,
+			RemainingMessage: commit.RemainingMessage,
+			ExtractedMessage: commit.ExtractedMessage,
+			ExtractedFirst:   commit.ExtractedFirst,
+		})
+	}
+	return plan, nil
+}
+
+// Write writes the plan to path as JSON
+func (p *Plan) Write(path string) error {
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// LoadPlan reads a plan written by Plan.Write
+func LoadPlan(path string) (*Plan, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	var plan Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("unsupported plan version %d (expected %d)", plan.Version, planVersion)
+	}
+	if plan.Base == "" || plan.Head == "" || len(plan.Targets) == 0 {
+		return nil, fmt.Errorf("plan %s is missing its base, head, or targets", path)
+	}
+	return &plan, nil
+}
+
+// UsePlan verifies that the repository is still where the plan was made
+// and makes the following runs, dry or not, carry out exactly that plan by
+// setting the overrides. Executor.Execute applies a plan in one step.
+func (e *Extractor) UsePlan(ctx context.Context, plan *Plan) error {
+	e.ctx = ctx
+	if err := e.checkPlan(plan); err != nil {
+		return err
+	}
+
+	commits, err := e.analyze(plan.Base, plan.Head)
+	if err != nil {
+		return fmt.Errorf("failed to analyze commits: %w", err)
+	}
+	overrides, err := planOverrides(plan, commits)
+	if err != nil {
+		return err
+	}
+	e.overrides = overrides
+	return nil
+}
@@ -0,0 +1,131 @@
+// ABOUTME: Planner and Executor, the two halves of a run
+// ABOUTME: The Planner turns an analysis into a Plan without touching the repository; the Executor applies a Plan
+
+package rebase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Planner turns the analysis of a range into a Plan, using the extractor's
+// targets, message templates, stack trailer policy, and overrides. It reads
+// nothing from the repository, so the same analysis always gives the same
+// plan, apart from regenerated stack trailers.
+type Planner struct {
+	extractor *Extractor
+}
+
+// Planner returns the planner for the extractor's settings
+func (e *Extractor) Planner() *Planner {
+	return &Planner{extractor: e}
+}
+
+// Plan plans the split of base..head, given the commits AnalyzeRange found
+// in it. Every commit mixing targets with other files is listed; those an
+// override skips are listed with Split false.
+func (p *Planner) Plan(base, head string, commits []CommitInfo) *Plan {
+	e := p.extractor
+	plan := &Plan{Version: planVersion, Base: base, Head: head, Targets: e.targetFiles, Commits: []PlanCommit{}}
+	for _, commit := range commits {
+		if !commit.NeedsSplit {
+			continue
+		}
+		remaining, extracted := e.splitMessages(commit)
+		plan.Commits = append(plan.Commits, PlanCommit{
+			Hash:             commit.Hash,
+			Subject:          subject(commit.Message),
+			Split:            !e.override(commit.Hash).Skip,
+			RemainingMessage: remaining,
+			ExtractedMessage: extracted,
+			ExtractedFirst:   e.extractedFirst(commit),
+		})
+	}
+	return plan
+}
+
+// Executor applies plans to the repository, with the extractor's settings
+// for everything a plan doesn't decide: backups, hooks, signing, reports,
+// and so on
+type Executor struct {
+	extractor *Extractor
+}
+
+// Executor returns the executor for the extractor's settings
+func (e *Extractor) Executor() *Executor {
+	return &Executor{extractor: e}
+}
+
+// Execute carries out plan, as long as the repository is still where the
+// plan was made. Canceling ctx stops the run like it does Extract.
+func (x *Executor) Execute(ctx context.Context, plan *Plan) error {
+	e := x.extractor
+	e.ctx = ctx
+	e.transcript = nil
+	err := e.checkPlan(plan)
+	if err == nil {
+		err = e.extract(plan.Base, plan.Head, plan)
+	}
+	e.complete(err)
+	return err
+}
+
+// checkPlan verifies that plan was made for the extractor's targets and the
+// current HEAD
+func (e *Extractor) checkPlan(plan *Plan) error {
+	if !slices.Equal(plan.Targets, e.targetFiles) {
+		return fmt.Errorf("plan was made for targets %s, not %s", strings.Join(plan.Targets, " "), strings.Join(e.targetFiles, " "))
+	}
+	head, err := e.resolveCommit("HEAD")
+	if err != nil {
+		return err
+	}
+	if head != plan.Head {
+		return fmt.Errorf("HEAD has moved since the plan was made (was %.7s, now %.7s); generate a new plan", plan.Head, head)
+	}
+	return nil
+}
+
+// planOverrides checks plan against the analyzed commits of its range and
+// returns the overrides that carry it out
+func planOverrides(plan *Plan, commits []CommitInfo) (map[string]SplitOverride, error) {
+	candidates := make(map[string]bool)
+	for _, commit := range commits {
+		if commit.NeedsSplit {
+			candidates[commit.Hash] = true
+		}
+	}
+
+	overrides := make(map[string]SplitOverride, len(plan.Commits))
+	for _, commit := range plan.Commits {
+		if !candidates[commit.Hash] {
+			return nil, fmt.Errorf("plan lists commit %s, which doesn't mix target and other files in %.7s..%.7s", commit.Hash, plan.Base, plan.Head)
+		}
+		delete(candidates, commit.Hash)
+		overrides[commit.Hash] = SplitOverride{
+			Skip:             !commit.Split,
+			RemainingMessage: strings.TrimSpace(commit.RemainingMessage),
+			ExtractedMessage: strings.TrimSpace(commit.ExtractedMessage),
+			ExtractedFirst:   commit.ExtractedFirst,
+		}
+	}
+	// Commits missing from the plan were removed by hand; keep them whole
+	for hash := range candidates {
+		overrides[hash] = SplitOverride{Skip: true}
+	}
+	return overrides, nil
+}
+
+// adoptPlan makes the rest of the run carry out plan, which is checked
+// against the analyzed commits, and drops the splits it skips from commits
+func (e *Extractor) adoptPlan(plan *Plan, commits []CommitInfo) error {
+	overrides, err := planOverrides(plan, commits)
+	if err != nil {
+		return err
+	}
+	e.planned = overrides
+	e.applyOverrides(commits)
+	return nil
+}
@@ -0,0 +1,297 @@
+// ABOUTME: Plumbing-only rewrite path that never touches the index or working tree
+// ABOUTME: Builds split commits with a temporary index and commit-tree, then moves the branch with one update-ref
+
+package rebase
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// nullOID is the all-zero object id git uses for a missing object
+const nullOID = "0000000000000000000000000000000000000000"
+
+// commitMeta holds the parts of a commit preserved when it is rewritten
+type commitMeta struct {
+	authorName  string
+	authorEmail string
+	authorDate  string
+	message     string
+}
+
+// treeEntry is a single blob, symlink, or submodule entry of a tree
+type treeEntry struct {
+	mode string
+	oid  string
+}
+
+// SetFastPath enables or disables rewriting with plumbing when no conflicts are predicted
+func (e *Extractor) SetFastPath(fastPath bool) {
+	e.fastPath = fastPath
+}
+
+// canUseFastPath reports whether the range can be rewritten purely with plumbing
+func (e *Extractor) canUseFastPath(commits []CommitInfo, conflicts map[string][]string, conflictErr error) bool {
+	if !e.fastPath || conflictErr != nil || len(conflicts) > 0 || len(commits) == 0 {
+		return false
+	}
+	// The branch is moved in one step, so the range has to end at HEAD
+	head, err := e.resolveCommit("HEAD")
+	if err != nil || commits[len(commits)-1].Hash != head {
+		return false
+	}
+	for _, commit := range commits {
+		parents, err := e.commitParents(commit.Hash)
+		if err != nil || len(parents) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteWithPlumbing rebuilds the range with split commits, moves the
+// current branch to the result in a single ref update, and tells the
+// post-rewrite hook
+func (e *Extractor) rewriteWithPlumbing(commits []CommitInfo) error {
+	oldHead := commits[len(commits)-1].Hash
+	parents, err := e.commitParents(commits[0].Hash)
+	if err != nil {
+		return err
+	}
+	chain := parents[0]
+	rewriting := false
+
+	splits := 0
+	for _, commit := range commits {
+		if commit.NeedsSplit {
+			splits++
+		}
+	}
+	if progress := e.newProgress(splits); progress != nil {
+		defer e.observe(progress)()
+	}
+	index := 0
+	var rewrites []rewrite
+	// Post-split commands only see commits the branch ends up on
+	var postSplits []func()
+
+	for _, commit := range commits {
+		dropped, err := e.dropsCommit(commit.Hash)
+		if err != nil {
+			return err
+		}
+		// Commits before the first split or drop are kept as they are
+		rewriting = rewriting || commit.NeedsSplit || dropped
+		if !rewriting {
+			chain = commit.Hash
+			continue
+		}
+		if dropped {
+			e.debug("dropping empty commit", "commit", commit.Hash)
+			continue
+		}
+
+		meta, err := e.readCommitMeta(commit.Hash)
+		if err != nil {
+			return err
+		}
+
+		if !commit.NeedsSplit {
+			e.debug("replaying commit", "commit", commit.Hash, "onto", chain)
+			if chain, err = e.commitTree(commit.Hash+"^{tree}", chain, meta, meta.message); err != nil {
+				return err
+			}
+			rewrites = append(rewrites, rewrite{old: commit.Hash, new: chain})
+			continue
+		}
+
+		index++
+		e.notify(func(o Observer) { o.OnSplitStart(commit, index, splits) })
+		if err := e.runPreSplit(commit); err != nil {
+			return err
+		}
+		e.debug("splitting commit", "commit", commit.Hash, "onto", chain)
+		parents, err := e.commitParents(commit.Hash)
+		if err != nil {
+			return err
+		}
+		firstTree, firstMsg, secondMsg, err := e.splitLayout(commit, commit.Hash, parents[0])
+		if err != nil {
+			return err
+		}
+
+		first, hooked, err := e.commitSplit(firstTree, chain, meta, firstMsg+"\n")
+		if err != nil {
+			return err
+		}
+		if hooked != firstTree {
+			return errHookChangedTree
+		}
+		sourceTree := commit.Hash + "^{tree}"
+		if chain, hooked, err = e.commitSplit(sourceTree, first, meta, secondMsg+"\n"); err != nil {
+			return err
+		}
+		if hooked != sourceTree {
+			return errHookChangedTree
+		}
+		e.verbosef("Split %s into %s and %s\n", commit.Hash[:7], first[:7], chain[:7])
+		e.notifySplitDone(commit, first, chain)
+		second := chain
+		postSplits = append(postSplits, func() { e.runPostSplit(commit, first, second) })
+		rewrites = append(rewrites, rewrite{old: commit.Hash, new: first}, rewrite{old: commit.Hash, new: chain})
+	}
+
+	if err := e.moveHead(oldHead, chain); err != nil {
+		return err
+	}
+	for _, postSplit := range postSplits {
+		postSplit()
+	}
+	// git rebase reports its own rewrites, but this path bypasses it
+	e.runPostRewrite(rewrites)
+	return nil
+}
+
+// readCommitMeta reads the author and raw message of a commit
+func (e *Extractor) readCommitMeta(hash string) (commitMeta, error) {
+	_, output, err := e.repo.ReadObject(e.ctx, hash)
+	if err != nil {
+		return commitMeta{}, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+
+	header, message, _ := strings.Cut(string(output), "\n\n")
+	meta := commitMeta{message: message}
+	for _, line := range strings.Split(header, "\n") {
+		author, ok := strings.CutPrefix(line, "author ")
+		if !ok {
+			continue
+		}
+		start := strings.LastIndex(author, "<")
+		end := strings.LastIndex(author, ">")
+		if start < 0 || end < start {
+			return commitMeta{}, fmt.Errorf("malformed author in commit %s", hash)
+		}
+		meta.authorName = strings.TrimSpace(author[:start])
+		meta.authorEmail = author[start+1 : end]
+		meta.authorDate = strings.TrimSpace(author[end+1:])
+	}
+
+	return meta, nil
+}
+
+// commitTree creates a commit with the given tree, parent, and message,
+// preserving the original author identity and date, and signing it when
+// commit.gpgSign is set
+func (e *Extractor) commitTree(tree, parent string, meta commitMeta, message string) (string, error) {
+	hash, err := e.gitBackend.CommitTree(e.ctx, git.NewCommit{
+		Tree:        tree,
+		Parents:     []string{parent},
+		Message:     message,
+		AuthorName:  meta.authorName,
+		AuthorEmail: meta.authorEmail,
+		AuthorDate:  meta.authorDate,
+		Sign:        e.sign,
+	})
+	if err != nil {
+		return "", err
+	}
+	e.record(CommittedEvent{Commit: hash, Tree: tree, Parents: []string{parent}, Message: message})
+	return hash, nil
+}
+
+// splitLayout returns the tree and message of the first commit of a split,
+// and the message of the second, whose tree is always the original one
+func (e *Extractor) splitLayout(commit CommitInfo, source, parent string) (string, string, string, error) {
+	remainingMsg, extractedMsg := e.splitMessages(commit)
+	// Both sides of a rename of a target go into the same half
+	partners, err := e.renamePartners(parent, source)
+	if err != nil {
+		return "", "", "", err
+	}
+	if e.extractedFirst(commit) {
+		// The parent plus the target changes, followed by everything else
+		tree, err := e.treeWithTargetsFrom(parent, source, commit.Files, partners)
+		return tree, extractedMsg, remainingMsg, err
+	}
+	// Everything but the target changes, followed by the targets
+	tree, err := e.treeWithTargetsFrom(source, parent, commit.Files, partners)
+	return tree, remainingMsg, extractedMsg, err
+}
+
+// treeWithTargetsFrom returns the tree of commit with every target path, and
+// every path in extra, set to its state in from, built in a throwaway index.
+// Targets are resolved against the files the split commit changes.
+func (e *Extractor) treeWithTargetsFrom(commit, from string, changed, extra []string) (string, error) {
+	commitEntries, err := e.targetEntries(commit, changed, extra)
+	if err != nil {
+		return "", err
+	}
+	fromEntries, err := e.targetEntries(from, changed, extra)
+	if err != nil {
+		return "", err
+	}
+
+	var staged []git.TreeEntry
+	for path := range commitEntries {
+		if _, ok := fromEntries[path]; !ok {
+			staged = append(staged, git.TreeEntry{Path: path})
+		}
+	}
+	for path, entry := range fromEntries {
+		staged = append(staged, git.TreeEntry{Mode: entry.mode, OID: entry.oid, Path: path})
+	}
+	tree, err := e.gitBackend.Stage(e.ctx, commit, staged)
+	if err != nil {
+		return "", err
+	}
+
+	paths := make([]string, len(staged))
+	for i, entry := range staged {
+		paths[i] = entry.Path
+	}
+	slices.Sort(paths)
+	e.record(StagedEvent{Base: commit, Tree: tree, Paths: paths})
+	return tree, nil
+}
+
+// targetEntries lists the tree entries of a commit that match the target
+// paths, as resolved for a commit changing changed, or are in extra
+func (e *Extractor) targetEntries(commit string, changed, extra []string) (map[string]treeEntry, error) {
+	listing, err := e.backend.ListTree(e.ctx, commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tree of %s: %w", commit, err)
+	}
+
+	analyzer := e.newAnalyzer().forCommit(changed)
+	entries := make(map[string]treeEntry)
+	for _, entry := range listing {
+		if analyzer.isTargetFile(entry.Path) || slices.Contains(extra, entry.Path) {
+			entries[entry.Path] = treeEntry{mode: entry.Mode, oid: entry.OID}
+		}
+	}
+	return entries, nil
+}
+
+// moveHead points the current branch (or detached HEAD) at newHead,
+// failing if it moved away from oldHead in the meantime
+func (e *Extractor) moveHead(oldHead, newHead string) error {
+	ref := "HEAD"
+	cmd := e.repo.Command(e.ctx, "symbolic-ref", "-q", "HEAD")
+	if output, err := cmd.Output(); err == nil {
+		ref = strings.TrimSpace(string(output))
+	}
+
+	if err := e.gitBackend.UpdateRef(e.ctx, ref, newHead, oldHead, "git-rebase-extract-file: split commits"); err != nil {
+		return err
+	}
+	e.record(ResetEvent{Ref: ref, From: oldHead, To: newHead})
+
+	// Mirror git rebase so "git reset --hard ORIG_HEAD" undoes the rewrite
+	if err := e.gitBackend.UpdateRef(e.ctx, "ORIG_HEAD", oldHead, "", ""); err != nil {
+		e.logWarn("failed to set ORIG_HEAD", err)
+	}
+	return nil
+}
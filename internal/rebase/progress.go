@@ -0,0 +1,56 @@
+// ABOUTME: Progress reporting for long rewrites
+// ABOUTME: Prints the split count and an ETA extrapolated from the measured time per split
+
+package rebase
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// progress is the Observer reporting how far a run has come through the
+// commits it splits
+type progress struct {
+	NopObserver
+	out     io.Writer
+	now     func() time.Time
+	total   int
+	done    int
+	started time.Time
+}
+
+// SetProgress enables or disables progress reporting during the rewrite
+func (e *Extractor) SetProgress(enabled bool) {
+	e.progress = enabled
+}
+
+// newProgress starts tracking total splits, returning nil when reporting is disabled
+func (e *Extractor) newProgress(total int) *progress {
+	if !e.progress || e.verbosity < VerbosityNormal || total == 0 {
+		return nil
+	}
+	return &progress{out: e.errOut, now: time.Now, total: total, started: time.Now()}
+}
+
+// OnSplitStart reports that the next split is starting
+func (p *progress) OnSplitStart(commit CommitInfo, _, _ int) {
+	p.step(commit.Hash)
+}
+
+// step reports that the split of hash is starting
+func (p *progress) step(hash string) {
+	p.done++
+	fmt.Fprintf(p.out, "Splitting commit %d/%d (%s)%s\n", p.done, p.total, hash[:7], p.eta())
+}
+
+// eta estimates the time left from the average duration of finished splits
+func (p *progress) eta() string {
+	finished := p.done - 1
+	if finished == 0 {
+		return ""
+	}
+	perSplit := p.now().Sub(p.started) / time.Duration(finished)
+	remaining := perSplit * time.Duration(p.total-finished)
+	return fmt.Sprintf(", ~%s remaining", remaining.Round(time.Second))
+}
@@ -0,0 +1,139 @@
+// ABOUTME: Partial clone support: fetches the objects a range needs in two batches up front
+// ABOUTME: Avoids one lazy fetch per object during analysis and a failure halfway through a rebase when offline
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// promisorRemote returns the remote a partial clone fetches missing objects
+// from, or "" when the repository isn't a partial clone
+func (e *Extractor) promisorRemote() string {
+	if remote, err := e.repo.GitOutput(e.ctx, "config", "--get", "extensions.partialClone"); err == nil && strings.TrimSpace(remote) != "" {
+		return strings.TrimSpace(remote)
+	}
+	output, err := e.repo.GitOutput(e.ctx, "config", "--bool", "--get-regexp", `^remote\..*\.promisor$`)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		if value == "true" {
+			return strings.TrimSuffix(strings.TrimPrefix(key, "remote."), ".promisor")
+		}
+	}
+	return ""
+}
+
+// prefetchRange fetches everything from..to needs from the promisor remote
+// of a partial clone: first the trees of the base and the range, then the
+// blobs on both sides of every change. Each step only fetches objects that
+// are missing, so a complete range never touches the network.
+func (e *Extractor) prefetchRange(from, to string) error {
+	// Without git to fetch them, reading a missing object fails instead
+	if e.withoutGit {
+		return nil
+	}
+	remote := e.promisorRemote()
+	if remote == "" {
+		return nil
+	}
+
+	// Trees come first: listing the changes of a treeless clone would
+	// otherwise fetch them one at a time
+	var trees []string
+	for _, rev := range []string{from + "^!", from + ".." + to} {
+		missing, err := e.missingObjects("--filter=blob:none", rev)
+		if err != nil {
+			return err
+		}
+		trees = append(trees, missing...)
+	}
+	if err := e.fetchMissing(remote, trees); err != nil {
+		return err
+	}
+
+	tree, err := e.changedBlobsTree(from, to)
+	if err != nil || tree == "" {
+		return err
+	}
+	blobs, err := e.missingObjects(tree)
+	if err != nil {
+		return err
+	}
+	return e.fetchMissing(remote, blobs)
+}
+
+// missingObjects lists the objects reachable from the given revisions that
+// aren't in the repository, without fetching them
+func (e *Extractor) missingObjects(args ...string) ([]string, error) {
+	output, err := e.repo.GitOutput(e.ctx, append([]string{"rev-list", "--objects", "--missing=print"}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list missing objects: %w", err)
+	}
+	var missing []string
+	for _, line := range strings.Split(output, "\n") {
+		if oid, ok := strings.CutPrefix(line, "?"); ok {
+			missing = append(missing, oid)
+		}
+	}
+	return missing, nil
+}
+
+// changedBlobsTree writes a throwaway tree holding the blobs on both sides
+// of every change in from..to, so rev-list can tell which are missing
+// without fetching them. It returns "" when nothing changed.
+func (e *Extractor) changedBlobsTree(from, to string) (string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "log", "-m", "--raw", "--no-renames", "--no-abbrev", "--format=", from+".."+to)
+	if err != nil {
+		return "", fmt.Errorf("failed to list changes in %s..%s: %w", from, to, err)
+	}
+	seen := make(map[string]bool)
+	var entries strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		// :<old mode> <new mode> <old oid> <new oid> <status>\t<path>
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], ":") {
+			continue
+		}
+		for _, side := range [][2]string{{strings.TrimPrefix(fields[0], ":"), fields[2]}, {fields[1], fields[3]}} {
+			mode, oid := side[0], side[1]
+			// Absent sides are all zeros, and submodule commits live elsewhere
+			if strings.Trim(oid, "0") == "" || mode == "160000" || seen[oid] {
+				continue
+			}
+			seen[oid] = true
+			fmt.Fprintf(&entries, "100644 blob %s\t%d\n", oid, len(seen))
+		}
+	}
+	if len(seen) == 0 {
+		return "", nil
+	}
+
+	cmd := e.repo.Command(e.ctx, "mktree", "--missing")
+	cmd.Stdin = strings.NewReader(entries.String())
+	tree, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list the blobs of %s..%s: %w", from, to, err)
+	}
+	return strings.TrimSpace(string(tree)), nil
+}
+
+// fetchMissing fetches objects from the promisor remote in one request
+func (e *Extractor) fetchMissing(remote string, oids []string) error {
+	if len(oids) == 0 {
+		return nil
+	}
+	e.infof("Fetching %d missing objects from %s (partial clone)\n", len(oids), remote)
+	// The same request git makes for a single lazily fetched object
+	cmd := e.repo.Command(e.ctx, "-c", "fetch.negotiationAlgorithm=noop", "fetch", "--quiet", "--no-tags", "--no-write-fetch-head",
+		"--recurse-submodules=no", "--filter=blob:none", "--stdin", remote)
+	cmd.Stdin = strings.NewReader(strings.Join(oids, "\n") + "\n")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("this is a partial clone and the range needs %d objects that aren't available locally, but fetching them from %s failed (are you offline?): %w, output: %s",
+			len(oids), remote, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
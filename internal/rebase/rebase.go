@@ -5,10 +5,20 @@
 package rebase
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"golang.org/x/sync/errgroup"
 )
 
 // CommitInfo represents a commit and whether it needs splitting
@@ -24,6 +34,7 @@ type CommitInfo struct {
 type Analyzer struct {
 	repoDir     string
 	targetFiles []string
+	backend     git.Backend
 }
 
 // NewAnalyzer creates a new commit analyzer
@@ -31,67 +42,77 @@ func NewAnalyzer(repoDir string, targetFiles ...string) *Analyzer {
 	return &Analyzer{
 		repoDir:     repoDir,
 		targetFiles: targetFiles,
+		backend:     git.NewRepository(repoDir),
+	}
+}
+
+// SetBackend sets the backend used to read commit history
+func (a *Analyzer) SetBackend(backend git.Backend) {
+	a.backend = backend
+}
+
+// SetCommandRunner runs the git commands of the analyzer through runner. It
+// has no effect once SetBackend has replaced the default backend.
+func (a *Analyzer) SetCommandRunner(runner git.CommandRunner) {
+	if repo, ok := a.backend.(*git.Repository); ok {
+		repo.SetCommandRunner(runner)
 	}
 }
 
 // AnalyzeRange analyzes commits in the given range
-func (a *Analyzer) AnalyzeRange(from, to string) ([]CommitInfo, error) {
+func (a *Analyzer) AnalyzeRange(ctx context.Context, from, to string) ([]CommitInfo, error) {
 	// Get list of commits in range
-	cmd := exec.Command("git", "rev-list", "--reverse", from+".."+to)
-	cmd.Dir = a.repoDir
-	output, err := cmd.Output()
+	commitHashes, err := a.backend.RevList(ctx, from, to)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get commit list: %w", err)
 	}
 
-	commitHashes := strings.Fields(strings.TrimSpace(string(output)))
-	var commits []CommitInfo
+	commits := make([]CommitInfo, len(commitHashes))
 
-	for _, hash := range commitHashes {
-		commit, err := a.analyzeCommit(hash)
-		if err != nil {
-			return nil, fmt.Errorf("failed to analyze commit %s: %w", hash, err)
-		}
-		commits = append(commits, commit)
+	// Each exec-backed analysis is a handful of independent git processes, so
+	// run them concurrently; results are stored by index to keep range order
+	group := new(errgroup.Group)
+	if _, isExec := a.backend.(*git.Repository); isExec {
+		group.SetLimit(runtime.GOMAXPROCS(0))
+	} else {
+		group.SetLimit(1)
 	}
 
-	return commits, nil
-}
-
-// analyzeCommit analyzes a single commit to determine if it needs splitting
-func (a *Analyzer) analyzeCommit(hash string) (CommitInfo, error) {
-	// Get commit message and author
-	cmd := exec.Command("git", "log", "--format=%B", "-n", "1", hash)
-	cmd.Dir = a.repoDir
-	msgOutput, err := cmd.Output()
-	if err != nil {
-		return CommitInfo{}, fmt.Errorf("failed to get commit message: %w", err)
+	for i, hash := range commitHashes {
+		group.Go(func() error {
+			commit, err := a.analyzeCommit(ctx, hash)
+			if err != nil {
+				return fmt.Errorf("failed to analyze commit %s: %w", hash, err)
+			}
+			commits[i] = commit
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
 	}
 
-	// Get author information
-	cmd = exec.Command("git", "log", "--format=%an <%ae>", "-n", "1", hash)
-	cmd.Dir = a.repoDir
-	authorOutput, err := cmd.Output()
-	if err != nil {
-		return CommitInfo{}, fmt.Errorf("failed to get commit author: %w", err)
+	if len(commits) == 0 {
+		return nil, nil
 	}
+	return commits, nil
+}
 
-	// Get files changed in commit
-	cmd = exec.Command("git", "show", "--name-only", "--format=", hash)
-	cmd.Dir = a.repoDir
-	filesOutput, err := cmd.Output()
+// analyzeCommit analyzes a single commit to determine if it needs splitting
+func (a *Analyzer) analyzeCommit(ctx context.Context, hash string) (CommitInfo, error) {
+	commit, err := a.backend.ReadCommit(ctx, hash)
 	if err != nil {
-		return CommitInfo{}, fmt.Errorf("failed to get commit files: %w", err)
+		return CommitInfo{}, err
 	}
-
-	files := strings.Fields(strings.TrimSpace(string(filesOutput)))
+	files := commit.Files
 
 	// Check if any target files are in the list and if there are other files
 	hasTargetFile := false
 	hasOtherFiles := false
 
+	targets := a.forCommit(files)
 	for _, file := range files {
-		if a.isTargetFile(file) {
+		if targets.isTargetFile(file) {
 			hasTargetFile = true
 		} else {
 			hasOtherFiles = true
@@ -100,8 +121,8 @@ func (a *Analyzer) analyzeCommit(hash string) (CommitInfo, error) {
 
 	return CommitInfo{
 		Hash:       hash,
-		Message:    strings.TrimSpace(string(msgOutput)),
-		Author:     strings.TrimSpace(string(authorOutput)),
+		Message:    commit.Message,
+		Author:     commit.Author,
 		Files:      files,
 		NeedsSplit: hasTargetFile && hasOtherFiles,
 	}, nil
@@ -110,110 +131,337 @@ func (a *Analyzer) analyzeCommit(hash string) (CommitInfo, error) {
 // isTargetFile checks if a file matches any of the target file patterns
 func (a *Analyzer) isTargetFile(file string) bool {
 	for _, target := range a.targetFiles {
-		// Exact match
-		if file == target {
-			return true
-		}
-		// Directory prefix match (e.g., "src/" matches "src/component.tsx")
-		if strings.HasSuffix(target, "/") && strings.HasPrefix(file, target) {
+		if matchesTarget(file, target) {
 			return true
 		}
 	}
 	return false
 }
 
+// forCommit returns an analyzer with the targets as they apply to a commit
+// changing files
+func (a *Analyzer) forCommit(files []string) *Analyzer {
+	return &Analyzer{repoDir: a.repoDir, targetFiles: commitTargets(a.targetFiles, files), backend: a.backend}
+}
+
+// commitTargets resolves each target against a commit changing files. A path
+// can be a file in some commits and a directory in others; in a commit that
+// changes it as a file, the target names both the file and the directory, so
+// turning one into the other stays in one half of the split. Elsewhere a
+// target without a trailing slash only names a file.
+func commitTargets(targets, files []string) []string {
+	resolved := slices.Clone(targets)
+	for _, target := range targets {
+		name := strings.TrimSuffix(target, "/")
+		if slices.Contains(files, name) {
+			resolved = append(resolved, name, name+"/")
+		}
+	}
+	return resolved
+}
+
+// matchesTarget checks if a file matches a single target pattern
+func matchesTarget(file, target string) bool {
+	// Exact match
+	if file == target {
+		return true
+	}
+	// Directory prefix match (e.g., "src/" matches "src/component.tsx")
+	return strings.HasSuffix(target, "/") && strings.HasPrefix(file, target)
+}
+
 // Extractor handles the actual rebase and splitting
 type Extractor struct {
-	repoDir     string
-	targetFiles []string
-	debug       bool
+	repoDir           string
+	targetFiles       []string
+	verbosity         Verbosity
+	logger            *slog.Logger
+	style             style
+	autostash         bool
+	strategyOption    string
+	rerere            bool
+	rewriteOthers     bool
+	fastPath          bool
+	progress          bool
+	reportPath        string
+	commitMapPath     string
+	follow            bool
+	followedNames     map[string][]string
+	reportFormat      string
+	backupPrefix      string
+	templates         MessageTemplates
+	overrides         map[string]SplitOverride
+	showDiff          bool
+	explain           bool
+	strictPaths       bool
+	noVerify          bool
+	deferHooks        bool
+	copyNotesTo       string
+	annotateNotes     bool
+	mapNotes          bool
+	rebaseDependents  bool
+	stackTrailers     string
+	detach            bool
+	preSplit          string
+	postSplit         string
+	exec              string
+	nonInteractive    bool
+	dropEmpty         bool
+	requireSignatures bool
+	sign              bool
+	// ctx is the context of the running operation, set by the exported
+	// methods that take one and used for every git command they run
+	ctx       context.Context
+	events    *eventStream
+	observers []Observer
+	// tempDir holds the temporary files of the running Extract
+	tempDir string
+	// planned holds the overrides of the plan a run is carrying out
+	planned map[string]SplitOverride
+	// backups counts the backup branches created by earlier runs
+	backups int
+	// transcript holds the actions of the last Extract
+	transcript []TranscriptEvent
+	out        io.Writer
+	errOut     io.Writer
+	repo       *git.Repository
+	backend    git.Backend
+	// gitBackend runs the steps of a rewrite; repo covers the rest
+	gitBackend git.GitBackend
+	// withoutGit reads everything through backend and never runs git
+	withoutGit bool
 }
 
 // NewExtractor creates a new commit extractor
 func NewExtractor(repoDir string, targetFiles ...string) *Extractor {
+	repo := git.NewRepository(repoDir)
 	return &Extractor{
-		repoDir:     repoDir,
-		targetFiles: targetFiles,
-		debug:       false,
+		repoDir:       repoDir,
+		targetFiles:   targetFiles,
+		follow:        true,
+		verbosity:     VerbosityNormal,
+		style:         style{emoji: true},
+		rerere:        true,
+		fastPath:      true,
+		copyNotesTo:   "both",
+		stackTrailers: "omit",
+		progress:      true,
+		ctx:           context.Background(),
+		repo:          repo,
+		backend:       repo,
+		gitBackend:    repo,
+		out:           os.Stdout,
+		errOut:        os.Stderr,
 	}
 }
 
-// SetDebug enables or disables debug output
-func (e *Extractor) SetDebug(debug bool) {
-	e.debug = debug
+// SetTargetFiles replaces the paths the following runs extract, so one
+// configured extractor can extract several groups of paths in turn
+func (e *Extractor) SetTargetFiles(targetFiles ...string) {
+	e.targetFiles = targetFiles
 }
 
-// debugf prints debug output if debug mode is enabled
-func (e *Extractor) debugf(format string, args ...interface{}) {
-	if e.debug {
-		fmt.Printf("🔧 DEBUG: "+format, args...)
+// Close releases long-lived git processes held by the extractor
+func (e *Extractor) Close() error {
+	return e.repo.Close()
+}
+
+// SetCommandLog records every git command the extractor runs in log
+func (e *Extractor) SetCommandLog(log *git.CommandLog) {
+	e.repo.SetCommandLog(log)
+}
+
+// SetCommandRunner runs every git command the extractor runs through runner,
+// so tests can check and answer them without a real repository. Hooks are
+// still run directly.
+func (e *Extractor) SetCommandRunner(runner git.CommandRunner) {
+	e.repo.SetCommandRunner(runner)
+}
+
+// SetBackend sets the backend used to read commit history during analysis
+func (e *Extractor) SetBackend(backend git.Backend) {
+	e.backend = backend
+}
+
+// SetGitBackend runs the operations backend covers through it: analysis,
+// status checks, building trees and commits, moving refs, and rebases
+func (e *Extractor) SetGitBackend(backend git.GitBackend) {
+	e.backend = backend
+	e.gitBackend = backend
+}
+
+// SetWithoutGit makes dry runs read everything through the backend set with
+// SetBackend and never run git, which need not be installed. The preview
+// then leaves out what only git can do: predicting conflicts, fetching what
+// a partial clone lacks, and checking for grafts and replace refs.
+func (e *Extractor) SetWithoutGit(withoutGit bool) {
+	e.withoutGit = withoutGit
+}
+
+// history returns the backend commits and refs are read through: git's own,
+// which sees each ref the rewrite moves, or in a run without git the one
+// set with SetBackend
+func (e *Extractor) history() git.Backend {
+	if e.withoutGit {
+		return e.backend
+	}
+	return e.gitBackend
+}
+
+// newAnalyzer creates an analyzer for the extractor's targets and backend
+func (e *Extractor) newAnalyzer() *Analyzer {
+	analyzer := NewAnalyzer(e.repoDir, e.matchTargets()...)
+	analyzer.SetBackend(e.backend)
+	return analyzer
+}
+
+// SetAutostash enables stashing uncommitted changes around the rebase
+func (e *Extractor) SetAutostash(autostash bool) {
+	e.autostash = autostash
+}
+
+// Render renders a dry-run report as text, styled like the rest of the output
+func (e *Extractor) Render(report *DryRunReport) string {
+	return report.render(e.style, e.explain)
+}
+
+// Extract performs the actual rebase with commit splitting, carrying out
+// the plan the Planner makes from the analysis of from..to. Canceling ctx
+// stops the run; a rewrite that already started is aborted and rolled back.
+func (e *Extractor) Extract(ctx context.Context, from, to string) error {
+	e.ctx = ctx
+	e.transcript = nil
+	err := e.extract(from, to, nil)
+	e.complete(err)
+	return err
+}
+
+// complete tells the observers that a run finished with err
+func (e *Extractor) complete(err error) {
+	if len(e.observers) == 0 {
+		return
+	}
+	var head string
+	if err == nil {
+		// A HEAD that can't be read leaves OnComplete without one
+		head, _ = e.resolveCommit("HEAD")
 	}
+	e.notify(func(o Observer) { o.OnComplete(head, err) })
 }
 
-// DryRun shows what would be done without making changes
-func (e *Extractor) DryRun(from, to string) (string, error) {
-	analyzer := NewAnalyzer(e.repoDir, e.targetFiles...)
-	commits, err := analyzer.AnalyzeRange(from, to)
+// extract carries out plan for from..to, or the plan the Planner makes
+// when plan is nil
+func (e *Extractor) extract(from, to string, plan *Plan) error {
+	started := time.Now()
+	defer func() { e.planned = nil }()
+
+	if e.withoutGit {
+		return errors.New("only a dry run can do without git")
+	}
+	// Fail up front rather than deep inside a rebase on an unsupported git
+	if err := e.checkGitVersion(); err != nil {
+		return err
+	}
+	if err := e.checkRevisions(from, to); err != nil {
+		return err
+	}
+
+	// Take the repository lock so concurrent runs can't interleave rebases
+	gitDir, err := e.gitDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to analyze commits: %w", err)
+		return err
+	}
+	lock, err := acquireLock(gitDir)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+	if err := e.createTempDir(gitDir); err != nil {
+		return err
 	}
+	defer e.removeTempDir()
 
-	// Count commits that need splitting
-	splitCount := 0
-	for _, commit := range commits {
-		if commit.NeedsSplit {
-			splitCount++
-		}
+	// git refuses to move a branch another worktree has checked out
+	collision, err := e.worktreeCollision()
+	if err != nil {
+		return err
+	}
+	if collision != nil && !e.detach {
+		return collision
 	}
 
-	var output strings.Builder
-	fmt.Fprintf(&output, "Would split %d out of %d commits:\n\n", splitCount, len(commits))
+	// Resolve the base to a commit so every pass rebases onto the same point,
+	// even when it was given relative to HEAD
+	base, err := e.resolveCommit(from)
+	if err != nil {
+		return err
+	}
 
-	// Show details for each commit that would be split
-	for _, commit := range commits {
-		if commit.NeedsSplit {
-			firstMsg, secondMsg := GenerateSplitMessages(commit.Message, e.targetFiles)
+	// Pick up a run that died before finishing
+	journal, err := e.resumeJournal(gitDir, base)
+	if err != nil {
+		return err
+	}
 
-			// Show original commit and its splits
-			fmt.Fprintf(&output, "Commit %s: \"%s\"\n", commit.Hash[:7], commit.Message)
-			fmt.Fprintf(&output, "├─ Split into: \"%s\"\n", firstMsg)
-			fmt.Fprintf(&output, "└─ Split into: \"%s\"\n\n", secondMsg)
+	// A rebase of the user's own would get mixed up with ours
+	if journal == nil {
+		if e.rebaseInProgress() {
+			return fmt.Errorf("%w; finish it with \"git rebase --continue\" or cancel it with \"git rebase --abort\" first", ErrRebaseInProgress)
 		}
 	}
 
-	return output.String(), nil
-}
-
-// Extract performs the actual rebase with commit splitting
-func (e *Extractor) Extract(from, to string) error {
-	// Check for clean working directory
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = e.repoDir
-	statusOutput, err := cmd.Output()
+	// Check for uncommitted changes to tracked files; untracked files are fine
+	dirty, untracked, err := e.workingTreeStatus()
 	if err != nil {
-		return fmt.Errorf("failed to check git status: %w", err)
+		return err
 	}
-	if len(strings.TrimSpace(string(statusOutput))) > 0 {
-		return fmt.Errorf("working directory is not clean. Please commit or stash changes first:\n%s", string(statusOutput))
+	if len(dirty) > 0 {
+		if !e.autostash {
+			return fmt.Errorf("%w. Please commit or stash changes first (or use --autostash):\n%s", ErrDirtyWorktree, strings.Join(dirty, "\n"))
+		}
+		stash, err := e.stashChanges()
+		if err != nil {
+			return err
+		}
+		defer e.restoreStash(stash)
 	}
+	e.warnUntrackedTargets(untracked)
 
 	// Capture original HEAD for recovery instructions and print them immediately
-	cmd = exec.Command("git", "rev-parse", "HEAD")
-	cmd.Dir = e.repoDir
-	headOutput, err := cmd.Output()
+	originalHead, err := e.resolveCommit("HEAD")
 	if err != nil {
 		return fmt.Errorf("failed to get current HEAD: %w", err)
 	}
-	originalHead := strings.TrimSpace(string(headOutput))
-	
+	if journal != nil {
+		originalHead = journal.start.OriginalHead
+	}
+
 	// Print recovery instructions at the start so user knows how to get back
-	fmt.Printf("To recover the repository state: git reset --hard %s\n", originalHead)
+	e.infof("To recover the repository state: git reset --hard %s\n", originalHead)
 
-	analyzer := NewAnalyzer(e.repoDir, e.targetFiles...)
-	commits, err := analyzer.AnalyzeRange(from, to)
+	head, err := e.resolveCommit(to)
+	if err != nil {
+		return err
+	}
+	if e.events != nil {
+		e.events.analysisStarted(base, head)
+	}
+	commits, err := e.analyze(base, head)
 	if err != nil {
 		return fmt.Errorf("failed to analyze commits: %w", err)
 	}
+	if err := e.checkTargets(commits); err != nil {
+		return err
+	}
+	e.checkLFS(commits)
+	if plan == nil {
+		plan = e.Planner().Plan(base, head, commits)
+	}
+	if err := e.adoptPlan(plan, commits); err != nil {
+		return err
+	}
+	e.notifyAnalyzed(commits)
+	e.record(AnalyzedEvent{Commits: commits})
 
 	// Check if any commits need splitting
 	needsWork := false
@@ -225,62 +473,379 @@ func (e *Extractor) Extract(from, to string) error {
 	}
 
 	if !needsWork {
-		fmt.Println("No commits need splitting")
-		return nil
+		if journal != nil {
+			journal.remove()
+		}
+		e.infof("No commits need splitting\n")
+		if err := e.writeCommitMap(base, commits); err != nil {
+			return err
+		}
+		return e.writeReport(base, originalHead, "", "none", commits, started)
+	}
+
+	// Show what else the rewrite touches before changing anything
+	if radius, err := e.computeBlastRadius(commits); err == nil {
+		e.infof("%s\n", radius)
+	} else {
+		e.logWarn("failed to compute blast radius", err)
+	}
+
+	// Don't silently rewrite teammates' commits
+	if err := e.checkForeignAuthors(commits); err != nil {
+		return err
+	}
+
+	// Nor silently turn signed commits into unsigned ones
+	e.sign = e.signingConfigured()
+	if err := e.checkSignatures(commits); err != nil {
+		return err
+	}
+
+	// Predict conflicts before starting
+	conflicts, conflictErr := e.predictConflicts(commits)
+	if conflictErr != nil {
+		e.warnf("Could not predict conflicts: %v\n\n", conflictErr)
+	} else if len(conflicts) > 0 {
+		e.warnf("The rewrite will stop for conflicts in:\n")
+		for _, commit := range commits {
+			if files, ok := conflicts[commit.Hash]; ok {
+				e.infof("  - %s: %s\n", commit.Hash[:7], strings.Join(files, ", "))
+			}
+		}
+		e.infof("\nBe ready to resolve these manually during the rebase.\n\n")
+	}
+
+	// Only a rebase checks files out, which could overwrite hidden changes
+	if !e.canUseFastPath(commits, conflicts, conflictErr) {
+		if err := e.checkHiddenChanges(commits); err != nil {
+			return err
+		}
 	}
 
-	// Check for potential conflicts before starting
-	if conflicts := e.checkPotentialConflicts(from); len(conflicts) > 0 {
-		fmt.Printf("⚠️  Warning: Potential conflicts detected in:\n")
-		for _, conflict := range conflicts {
-			fmt.Printf("  - %s\n", conflict)
+	if journal == nil {
+		backupBranch, err := e.createBackupBranch()
+		if err != nil {
+			return err
+		}
+		journal, err = startJournal(gitDir, journalEntry{
+			From:         base,
+			OriginalHead: originalHead,
+			BackupBranch: backupBranch,
+			Targets:      e.targetFiles,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if collision != nil {
+		if err := e.detachHead(); err != nil {
+			return err
 		}
-		fmt.Printf("\nThese files have been modified in multiple commits and may cause conflicts.\n")
-		fmt.Printf("Consider resolving manually if the rebase fails.\n\n")
+		e.infof("Detached HEAD, leaving %s to the worktree at %s\n", collision.Branch, collision.Worktree)
 	}
 
-	// Perform the rebase with splitting
-	if err := e.performRebase(from, commits); err != nil {
-		fmt.Printf("\n🚨 Rebase failed. To recover:\n")
-		fmt.Printf("  git reset --hard %s\n", originalHead)
-		return fmt.Errorf("rebase failed: %w", err)
+	// Only a process that dies mid-run leaves the journal behind
+	defer journal.remove()
+	defer removeAnalysisCache(gitDir)
+
+	// Rewrite without touching the working tree when nothing can conflict,
+	// otherwise perform the rebase with splitting
+	engine := "rebase"
+	if e.canUseFastPath(commits, conflicts, conflictErr) {
+		engine = "plumbing"
+		e.verbosef("No conflicts predicted, rewriting with plumbing\n")
+		err := e.rewriteWithPlumbing(commits)
+		switch {
+		case errors.Is(err, errHookChangedTree):
+			// Nothing has moved yet, and a rebase replays the commits after
+			// the split onto what the hook left
+			e.infof("The pre-commit hook changed a split commit; rewriting with git rebase to keep its changes\n")
+			if err := e.checkHiddenChanges(commits); err != nil {
+				return err
+			}
+			engine = "rebase"
+		case err != nil:
+			if e.ctx.Err() != nil {
+				return e.cancelRewrite(originalHead)
+			}
+			e.errorf("\n%s%s\n", e.style.glyph("🚨 "), e.style.paint(ansiRed, "Rewrite failed. To recover:"))
+			e.errorf("  git reset --hard %s\n", originalHead)
+			return fmt.Errorf("rewrite failed: %w", err)
+		}
+	}
+	if engine == "rebase" {
+		if err := e.performRebase(base, commits, journal); err != nil {
+			if e.ctx.Err() != nil {
+				return e.cancelRewrite(originalHead)
+			}
+			if conflict := (*ConflictError)(nil); errors.As(err, &conflict) && conflict.Aborted {
+				if rollErr := e.rollBack(originalHead); rollErr != nil {
+					return fmt.Errorf("rebase failed: %w; %v", err, rollErr)
+				}
+				e.errorf("\n%s%s\n", e.style.glyph("🚨 "), e.style.paint(ansiRed, "Stopped on conflicts; the rewrite was rolled back."))
+				return fmt.Errorf("rebase failed: %w", err)
+			}
+			e.errorf("\n%s%s\n", e.style.glyph("🚨 "), e.style.paint(ansiRed, "Rebase failed. To recover:"))
+			e.errorf("  git reset --hard %s\n", originalHead)
+			return fmt.Errorf("rebase failed: %w", err)
+		}
+	}
+	if err := e.checkRewrite(base, originalHead); err != nil {
+		if e.ctx.Err() != nil {
+			return e.cancelRewrite(originalHead)
+		}
+		return err
+	}
+	if err := e.runDeferredHooks(base, originalHead, commits, engine); err != nil {
+		if e.ctx.Err() != nil {
+			return e.cancelRewrite(originalHead)
+		}
+		return err
+	}
+	if err := e.runExec(base, originalHead, commits); err != nil {
+		if e.ctx.Err() != nil {
+			return e.cancelRewrite(originalHead)
+		}
+		return err
 	}
 
 	// Print success message with recovery info
-	fmt.Printf("\n✅ Successfully split commits. If you need to revert:\n")
-	fmt.Printf("  git reset --hard %s\n", originalHead)
+	e.infof("\n%s%s If you need to revert:\n", e.style.glyph("✅ "), e.style.paint(ansiGreen, "Successfully split commits."))
+	e.infof("  git reset --hard %s\n", originalHead)
+	if collision != nil {
+		if newHead, err := e.resolveCommit("HEAD"); err == nil {
+			e.infof("%s still points at the original commits. To move it, run in %s:\n", collision.Branch, collision.Worktree)
+			e.infof("  git reset --keep %s\n", newHead)
+		}
+	}
 
+	if err := e.updateNotes(base, commits); err != nil {
+		e.warnf("Commits were split, but their notes could not be updated: %v\n", err)
+	}
+	if e.rebaseDependents {
+		if err := e.rebaseDependentBranches(base, originalHead, journal.start.BackupBranch, commits); err != nil {
+			e.warnf("Commits were split, but dependent branches could not be rebased: %v\n", err)
+		}
+	}
+
+	if err := e.writeCommitMap(base, commits); err != nil {
+		return fmt.Errorf("commits were split, but %w", err)
+	}
+	if err := e.writeReport(base, originalHead, journal.start.BackupBranch, engine, commits, started); err != nil {
+		return fmt.Errorf("commits were split, but the report could not be written: %w", err)
+	}
 	return nil
 }
 
-// performRebase executes the git rebase with commit splitting
-func (e *Extractor) performRebase(from string, commits []CommitInfo) error {
+// workingTreeStatus returns porcelain status lines for changed tracked files
+// and the paths of untracked files
+func (e *Extractor) workingTreeStatus() ([]string, []string, error) {
+	entries, err := e.gitBackend.Status(e.ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dirty, untracked []string
+	for _, entry := range entries {
+		if entry.Untracked() {
+			untracked = append(untracked, entry.Path)
+		} else {
+			dirty = append(dirty, entry.String())
+		}
+	}
+	return dirty, untracked, nil
+}
+
+// warnUntrackedTargets warns about untracked files that match a target path,
+// since re-adding the targets during a split would pick them up
+func (e *Extractor) warnUntrackedTargets(untracked []string) {
+	analyzer := e.newAnalyzer()
+
+	var collisions []string
+	for _, path := range untracked {
+		if analyzer.isTargetFile(path) {
+			collisions = append(collisions, path)
+		}
+	}
+	if len(collisions) == 0 {
+		return
+	}
+
+	e.warnf("Untracked files match the target paths:\n")
+	for _, path := range collisions {
+		e.infof("  - %s\n", path)
+	}
+	e.infof("\nThese files may be added to the extracted commits. Move or remove them first.\n\n")
+}
+
+// checkGitVersion fails if the installed git is older than the minimum supported release
+func (e *Extractor) checkGitVersion() error {
+	version, err := e.repo.Version(e.ctx)
+	if err != nil {
+		return err
+	}
+	if !version.AtLeast(git.MinimumVersion) {
+		return fmt.Errorf("git >= %s is required, but git %s is installed", git.MinimumVersion, version)
+	}
+	e.verbosef("Using git %s\n", version)
+	return nil
+}
+
+// requireFeature returns an actionable error if the installed git lacks feature
+func (e *Extractor) requireFeature(feature git.Feature) error {
+	version, err := e.repo.Version(e.ctx)
+	if err != nil {
+		return err
+	}
+	return version.Require(feature)
+}
+
+// gitDir returns the absolute path of the repository's git directory
+func (e *Extractor) gitDir() (string, error) {
+	cmd := e.repo.Command(e.ctx, "rev-parse", "--absolute-git-dir")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate git directory: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitPath returns the path of name inside the git directory as git itself
+// resolves it: in the worktree's own directory for per-worktree state such
+// as rebase-merge, in the common directory for shared files such as shallow
+// and info/grafts, and under core.hooksPath for hooks
+func (e *Extractor) gitPath(name string) (string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "rev-parse", "--git-path", name)
+	if err != nil {
+		return "", fmt.Errorf("failed to locate %s: %w", name, err)
+	}
+	path := strings.TrimSpace(output)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(e.repoDir, path)
+	}
+	return path, nil
+}
+
+// workTree returns the absolute path of the top of the working tree, which
+// GIT_WORK_TREE may put somewhere other than the directory we run in
+func (e *Extractor) workTree() (string, error) {
+	output, err := e.repo.GitOutput(e.ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate working tree: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// resolveCommit resolves a revision to a full commit hash
+func (e *Extractor) resolveCommit(rev string) (string, error) {
+	return e.history().ResolveCommit(e.ctx, rev)
+}
+
+// resumeJournal loads the journal of an interrupted run and restores the
+// repository to the state after its last completed split
+func (e *Extractor) resumeJournal(gitDir, base string) (*journal, error) {
+	journal, err := loadJournal(gitDir)
+	if err != nil || journal == nil {
+		return nil, err
+	}
+
+	if !journal.matches(base, e.targetFiles) {
+		return nil, fmt.Errorf("an interrupted run with different arguments was found (base %s, targets %v).\n"+
+			"Re-run with the same arguments to resume, or remove %s to start over",
+			journal.start.From[:7], journal.start.Targets, journal.path)
+	}
+
+	// A split that was in flight when the process died left its rebase
+	// stopped; aborting it returns HEAD to the last completed split
+	if inProgress, _ := e.checkRebaseConflicts(); inProgress {
+		if err := e.gitBackend.Rebase(e.ctx, git.RebaseOptions{}, "--abort"); err != nil {
+			return nil, fmt.Errorf("failed to abort interrupted rebase: %w", err)
+		}
+	}
+
+	head, err := e.resolveCommit("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if head != journal.lastHead() {
+		return nil, fmt.Errorf("cannot resume interrupted run: HEAD is %s but the journal expects %s.\n"+
+			"To recover the original state: git reset --hard %s\n"+
+			"Then remove %s to start over", head[:7], journal.lastHead()[:7], journal.start.OriginalHead, journal.path)
+	}
+
+	e.infof("Resuming interrupted run: %d splits already completed\n", len(journal.splits))
+	return journal, nil
+}
+
+// SetBackupPrefix names backup branches <prefix><branch>-<pid> instead of <branch>-backup-<pid>
+func (e *Extractor) SetBackupPrefix(prefix string) {
+	e.backupPrefix = prefix
+}
+
+// createBackupBranch creates a backup branch at the current HEAD
+func (e *Extractor) createBackupBranch() (string, error) {
 	// Get current branch name for backup
-	cmd := exec.Command("git", "branch", "--show-current")
-	cmd.Dir = e.repoDir
-	branchOutput, err := cmd.Output()
+	currentBranch, err := e.history().CurrentBranch(e.ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get current branch: %w", err)
+		return "", err
 	}
-	currentBranch := strings.TrimSpace(string(branchOutput))
 
-	// Create backup branch
-	backupBranch := currentBranch + "-backup-" + fmt.Sprintf("%d", os.Getpid())
-	cmd = exec.Command("git", "branch", backupBranch)
-	cmd.Dir = e.repoDir
+	// Create backup branch. Later runs of the same extractor, such as the
+	// passes of a profile that groups its paths, number theirs
+	suffix := fmt.Sprintf("%d", os.Getpid())
+	if e.backups > 0 {
+		suffix += fmt.Sprintf("-%d", e.backups+1)
+	}
+	backupBranch := currentBranch + "-backup-" + suffix
+	if e.backupPrefix != "" {
+		backupBranch = e.backupPrefix + currentBranch + "-" + suffix
+	}
+	cmd := e.repo.Command(e.ctx, "branch", backupBranch)
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create backup branch: %w", err)
+		return "", fmt.Errorf("failed to create backup branch: %w", err)
 	}
-	fmt.Printf("Created backup branch: %s\n", backupBranch)
+	e.backups++
+	e.infof("Created backup branch: %s\n", backupBranch)
+
+	return backupBranch, nil
+}
+
+// performRebase executes the git rebase with commit splitting
+func (e *Extractor) performRebase(from string, commits []CommitInfo, journal *journal) error {
+	pending := 0
+	for _, commit := range commits {
+		if commit.NeedsSplit && !journal.completed(commit.Hash) {
+			pending++
+		}
+	}
+	if progress := e.newProgress(pending); progress != nil {
+		defer e.observe(progress)()
+	}
+	e.verbosef("Splitting %d commits with an interactive rebase each\n", pending)
 
 	// Process each commit that needs splitting using proper interactive rebase
 	// Work backwards through commits to maintain proper order
+	index := 0
 	for i := len(commits) - 1; i >= 0; i-- {
 		commit := commits[i]
-		if commit.NeedsSplit {
-			if err := e.splitCommitUsingInteractiveRebase(commit, from); err != nil {
-				return fmt.Errorf("failed to split commit %s: %w", commit.Hash, err)
-			}
+		if !commit.NeedsSplit || journal.completed(commit.Hash) {
+			continue
+		}
+		index++
+		e.notify(func(o Observer) { o.OnSplitStart(commit, index, pending) })
+		if err := e.runPreSplit(commit); err != nil {
+			return err
+		}
+		if err := e.splitCommitUsingInteractiveRebase(commit, from); err != nil {
+			return fmt.Errorf("failed to split commit %s: %w", commit.Hash, err)
+		}
+
+		head, err := e.resolveCommit("HEAD")
+		if err != nil {
+			return err
+		}
+		if err := journal.recordSplit(commit.Hash, head); err != nil {
+			return err
 		}
 	}
 
@@ -289,409 +854,242 @@ func (e *Extractor) performRebase(from string, commits []CommitInfo) error {
 
 // splitCommitUsingInteractiveRebase splits a buried commit using interactive rebase
 func (e *Extractor) splitCommitUsingInteractiveRebase(commit CommitInfo, from string) error {
-	// Create a custom rebase sequence that marks our target commit for editing
-	// and picks all others
-	sequenceFile := fmt.Sprintf("/tmp/rebase-sequence-%d", os.Getpid())
-	defer os.Remove(sequenceFile)
-	
-	// Generate the rebase todo list
-	cmd := exec.Command("git", "log", "--reverse", "--format=%H %s", from+"..HEAD")
-	cmd.Dir = e.repoDir
-	output, err := cmd.Output()
+	// Re-run ourselves as the sequence editor to turn the commit's pick
+	// into an edit in the todo list git generates
+	editorEnv, err := sequenceEditor(commit.Hash)
 	if err != nil {
-		return fmt.Errorf("failed to get commit list: %w", err)
-	}
-	
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	var sequence []string
-	
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) < 2 {
-			continue
-		}
-		hash := parts[0]
-		message := parts[1]
-		
-		if hash == commit.Hash {
-			// Mark this commit for editing
-			sequence = append(sequence, fmt.Sprintf("edit %s %s", hash[:7], message))
-		} else {
-			// Pick other commits normally
-			sequence = append(sequence, fmt.Sprintf("pick %s %s", hash[:7], message))
-		}
-	}
-	
-	// Write the sequence file
-	sequenceContent := strings.Join(sequence, "\n") + "\n"
-	if err := os.WriteFile(sequenceFile, []byte(sequenceContent), 0644); err != nil {
-		return fmt.Errorf("failed to write sequence file: %w", err)
-	}
-	
-	// Create a simple sequence editor that uses our pre-written file
-	editorScript := fmt.Sprintf("#!/bin/sh\ncp %s \"$1\"\n", sequenceFile)
-	editorPath := fmt.Sprintf("/tmp/rebase-editor-%d.sh", os.Getpid())
-	if err := os.WriteFile(editorPath, []byte(editorScript), 0755); err != nil {
-		return fmt.Errorf("failed to create editor script: %w", err)
+		return err
 	}
-	defer os.Remove(editorPath)
-	
+
 	// Start the interactive rebase
-	cmd = exec.Command("git", "rebase", "-i", from)
-	cmd.Dir = e.repoDir
-	cmd.Env = append(os.Environ(), "GIT_SEQUENCE_EDITOR="+editorPath)
-	
-	if err := cmd.Run(); err != nil {
+	mergeArgs, err := e.mergeRebaseArgs(from)
+	if err != nil {
+		return err
+	}
+	args := append([]string{"-i"}, e.emptyRebaseArgs()...)
+	args = append(args, mergeArgs...)
+	e.record(EditedTodoEvent{Commit: commit.Hash, Onto: from})
+	if err := e.runRebase(editorEnv, append(args, from)...); err != nil {
 		// Check if we're in a rebase state with conflicts
 		if isRebaseInProgress, conflictMsg := e.checkRebaseConflicts(); isRebaseInProgress {
-			return fmt.Errorf("rebase stopped due to conflicts:\n%s\n\nTo resolve:\n1. Manually resolve conflicts in the affected files\n2. Run: git add <resolved-files>\n3. Run: git rebase --continue\n4. Or run: git rebase --abort to cancel", conflictMsg)
+			return e.conflictError(commit, conflictMsg)
 		}
 		return fmt.Errorf("failed to start interactive rebase: %w", err)
 	}
-	
+
 	// Check if rebase is still in progress (stopped at our edit point)
+	var unreported rewrite
 	if isRebaseInProgress, _ := e.checkRebaseConflicts(); isRebaseInProgress {
 		// We're in edit mode, proceed with splitting
-		if err := e.splitCurrentCommit(commit); err != nil {
-			exec.Command("git", "rebase", "--abort").Run()
+		if unreported, err = e.splitCurrentCommit(commit); err != nil {
+			_ = e.gitBackend.Rebase(e.ctx, git.RebaseOptions{}, "--abort")
 			return fmt.Errorf("failed to split commit during rebase: %w", err)
 		}
 	} else {
 		// Rebase completed without stopping - this shouldn't happen with our edit command
 		return fmt.Errorf("rebase completed unexpectedly without stopping for editing")
 	}
-	
+
 	// Continue the rebase
-	cmd = exec.Command("git", "rebase", "--continue")
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
+	if err := e.runRebase(nil, "--continue"); err != nil {
+		if _, conflictMsg := e.checkRebaseConflicts(); strings.HasPrefix(conflictMsg, "Merge conflicts") {
+			return e.conflictError(commit, conflictMsg)
+		}
 		return fmt.Errorf("failed to continue rebase: %w", err)
 	}
-	
+
+	// git reports the stopped commit as rewritten into the one HEAD ended
+	// on, so tell post-rewrite about the other half, if it was split.
+	// Deferred hooks hear about the whole run at the end instead.
+	if unreported.old != "" && !e.deferHooks {
+		e.runPostRewrite([]rewrite{unreported})
+	}
 	return nil
 }
 
-// splitCurrentCommit splits the current commit during a rebase
-func (e *Extractor) splitCurrentCommit(commit CommitInfo) error {
-	e.debugf("Starting to split commit %s\n", commit.Hash[:7])
-	
-	// Reset the commit but keep the changes in the working directory
-	e.debugf("Resetting commit to HEAD^\n")
-	cmd := exec.Command("git", "reset", "HEAD^")
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to reset commit: %w", err)
-	}
-	
-	// Show what's in working directory after reset
-	e.debugGitStatus("After resetting commit")
-	
-	firstMsg, secondMsg := GenerateSplitMessages(commit.Message, e.targetFiles)
-
-	// Stage all files except the target files
-	e.debugf("Staging all files with 'git add .'\n")
-	cmd = exec.Command("git", "add", ".")
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to stage files: %w", err)
+// splitCurrentCommit splits the current commit during a rebase. Both halves
+// are built with plumbing, so the index and working tree are never rewritten
+// and file mtimes stay untouched. It returns the rewrite of the stopped commit
+// into the first half, which git doesn't know about, or a zero rewrite when
+// the commit has only target changes or none left and is kept whole
+func (e *Extractor) splitCurrentCommit(commit CommitInfo) (rewrite, error) {
+	e.debug("splitting commit", "commit", commit.Hash, "step", "start")
+
+	// The stopped commit differs from commit.Hash once earlier commits in the
+	// range have been rewritten
+	source, err := e.resolveCommit("HEAD")
+	if err != nil {
+		return rewrite{}, err
 	}
-
-	// Show what's staged after add .
-	e.debugGitStatus("After staging all files")
-
-	// Unstage the target files
-	e.debugf("Unstaging target files: %v\n", e.targetFiles)
-	for _, targetFile := range e.targetFiles {
-		e.debugf("Running 'git reset HEAD %s'\n", targetFile)
-		cmd = exec.Command("git", "reset", "HEAD", targetFile)
-		cmd.Dir = e.repoDir
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			e.debugf("Reset failed for %s: %v, output: %s\n", targetFile, err, string(output))
-			// Continue anyway - file might not be staged
-			continue
-		}
-		e.debugf("Reset successful for %s, output: %s\n", targetFile, string(output))
+	// Read the parent from the commit itself rather than HEAD^, which needs
+	// care at the base and says nothing about merges
+	parents, err := e.commitParents(source)
+	if err != nil {
+		return rewrite{}, err
 	}
-
-	// Show what's staged after unstaging target files
-	e.debugGitStatus("After unstaging target files")
-
-	// Create first commit (everything except target files)
-	e.debugf("Creating first commit with message: %q\n", firstMsg)
-	e.debugf("Preserving author: %s\n", commit.Author)
-	cmd = exec.Command("git", "commit", "-m", firstMsg, "--author", commit.Author)
-	cmd.Dir = e.repoDir
-	output, err := cmd.CombinedOutput()
+	if len(parents) != 1 {
+		return rewrite{}, fmt.Errorf("stopped at %s, which has %d parents; only commits with a single parent can be split", source[:7], len(parents))
+	}
+	parent := parents[0]
+	meta, err := e.readCommitMeta(source)
 	if err != nil {
-		e.debugf("First commit failed: %v, output: %s\n", err, string(output))
-		return fmt.Errorf("failed to create first split commit: %w, output: %s", err, string(output))
+		return rewrite{}, err
 	}
-	e.debugf("First commit successful, output: %s\n", string(output))
 
-	// Show repo state after first commit
-	e.debugGitStatus("After first commit")
-
-	// Add the target files back
-	e.debugf("Adding target files back\n")
-	targetFilesAdded := 0
-	for _, targetFile := range e.targetFiles {
-		e.debugf("Running 'git add %s'\n", targetFile)
-		cmd = exec.Command("git", "add", targetFile)
-		cmd.Dir = e.repoDir
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			// If normal add fails, try with --force to handle .gitignore'd files
-			e.debugf("Add failed for %s: %v, output: %s\n", targetFile, err, string(output))
-			e.debugf("Retrying with 'git add --force %s'\n", targetFile)
-			cmd = exec.Command("git", "add", "--force", targetFile)
-			cmd.Dir = e.repoDir
-			output, err = cmd.CombinedOutput()
-			if err != nil {
-				e.debugf("Force add also failed for %s: %v, output: %s\n", targetFile, err, string(output))
-				// Continue anyway - file might not exist in working dir
-				continue
-			}
-			e.debugf("Force add successful for %s, output: %s\n", targetFile, string(output))
-		} else {
-			e.debugf("Add successful for %s, output: %s\n", targetFile, string(output))
-		}
-		targetFilesAdded++
+	// First commit: everything except the target files, or only the target
+	// files when the extracted commit goes first
+	firstTree, firstMsg, secondMsg, err := e.splitLayout(commit, source, parent)
+	if err != nil {
+		return rewrite{}, err
 	}
-
-	e.debugf("Successfully added %d target files\n", targetFilesAdded)
-	
-	// Show what's staged before second commit
-	e.debugGitStatus("Before second commit")
-
-	// Check if we have anything to commit
-	if targetFilesAdded == 0 {
-		return fmt.Errorf("no target files were successfully staged for second commit")
+	sourceTree, err := e.repo.GitOutput(e.ctx, "rev-parse", source+"^{tree}")
+	if err != nil {
+		return rewrite{}, fmt.Errorf("failed to read tree of %s: %w", source[:7], err)
 	}
-
-	// Create second commit (target files only)
-	e.debugf("Creating second commit with message: %q\n", secondMsg)
-	e.debugf("Preserving author: %s\n", commit.Author)
-	cmd = exec.Command("git", "commit", "-m", secondMsg, "--author", commit.Author)
-	cmd.Dir = e.repoDir
-	output, err = cmd.CombinedOutput()
+	parentTree, err := e.repo.GitOutput(e.ctx, "rev-parse", parent+"^{tree}")
 	if err != nil {
-		e.debugf("Second commit failed: %v, output: %s\n", err, string(output))
-		return fmt.Errorf("failed to create second split commit: %w, output: %s", err, string(output))
+		return rewrite{}, fmt.Errorf("failed to read tree of %s: %w", parent[:7], err)
 	}
-	e.debugf("Second commit successful, output: %s\n", string(output))
-
-	e.debugf("Commit splitting completed successfully\n")
-	return nil
-}
-
-// splitHeadCommit splits the HEAD commit
-func (e *Extractor) splitHeadCommit(commit CommitInfo) error {
-	// Reset the commit but keep changes in working directory
-	cmd := exec.Command("git", "reset", "--soft", "HEAD~1")
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to reset HEAD commit: %w", err)
+	// Replaying a flattened merge can leave a commit whose target changes,
+	// or whose other changes, are already in the history below it; it
+	// stays whole rather than getting a half that changes nothing
+	noTargetChanges := firstTree == strings.TrimSpace(sourceTree)
+	onlyTargetChanges := firstTree == strings.TrimSpace(parentTree)
+	if e.extractedFirst(commit) {
+		noTargetChanges, onlyTargetChanges = onlyTargetChanges, noTargetChanges
 	}
-
-	firstMsg, secondMsg := GenerateSplitMessages(commit.Message, e.targetFiles)
-
-	// Stage all files except the target file
-	cmd = exec.Command("git", "add", ".")
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to stage files: %w", err)
+	if noTargetChanges {
+		e.infof("Keeping %s whole: its changes to the targets are already in the rewritten history\n", commit.Hash[:7])
+		return rewrite{}, nil
+	}
+	if onlyTargetChanges {
+		e.infof("Keeping %s whole: its changes to other files are already in the rewritten history\n", commit.Hash[:7])
+		return rewrite{}, nil
 	}
 
-	// Unstage the target files
-	for _, targetFile := range e.targetFiles {
-		cmd = exec.Command("git", "reset", "HEAD", targetFile)
-		cmd.Dir = e.repoDir
-		if err := cmd.Run(); err != nil {
-			// Ignore errors for files that don't exist in this commit
-			continue
-		}
+	e.debug("creating split commit", "commit", commit.Hash, "step", "first", "message", firstMsg)
+	first, hooked, err := e.commitSplit(firstTree, parent, meta, firstMsg+"\n")
+	if err != nil {
+		return rewrite{}, fmt.Errorf("failed to create first split commit: %w", err)
 	}
 
-	// Create first commit (everything except target file)
-	cmd = exec.Command("git", "commit", "-m", firstMsg, "--author", commit.Author)
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create first split commit: %w", err)
-	}
-
-	// Add and commit the target files
-	for _, targetFile := range e.targetFiles {
-		cmd = exec.Command("git", "add", targetFile)
-		cmd.Dir = e.repoDir
-		if err := cmd.Run(); err != nil {
-			// If normal add fails, try with --force to handle .gitignore'd files
-			cmd = exec.Command("git", "add", "--force", targetFile)
-			cmd.Dir = e.repoDir
-			if err := cmd.Run(); err != nil {
-				// Ignore errors for files that don't exist in working dir
-				continue
-			}
+	// Second commit: the other half, which brings the tree back to the
+	// original, along with anything the pre-commit hook changed in the first
+	e.debug("creating split commit", "commit", commit.Hash, "step", "second", "message", secondMsg)
+	secondTree := source + "^{tree}"
+	if hooked != firstTree {
+		if secondTree, err = e.afterHookedHalf(firstTree, hooked, source); err != nil {
+			return rewrite{}, err
 		}
 	}
+	second, hooked, err := e.commitSplit(secondTree, first, meta, secondMsg+"\n")
+	if err != nil {
+		return rewrite{}, fmt.Errorf("failed to create second split commit: %w", err)
+	}
 
-	cmd = exec.Command("git", "commit", "-m", secondMsg, "--author", commit.Author)
-	cmd.Dir = e.repoDir
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create second split commit: %w", err)
+	if err := e.gitBackend.UpdateRef(e.ctx, "HEAD", second, source, "git-rebase-extract-file: split "+commit.Hash[:7]); err != nil {
+		return rewrite{}, err
+	}
+	e.record(ResetEvent{Ref: "HEAD", From: source, To: second})
+	// The index and files still match the original tree, which is the tree
+	// at HEAD unless the pre-commit hook changed files
+	if hooked != source+"^{tree}" {
+		cmd := e.repo.Command(e.ctx, "read-tree", "-m", "-u", source, second)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return rewrite{}, fmt.Errorf("failed to check out the files the pre-commit hook changed: %w, output: %s", err, string(output))
+		}
 	}
 
-	return nil
+	e.verbosef("Split %s into %s and %s\n", commit.Hash[:7], first[:7], second[:7])
+	e.notifySplitDone(commit, first, second)
+	e.runPostSplit(commit, first, second)
+	e.debugGitStatus(commit, "done")
+	return rewrite{old: source, new: first}, nil
 }
 
-
-
-
 // GenerateSplitMessages creates the two commit messages for a split
 func GenerateSplitMessages(original string, targetFiles []string) (string, string) {
 	// First commit: original + split notice
-	var firstMsg string
-	if len(targetFiles) == 1 {
-		firstMsg = original + "\n\nChanges to " + targetFiles[0] + " split into a separate commit"
-	} else {
-		firstMsg = original + "\n\nChanges to target files split into a separate commit"
-	}
+	firstMsg := original + "\n\nChanges to " + targetDescription(targetFiles) + " split into a separate commit"
 
 	// Second commit: prefixed original
-	var secondMsg string
-	if len(targetFiles) == 1 {
-		secondMsg = targetFiles[0] + ": " + original
-	} else {
-		secondMsg = "target files: " + original
-	}
+	secondMsg := targetDescription(targetFiles) + ": " + original
 
 	return firstMsg, secondMsg
 }
 
+// rebaseInProgress reports whether a rebase (or git am) is stopped in the
+// current worktree
+func (e *Extractor) rebaseInProgress() bool {
+	for _, state := range []string{"rebase-merge", "rebase-apply"} {
+		path, err := e.gitPath(state)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
 // checkRebaseConflicts checks if we're in a rebase state and returns conflict information
 func (e *Extractor) checkRebaseConflicts() (bool, string) {
-	// Check if rebase is in progress by looking for .git/rebase-merge directory
-	rebaseMergeDir := fmt.Sprintf("%s/.git/rebase-merge", e.repoDir)
-	if _, err := os.Stat(rebaseMergeDir); os.IsNotExist(err) {
+	// git keeps the rebase state in the worktree's own git directory, which
+	// isn't <worktree>/.git with GIT_DIR, --separate-git-dir, or linked worktrees
+	rebaseMerge, err := e.gitPath("rebase-merge")
+	if err != nil {
+		return false, ""
+	}
+	if _, err := os.Stat(rebaseMerge); os.IsNotExist(err) {
 		return false, ""
 	}
 
-	// Get status to check for conflicts
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = e.repoDir
-	output, err := cmd.Output()
+	entries, err := e.gitBackend.Status(e.ctx)
 	if err != nil {
 		return true, "Unable to check git status"
 	}
-
-	status := strings.TrimSpace(string(output))
-	if status == "" {
+	if len(entries) == 0 {
 		return true, "Rebase in progress - ready for editing"
 	}
 
-	// Look for conflict markers in status
-	lines := strings.Split(status, "\n")
 	var conflicts []string
 	var staged []string
-	
-	for _, line := range lines {
-		if len(line) < 3 {
-			continue
-		}
-		
-		// Parse git status format: XY filename
-		statusCode := line[:2]
-		filename := line[3:]
-		
-		if strings.Contains(statusCode, "U") || statusCode == "AA" || statusCode == "DD" {
-			conflicts = append(conflicts, filename)
-		} else if statusCode[0] != ' ' && statusCode[0] != '?' {
-			staged = append(staged, filename)
+	for _, entry := range entries {
+		if entry.Conflicted() {
+			conflicts = append(conflicts, entry.Path)
+		} else if entry.XY[0] != ' ' && !entry.Untracked() {
+			staged = append(staged, entry.Path)
 		}
 	}
 
 	if len(conflicts) > 0 {
 		return true, fmt.Sprintf("Merge conflicts in: %s", strings.Join(conflicts, ", "))
 	}
-	
+
 	if len(staged) > 0 {
 		return true, fmt.Sprintf("Changes ready to commit: %s", strings.Join(staged, ", "))
 	}
-	
+
 	return true, "Rebase in progress"
 }
 
-// checkPotentialConflicts identifies files that might cause conflicts during rebase
-func (e *Extractor) checkPotentialConflicts(from string) []string {
-	// Get all files modified in the range
-	cmd := exec.Command("git", "log", "--name-only", "--format=", from+"..HEAD")
-	cmd.Dir = e.repoDir
-	output, err := cmd.Output()
-	if err != nil {
-		return nil
-	}
-
-	// Count occurrences of each file
-	fileCount := make(map[string]int)
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" {
-			fileCount[line]++
-		}
-	}
-
-	// Find files modified in multiple commits
-	var potentialConflicts []string
-	for file, count := range fileCount {
-		if count > 1 {
-			potentialConflicts = append(potentialConflicts, file)
-		}
+// debugGitStatus records the status of the working tree and index at a
+// step of splitting commit
+func (e *Extractor) debugGitStatus(commit CommitInfo, step string) {
+	// Both commands are only worth running if someone is listening
+	if !e.log().Enabled(e.ctx, slog.LevelDebug) {
+		return
 	}
-
-	return potentialConflicts
-}
-
-// debugGitStatus shows the current git status for debugging
-func (e *Extractor) debugGitStatus(label string) {
-	e.debugf("Git status %s:\n", label)
-	
-	// Get porcelain status
-	cmd := exec.Command("git", "status", "--porcelain")
-	cmd.Dir = e.repoDir
-	output, err := cmd.Output()
+	status, err := e.repo.GitOutput(e.ctx, "-c", "core.quotePath=false", "status", "--porcelain")
 	if err != nil {
-		e.debugf("Failed to get git status: %v\n", err)
+		e.logWarn("failed to get git status", err)
 		return
 	}
-
-	status := string(output)
-	if status == "" {
-		e.debugf("Working directory clean\n")
-	} else {
-		e.debugf("Status output:\n%s", status)
-	}
-	
-	// Also show what's staged specifically
-	cmd = exec.Command("git", "diff", "--cached", "--name-status")
-	cmd.Dir = e.repoDir
-	output, err = cmd.Output()
+	staged, err := e.repo.GitOutput(e.ctx, "-c", "core.quotePath=false", "diff", "--cached", "--name-status")
 	if err != nil {
-		e.debugf("Failed to get staged changes: %v\n", err)
+		e.logWarn("failed to get staged changes", err)
 		return
 	}
-	
-	staged := string(output)
-	if staged == "" {
-		e.debugf("No staged changes\n")
-	} else {
-		e.debugf("Staged changes:\n%s", staged)
-	}
-	
-	e.debugf("---\n")
+	e.debug("git status", "commit", commit.Hash, "step", step, "status", status, "staged", staged)
 }
-
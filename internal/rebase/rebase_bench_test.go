@@ -0,0 +1,96 @@
+// ABOUTME: Benchmarks for commit analysis and the rewrite engines
+// ABOUTME: Uses generated histories to compare exec/go-git analysis and single-pass/per-commit rewrites
+
+package rebase
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"github.com/obra/git-rebase-extract-file/internal/testutils"
+)
+
+// benchmarkHistory is the history shape shared by the benchmarks
+var benchmarkHistory = testutils.HistoryOptions{Commits: 50, Files: 20, MixRatio: 0.2}
+
+func BenchmarkAnalyzeRange_Exec(b *testing.B) {
+	repo := testutils.NewTestRepo(b)
+	base := repo.GenerateHistory(benchmarkHistory)
+
+	// The exec backend analyzes GOMAXPROCS commits at once, each worker with
+	// git processes of its own; one worker shows what that parallelism buys
+	for _, workers := range []int{1, max(4, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(workers))
+			backend := git.NewRepository(repo.Dir)
+			defer backend.Close()
+			analyzer := NewAnalyzer(repo.Dir, "target.txt")
+			analyzer.SetBackend(backend)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := analyzer.AnalyzeRange(b.Context(), base, "HEAD"); err != nil {
+					b.Fatalf("AnalyzeRange failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAnalyzeRange_GoGit(b *testing.B) {
+	repo := testutils.NewTestRepo(b)
+	base := repo.GenerateHistory(benchmarkHistory)
+	backend, err := git.OpenGoGit(repo.Dir)
+	if err != nil {
+		b.Fatalf("OpenGoGit failed: %v", err)
+	}
+	analyzer := NewAnalyzer(repo.Dir, "target.txt")
+	analyzer.SetBackend(backend)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := analyzer.AnalyzeRange(b.Context(), base, "HEAD"); err != nil {
+			b.Fatalf("AnalyzeRange failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkExtract_SinglePass(b *testing.B) {
+	benchmarkExtract(b, true)
+}
+
+func BenchmarkExtract_PerCommitRebase(b *testing.B) {
+	benchmarkExtract(b, false)
+}
+
+// benchmarkExtract times full extractions, restoring the history between runs
+func benchmarkExtract(b *testing.B, fastPath bool) {
+	repo := testutils.NewTestRepo(b)
+	base := repo.GenerateHistory(benchmarkHistory)
+	originalHead := repo.GetCurrentHead()
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetFastPath(fastPath)
+	// Printing progress and the summary on every run would skew the timings
+	extractor.SetOutput(io.Discard)
+	extractor.SetErrorOutput(io.Discard)
+	defer extractor.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := extractor.Extract(b.Context(), base, "HEAD"); err != nil {
+			b.Fatalf("Extract failed: %v", err)
+		}
+
+		b.StopTimer()
+		repo.Git("reset", "-q", "--hard", originalHead)
+		for _, branch := range strings.Fields(repo.Git("branch", "--list", "*-backup-*", "--format=%(refname:short)")) {
+			repo.Git("branch", "-D", branch)
+		}
+		b.StartTimer()
+	}
+}
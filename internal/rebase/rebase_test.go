@@ -4,12 +4,64 @@
 package rebase
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/obra/git-rebase-extract-file/internal/git"
 	"github.com/obra/git-rebase-extract-file/internal/testutils"
 )
 
+// TestMain lets the test binary stand in for the tool when git runs it as
+// the rebase sequence editor
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == "--"+SequenceEditorFlag {
+		if err := RunSequenceEditor(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// gitVersion probes the git the tests run against: the first one on PATH,
+// which "make test-git-versions" points at each release in turn
+var gitVersion = sync.OnceValues(func() (git.Version, error) {
+	dir, err := os.MkdirTemp("", "git-rebase-extract-version-*")
+	if err != nil {
+		return git.Version{}, err
+	}
+	defer os.RemoveAll(dir)
+	return git.NewRepository(dir).Version(context.Background())
+})
+
+// requireGit skips the test if the git under test lacks feature
+func requireGit(t *testing.T, feature git.Feature) {
+	t.Helper()
+
+	version, err := gitVersion()
+	if err != nil {
+		t.Fatalf("Failed to probe git version: %v", err)
+	}
+	if !version.Supports(feature) {
+		t.Skipf("git %s lacks %s", version, feature.Name)
+	}
+}
+
 func TestAnalyzeCommits_NoTargetFileChanges(t *testing.T) {
 	repo := testutils.NewTestRepo(t)
 
@@ -21,7 +73,7 @@ func TestAnalyzeCommits_NoTargetFileChanges(t *testing.T) {
 	repo.Commit("Add other file")
 
 	analyzer := NewAnalyzer(repo.Dir, "target.txt")
-	commits, err := analyzer.AnalyzeRange(commit1, "HEAD")
+	commits, err := analyzer.AnalyzeRange(t.Context(), commit1, "HEAD")
 
 	if err != nil {
 		t.Fatalf("AnalyzeRange failed: %v", err)
@@ -52,7 +104,7 @@ func TestAnalyzeCommits_TargetFileOnly(t *testing.T) {
 	repo.Commit("Update target file only")
 
 	analyzer := NewAnalyzer(repo.Dir, "target.txt")
-	commits, err := analyzer.AnalyzeRange(baseCommit, "HEAD")
+	commits, err := analyzer.AnalyzeRange(t.Context(), baseCommit, "HEAD")
 
 	if err != nil {
 		t.Fatalf("AnalyzeRange failed: %v", err)
@@ -81,7 +133,7 @@ func TestAnalyzeCommits_TargetFileWithOthers(t *testing.T) {
 	repo.Commit("Update multiple files")
 
 	analyzer := NewAnalyzer(repo.Dir, "target.txt")
-	commits, err := analyzer.AnalyzeRange(baseCommit, "HEAD")
+	commits, err := analyzer.AnalyzeRange(t.Context(), baseCommit, "HEAD")
 
 	if err != nil {
 		t.Fatalf("AnalyzeRange failed: %v", err)
@@ -110,11 +162,12 @@ func TestDryRun_Output(t *testing.T) {
 
 	// Test dry run
 	extractor := NewExtractor(repo.Dir, "target.txt")
-	output, err := extractor.DryRun(baseCommit, "HEAD")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
 
 	if err != nil {
 		t.Fatalf("DryRun failed: %v", err)
 	}
+	output := extractor.Render(report)
 
 	// Verify output format
 	expectedParts := []string{
@@ -188,7 +241,7 @@ func TestExtractFile_ActualRebase(t *testing.T) {
 
 	// Perform the extraction (currently disabled for safety)
 	extractor := NewExtractor(repo.Dir, "target.txt")
-	err := extractor.Extract(baseCommit, "HEAD")
+	err := extractor.Extract(t.Context(), baseCommit, "HEAD")
 
 	if err != nil {
 		t.Fatalf("Extract failed: %v", err)
@@ -196,7 +249,7 @@ func TestExtractFile_ActualRebase(t *testing.T) {
 
 	// Since actual splitting is now enabled, commits should be split
 	analyzer := NewAnalyzer(repo.Dir, "target.txt")
-	commits, err := analyzer.AnalyzeRange(baseCommit, "HEAD")
+	commits, err := analyzer.AnalyzeRange(t.Context(), baseCommit, "HEAD")
 	if err != nil {
 		t.Fatalf("Failed to analyze result: %v", err)
 	}
@@ -234,7 +287,7 @@ func TestExtractFile_PrintsRevertInstructions(t *testing.T) {
 
 	// We can't easily capture stdout in tests, but we can verify the extraction works
 	// and that it would print the correct hash by checking the logic
-	err := extractor.Extract(baseCommit, "HEAD")
+	err := extractor.Extract(t.Context(), baseCommit, "HEAD")
 	if err != nil {
 		t.Fatalf("Extract failed: %v", err)
 	}
@@ -248,7 +301,7 @@ func TestExtractFile_PrintsRevertInstructions(t *testing.T) {
 
 	// Verify splitting occurred by checking commit count
 	analyzer := NewAnalyzer(repo.Dir, "target.txt")
-	commits, err := analyzer.AnalyzeRange(baseCommit, "HEAD")
+	commits, err := analyzer.AnalyzeRange(t.Context(), baseCommit, "HEAD")
 	if err != nil {
 		t.Fatalf("Failed to analyze result: %v", err)
 	}
@@ -259,7 +312,7 @@ func TestExtractFile_PrintsRevertInstructions(t *testing.T) {
 	}
 }
 
-// Test multi-file message generation  
+// Test multi-file message generation
 func TestMultiFileMessageGeneration(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -298,3 +351,4701 @@ func TestMultiFileMessageGeneration(t *testing.T) {
 		})
 	}
 }
+
+func TestExtract_FailsWhenLocked(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Fix user authentication bug")
+
+	// Simulate another run holding the lock
+	lock, err := acquireLock(filepath.Join(repo.Dir, ".git"))
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	defer lock.release()
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	err = extractor.Extract(t.Context(), baseCommit, "HEAD")
+	if err == nil {
+		t.Fatal("Expected Extract to fail while another run holds the lock")
+	}
+
+	expectedParts := []string{"another git-rebase-extract-file run is in progress", fmt.Sprintf("pid %d", os.Getpid())}
+	for _, part := range expectedParts {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Expected lock error to contain '%s', got: %v", part, err)
+		}
+	}
+
+	// The lock must be released after a successful run
+	lock.release()
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed after lock release: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repo.Dir, ".git", lockFileName)); !os.IsNotExist(err) {
+		t.Error("Expected lock file to be removed after Extract")
+	}
+}
+
+func TestExtract_KeepsTemporaryFilesInRunDirectory(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+	gitDir := filepath.Join(repo.Dir, ".git")
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	// Leftovers of a run that was killed
+	stale := filepath.Join(gitDir, tempDirName, "run-1234")
+	if err := os.MkdirAll(stale, 0700); err != nil {
+		t.Fatalf("Failed to create stale directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(stale, "index"), []byte("stale"), 0600); err != nil {
+		t.Fatalf("Failed to write stale file: %v", err)
+	}
+
+	// The hooks see where the temporary index and message file are.
+	// pre-commit runs in a worktree of its own, where .git is a file.
+	hooks := map[string]string{
+		"pre-commit": "echo \"$GIT_INDEX_FILE\" >> \"$(git rev-parse --git-common-dir)/temp-paths\"\n",
+		"commit-msg": "echo \"$1\" >> .git/temp-paths\n",
+	}
+	for name, script := range hooks {
+		if err := os.WriteFile(filepath.Join(gitDir, "hooks", name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("Failed to install %s hook: %v", name, err)
+		}
+	}
+
+	if err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	paths, err := os.ReadFile(filepath.Join(gitDir, "temp-paths"))
+	if err != nil {
+		t.Fatalf("Expected the hooks to run: %v", err)
+	}
+	lines := strings.Fields(string(paths))
+	if len(lines) != 4 {
+		t.Fatalf("Expected 2 temporary paths per split commit, got %q", lines)
+	}
+	runDir := filepath.Dir(filepath.Dir(lines[0]))
+	for _, path := range lines {
+		if !strings.HasPrefix(path, filepath.Join(gitDir, tempDirName, "run-")) || !strings.HasPrefix(path, runDir) {
+			t.Errorf("Expected %s in the run's temporary directory", path)
+		}
+	}
+	if runDir == stale {
+		t.Errorf("Expected a fresh directory, not the stale one")
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, tempDirName)); !os.IsNotExist(err) {
+		t.Error("Expected the temporary files, stale ones included, to be removed")
+	}
+}
+
+func TestExtract_Autostash(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Fix user authentication bug")
+
+	// Leave an uncommitted modification in the working tree
+	repo.WriteFile("main.go", "package main\n\n// work in progress\n")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err == nil {
+		t.Fatal("Expected Extract to refuse a dirty working tree without autostash")
+	}
+
+	extractor.SetAutostash(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract with autostash failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(repo.Dir, "main.go"))
+	if err != nil {
+		t.Fatalf("Failed to read main.go: %v", err)
+	}
+	if string(content) != "package main\n\n// work in progress\n" {
+		t.Errorf("Expected uncommitted changes to be restored, got %q", string(content))
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits after splitting, got %d", len(commits))
+	}
+}
+
+func TestExtract_AllowsUntrackedFiles(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Fix user authentication bug")
+
+	// Untracked build output must not block the run or leak into commits
+	repo.WriteFile("build/output.bin", "artifact")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed with untracked files present: %v", err)
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits after splitting, got %d", len(commits))
+	}
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			if file == "build/output.bin" {
+				t.Errorf("Untracked file was committed in %s", commit.Hash[:7])
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(repo.Dir, "build/output.bin")); err != nil {
+		t.Errorf("Expected untracked file to remain in place: %v", err)
+	}
+}
+
+func TestExtract_StagesOnlyCommittedTargetPaths(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("docs/guide.md", "guide")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Add guide")
+
+	// An editor swap file inside the target directory must stay untracked
+	repo.WriteFile("docs/.guide.md.swp", "swap")
+
+	extractor := NewExtractor(repo.Dir, "docs/")
+	extractor.SetFastPath(false)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "docs/").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("Expected 2 commits after splitting, got %d", len(commits))
+	}
+	if !reflect.DeepEqual(commits[1].Files, []string{"docs/guide.md"}) {
+		t.Errorf("Expected only docs/guide.md in the extracted commit, got %v", commits[1].Files)
+	}
+}
+
+func TestExtract_ResumesFromJournal(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "first")
+	repo.WriteFile("one.go", "package one\n")
+	repo.Commit("First mixed commit")
+
+	repo.WriteFile("target.txt", "second")
+	repo.WriteFile("two.go", "package two\n")
+	repo.Commit("Second mixed commit")
+	originalHead := repo.GetCurrentHead()
+
+	// Simulate a run that completed the first split and then died
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("AnalyzeRange failed: %v", err)
+	}
+	gitDir := filepath.Join(repo.Dir, ".git")
+	journal, err := startJournal(gitDir, journalEntry{
+		From:         baseCommit,
+		OriginalHead: originalHead,
+		BackupBranch: "master-backup-1",
+		Targets:      []string{"target.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start journal: %v", err)
+	}
+	if err := extractor.splitCommitUsingInteractiveRebase(commits[1], baseCommit); err != nil {
+		t.Fatalf("Failed to split commit: %v", err)
+	}
+	if err := journal.recordSplit(commits[1].Hash, repo.GetCurrentHead()); err != nil {
+		t.Fatalf("Failed to record split: %v", err)
+	}
+
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Resumed Extract failed: %v", err)
+	}
+
+	result, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	if len(result) != 4 {
+		t.Fatalf("Expected 4 commits after resuming, got %d", len(result))
+	}
+	if _, err := os.Stat(filepath.Join(gitDir, journalFileName)); !os.IsNotExist(err) {
+		t.Error("Expected journal to be removed after a completed run")
+	}
+}
+
+func TestExtract_RefusesResumeWhenHeadMoved(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	staleHead := repo.Commit("Fix user authentication bug")
+
+	_, err := startJournal(filepath.Join(repo.Dir, ".git"), journalEntry{
+		From:         baseCommit,
+		OriginalHead: staleHead,
+		Targets:      []string{"target.txt"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start journal: %v", err)
+	}
+
+	// The branch moves on after the interrupted run
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	err = NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "cannot resume interrupted run") {
+		t.Fatalf("Expected resume verification to fail, got: %v", err)
+	}
+}
+
+func TestSimulatePick_DetectsConflicts(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("config.txt", "a\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("config.txt", "b\n")
+	first := repo.Commit("First change")
+
+	repo.WriteFile("config.txt", "c\n")
+	second := repo.Commit("Second change")
+
+	extractor := NewExtractor(repo.Dir, "config.txt")
+
+	// Replaying onto the history it was written against is clean
+	if _, files, err := extractor.simulatePick(second, first, first); err != nil || len(files) != 0 {
+		t.Errorf("Expected clean replay, got files %v, err %v", files, err)
+	}
+
+	// Replaying without the first change conflicts on the shared file
+	_, files, err := extractor.simulatePick(second, first, baseCommit)
+	if err != nil {
+		t.Fatalf("simulatePick failed: %v", err)
+	}
+	if len(files) != 1 || files[0] != "config.txt" {
+		t.Errorf("Expected conflict in config.txt, got %v", files)
+	}
+}
+
+func TestDryRun_NoFalseConflictWarnings(t *testing.T) {
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	// The same files change in several commits, which splitting handles cleanly
+	repo.WriteFile("target.txt", "one")
+	repo.WriteFile("main.go", "package main\n\n// one\n")
+	repo.Commit("First mixed commit")
+
+	repo.WriteFile("target.txt", "two")
+	repo.WriteFile("main.go", "package main\n\n// two\n")
+	repo.Commit("Second mixed commit")
+
+	report, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	output := report.String()
+	if !strings.Contains(output, "No conflicts predicted.") {
+		t.Errorf("Expected no predicted conflicts, got:\n%s", output)
+	}
+}
+
+func TestRunRebase_ResolvesTargetConflictsWithStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		option   string
+		expected string
+	}{
+		{name: "ours keeps rewritten history", option: "ours", expected: "upstream\n"},
+		{name: "theirs keeps replayed commit", option: "theirs", expected: "topic\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("package-lock.json", "base\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			// Build a conflicting upstream commit on a side branch
+			repo.Git("checkout", "-q", "-b", "upstream")
+			repo.WriteFile("package-lock.json", "upstream\n")
+			upstream := repo.Commit("Upstream change")
+
+			repo.Git("checkout", "-q", "-b", "topic", baseCommit)
+			repo.WriteFile("package-lock.json", "topic\n")
+			repo.Commit("Topic change")
+
+			extractor := NewExtractor(repo.Dir, "package-lock.json")
+			if err := extractor.runRebase(nil, upstream); err == nil {
+				t.Fatal("Expected rebase to stop without a strategy")
+			}
+			if err := extractor.runRebase(nil, "--abort"); err != nil {
+				t.Fatalf("Failed to abort rebase: %v", err)
+			}
+
+			if err := extractor.SetStrategyOption(tt.option); err != nil {
+				t.Fatalf("SetStrategyOption failed: %v", err)
+			}
+			if err := extractor.runRebase(nil, upstream); err != nil {
+				t.Fatalf("Expected conflict to be resolved automatically: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(repo.Dir, "package-lock.json"))
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+func TestSetStrategyOption_RejectsUnknownValues(t *testing.T) {
+	extractor := NewExtractor(t.TempDir(), "target.txt")
+	if err := extractor.SetStrategyOption("recursive"); err == nil {
+		t.Error("Expected invalid strategy option to be rejected")
+	}
+}
+
+func TestRunRebase_ReplaysRerereResolutions(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("schema.sql", "base\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("checkout", "-q", "-b", "upstream")
+	repo.WriteFile("schema.sql", "upstream\n")
+	upstream := repo.Commit("Upstream change")
+
+	repo.Git("checkout", "-q", "-b", "topic", baseCommit)
+	repo.WriteFile("schema.sql", "topic\n")
+	topic := repo.Commit("Topic change")
+
+	// First pass: resolve the conflict by hand
+	extractor := NewExtractor(repo.Dir, "schema.sql")
+	if err := extractor.runRebase(nil, upstream); err == nil {
+		t.Fatal("Expected first rebase to stop for conflicts")
+	}
+	repo.WriteFile("schema.sql", "resolved\n")
+	repo.Git("add", "schema.sql")
+	// Keep the message, as a user saving it unchanged would
+	if err := extractor.runRebase([]string{"GIT_EDITOR=true"}, "--continue"); err != nil {
+		t.Fatalf("Failed to continue after manual resolution: %v", err)
+	}
+
+	// Second pass over the same hunks replays the recorded resolution
+	repo.Git("reset", "-q", "--hard", topic)
+	if err := extractor.runRebase(nil, upstream); err != nil {
+		t.Fatalf("Expected rerere to resolve the repeated conflict: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(repo.Dir, "schema.sql"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "resolved\n" {
+		t.Errorf("Expected recorded resolution, got %q", string(content))
+	}
+}
+
+func TestExtract_RefusesForeignAuthorsWithoutFlag(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Git("add", ".")
+	repo.Git("commit", "-q", "-m", "Teammate's change", "--author", "Teammate <teammate@example.com>")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "--rewrite-others") {
+		t.Fatalf("Expected foreign-author guard to refuse, got: %v", err)
+	}
+
+	extractor.SetRewriteOthers(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract with --rewrite-others failed: %v", err)
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	for _, commit := range commits {
+		if commit.Author != "Teammate <teammate@example.com>" {
+			t.Errorf("Expected split commit %s to keep the original author, got %s", commit.Hash[:7], commit.Author)
+		}
+	}
+}
+
+func TestDryRun_ReportsBlastRadius(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Fix user authentication bug")
+	repo.Git("branch", "feature-b", mixed)
+	repo.Git("tag", "v1.0", mixed)
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	report, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	output := report.String()
+
+	expectedParts := []string{
+		"Commits rewritten: 2",
+		"Other local branches containing them: feature-b",
+		"Tags containing them: v1.0",
+		"Already on remotes: none",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(output, part) {
+			t.Errorf("Expected dry run output to contain '%s', got:\n%s", part, output)
+		}
+	}
+}
+
+func TestDryRun_GoGitWithoutGit(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	repo.WriteFile("target.txt", "target\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "changed\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.WriteBinaryFile("image.bin", 64, 3)
+	mixed := repo.Commit("Change the target and more")
+	repo.Tag("v1.0", mixed, "")
+
+	repo.Rename("target.txt", "renamed.txt")
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Rename the target")
+
+	repo.Branch("side", "HEAD")
+	repo.WriteFile("side.txt", "side\n")
+	repo.Commit("Add side")
+	repo.Git("checkout", "-q", "master")
+	repo.Merge("Merge side", "side")
+
+	want, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun with git failed: %v", err)
+	}
+
+	backend, err := git.OpenGoGit(repo.Dir)
+	if err != nil {
+		t.Fatalf("OpenGoGit failed: %v", err)
+	}
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetBackend(backend)
+	extractor.SetWithoutGit(true)
+	// Any git command would now fail to start
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("GIT_EXEC_PATH", "")
+
+	got, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun without git failed: %v", err)
+	}
+	if got.SplitCount != 2 {
+		t.Errorf("Expected the split and the renamed target to be split, got %d splits", got.SplitCount)
+	}
+	if !strings.Contains(got.ConflictPredictionError, "doesn't run git") {
+		t.Errorf("Expected conflict prediction to be left out, got %q", got.ConflictPredictionError)
+	}
+	// Only the conflict prediction needs git
+	want.ConflictPredictionError, got.ConflictPredictionError = "", ""
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dry runs disagree:\nwith git:    %+v\nwithout git: %+v", want, got)
+	}
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err == nil {
+		t.Error("Expected a run that changes history to need git")
+	}
+}
+
+func TestExtract_FastPathLeavesWorkingTreeAlone(t *testing.T) {
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Git("add", ".")
+	repo.Git("commit", "-q", "-m", "Fix user authentication bug", "--date", "2001-02-03T04:05:06Z")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	originalHead := repo.Commit("Add main function")
+
+	before, err := os.Stat(filepath.Join(repo.Dir, "target.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat target: %v", err)
+	}
+
+	if err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	after, err := os.Stat(filepath.Join(repo.Dir, "target.txt"))
+	if err != nil {
+		t.Fatalf("Failed to stat target: %v", err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Error("Expected the fast path not to rewrite working tree files")
+	}
+	if status := repo.Git("status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean working tree after the rewrite, got:\n%s", status)
+	}
+
+	// Extracted commit sits on top of the remaining changes with the original author date
+	if files := repo.Git("show", "--name-only", "--format=", "HEAD~1"); files != "target.txt" {
+		t.Errorf("Expected extracted commit to contain only target.txt, got %q", files)
+	}
+	if files := repo.Git("show", "--name-only", "--format=", "HEAD~2"); files != "other.go" {
+		t.Errorf("Expected remaining commit to contain only other.go, got %q", files)
+	}
+	for _, rev := range []string{"HEAD~1", "HEAD~2"} {
+		if date := repo.Git("log", "-1", "--format=%aI", rev); date != "2001-02-03T04:05:06+00:00" {
+			t.Errorf("Expected %s to keep the original author date, got %s", rev, date)
+		}
+	}
+	if orig := repo.Git("rev-parse", "ORIG_HEAD"); orig != originalHead {
+		t.Errorf("Expected ORIG_HEAD to point at the pre-rewrite HEAD %s, got %s", originalHead, orig)
+	}
+}
+
+func TestExtract_WithoutFastPath(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Fix user authentication bug")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetFastPath(false)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze result: %v", err)
+	}
+	if len(commits) != 3 {
+		t.Fatalf("Expected 3 commits after splitting, got %d", len(commits))
+	}
+}
+
+func TestAnalyzeRange_GoGitBackendMatchesExec(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("src/other.go", "package other\n")
+	repo.Commit("Fix user authentication bug\n\nWith a body")
+
+	repo.WriteFile("target.txt", "more content")
+	repo.Commit("Update target file only")
+
+	execCommits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("AnalyzeRange with exec backend failed: %v", err)
+	}
+
+	backend, err := git.OpenGoGit(repo.Dir)
+	if err != nil {
+		t.Fatalf("OpenGoGit failed: %v", err)
+	}
+	analyzer := NewAnalyzer(repo.Dir, "target.txt")
+	analyzer.SetBackend(backend)
+	goGitCommits, err := analyzer.AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("AnalyzeRange with go-git backend failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(execCommits, goGitCommits) {
+		t.Errorf("Backends disagree:\nexec:   %+v\ngo-git: %+v", execCommits, goGitCommits)
+	}
+}
+
+func TestAnalyzeRange_PreservesOrderWhenParallel(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	for i := 0; i < 20; i++ {
+		repo.WriteFile("target.txt", fmt.Sprintf("revision %d", i))
+		repo.WriteFile(fmt.Sprintf("file%d.go", i), "package main\n")
+		repo.Commit(fmt.Sprintf("Commit %d", i))
+	}
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("AnalyzeRange failed: %v", err)
+	}
+	if len(commits) != 20 {
+		t.Fatalf("Expected 20 commits, got %d", len(commits))
+	}
+	for i, commit := range commits {
+		if expected := fmt.Sprintf("Commit %d", i); commit.Message != expected {
+			t.Errorf("Expected commit %d to be %q, got %q", i, expected, commit.Message)
+		}
+	}
+}
+
+// fakeRunner answers git commands with canned output, keyed by their
+// arguments, and records every command it is asked to run
+type fakeRunner struct {
+	mu       sync.Mutex
+	outputs  map[string]string
+	objects  map[string]string
+	files    map[string]string
+	commands []string
+}
+
+func (f *fakeRunner) Run(cmd *exec.Cmd) error {
+	args := strings.Join(cmd.Args[1:], " ")
+	f.mu.Lock()
+	f.commands = append(f.commands, args)
+	f.mu.Unlock()
+
+	output, ok := f.outputs[args]
+	if args == "cat-file --batch" {
+		input, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(string(input), "\n")
+		object, found := f.objects[name]
+		if !found {
+			return fmt.Errorf("unexpected object %s", name)
+		}
+		output, ok = fmt.Sprintf("%s commit %d\n%s\n", name, len(object), object), true
+	}
+	if strings.HasPrefix(args, "diff-tree --stdin") {
+		input, err := io.ReadAll(cmd.Stdin)
+		if err != nil {
+			return err
+		}
+		// Each commit is followed by a line diff-tree echoes once it is listed
+		hash, end, _ := strings.Cut(string(input), "\n")
+		files, found := f.files[hash]
+		if !found {
+			return fmt.Errorf("unexpected commit %s", hash)
+		}
+		output, ok = files+end, true
+	}
+	if !ok {
+		return fmt.Errorf("unexpected command: git %s", args)
+	}
+	_, err := io.WriteString(cmd.Stdout, output)
+	return err
+}
+
+func TestAnalyzeRange_CommandRunner(t *testing.T) {
+	const base = "1111111111111111111111111111111111111111"
+	const split = "2222222222222222222222222222222222222222"
+	runner := &fakeRunner{
+		outputs: map[string]string{
+			"rev-list --reverse --topo-order " + base + "..HEAD": split + "\n",
+		},
+		files: map[string]string{
+			split: "My Docs/target file.txt\x00src/main file.go\x00",
+		},
+		objects: map[string]string{
+			split: "tree 3333333333333333333333333333333333333333\n" +
+				"parent " + base + "\n" +
+				"author Test User <test@example.com> 1700000000 +0000\n" +
+				"committer Test User <test@example.com> 1700000000 +0000\n" +
+				"\nAdd docs and code\n",
+		},
+	}
+
+	analyzer := NewAnalyzer(t.TempDir(), "My Docs/target file.txt")
+	analyzer.SetCommandRunner(runner)
+	commits, err := analyzer.AnalyzeRange(t.Context(), base, "HEAD")
+	if err != nil {
+		t.Fatalf("AnalyzeRange failed: %v", err)
+	}
+
+	if len(commits) != 1 || !commits[0].NeedsSplit {
+		t.Fatalf("Expected one commit to split, got %+v", commits)
+	}
+	if want := []string{"My Docs/target file.txt", "src/main file.go"}; !slices.Equal(commits[0].Files, want) {
+		t.Errorf("Expected files %q, got %q", want, commits[0].Files)
+	}
+	want := []string{
+		"rev-list --reverse --topo-order " + base + "..HEAD",
+		"cat-file --batch",
+		"diff-tree --stdin -z -r --name-only --no-commit-id --root -M --cc",
+	}
+	if !slices.Equal(runner.commands, want) {
+		t.Errorf("Unexpected git commands:\n%q\nwant:\n%q", runner.commands, want)
+	}
+}
+
+func TestExtract_CommandRunnerReportsFailures(t *testing.T) {
+	runner := &fakeRunner{}
+	extractor := NewExtractor(t.TempDir(), "target.txt")
+	defer extractor.Close()
+	extractor.SetCommandRunner(runner)
+
+	err := extractor.Extract(t.Context(), "main", "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "unexpected command") {
+		t.Fatalf("Expected the runner's error, got %v", err)
+	}
+	if len(runner.commands) == 0 {
+		t.Error("Expected git commands to go through the runner")
+	}
+}
+
+func TestProgress_EstimatesRemainingTime(t *testing.T) {
+	var out strings.Builder
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &progress{out: &out, now: func() time.Time { return clock }, total: 4, started: clock}
+
+	p.step("aaaaaaaaaa")
+	clock = clock.Add(20 * time.Second)
+	p.step("bbbbbbbbbb")
+	clock = clock.Add(40 * time.Second)
+	p.step("cccccccccc")
+
+	want := "Splitting commit 1/4 (aaaaaaa)\n" +
+		"Splitting commit 2/4 (bbbbbbb), ~1m0s remaining\n" +
+		"Splitting commit 3/4 (ccccccc), ~1m0s remaining\n"
+	if out.String() != want {
+		t.Errorf("Unexpected progress output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestSetProgress_DisablesReporting(t *testing.T) {
+	extractor := NewExtractor(t.TempDir(), "target.txt")
+	extractor.SetProgress(false)
+	if p := extractor.newProgress(10); p != nil {
+		t.Errorf("Expected progress reporting to be disabled")
+	}
+}
+
+func TestExtract_ReusesDryRunAnalysis(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed commit")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if _, err := extractor.DryRun(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	cachePath := filepath.Join(repo.Dir, ".git", analysisCacheFileName)
+	_, key, err := extractor.analysisCacheKey(baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to compute cache key: %v", err)
+	}
+	cached, ok := loadAnalysis(cachePath, key)
+	if !ok || len(cached) != 1 || !cached[0].NeedsSplit {
+		t.Fatalf("Expected the dry run to cache its analysis, got %v (found: %v)", cached, ok)
+	}
+
+	// Mark the commit as clean in the cache; a reused analysis has nothing to split
+	key.Commits = []CommitInfo{{Hash: cached[0].Hash, Message: cached[0].Message, Files: cached[0].Files}}
+	if err := saveAnalysis(cachePath, key); err != nil {
+		t.Fatalf("Failed to rewrite cache: %v", err)
+	}
+	head := repo.GetCurrentHead()
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if repo.GetCurrentHead() != head {
+		t.Errorf("Expected Extract to reuse the cached analysis and leave HEAD alone")
+	}
+
+	// A different target set must not hit the cache
+	_, otherKey, err := NewExtractor(repo.Dir, "other.go").analysisCacheKey(baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to compute cache key: %v", err)
+	}
+	if _, ok := loadAnalysis(cachePath, otherKey); ok {
+		t.Errorf("Expected the cache to miss for different targets")
+	}
+
+	// Nor must an analysis read by another backend
+	backend, err := git.OpenGoGit(repo.Dir)
+	if err != nil {
+		t.Fatalf("OpenGoGit failed: %v", err)
+	}
+	goGitExtractor := NewExtractor(repo.Dir, "target.txt")
+	goGitExtractor.SetBackend(backend)
+	_, goGitKey, err := goGitExtractor.analysisCacheKey(baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to compute cache key: %v", err)
+	}
+	if _, ok := loadAnalysis(cachePath, goGitKey); ok {
+		t.Errorf("Expected the cache to miss for a different backend")
+	}
+}
+
+func TestSplitCurrentCommit_LeavesWorkingTreeAlone(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Git("add", ".")
+	repo.Git("commit", "-q", "-m", "Fix user authentication bug", "--date", "2001-02-03T04:05:06Z")
+
+	mtimes := make(map[string]time.Time)
+	for _, file := range []string{"target.txt", "other.go"} {
+		info, err := os.Stat(filepath.Join(repo.Dir, file))
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", file, err)
+		}
+		mtimes[file] = info.ModTime()
+	}
+
+	// Split HEAD directly; the interactive rebase around it checks out files
+	// on its own, independently of how the split is made
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	defer extractor.Close()
+	commits, err := extractor.analyze(baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Failed to analyze commits: %v", err)
+	}
+	if _, err := extractor.splitCurrentCommit(commits[0]); err != nil {
+		t.Fatalf("splitCurrentCommit failed: %v", err)
+	}
+
+	for file, before := range mtimes {
+		info, err := os.Stat(filepath.Join(repo.Dir, file))
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", file, err)
+		}
+		if !info.ModTime().Equal(before) {
+			t.Errorf("Expected splitting not to rewrite %s", file)
+		}
+	}
+	if status := repo.Git("status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean working tree after the split, got:\n%s", status)
+	}
+	if files := repo.Git("show", "--name-only", "--format=", "HEAD"); files != "target.txt" {
+		t.Errorf("Expected extracted commit to contain only target.txt, got %q", files)
+	}
+	if date := repo.Git("log", "-1", "--format=%aI", "HEAD~1"); date != "2001-02-03T04:05:06+00:00" {
+		t.Errorf("Expected the split to keep the original author date, got %s", date)
+	}
+}
+
+func TestSplitCurrentCommit_KeepsTargetOnlyCommitWhole(t *testing.T) {
+	for _, extractedFirst := range []bool{false, true} {
+		t.Run(fmt.Sprintf("extractedFirst=%v", extractedFirst), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Fix user authentication bug")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			defer extractor.Close()
+			extractor.SetOverrides(map[string]SplitOverride{mixed: {ExtractedFirst: extractedFirst}})
+			commits, err := extractor.analyze(baseCommit, "HEAD")
+			if err != nil {
+				t.Fatalf("Failed to analyze commits: %v", err)
+			}
+
+			// Stop at a replay of the commit whose other changes are
+			// already below it, as a flattened merge can leave it
+			repo.Git("reset", "-q", "--hard", baseCommit)
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Add other")
+			repo.WriteFile("target.txt", "content")
+			stopped := repo.Commit("Fix user authentication bug")
+
+			unreported, err := extractor.splitCurrentCommit(commits[0])
+			if err != nil {
+				t.Fatalf("splitCurrentCommit failed: %v", err)
+			}
+			if unreported.old != "" {
+				t.Errorf("Expected no rewrite, got %+v", unreported)
+			}
+			if head := repo.GetCurrentHead(); head != stopped {
+				t.Errorf("Expected the commit to be kept whole at %s, HEAD is %s", stopped, head)
+			}
+		})
+	}
+}
+
+func TestExtract_SparseCheckout(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("src/main.go", "package main\n")
+			repo.WriteFile("docs/guide.md", "guide\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("src/main.go", "package main\n\nfunc main() {}\n")
+			repo.WriteFile("docs/guide.md", "updated guide\n")
+			repo.Commit("Update main and guide")
+
+			// The target lives outside the cone, so it isn't on disk
+			repo.Git("sparse-checkout", "set", "--cone", "--sparse-index", "src")
+			if _, err := os.Stat(filepath.Join(repo.Dir, "docs/guide.md")); !os.IsNotExist(err) {
+				t.Fatalf("Expected docs/guide.md to be outside the sparse checkout")
+			}
+
+			extractor := NewExtractor(repo.Dir, "docs/guide.md")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if files := repo.Git("show", "--name-only", "--format=", "HEAD"); files != "docs/guide.md" {
+				t.Errorf("Expected extracted commit to contain only docs/guide.md, got %q", files)
+			}
+			if files := repo.Git("show", "--name-only", "--format=", "HEAD~1"); files != "src/main.go" {
+				t.Errorf("Expected remaining commit to contain only src/main.go, got %q", files)
+			}
+			if content := repo.Git("show", "HEAD:docs/guide.md"); content != "updated guide" {
+				t.Errorf("Expected the target change to survive, got %q", content)
+			}
+		})
+	}
+}
+
+func TestRunRebase_ResolvesTargetConflictsOutsideSparseCheckout(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("src/main.go", "package main\n")
+	repo.WriteFile("docs/package-lock.json", "base\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("checkout", "-q", "-b", "upstream")
+	repo.WriteFile("docs/package-lock.json", "upstream\n")
+	upstream := repo.Commit("Upstream change")
+
+	repo.Git("checkout", "-q", "-b", "topic", baseCommit)
+	repo.WriteFile("docs/package-lock.json", "topic\n")
+	repo.Commit("Topic change")
+
+	repo.Git("sparse-checkout", "set", "--cone", "src")
+
+	extractor := NewExtractor(repo.Dir, "docs/package-lock.json")
+	if err := extractor.SetStrategyOption("theirs"); err != nil {
+		t.Fatalf("SetStrategyOption failed: %v", err)
+	}
+	if err := extractor.runRebase(nil, upstream); err != nil {
+		t.Fatalf("Expected conflict to be resolved automatically: %v", err)
+	}
+
+	if content := repo.Git("show", "HEAD:docs/package-lock.json"); content != "topic" {
+		t.Errorf("Expected the replayed commit's version, got %q", content)
+	}
+	if status := repo.Git("status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean working tree, got:\n%s", status)
+	}
+}
+
+func TestEditTodo(t *testing.T) {
+	todo := "pick 1111111 First\np 2222222 Second\npick 3333333 Third\n\n# Rebase instructions\n"
+
+	tests := []struct {
+		name    string
+		edit    []string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "one commit",
+			edit: []string{"2222222abcdef"},
+			want: "pick 1111111 First\nedit 2222222 Second\npick 3333333 Third\n\n# Rebase instructions\n",
+		},
+		{
+			name: "several commits",
+			edit: []string{"3333333abcdef", "1111111abcdef"},
+			want: "edit 1111111 First\np 2222222 Second\nedit 3333333 Third\n\n# Rebase instructions\n",
+		},
+		{
+			name:    "missing commit",
+			edit:    []string{"2222222abcdef", "4444444abcdef"},
+			wantErr: "commit 4444444abcdef is not in the rebase todo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := editTodo(todo, todoEdit{Edit: tt.edit})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("editTodo failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Unexpected todo:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSequenceEditor_ReadsTheEditFromTheEnvironment(t *testing.T) {
+	todo := filepath.Join(t.TempDir(), "git-rebase-todo")
+	if err := os.WriteFile(todo, []byte("pick 1111111 First\npick 2222222 Second\n"), 0644); err != nil {
+		t.Fatalf("Failed to write todo: %v", err)
+	}
+
+	t.Setenv(SequenceTodoEnv, `{"edit":["2222222abcdef"]}`)
+	if err := RunSequenceEditor([]string{todo}); err != nil {
+		t.Fatalf("RunSequenceEditor failed: %v", err)
+	}
+	edited, err := os.ReadFile(todo)
+	if err != nil {
+		t.Fatalf("Failed to read todo: %v", err)
+	}
+	if want := "pick 1111111 First\nedit 2222222 Second\n"; string(edited) != want {
+		t.Errorf("Unexpected todo:\n%s\nwant:\n%s", edited, want)
+	}
+
+	t.Setenv(SequenceTodoEnv, "")
+	if err := RunSequenceEditor([]string{todo}); err == nil || !strings.Contains(err.Error(), SequenceTodoEnv) {
+		t.Errorf("Expected an error naming %s without an edit, got %v", SequenceTodoEnv, err)
+	}
+}
+
+func TestEditorCommand_WindowsExecutable(t *testing.T) {
+	got := editorCommand(`C:\Program Files\Tools\git-rebase-extract-file.exe`, '\\')
+	want := "'C:/Program Files/Tools/git-rebase-extract-file.exe' --" + SequenceEditorFlag
+	if got != want {
+		t.Errorf("editorCommand() = %q, want %q", got, want)
+	}
+
+	got = editorCommand("/usr/local/bin/it's here", '/')
+	want = `'/usr/local/bin/it'\''s here' --` + SequenceEditorFlag
+	if got != want {
+		t.Errorf("editorCommand() = %q, want %q", got, want)
+	}
+}
+
+func TestTargetPath_WindowsSeparators(t *testing.T) {
+	tests := []struct {
+		path      string
+		separator rune
+		want      string
+	}{
+		{`src\component.tsx`, '\\', "src/component.tsx"},
+		{`.\src\generated\`, '\\', "src/generated/"},
+		{`.\\docs\README.md`, '\\', "docs/README.md"},
+		{"./src/component.tsx", '/', "src/component.tsx"},
+		// A backslash is an ordinary file name character elsewhere
+		{`odd\name.txt`, '/', `odd\name.txt`},
+		{"./", '/', "./"},
+	}
+	for _, tt := range tests {
+		if got := targetPath(tt.path, tt.separator); got != tt.want {
+			t.Errorf("targetPath(%q, %q) = %q, want %q", tt.path, tt.separator, got, tt.want)
+		}
+	}
+}
+
+func TestShellArgs(t *testing.T) {
+	if got, want := shellArgs("linux", "make test"), []string{"sh", "-c", "make test"}; !slices.Equal(got, want) {
+		t.Errorf("shellArgs(linux) = %q, want %q", got, want)
+	}
+	got := shellArgs("windows", "go test ./...")
+	if got[0] != "powershell.exe" || got[len(got)-1] != "go test ./..." || slices.Contains(got, "sh") {
+		t.Errorf("shellArgs(windows) = %q, want PowerShell running the command", got)
+	}
+}
+
+func TestDryRun_EncodesPlanAsJSON(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Fix user authentication bug")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	encoded, err := extractor.RenderJSON(report)
+	if err != nil {
+		t.Fatalf("Failed to encode report: %v", err)
+	}
+	var decoded DryRunReport
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+
+	if decoded.SplitCount != 1 || len(decoded.Commits) != 2 {
+		t.Fatalf("Expected 1 of 2 commits to split, got %d of %d", decoded.SplitCount, len(decoded.Commits))
+	}
+	split := decoded.Commits[0]
+	if split.Hash != mixed || !split.Split {
+		t.Errorf("Expected %s to be split, got %+v", mixed, split)
+	}
+	if split.ExtractedMessage != "target.txt: Fix user authentication bug" {
+		t.Errorf("Unexpected extracted message %q", split.ExtractedMessage)
+	}
+	if decoded.Commits[1].Split || decoded.Commits[1].RemainingMessage != "" {
+		t.Errorf("Expected the second commit to be kept as is, got %+v", decoded.Commits[1])
+	}
+	if decoded.BlastRadius == nil || decoded.BlastRadius.Rewritten != 2 {
+		t.Errorf("Expected a blast radius of 2 rewritten commits, got %+v", decoded.BlastRadius)
+	}
+}
+
+func TestDryRun_ListsSplitHalvesInCommitOrder(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Fix user authentication bug")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetOverrides(map[string]SplitOverride{mixed: {ExtractedFirst: true}})
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	output := report.String()
+	extracted := strings.Index(output, "├─ Split into: \"target.txt: Fix user authentication bug\"")
+	remaining := strings.Index(output, "└─ Split into: \"Fix user authentication bug")
+	if extracted < 0 || remaining < 0 {
+		t.Errorf("Expected the extracted half listed before the remaining one:\n%s", output)
+	}
+}
+
+func TestDryRun_RendersMarkdown(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content\n")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Fix auth | login bug")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	output := extractor.RenderMarkdown(report)
+
+	for _, want := range []string{
+		"## Extract `target.txt` into separate commits\n",
+		"Would split 1 of 2 commits. 2 commits would be rewritten.\n",
+		"| `" + mixed[:7] + "` Fix auth \\| login bug | Fix auth \\| login bug (1 file, +1 -0) | target.txt: Fix auth \\| login bug (1 file, +1 -0) |  |\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected markdown to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Add main function") {
+		t.Errorf("Expected only split commits in the table, got:\n%s", output)
+	}
+}
+
+func TestExtract_WritesReportWithCommitMapping(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("README.md", "readme\n")
+			kept := repo.Commit("Add readme")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Fix user authentication bug")
+
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			replayed := repo.Commit("Add main function")
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetReportPath(reportPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			content, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatalf("Failed to read report: %v", err)
+			}
+			var report RunReport
+			if err := json.Unmarshal(content, &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+
+			if report.OriginalHead != replayed || report.NewHead != repo.GetCurrentHead() {
+				t.Errorf("Unexpected heads: %s -> %s", report.OriginalHead, report.NewHead)
+			}
+			if !strings.Contains(report.BackupBranch, "-backup-") {
+				t.Errorf("Expected the backup branch in the report, got %q", report.BackupBranch)
+			}
+			want := []CommitMapping{
+				{Original: kept, Remaining: kept},
+				{Original: mixed, Remaining: repo.Git("rev-parse", "HEAD~2"), Extracted: repo.Git("rev-parse", "HEAD~1"), Split: true},
+				{Original: replayed, Remaining: repo.Git("rev-parse", "HEAD")},
+			}
+			if !reflect.DeepEqual(report.Commits, want) {
+				t.Errorf("Unexpected mapping:\n%+v\nwant:\n%+v", report.Commits, want)
+			}
+			if report.Stats.Commits != 3 || report.Stats.Split != 1 || report.Stats.Rewritten != 2 {
+				t.Errorf("Unexpected stats: %+v", report.Stats)
+			}
+		})
+	}
+}
+
+func TestExtract_VerbosityLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		verbosity Verbosity
+		contains  []string
+		excludes  []string
+	}{
+		{name: "quiet", verbosity: VerbosityQuiet, excludes: []string{"Successfully split", "Split "}},
+		{name: "normal", verbosity: VerbosityNormal, contains: []string{"Successfully split"}, excludes: []string{"Split ", "DEBUG"}},
+		{name: "verbose", verbosity: VerbosityVerbose, contains: []string{"Successfully split", "Split "}, excludes: []string{"DEBUG"}},
+		{name: "debug", verbosity: VerbosityDebug, contains: []string{"Split ", "DEBUG"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Fix user authentication bug")
+
+			var buf bytes.Buffer
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetVerbosity(tt.verbosity)
+			extractor.SetOutput(&buf)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			output := buf.String()
+
+			if tt.verbosity == VerbosityQuiet && output != "" {
+				t.Errorf("Expected no output in quiet mode, got:\n%s", output)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(output, want) {
+					t.Errorf("Expected output to contain %q, got:\n%s", want, output)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(output, unwanted) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", unwanted, output)
+				}
+			}
+		})
+	}
+}
+
+// recordingHandler keeps every slog record it handles
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordingHandler) Handle(_ context.Context, record slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, record)
+	return nil
+}
+
+// attrs returns the attributes of the records with message msg
+func (h *recordingHandler) attrs(msg string) []map[string]string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var found []map[string]string
+	for _, record := range h.records {
+		if record.Message != msg {
+			continue
+		}
+		attrs := make(map[string]string)
+		record.Attrs(func(attr slog.Attr) bool {
+			attrs[attr.Key] = attr.Value.String()
+			return true
+		})
+		found = append(found, attrs)
+	}
+	return found
+}
+
+func TestExtract_Logger(t *testing.T) {
+	for _, engine := range []string{"plumbing", "rebase"} {
+		t.Run(engine, func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Fix user authentication bug")
+			original := repo.GetCurrentHead()
+
+			var buf bytes.Buffer
+			handler := &recordingHandler{}
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetOutput(&buf)
+			extractor.SetFastPath(engine == "plumbing")
+			extractor.SetLogger(slog.New(handler))
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			// A logger takes the trace at any verbosity, and keeps it out of the output
+			if strings.Contains(buf.String(), "DEBUG") {
+				t.Errorf("Expected no debug trace in the output, got:\n%s", buf.String())
+			}
+
+			splits := handler.attrs("splitting commit")
+			if len(splits) == 0 || splits[0]["commit"] != original {
+				t.Errorf("Expected a splitting commit record for %s, got %v", original, splits)
+			}
+			if engine == "rebase" && splits[0]["step"] != "start" {
+				t.Errorf("Expected the split to record its start step, got %v", splits[0])
+			}
+
+			commands := handler.attrs("git")
+			if len(commands) == 0 {
+				t.Fatal("Expected git commands to be logged")
+			}
+			for _, command := range commands {
+				if command["git-args"] == "" || command["exit-code"] == "" {
+					t.Errorf("Expected git-args and exit-code on every git record, got %v", command)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_ColorAndEmojiSettings(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Fix user authentication bug")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetColor(true)
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	colored := extractor.Render(report)
+	if !strings.Contains(colored, "\x1b[") {
+		t.Errorf("Expected colored dry run output, got:\n%s", colored)
+	}
+
+	var buf bytes.Buffer
+	extractor.SetColor(false)
+	extractor.SetEmoji(false)
+	extractor.SetOutput(&buf)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Errorf("Extract failed: %v", err)
+	}
+	output := buf.String()
+	if strings.Contains(output, "\x1b[") || strings.Contains(output, "✅") {
+		t.Errorf("Expected plain output without color or emoji, got:\n%s", output)
+	}
+	if !strings.Contains(output, "Successfully split commits.") {
+		t.Errorf("Expected success message, got:\n%s", output)
+	}
+}
+
+func TestExtract_AppliesOverrides(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "one")
+			repo.WriteFile("one.go", "package one\n")
+			skipped := repo.Commit("First change")
+
+			repo.WriteFile("target.txt", "two")
+			repo.WriteFile("two.go", "package two\n")
+			renamed := repo.Commit("Second change")
+
+			repo.WriteFile("target.txt", "three")
+			repo.WriteFile("three.go", "package three\n")
+			reordered := repo.Commit("Third change")
+
+			reportPath := filepath.Join(t.TempDir(), "report.json")
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetReportPath(reportPath)
+			extractor.SetOverrides(map[string]SplitOverride{
+				skipped:   {Skip: true},
+				renamed:   {RemainingMessage: "Add two", ExtractedMessage: "Bump target to two"},
+				reordered: {ExtractedFirst: true},
+			})
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			log := repo.Git("log", "--reverse", "--format=%s", baseCommit+"..HEAD")
+			want := "First change\nAdd two\nBump target to two\ntarget.txt: Third change\nThird change"
+			if log != want {
+				t.Errorf("Unexpected history:\n%s\nwant:\n%s", log, want)
+			}
+			if files := repo.Git("show", "--name-only", "--format=", "HEAD~1"); files != "target.txt" {
+				t.Errorf("Expected the extracted commit first, with only target.txt, got %q", files)
+			}
+			if files := repo.Git("show", "--name-only", "--format=", "HEAD"); files != "three.go" {
+				t.Errorf("Expected the remaining commit last, with only three.go, got %q", files)
+			}
+
+			content, err := os.ReadFile(reportPath)
+			if err != nil {
+				t.Fatalf("Failed to read report: %v", err)
+			}
+			var report RunReport
+			if err := json.Unmarshal(content, &report); err != nil {
+				t.Fatalf("Failed to decode report: %v", err)
+			}
+			last := report.Commits[len(report.Commits)-1]
+			if last.Extracted != repo.Git("rev-parse", "HEAD~1") || last.Remaining != repo.GetCurrentHead() {
+				t.Errorf("Expected the report to follow the reordered split, got %+v", last)
+			}
+		})
+	}
+}
+
+func TestExtract_AppliesEditedPlan(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "one")
+	repo.WriteFile("one.go", "package one\n")
+	repo.Commit("First change")
+
+	repo.WriteFile("target.txt", "two")
+	repo.WriteFile("two.go", "package two\n")
+	repo.Commit("Second change")
+
+	planner := NewExtractor(repo.Dir, "target.txt")
+	report, err := planner.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	plan, err := planner.NewPlan(t.Context(), baseCommit, "HEAD", report)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := plan.Write(planPath); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Edit the plan as a user would
+	plan, err = LoadPlan(planPath)
+	if err != nil {
+		t.Fatalf("LoadPlan failed: %v", err)
+	}
+	if len(plan.Commits) != 2 || plan.Base != baseCommit || plan.Head != repo.GetCurrentHead() {
+		t.Fatalf("Unexpected plan: %+v", plan)
+	}
+	plan.Commits[0].Split = false
+	plan.Commits[1].ExtractedMessage = "Bump target to two"
+	plan.Commits[1].ExtractedFirst = true
+
+	extractor := NewExtractor(repo.Dir, plan.Targets...)
+	if err := extractor.UsePlan(t.Context(), plan); err != nil {
+		t.Fatalf("UsePlan failed: %v", err)
+	}
+	if err := extractor.Extract(t.Context(), plan.Base, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	log := repo.Git("log", "--reverse", "--format=%s", baseCommit+"..HEAD")
+	want := "First change\nBump target to two\nSecond change"
+	if log != want {
+		t.Errorf("Unexpected history:\n%s\nwant:\n%s", log, want)
+	}
+}
+
+func TestUsePlan_RejectsMovedHead(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "one")
+	repo.WriteFile("one.go", "package one\n")
+	repo.Commit("First change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	plan, err := extractor.NewPlan(t.Context(), baseCommit, "HEAD", report)
+	if err != nil {
+		t.Fatalf("NewPlan failed: %v", err)
+	}
+
+	repo.WriteFile("later.go", "package later\n")
+	repo.Commit("Later change")
+
+	err = extractor.UsePlan(t.Context(), plan)
+	if err == nil || !strings.Contains(err.Error(), "HEAD has moved") {
+		t.Errorf("Expected a moved-HEAD error, got %v", err)
+	}
+}
+
+func TestPlanner_PlansFromAnalysis(t *testing.T) {
+	commits := []CommitInfo{
+		{Hash: "1111111111111111111111111111111111111111", Message: "Only code\n", Files: []string{"main.go"}},
+		{Hash: "2222222222222222222222222222222222222222", Message: "Mixed change\n\nWith a body\n", Files: []string{"main.go", "target.txt"}, NeedsSplit: true},
+		{Hash: "3333333333333333333333333333333333333333", Message: "Kept whole\n", Files: []string{"one.go", "target.txt"}, NeedsSplit: true},
+	}
+
+	// Planning reads nothing from the repository
+	extractor := NewExtractor(t.TempDir(), "target.txt")
+	extractor.SetOverrides(map[string]SplitOverride{commits[2].Hash: {Skip: true}})
+	plan := extractor.Planner().Plan("base", commits[2].Hash, commits)
+
+	if plan.Base != "base" || plan.Head != commits[2].Hash || !slices.Equal(plan.Targets, []string{"target.txt"}) {
+		t.Errorf("Unexpected plan range: %+v", plan)
+	}
+	if len(plan.Commits) != 2 {
+		t.Fatalf("Expected the 2 mixed commits, got %+v", plan.Commits)
+	}
+	mixed, kept := plan.Commits[0], plan.Commits[1]
+	if mixed.Hash != commits[1].Hash || mixed.Subject != "Mixed change" || !mixed.Split {
+		t.Errorf("Unexpected plan for the mixed commit: %+v", mixed)
+	}
+	if !strings.Contains(mixed.RemainingMessage, "Mixed change") || !strings.Contains(mixed.ExtractedMessage, "target.txt") {
+		t.Errorf("Unexpected messages for the mixed commit: %+v", mixed)
+	}
+	if kept.Hash != commits[2].Hash || kept.Split {
+		t.Errorf("Expected the overridden commit to be kept whole, got %+v", kept)
+	}
+}
+
+func TestExecutor_AppliesPlan(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "one")
+	repo.WriteFile("one.go", "package one\n")
+	repo.Commit("First change")
+
+	repo.WriteFile("target.txt", "two")
+	repo.WriteFile("two.go", "package two\n")
+	head := repo.Commit("Second change")
+
+	commits, err := NewAnalyzer(repo.Dir, "target.txt").AnalyzeRange(t.Context(), baseCommit, head)
+	if err != nil {
+		t.Fatalf("AnalyzeRange failed: %v", err)
+	}
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	plan := extractor.Planner().Plan(baseCommit, head, commits)
+	plan.Commits[0].Split = false
+	plan.Commits[1].ExtractedMessage = "Bump target to two"
+
+	if err := extractor.Executor().Execute(t.Context(), plan); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	log := repo.Git("log", "--reverse", "--format=%s", baseCommit+"..HEAD")
+	want := "First change\nSecond change\nBump target to two"
+	if log != want {
+		t.Errorf("Unexpected history:\n%s\nwant:\n%s", log, want)
+	}
+
+	// A plan for history that has moved on is refused
+	if err := extractor.Executor().Execute(t.Context(), plan); err == nil || !strings.Contains(err.Error(), "HEAD has moved") {
+		t.Errorf("Expected a moved-HEAD error, got %v", err)
+	}
+}
+
+func TestDryRun_ShowsSplitDiffs(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target content\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetShowDiff(true)
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	commit := report.Commits[0]
+	if !strings.Contains(commit.ExtractedDiff, "+target content") || strings.Contains(commit.ExtractedDiff, "other.go") {
+		t.Errorf("Expected only target.txt in the extracted patch, got:\n%s", commit.ExtractedDiff)
+	}
+	if !strings.Contains(commit.RemainingDiff, "+package other") || strings.Contains(commit.RemainingDiff, "target.txt") {
+		t.Errorf("Expected only other.go in the remaining patch, got:\n%s", commit.RemainingDiff)
+	}
+	if output := report.String(); !strings.Contains(output, "Extracted patch:") || !strings.Contains(output, "Remaining patch:") {
+		t.Errorf("Expected the patches in the text preview, got:\n%s", output)
+	}
+
+	// Without --show-diff the preview stays compact
+	extractor.SetShowDiff(false)
+	report, err = extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if report.Commits[0].ExtractedDiff != "" {
+		t.Error("Expected no patches without SetShowDiff")
+	}
+}
+
+func TestDryRun_ReportsSplitDiffstats(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("docs/a.md", "one\ntwo\n")
+	repo.WriteFile("docs/b.md", "three\n")
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "docs/")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	commit := report.Commits[0]
+	if commit.ExtractedStat == nil || !reflect.DeepEqual(*commit.ExtractedStat, DiffStat{Files: 2, Insertions: 3}) {
+		t.Errorf("Unexpected extracted diffstat: %+v", commit.ExtractedStat)
+	}
+	if commit.RemainingStat == nil || !reflect.DeepEqual(*commit.RemainingStat, DiffStat{Files: 1, Insertions: 2}) {
+		t.Errorf("Unexpected remaining diffstat: %+v", commit.RemainingStat)
+	}
+	if !strings.Contains(report.String(), "(2 files changed, 3 insertions(+), 0 deletions(-))") {
+		t.Errorf("Expected the diffstat in the preview, got:\n%s", report.String())
+	}
+}
+
+func TestGraph_ShowsBeforeAndAfter(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("untouched.go", "package untouched\n")
+	kept := repo.Commit("Untouched change")
+
+	repo.WriteFile("target.txt", "target")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	graph, err := extractor.Graph(t.Context(), baseCommit, "HEAD", report)
+	if err != nil {
+		t.Fatalf("Graph failed: %v", err)
+	}
+
+	want := fmt.Sprintf("Before (2 commits):\n* %s Mixed change\n* %s Untouched change\n\n"+
+		"After (3 commits, +1):\n* (new)    target.txt: Mixed change [extracted]\n* %s' Mixed change\n* %s Untouched change\n",
+		mixed[:7], kept[:7], mixed[:7], kept[:7])
+	if graph != want {
+		t.Errorf("Unexpected graph:\n%s\nwant:\n%s", graph, want)
+	}
+}
+
+func TestExtract_EmitsProgressEvents(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "target")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+
+			repo.WriteFile("plain.go", "package plain\n")
+			repo.Commit("Plain change")
+
+			var stream bytes.Buffer
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetVerbosity(VerbosityQuiet)
+			extractor.SetEventStream(&stream)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			var events []Event
+			decoder := json.NewDecoder(&stream)
+			for decoder.More() {
+				var event Event
+				if err := decoder.Decode(&event); err != nil {
+					t.Fatalf("Failed to decode event: %v", err)
+				}
+				events = append(events, event)
+			}
+
+			var types []string
+			for _, event := range events {
+				types = append(types, event.Event)
+			}
+			want := []string{EventAnalysisStarted, EventCommitAnalyzed, EventCommitAnalyzed, EventSplitStarted, EventSplitFinished, EventDone}
+			if !slices.Equal(types, want) {
+				t.Fatalf("Unexpected events %v, want %v", types, want)
+			}
+
+			if !events[1].Split || events[1].Commit != mixed || events[2].Split {
+				t.Errorf("Unexpected analysis events: %+v, %+v", events[1], events[2])
+			}
+			finished := events[4]
+			if finished.Commit != mixed || repo.Git("show", "--name-only", "--format=", finished.Extracted) != "target.txt" {
+				t.Errorf("Unexpected split-finished event: %+v", finished)
+			}
+			if done := events[5]; done.Error != "" || done.Head != repo.GetCurrentHead() {
+				t.Errorf("Unexpected done event: %+v", done)
+			}
+		})
+	}
+}
+
+// recordingObserver records the calls it gets as readable strings
+type recordingObserver struct {
+	NopObserver
+	calls []string
+}
+
+func (o *recordingObserver) OnAnalyzeCommit(commit CommitInfo, index, total int) {
+	o.calls = append(o.calls, fmt.Sprintf("analyze %.7s %d/%d split=%v", commit.Hash, index, total, commit.NeedsSplit))
+}
+
+func (o *recordingObserver) OnSplitStart(commit CommitInfo, index, total int) {
+	o.calls = append(o.calls, fmt.Sprintf("start %.7s %d/%d", commit.Hash, index, total))
+}
+
+func (o *recordingObserver) OnSplitDone(commit CommitInfo, remaining, extracted string) {
+	o.calls = append(o.calls, fmt.Sprintf("done %.7s", commit.Hash))
+}
+
+func (o *recordingObserver) OnConflict(commit CommitInfo, files []string) {
+	o.calls = append(o.calls, fmt.Sprintf("conflict %.7s %v", commit.Hash, files))
+}
+
+func (o *recordingObserver) OnComplete(head string, err error) {
+	o.calls = append(o.calls, fmt.Sprintf("complete %.7s %v", head, err))
+}
+
+func TestExtract_RecordsTranscript(t *testing.T) {
+	tests := []struct {
+		fastPath bool
+		kinds    []string
+	}{
+		{true, []string{"analyzed", "staged", "committed", "committed", "reset"}},
+		{false, []string{"analyzed", "edited-todo", "staged", "committed", "committed", "reset", "continued"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("fastPath=%v", tt.fastPath), func(t *testing.T) {
+			if tt.fastPath {
+				requireGit(t, git.FeatureMergeTreeWriteTree)
+			}
+			repo := testutils.NewTestRepo(t)
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(tt.fastPath)
+			extractor.SetVerbosity(VerbosityQuiet)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			transcript := extractor.Transcript()
+			var kinds []string
+			for _, event := range transcript {
+				kinds = append(kinds, event.Kind())
+			}
+			if !slices.Equal(kinds, tt.kinds) {
+				t.Fatalf("Unexpected transcript %q, want %q", kinds, tt.kinds)
+			}
+
+			analyzed := transcript[0].(AnalyzedEvent)
+			if len(analyzed.Commits) != 1 || analyzed.Commits[0].Hash != mixed {
+				t.Errorf("Expected the analysis of %s, got %+v", mixed, analyzed.Commits)
+			}
+			var staged StagedEvent
+			var committed []CommittedEvent
+			var reset ResetEvent
+			for _, event := range transcript {
+				switch event := event.(type) {
+				case StagedEvent:
+					staged = event
+				case CommittedEvent:
+					committed = append(committed, event)
+				case ResetEvent:
+					reset = event
+				}
+			}
+			if !slices.Equal(staged.Paths, []string{"target.txt"}) || staged.Tree != committed[0].Tree {
+				t.Errorf("Expected target.txt to be staged into the first commit, got %+v", staged)
+			}
+			if committed[0].Message != "Mixed change\n\nChanges to target.txt split into a separate commit\n" || committed[1].Parents[0] != committed[0].Commit {
+				t.Errorf("Unexpected commits %+v", committed)
+			}
+			if reset.From != mixed || reset.To != committed[1].Commit || reset.To != repo.GetCurrentHead() {
+				t.Errorf("Expected HEAD to move from %s to the second commit, got %+v", mixed, reset)
+			}
+			if tt.fastPath {
+				if reset.Ref != "refs/heads/master" {
+					t.Errorf("Expected the branch to be moved, got %s", reset.Ref)
+				}
+			} else if transcript[1] != (EditedTodoEvent{Commit: mixed, Onto: baseCommit}) {
+				t.Errorf("Expected the todo to stop at %s, got %+v", mixed, transcript[1])
+			}
+		})
+	}
+
+	t.Run("rolled back", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		original := repo.Commit("Mixed change")
+
+		extractor := NewExtractor(repo.Dir, "target.txt")
+		extractor.SetVerbosity(VerbosityQuiet)
+		extractor.SetExec("false")
+		if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err == nil {
+			t.Fatal("Expected the failing --exec to fail the run")
+		}
+		transcript := extractor.Transcript()
+		last, ok := transcript[len(transcript)-1].(ResetEvent)
+		if !ok || last.To != original || last.From == original {
+			t.Errorf("Expected the transcript to end with the rollback to %s, got %+v", original, transcript[len(transcript)-1])
+		}
+	})
+}
+
+func TestExtract_NotifiesObservers(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "target")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+
+			repo.WriteFile("plain.go", "package plain\n")
+			plain := repo.Commit("Plain change")
+
+			var stderr bytes.Buffer
+			observer := &recordingObserver{}
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetOutput(io.Discard)
+			extractor.SetErrorOutput(&stderr)
+			extractor.AddObserver(observer)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			want := []string{
+				"analyze " + mixed[:7] + " 1/2 split=true",
+				"analyze " + plain[:7] + " 2/2 split=false",
+				"start " + mixed[:7] + " 1/1",
+				"done " + mixed[:7],
+				"complete " + repo.GetCurrentHead()[:7] + " <nil>",
+			}
+			if !slices.Equal(observer.calls, want) {
+				t.Errorf("Unexpected observer calls:\n%s\nwant:\n%s", strings.Join(observer.calls, "\n"), strings.Join(want, "\n"))
+			}
+			// The text progress is an observer too, only there while rewriting
+			if !strings.Contains(stderr.String(), "Splitting commit 1/1") {
+				t.Errorf("Expected progress on the error output, got:\n%s", stderr.String())
+			}
+			if len(extractor.observers) != 1 {
+				t.Errorf("Expected only the added observer to remain, got %d", len(extractor.observers))
+			}
+		})
+	}
+}
+
+// recordingBackend runs everything through the git binary, recording the
+// writes and optionally faking the status
+type recordingBackend struct {
+	git.GitBackend
+	status []git.StatusEntry
+	calls  []string
+}
+
+func (b *recordingBackend) Status(ctx context.Context) ([]git.StatusEntry, error) {
+	if b.status != nil {
+		return b.status, nil
+	}
+	return b.GitBackend.Status(ctx)
+}
+
+func (b *recordingBackend) CommitTree(ctx context.Context, commit git.NewCommit) (string, error) {
+	b.calls = append(b.calls, "commit-tree "+strings.SplitN(commit.Message, "\n", 2)[0])
+	return b.GitBackend.CommitTree(ctx, commit)
+}
+
+func (b *recordingBackend) UpdateRef(ctx context.Context, ref, newValue, oldValue, reason string) error {
+	b.calls = append(b.calls, "update-ref "+ref)
+	return b.GitBackend.UpdateRef(ctx, ref, newValue, oldValue, reason)
+}
+
+func (b *recordingBackend) Rebase(ctx context.Context, options git.RebaseOptions, args ...string) error {
+	b.calls = append(b.calls, "rebase "+args[0])
+	return b.GitBackend.Rebase(ctx, options, args...)
+}
+
+func TestExtract_RunsThroughGitBackend(t *testing.T) {
+	setup := func(t *testing.T) (*testutils.TestRepo, string) {
+		repo := testutils.NewTestRepo(t)
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.Commit("Mixed change")
+		return repo, baseCommit
+	}
+
+	tests := []struct {
+		fastPath bool
+		want     []string
+	}{
+		{true, []string{"commit-tree Mixed change", "commit-tree target.txt: Mixed change", "update-ref refs/heads/master", "update-ref ORIG_HEAD"}},
+		{false, []string{"rebase -i", "commit-tree Mixed change", "commit-tree target.txt: Mixed change", "update-ref HEAD", "rebase --continue"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("fastPath=%v", tt.fastPath), func(t *testing.T) {
+			if tt.fastPath {
+				requireGit(t, git.FeatureMergeTreeWriteTree)
+			}
+			repo, baseCommit := setup(t)
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			backend := &recordingBackend{GitBackend: git.NewRepository(repo.Dir)}
+			extractor.SetGitBackend(backend)
+			extractor.SetFastPath(tt.fastPath)
+			extractor.SetOutput(io.Discard)
+			extractor.SetErrorOutput(io.Discard)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if !slices.Equal(backend.calls, tt.want) {
+				t.Errorf("Unexpected backend calls:\n%s\nwant:\n%s", strings.Join(backend.calls, "\n"), strings.Join(tt.want, "\n"))
+			}
+			if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit on top, got %v", files)
+			}
+		})
+	}
+
+	t.Run("faked status", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+		extractor := NewExtractor(repo.Dir, "target.txt")
+		backend := &recordingBackend{GitBackend: git.NewRepository(repo.Dir), status: []git.StatusEntry{{XY: " M", Path: "main.go"}}}
+		extractor.SetGitBackend(backend)
+		err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+		if !errors.Is(err, ErrDirtyWorktree) || !strings.Contains(err.Error(), " M main.go") {
+			t.Errorf("Expected the faked change to count as a dirty worktree, got %v", err)
+		}
+		if len(backend.calls) != 0 {
+			t.Errorf("Expected nothing to be written, got %v", backend.calls)
+		}
+	})
+}
+
+func TestExtract_PrintsRecoveryInstructions(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target")
+	repo.WriteFile("other.go", "package other\n")
+	originalHead := repo.Commit("Mixed change")
+
+	var stdout, stderr bytes.Buffer
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetOutput(&stdout)
+	extractor.SetErrorOutput(&stderr)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	output := stdout.String()
+	if !strings.HasPrefix(output, "To recover the repository state: git reset --hard "+originalHead+"\n") {
+		t.Errorf("Expected recovery instructions first, got:\n%s", output)
+	}
+	if !strings.Contains(output, "If you need to revert:\n  git reset --hard "+originalHead) {
+		t.Errorf("Expected revert instructions after success, got:\n%s", output)
+	}
+	if !strings.Contains(stderr.String(), "Splitting commit 1/1") {
+		t.Errorf("Expected progress on the error output, got:\n%s", stderr.String())
+	}
+}
+
+func TestExtract_WritesMarkdownReport(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target\n")
+	repo.WriteFile("other.go", "package other\n\nvar x = 1\n")
+	mixed := repo.Commit("Mixed | change")
+
+	var buf bytes.Buffer
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetVerbosity(VerbosityQuiet)
+	extractor.SetOutput(&buf)
+	extractor.SetReportPath("-")
+	if err := extractor.SetReportFormat("markdown"); err != nil {
+		t.Fatalf("SetReportFormat failed: %v", err)
+	}
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	report := buf.String()
+	remaining := repo.Git("rev-parse", "--short=7", "HEAD~1")
+	extracted := repo.Git("rev-parse", "--short=7", "HEAD")
+	row := fmt.Sprintf("| `%s` Mixed \\| change | `%s` Mixed \\| change (1 file, +3 -0) | `%s` target.txt: Mixed \\| change (1 file, +1 -0) |",
+		mixed[:7], remaining, extracted)
+	if !strings.Contains(report, row) {
+		t.Errorf("Expected row %q in report:\n%s", row, report)
+	}
+	if !strings.HasPrefix(report, "## Extracted `target.txt` into separate commits\n") {
+		t.Errorf("Unexpected report heading:\n%s", report)
+	}
+
+	if err := extractor.SetReportFormat("yaml"); err == nil {
+		t.Error("Expected an invalid report format to be rejected")
+	}
+}
+
+func TestExtract_GroupsOfTargetsInTurn(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("package-lock.json", "{}\n")
+	repo.WriteFile("go.sum", "sum\n")
+	repo.WriteFile("other.go", "package other\n")
+	originalHead := repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "package-lock.json")
+	extractor.SetVerbosity(VerbosityQuiet)
+	extractor.SetBackupPrefix("backup/")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract of the first group failed: %v", err)
+	}
+	firstPass := repo.GetCurrentHead()
+	extractor.SetTargetFiles("go.sum")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract of the second group failed: %v", err)
+	}
+
+	for rev, expected := range map[string][]string{"HEAD~2": {"other.go"}, "HEAD~1": {"go.sum"}, "HEAD": {"package-lock.json"}} {
+		if files := repo.GetCommitFiles(rev); !slices.Equal(files, expected) {
+			t.Errorf("Expected %s to hold %q, got %q", rev, expected, files)
+		}
+	}
+	// Each run keeps a backup of its own, the first of the original history
+	backups := repo.Git("for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads/backup/")
+	branch := repo.Git("symbolic-ref", "--short", "HEAD")
+	expected := fmt.Sprintf("backup/%[1]s-%[2]d %[3]s\nbackup/%[1]s-%[2]d-2 %[4]s", branch, os.Getpid(), originalHead, firstPass)
+	if backups != expected {
+		t.Errorf("Expected backups\n%s\ngot\n%s", expected, backups)
+	}
+}
+
+func TestExtract_MessageTemplatesAndBackupPrefix(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change\n\nWith details")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetVerbosity(VerbosityQuiet)
+	extractor.SetBackupPrefix("backup/")
+	extractor.SetMessageTemplates(MessageTemplates{
+		Remaining: "{subject} (without {targets})\n\n{body}",
+		Extracted: "chore({targets}): {subject}",
+	})
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	if msg := repo.Git("log", "-1", "--format=%B", "HEAD~1"); msg != "Mixed change (without target.txt)\n\nWith details" {
+		t.Errorf("Unexpected remaining message %q", msg)
+	}
+	if msg := repo.Git("log", "-1", "--format=%B", "HEAD"); msg != "chore(target.txt): Mixed change" {
+		t.Errorf("Unexpected extracted message %q", msg)
+	}
+	if branches := repo.Git("branch", "--list", "backup/*"); !strings.Contains(branches, "backup/") {
+		t.Errorf("Expected a backup branch under backup/, got %q", branches)
+	}
+}
+
+func TestRankCandidates_MixedFilesFirst(t *testing.T) {
+	commits := []CommitInfo{
+		{Hash: "a", Files: []string{"go.sum", "main.go"}},
+		{Hash: "b", Files: []string{"go.sum", "util.go"}},
+		{Hash: "c", Files: []string{"README.md"}},
+		{Hash: "d", Files: []string{"README.md"}},
+	}
+
+	expected := []FileCandidate{
+		{Path: "go.sum", Commits: 2, MixedCommits: 2},
+		{Path: "main.go", Commits: 1, MixedCommits: 1},
+		{Path: "util.go", Commits: 1, MixedCommits: 1},
+		{Path: "README.md", Commits: 2},
+	}
+	if got := RankCandidates(commits); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestDryRun_ExplainsEveryCommit(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target content\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.WriteFile("more.go", "package more\n")
+	repo.Commit("Mixed change")
+
+	repo.WriteFile("other.go", "package other // changed\n")
+	repo.Commit("Other only")
+
+	repo.WriteFile("target.txt", "target changed\n")
+	repo.Commit("Target only")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+
+	expected := []string{"split: 1 target file + 2 others", "skipped: no target files", "skipped: only target files"}
+	for i, commit := range report.Commits {
+		if commit.Reason != expected[i] {
+			t.Errorf("Commit %d: expected reason %q, got %q", i, expected[i], commit.Reason)
+		}
+	}
+
+	if output := extractor.Render(report); strings.Contains(output, expected[1]) {
+		t.Errorf("Expected no reasons without SetExplain, got:\n%s", output)
+	}
+	extractor.SetExplain(true)
+	if output := extractor.Render(report); !strings.Contains(output, `"Other only" - skipped: no target files`) {
+		t.Errorf("Expected reasons with SetExplain, got:\n%s", output)
+	}
+}
+
+func TestUnmatchedTargets_SuggestsNearMisses(t *testing.T) {
+	commits := []CommitInfo{
+		{Hash: "a", Files: []string{"src/components/Button.tsx", "db/schema.sql"}},
+		{Hash: "b", Files: []string{"README.md"}},
+	}
+	targets := []string{"db/schema.sql", "src/Components/button.tsx", "components/", "db", "db/shcema.sql", "nothing/like/it.go"}
+
+	expected := []UnmatchedTarget{
+		{Target: "src/Components/button.tsx", Suggestions: []string{"src/components/Button.tsx"}},
+		{Target: "components/", Suggestions: []string{"src/components/"}},
+		{Target: "db", Suggestions: []string{"db/"}},
+		{Target: "db/shcema.sql", Suggestions: []string{"db/schema.sql"}},
+		{Target: "nothing/like/it.go"},
+	}
+	if got := findUnmatchedTargets(targets, nil, commits); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestDryRun_StrictPathsRejectsUnmatchedTargets(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target content\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "Target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if output := report.String(); !strings.Contains(output, "Target.txt matches no file changed in the range (did you mean target.txt?)") {
+		t.Errorf("Expected a warning about the unmatched target, got:\n%s", output)
+	}
+
+	extractor.SetStrictPaths(true)
+	if _, err := extractor.DryRun(t.Context(), baseCommit, "HEAD"); err == nil || !strings.Contains(err.Error(), "did you mean target.txt?") {
+		t.Errorf("Expected strict paths to fail with a suggestion, got %v", err)
+	}
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err == nil {
+		t.Error("Expected strict paths to stop the extraction")
+	}
+}
+
+func TestExtract_StrictPathsFollowsRenamedTarget(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	repo.WriteFile("target.txt", "target content\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("mv", "target.txt", "moved.txt")
+	repo.WriteFile("moved.txt", "target content\nmore\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Move target alongside other work")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetStrictPaths(true)
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	if output := report.String(); strings.Contains(output, "matches no file changed") {
+		t.Errorf("Expected no unmatched target warning for a renamed target, got:\n%s", output)
+	}
+
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+		t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+	}
+}
+
+func TestExtract_FastPathRunsPostRewriteHook(t *testing.T) {
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+
+	repo := testutils.NewTestRepo(t)
+
+	hook := "#!/bin/sh\necho \"$1\" > .git/post-rewrite.args\ncat > .git/post-rewrite.in\n"
+	if err := os.WriteFile(filepath.Join(repo.Dir, ".git", "hooks", "post-rewrite"), []byte(hook), 0755); err != nil {
+		t.Fatalf("Failed to install hook: %v", err)
+	}
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	later := repo.Commit("Add main function")
+
+	if err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(repo.Dir, ".git", "post-rewrite.args"))
+	if err != nil {
+		t.Fatalf("Expected the post-rewrite hook to run: %v", err)
+	}
+	if string(args) != "rebase\n" {
+		t.Errorf("Expected the hook to be called for a rebase, got %q", args)
+	}
+	input, err := os.ReadFile(filepath.Join(repo.Dir, ".git", "post-rewrite.in"))
+	if err != nil {
+		t.Fatalf("Failed to read hook input: %v", err)
+	}
+	expected := fmt.Sprintf("%s %s\n%s %s\n%s %s\n",
+		mixed, repo.Git("rev-parse", "HEAD~2"), mixed, repo.Git("rev-parse", "HEAD~1"), later, repo.Git("rev-parse", "HEAD"))
+	if string(input) != expected {
+		t.Errorf("Expected hook input:\n%s\ngot:\n%s", expected, input)
+	}
+}
+
+func TestExtract_RunsCommitHooksForSplitCommits(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+	installHook := func(name, script string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo.Dir, ".git", "hooks", name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+			t.Fatalf("Failed to install %s hook: %v", name, err)
+		}
+	}
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	originalHead := repo.Commit("Mixed change")
+
+	// A failing pre-commit hook stops the rewrite
+	installHook("pre-commit", "echo rejected >&2\nexit 1\n")
+	err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "pre-commit hook failed") {
+		t.Fatalf("Expected the pre-commit hook to stop the rewrite, got %v", err)
+	}
+	if head := repo.GetCurrentHead(); head != originalHead {
+		t.Fatalf("Expected HEAD to stay at %s, got %s", originalHead, head)
+	}
+
+	// commit-msg can rewrite the message, and pre-commit sees each half's
+	// changes staged on its parent
+	installHook("pre-commit", "git diff --cached --name-only >> \"$(git rev-parse --git-common-dir)/pre-commit.files\"\n")
+	installHook("commit-msg", "printf '\\nReviewed-by: hook\\n' >> \"$1\"\n")
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetBackupPrefix("verified/")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	for _, rev := range []string{"HEAD", "HEAD~1"} {
+		if message := repo.GetCommitMessage(rev); !strings.HasSuffix(message, "Reviewed-by: hook") {
+			t.Errorf("Expected commit-msg to add a trailer to %s, got %q", rev, message)
+		}
+	}
+	staged, err := os.ReadFile(filepath.Join(repo.Dir, ".git", "pre-commit.files"))
+	if err != nil {
+		t.Fatalf("Expected the pre-commit hook to run: %v", err)
+	}
+	if string(staged) != "other.go\ntarget.txt\n" {
+		t.Errorf("Expected pre-commit to see other.go, then target.txt, got %q", staged)
+	}
+
+	// --no-verify bypasses both
+	repo.Git("reset", "-q", "--hard", originalHead)
+	installHook("pre-commit", "exit 1\n")
+	extractor = NewExtractor(repo.Dir, "target.txt")
+	extractor.SetBackupPrefix("unverified/")
+	extractor.SetNoVerify(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract with no-verify failed: %v", err)
+	}
+	if message := repo.GetCommitMessage("HEAD"); strings.Contains(message, "Reviewed-by") {
+		t.Errorf("Expected no-verify to skip commit-msg, got %q", message)
+	}
+}
+
+func TestExtract_KeepsPreCommitHookChanges(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			if fastPath {
+				requireGit(t, git.FeatureMergeTreeWriteTree)
+			}
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content\n")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Mixed change")
+
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			repo.Commit("Add main function")
+
+			// A formatter that fixes up the Go files a commit adds or changes
+			hook := "#!/bin/sh\n" +
+				"for f in $(git diff --cached --name-only --diff-filter=AM -- '*.go'); do\n" +
+				"  echo '// formatted' >> \"$f\" && git add \"$f\"\n" +
+				"done\n"
+			if err := os.WriteFile(filepath.Join(repo.Dir, ".git", "hooks", "pre-commit"), []byte(hook), 0755); err != nil {
+				t.Fatalf("Failed to install pre-commit hook: %v", err)
+			}
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			formatted := "package other\n// formatted\n"
+			if content := repo.Git("show", "HEAD~2:other.go"); content+"\n" != formatted {
+				t.Errorf("Expected the hook to format other.go in the remaining commit, got %q", content)
+			}
+			// Neither the extracted commit nor the commit after it undo that
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit to hold only target.txt, got %v", files)
+			}
+			if content := repo.Git("show", "HEAD:other.go"); content+"\n" != formatted {
+				t.Errorf("Expected HEAD to keep the formatted other.go, got %q", content)
+			}
+			if status := repo.Git("status", "--porcelain"); status != "" {
+				t.Errorf("Expected the working tree to match HEAD, got:\n%s", status)
+			}
+			if worktrees := repo.Git("worktree", "list"); strings.Count(worktrees, "\n") != 0 {
+				t.Errorf("Expected the hook worktrees to be removed, got:\n%s", worktrees)
+			}
+		})
+	}
+}
+
+func TestExtract_DefersHooksToTheResult(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			if fastPath {
+				requireGit(t, git.FeatureMergeTreeWriteTree)
+			}
+			repo := testutils.NewTestRepo(t)
+
+			// The hooks live outside .git, found through core.hooksPath
+			hooksDir := t.TempDir()
+			repo.Git("config", "core.hooksPath", hooksDir)
+			logFile := filepath.Join(t.TempDir(), "hooks.log")
+			installHook := func(name, script string) {
+				t.Helper()
+				if err := os.WriteFile(filepath.Join(hooksDir, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+					t.Fatalf("Failed to install %s hook: %v", name, err)
+				}
+			}
+			for _, name := range []string{"pre-commit", "commit-msg", "post-commit", "post-checkout"} {
+				installHook(name, fmt.Sprintf("echo %s >> '%s'\n", name, logFile))
+			}
+			installHook("post-rewrite", fmt.Sprintf("cat >> '%s.rewrites'\n", logFile))
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			originalHead := repo.Commit("Add main function")
+			// Committing the fixture ran the hooks too
+			if err := os.Remove(logFile); err != nil {
+				t.Fatalf("Failed to clear hook log: %v", err)
+			}
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetDeferHooks(true)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			// commit-msg for each half of the split, then pre-commit once
+			ran, err := os.ReadFile(logFile)
+			if err != nil {
+				t.Fatalf("Expected the hooks to run: %v", err)
+			}
+			if expected := "commit-msg\ncommit-msg\npre-commit\n"; string(ran) != expected {
+				t.Errorf("Expected hooks:\n%s\ngot:\n%s", expected, ran)
+			}
+			rewrites, err := os.ReadFile(logFile + ".rewrites")
+			if err != nil {
+				t.Fatalf("Expected the post-rewrite hook to run: %v", err)
+			}
+			expected := fmt.Sprintf("%s %s\n%s %s\n%s %s\n",
+				mixed, repo.Git("rev-parse", "HEAD~2"), mixed, repo.Git("rev-parse", "HEAD~1"), originalHead, repo.Git("rev-parse", "HEAD"))
+			if string(rewrites) != expected {
+				t.Errorf("Expected post-rewrite input:\n%s\ngot:\n%s", expected, rewrites)
+			}
+
+			// A pre-commit hook failing on the result undoes the rewrite
+			repo.Git("reset", "-q", "--hard", originalHead)
+			installHook("pre-commit", "echo rejected >&2\nexit 1\n")
+			extractor = NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetDeferHooks(true)
+			extractor.SetBackupPrefix("rejected/")
+			err = extractor.Extract(t.Context(), baseCommit, "HEAD")
+			if err == nil || !strings.Contains(err.Error(), "pre-commit hook failed") || !strings.Contains(err.Error(), "rewrite undone") {
+				t.Fatalf("Expected the pre-commit hook to undo the rewrite, got %v", err)
+			}
+			if head := repo.GetCurrentHead(); head != originalHead {
+				t.Errorf("Expected HEAD back at %s, got %s", originalHead, head)
+			}
+		})
+	}
+}
+
+func TestExtract_CopiesNotesToSplitCommits(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+	repo.Git("notes", "add", "-m", "LGTM", mixed)
+	repo.Git("notes", "--ref", "ci", "add", "-m", "passed", mixed)
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	later := repo.Commit("Add main function")
+	repo.Git("notes", "add", "-m", "later", later)
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if err := extractor.SetCopyNotes("extracted"); err != nil {
+		t.Fatalf("SetCopyNotes failed: %v", err)
+	}
+	extractor.SetAnnotateNotes(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	// HEAD~1 holds the extracted target, HEAD~2 the remaining changes
+	expected := "LGTM\n\n(copied from " + mixed + ")"
+	if note := repo.Git("notes", "show", "HEAD~1"); note != expected {
+		t.Errorf("Expected extracted commit note %q, got %q", expected, note)
+	}
+	if note := repo.Git("notes", "--ref", "ci", "show", "HEAD~1"); !strings.HasPrefix(note, "passed") {
+		t.Errorf("Expected the ci note to be copied too, got %q", note)
+	}
+	if strings.Contains(repo.Git("notes", "list"), repo.Git("rev-parse", "HEAD~2")) {
+		t.Error("Expected the remaining commit to get no note")
+	}
+	if note := repo.Git("notes", "show", "HEAD"); !strings.HasPrefix(note, "later") {
+		t.Errorf("Expected the replayed commit to keep its note, got %q", note)
+	}
+
+	if err := extractor.SetCopyNotes("all"); err == nil {
+		t.Error("Expected an unknown notes target to be rejected")
+	}
+}
+
+func TestExtract_RecordsRewriteMapInNotes(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	later := repo.Commit("Add main function")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetMapNotes(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"HEAD~2": "Original: " + mixed + "\nRole: remaining",
+		"HEAD~1": "Original: " + mixed + "\nRole: extracted",
+		"HEAD":   "Original: " + later + "\nRole: rewritten",
+	}
+	for rev, note := range expected {
+		if got := repo.Git("notes", "--ref", MapNotesRef, "show", rev); got != note {
+			t.Errorf("Expected %s to be noted %q, got %q", rev, note, got)
+		}
+	}
+}
+
+func TestExtract_RebasesDependentBranches(t *testing.T) {
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	// A feature branch forked from the mixed commit, and a branch pointing at it
+	repo.Git("checkout", "-q", "-b", "feature")
+	repo.WriteFile("feature.go", "package feature\n")
+	repo.Commit("Add feature")
+	repo.Git("branch", "marker", mixed)
+	repo.Git("checkout", "-q", "master")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	originalHead := repo.Commit("Add main function")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetBackupPrefix("backup/")
+	extractor.SetRebaseDependents(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	// Both now sit on the extracted half of the split, which has the mixed commit's tree
+	split := repo.Git("rev-parse", "HEAD~1")
+	if parent := repo.Git("rev-parse", "feature~1"); parent != split {
+		t.Errorf("Expected feature to fork from the split commit %s, got %s", split, parent)
+	}
+	if files := repo.Git("show", "--name-only", "--format=", "feature"); files != "feature.go" {
+		t.Errorf("Expected feature to keep its own commit, got %q", files)
+	}
+	if subject := repo.Git("log", "-1", "--format=%s", "feature"); subject != "Add feature" {
+		t.Errorf("Expected feature's message to be kept, got %q", subject)
+	}
+	if marker := repo.Git("rev-parse", "marker"); marker != split {
+		t.Errorf("Expected marker to move to %s, got %s", split, marker)
+	}
+
+	// The backup keeps the original history
+	if backup := repo.Git("for-each-ref", "--format=%(objectname)", "refs/heads/backup/"); backup != originalHead {
+		t.Errorf("Expected the backup branch to stay at %s, got %s", originalHead, backup)
+	}
+}
+
+// TestExtract_RewritesVisibleToEventLogs checks that tools keeping an event
+// log from hooks, like git-branchless, see every original commit rewritten
+// into both halves of its split and the branch moved, with either engine
+func TestExtract_RewritesVisibleToEventLogs(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+			hooks := map[string]string{
+				"post-rewrite":          "cat >> .git/rewrites.log\n",
+				"reference-transaction": "[ \"$1\" = committed ] && cat >> .git/refs.log\nexit 0\n",
+			}
+			for name, script := range hooks {
+				if err := os.WriteFile(filepath.Join(repo.Dir, ".git", "hooks", name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+					t.Fatalf("Failed to install %s hook: %v", name, err)
+				}
+			}
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			later := repo.Commit("Add main function")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			log, err := os.ReadFile(filepath.Join(repo.Dir, ".git", "rewrites.log"))
+			if err != nil {
+				t.Fatalf("Expected post-rewrite to run: %v", err)
+			}
+			rewrites := make(map[string][]string)
+			for _, line := range strings.Split(strings.TrimSpace(string(log)), "\n") {
+				old, new, _ := strings.Cut(line, " ")
+				rewrites[old] = append(rewrites[old], new)
+			}
+			// Passes of a rebase report intermediate commits, so follow the chains
+			var final func(commit string) []string
+			final = func(commit string) []string {
+				next, ok := rewrites[commit]
+				if !ok {
+					return []string{commit}
+				}
+				var commits []string
+				for _, n := range next {
+					commits = append(commits, final(n)...)
+				}
+				slices.Sort(commits)
+				return slices.Compact(commits)
+			}
+
+			halves := []string{repo.Git("rev-parse", "HEAD~2"), repo.Git("rev-parse", "HEAD~1")}
+			slices.Sort(halves)
+			if got := final(mixed); !slices.Equal(got, halves) {
+				t.Errorf("Expected the mixed commit to be rewritten into %v, got %v", halves, got)
+			}
+			if got := final(later); !slices.Equal(got, []string{repo.GetCurrentHead()}) {
+				t.Errorf("Expected the later commit to be rewritten into HEAD, got %v", got)
+			}
+
+			refs, err := os.ReadFile(filepath.Join(repo.Dir, ".git", "refs.log"))
+			if err != nil {
+				t.Fatalf("Expected reference-transaction to run: %v", err)
+			}
+			if !strings.Contains(string(refs), " "+repo.GetCurrentHead()+" refs/heads/master") {
+				t.Errorf("Expected the branch update in reference transactions, got:\n%s", refs)
+			}
+		})
+	}
+}
+
+func TestSplitMessages_StackTrailers(t *testing.T) {
+	commit := CommitInfo{
+		Hash:    "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		Message: "Add login\n\nDetails here.\n\nSigned-off-by: Dev <dev@example.com>\nghstack-source-id: 1234\nChange-Id: I0123456789abcdef0123456789abcdef01234567",
+	}
+	extractor := NewExtractor(t.TempDir(), "go.sum")
+
+	remaining, extracted := extractor.splitMessages(commit)
+	expectedRemaining := "Add login\n\nDetails here.\n\nSigned-off-by: Dev <dev@example.com>\n\nChanges to go.sum split into a separate commit\n\n" +
+		"ghstack-source-id: 1234\nChange-Id: I0123456789abcdef0123456789abcdef01234567"
+	if remaining != expectedRemaining {
+		t.Errorf("Expected stack trailers to end the remaining message:\n%s\ngot:\n%s", expectedRemaining, remaining)
+	}
+	if expected := "go.sum: Add login\n\nDetails here.\n\nSigned-off-by: Dev <dev@example.com>"; extracted != expected {
+		t.Errorf("Expected stack trailers to be omitted from the extracted message:\n%s\ngot:\n%s", expected, extracted)
+	}
+
+	if err := extractor.SetStackTrailers("regenerate"); err != nil {
+		t.Fatalf("SetStackTrailers failed: %v", err)
+	}
+	_, extracted = extractor.splitMessages(commit)
+	lines := strings.Split(extracted, "\n")
+	last := lines[len(lines)-1]
+	if !strings.HasPrefix(last, "Change-Id: I") || len(last) != len("Change-Id: I")+40 || strings.Contains(extracted, "0123456789abcdef") {
+		t.Errorf("Expected a fresh Change-Id on the extracted message, got:\n%s", extracted)
+	}
+	if strings.Contains(extracted, "ghstack-source-id") {
+		t.Errorf("Expected ghstack trailers to be left for ghstack to assign, got:\n%s", extracted)
+	}
+
+	if err := extractor.SetStackTrailers("copy"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestExtract_KeepsLFSPointers(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile(".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n")
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			pointer := "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393\nsize 12345\n"
+			repo.WriteFile("assets/logo.bin", pointer)
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Add logo")
+			blob := repo.Git("rev-parse", "HEAD:assets/logo.bin")
+
+			// A filter pair whose smudged form differs from the pointer, so
+			// committing the working tree copy unfiltered would show up
+			repo.Git("config", "filter.lfs.clean", "tr A-Z a-z")
+			repo.Git("config", "filter.lfs.smudge", "tr a-z A-Z")
+
+			var output bytes.Buffer
+			extractor := NewExtractor(repo.Dir, "assets/")
+			extractor.SetOutput(&output)
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if got := repo.Git("rev-parse", "HEAD:assets/logo.bin"); got != blob {
+				t.Errorf("Expected the pointer blob %s to be kept, got %s", blob, got)
+			}
+			if files := repo.Git("show", "--name-only", "--format=", "HEAD"); files != "assets/logo.bin" {
+				t.Errorf("Expected the extracted commit to hold the pointer, got %q", files)
+			}
+			if _, err := exec.LookPath("git-lfs"); err != nil && !strings.Contains(output.String(), "assets/logo.bin is tracked by Git LFS, but git lfs isn't installed") {
+				t.Errorf("Expected a warning about the missing git lfs, got:\n%s", output.String())
+			}
+		})
+	}
+}
+
+func TestDryRun_RefusesReplacedHistory(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	// Replace the mixed commit with one that only touches main.go
+	replacement := repo.Git("commit-tree", baseCommit+"^{tree}", "-p", baseCommit, "-m", "Replacement")
+	repo.Git("replace", mixed, replacement)
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if _, err := extractor.DryRun(t.Context(), baseCommit, "HEAD"); err == nil || !strings.Contains(err.Error(), "refs/replace/"+mixed) {
+		t.Errorf("Expected the replaced commit to be refused, got %v", err)
+	}
+
+	t.Setenv("GIT_NO_REPLACE_OBJECTS", "1")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("Expected GIT_NO_REPLACE_OBJECTS to allow the run, got %v", err)
+	}
+	if report.SplitCount != 1 {
+		t.Errorf("Expected the real mixed commit to be split, got %d splits", report.SplitCount)
+	}
+}
+
+func TestDryRun_RefusesRangeAtShallowBoundary(t *testing.T) {
+	origin := testutils.NewTestRepo(t)
+
+	origin.WriteFile("main.go", "package main\n")
+	origin.Commit("Initial commit")
+	origin.WriteFile("target.txt", "content")
+	origin.WriteFile("other.go", "package other\n")
+	origin.Commit("Mixed change")
+	origin.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	origin.Commit("Add main function")
+
+	clone := filepath.Join(t.TempDir(), "clone")
+	origin.Git("clone", "-q", "--depth", "2", "file://"+origin.Dir, clone)
+
+	// An unrelated base puts the whole shallow history, boundary included, in the range
+	unrelated := origin.Git("-C", clone, "-c", "user.name=Test", "-c", "user.email=test@example.com", "commit-tree", "-m", "Unrelated", "4b825dc642cb6eb9a060e54bf8d69288fbee4904")
+
+	extractor := NewExtractor(clone, "target.txt")
+	if _, err := extractor.DryRun(t.Context(), unrelated, "HEAD"); err == nil || !strings.Contains(err.Error(), "shallow clone") {
+		t.Errorf("Expected a range reaching the shallow boundary to be refused, got %v", err)
+	}
+	if _, err := extractor.DryRun(t.Context(), "HEAD~1", "HEAD"); err != nil {
+		t.Errorf("Expected a range inside the shallow history to work, got %v", err)
+	}
+}
+
+func TestExtract_InLinkedWorktree(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			worktree := repo.AddWorktree("feature")
+			worktree.WriteFile("target.txt", "content")
+			worktree.WriteFile("other.go", "package other\n")
+			worktree.Commit("Mixed change")
+
+			extractor := NewExtractor(worktree.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if files := worktree.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit to hold target.txt, got %v", files)
+			}
+			if files := worktree.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+				t.Errorf("Expected the remaining commit to hold other.go, got %v", files)
+			}
+			if head := repo.GetCurrentHead(); head != baseCommit {
+				t.Errorf("Expected the main worktree to stay at %s, got %s", baseCommit, head)
+			}
+			if inProgress, _ := extractor.checkRebaseConflicts(); inProgress {
+				t.Error("Expected the rebase to be finished")
+			}
+		})
+	}
+}
+
+func TestCheckRebaseConflicts_LinkedWorktree(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("schema.sql", "base\n")
+	repo.Commit("Initial commit")
+
+	worktree := repo.AddWorktree("topic")
+	worktree.WriteFile("schema.sql", "topic\n")
+	worktree.Commit("Topic change")
+
+	repo.WriteFile("schema.sql", "upstream\n")
+	upstream := repo.Commit("Upstream change")
+
+	// The rebase state is in the worktree's own git directory, behind a .git file
+	worktreeExtractor := NewExtractor(worktree.Dir, "schema.sql")
+	if err := worktreeExtractor.runRebase(nil, upstream); err == nil {
+		t.Fatal("Expected the rebase to stop for conflicts")
+	}
+	inProgress, message := worktreeExtractor.checkRebaseConflicts()
+	if !inProgress || message != "Merge conflicts in: schema.sql" {
+		t.Errorf("Expected the conflict in the worktree to be seen, got %v %q", inProgress, message)
+	}
+	if !worktreeExtractor.rebaseInProgress() {
+		t.Error("Expected a rebase in progress in the worktree")
+	}
+
+	// Other worktrees aren't rebasing
+	mainExtractor := NewExtractor(repo.Dir, "schema.sql")
+	if inProgress, _ := mainExtractor.checkRebaseConflicts(); inProgress || mainExtractor.rebaseInProgress() {
+		t.Error("Expected no rebase in progress in the main worktree")
+	}
+}
+
+func TestExtract_SeparateGitDir(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+	repo.SeparateGitDir()
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetFastPath(false)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"target.txt"}) {
+		t.Errorf("Expected the extracted commit to hold target.txt, got %v", files)
+	}
+}
+
+func TestDryRun_RefusesGraftsFromLinkedWorktree(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	worktree := repo.AddWorktree("feature")
+	worktree.WriteFile("target.txt", "content")
+	worktree.WriteFile("other.go", "package other\n")
+	mixed := worktree.Commit("Mixed change")
+
+	// Grafts are shared by every worktree, from the common git directory
+	grafts := filepath.Join(repo.Dir, ".git", "info", "grafts")
+	if err := os.MkdirAll(filepath.Dir(grafts), 0755); err != nil {
+		t.Fatalf("Failed to create info directory: %v", err)
+	}
+	if err := os.WriteFile(grafts, []byte(mixed+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write grafts: %v", err)
+	}
+
+	_, err := NewExtractor(worktree.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "grafts") {
+		t.Errorf("Expected the grafts file to be refused, got %v", err)
+	}
+}
+
+func TestTemporaryWorktree_SplitsBranchOfBareRepository(t *testing.T) {
+	origin := testutils.NewTestRepo(t)
+
+	origin.WriteFile("main.go", "package main\n")
+	baseCommit := origin.Commit("Initial commit")
+
+	origin.WriteFile("target.txt", "content")
+	origin.WriteFile("other.go", "package other\n")
+	originalHead := origin.Commit("Mixed change")
+
+	mirror := origin.Clone("--bare")
+	if _, err := AddTemporaryWorktree(t.Context(), mirror.Dir, "missing"); err == nil || !strings.Contains(err.Error(), "no branch named missing") {
+		t.Errorf("Expected a missing branch to be refused, got %v", err)
+	}
+
+	worktree, err := AddTemporaryWorktree(t.Context(), mirror.Dir, "master")
+	if err != nil {
+		t.Fatalf("AddTemporaryWorktree failed: %v", err)
+	}
+	extractor := NewExtractor(worktree.Dir, "target.txt")
+	extractor.SetNonInteractive(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if err := extractor.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := worktree.Remove(t.Context()); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	if head := mirror.Git("rev-parse", "master"); head == originalHead {
+		t.Fatal("Expected master to be rewritten")
+	}
+	if files := mirror.GetCommitFiles("master"); !slices.Equal(files, []string{"target.txt"}) {
+		t.Errorf("Expected the extracted commit to hold target.txt, got %v", files)
+	}
+	if files := mirror.GetCommitFiles("master~1"); !slices.Equal(files, []string{"other.go"}) {
+		t.Errorf("Expected the remaining commit to hold other.go, got %v", files)
+	}
+	if _, err := os.Stat(worktree.Dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the worktree directory to be removed, got %v", err)
+	}
+	if list := mirror.Git("worktree", "list", "--porcelain"); strings.Count(list, "worktree ") != 1 {
+		t.Errorf("Expected git to forget the temporary worktree, got:\n%s", list)
+	}
+}
+
+func TestExtract_BranchCheckedOutInAnotherWorktree(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			originalHead := repo.Commit("Mixed change")
+
+			other := filepath.Join(t.TempDir(), "other")
+			repo.Git("worktree", "add", "-q", "--force", other, "master")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+			var collision *WorktreeCollisionError
+			if !errors.As(err, &collision) {
+				t.Fatalf("Expected a worktree collision, got %v", err)
+			}
+			if collision.Branch != "master" || !samePath(collision.Worktree, other) {
+				t.Errorf("Expected master in %s, got %s in %s", other, collision.Branch, collision.Worktree)
+			}
+			if head := repo.GetCurrentHead(); head != originalHead {
+				t.Errorf("Expected nothing to change, HEAD moved to %s", head)
+			}
+
+			extractor.SetDetach(true)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract with detach failed: %v", err)
+			}
+			if ref := repo.Git("rev-parse", "--symbolic-full-name", "HEAD"); ref != "HEAD" {
+				t.Errorf("Expected a detached HEAD, got %s", ref)
+			}
+			if branch := repo.Git("rev-parse", "master"); branch != originalHead {
+				t.Errorf("Expected master to stay at %s, got %s", originalHead, branch)
+			}
+			if count := repo.Git("rev-list", "--count", baseCommit+"..HEAD"); count != "2" {
+				t.Errorf("Expected the detached HEAD to hold both halves, got %s commits", count)
+			}
+		})
+	}
+}
+
+func TestExtract_RunsSplitCommands(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			mixed := repo.Commit("Mixed change")
+
+			log := filepath.Join(t.TempDir(), "log")
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetPreSplitCommand(`echo "pre $GIT_EXTRACT_ORIGINAL $GIT_EXTRACT_TARGETS" >> ` + log)
+			extractor.SetPostSplitCommand(`echo "post $GIT_EXTRACT_REMAINING $GIT_EXTRACT_EXTRACTED $GIT_EXTRACT_EXTRACTED_MESSAGE" >> ` + log)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			remaining := repo.Git("rev-parse", "HEAD~1")
+			extracted := repo.Git("rev-parse", "HEAD")
+			content, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatalf("Split commands didn't run: %v", err)
+			}
+			expected := fmt.Sprintf("pre %s target.txt\npost %s %s target.txt: Mixed change\n", mixed, remaining, extracted)
+			if string(content) != expected {
+				t.Errorf("Expected split commands to log\n%s\ngot\n%s", expected, content)
+			}
+		})
+	}
+}
+
+func TestExtract_FailingPreSplitCommandStopsTheRun(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	originalHead := repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetPreSplitCommand("exit 1")
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err == nil || !strings.Contains(err.Error(), "pre-split command failed") {
+		t.Fatalf("Expected the pre-split command to stop the run, got %v", err)
+	}
+	if head := repo.GetCurrentHead(); head != originalHead {
+		t.Errorf("Expected HEAD to stay at %s, got %s", originalHead, head)
+	}
+}
+
+func TestExtract_ExecRunsOnEverySplitCommit(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	repo.Commit("Add main function")
+
+	log := filepath.Join(t.TempDir(), "log")
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetExec("git rev-parse HEAD >> " + log)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	content, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("--exec didn't run: %v", err)
+	}
+	expected := repo.Git("rev-parse", "HEAD~2") + "\n" + repo.Git("rev-parse", "HEAD~1") + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected --exec to run on the split commits\n%s\ngot\n%s", expected, content)
+	}
+	if branch := repo.Git("symbolic-ref", "--short", "HEAD"); branch != "master" {
+		t.Errorf("Expected to be back on master, got %s", branch)
+	}
+}
+
+func TestExtract_FailingExecUndoesTheRewrite(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	originalHead := repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetExec("test ! -f target.txt")
+	err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+	if err == nil || !strings.Contains(err.Error(), "rewrite undone") {
+		t.Fatalf("Expected the failing --exec to undo the rewrite, got %v", err)
+	}
+	if head := repo.GetCurrentHead(); head != originalHead {
+		t.Errorf("Expected HEAD back at %s, got %s", originalHead, head)
+	}
+	if branch := repo.Git("symbolic-ref", "--short", "HEAD"); branch != "master" {
+		t.Errorf("Expected to be back on master, got %s", branch)
+	}
+	if status := repo.Git("status", "--porcelain"); status != "" {
+		t.Errorf("Expected a clean working tree, got %s", status)
+	}
+}
+
+func TestExtract_ErrorKinds(t *testing.T) {
+	setup := func(t *testing.T) (*testutils.TestRepo, string) {
+		repo := testutils.NewTestRepo(t)
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.Commit("Mixed change")
+		return repo, baseCommit
+	}
+
+	t.Run("dirty worktree", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+		repo.WriteFile("main.go", "package main // edited\n")
+		err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD")
+		if !errors.Is(err, ErrDirtyWorktree) {
+			t.Errorf("Expected ErrDirtyWorktree, got %v", err)
+		}
+	})
+
+	t.Run("rebase in progress", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+		repo.Git("-c", "sequence.editor=sed -i 1s/^pick/edit/", "rebase", "-q", "-i", "HEAD~1")
+		err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD")
+		if !errors.Is(err, ErrRebaseInProgress) {
+			t.Errorf("Expected ErrRebaseInProgress, got %v", err)
+		}
+	})
+
+	t.Run("foreign authors", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+		repo.Git("commit", "-q", "--amend", "--no-edit", "--author", "Someone Else <someone@example.com>")
+		err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), baseCommit, "HEAD")
+		if !errors.Is(err, ErrProtectedBranch) {
+			t.Errorf("Expected ErrProtectedBranch, got %v", err)
+		}
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+		err := NewExtractor(repo.Dir, "target.txt").Extract(t.Context(), "HEAD~1", "HEAD")
+		if !errors.Is(err, ErrNothingToSplit) {
+			t.Errorf("Expected ErrNothingToSplit, got %v", err)
+		}
+	})
+}
+
+func TestConflictError_NonInteractiveAbortsTheRebase(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("package-lock.json", "base\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("checkout", "-q", "-b", "upstream")
+	repo.WriteFile("package-lock.json", "upstream\n")
+	upstream := repo.Commit("Upstream change")
+
+	repo.Git("checkout", "-q", "-b", "topic", baseCommit)
+	repo.WriteFile("package-lock.json", "topic\n")
+	topic := repo.Commit("Topic change")
+
+	extractor := NewExtractor(repo.Dir, "package-lock.json")
+	extractor.SetNonInteractive(true)
+	if err := extractor.runRebase(nil, upstream); err == nil {
+		t.Fatal("Expected the rebase to stop on conflicts")
+	}
+
+	observer := &recordingObserver{}
+	extractor.AddObserver(observer)
+	err := extractor.conflictError(CommitInfo{Hash: topic}, "Merge conflicts in: package-lock.json")
+	if !errors.Is(err, ErrConflicts) {
+		t.Fatalf("Expected ErrConflicts, got %v", err)
+	}
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !conflict.Aborted || conflict.Commit != topic || !slices.Equal(conflict.Files, []string{"package-lock.json"}) {
+		t.Errorf("Expected an aborted ConflictError listing package-lock.json, got %#v", conflict)
+	}
+	if want := []string{"conflict " + topic[:7] + " [package-lock.json]"}; !slices.Equal(observer.calls, want) {
+		t.Errorf("Expected observers to hear about the conflict, got %v", observer.calls)
+	}
+	if inProgress, _ := extractor.checkRebaseConflicts(); inProgress {
+		t.Error("Expected the rebase to be aborted")
+	}
+	if head := repo.GetCurrentHead(); head != topic {
+		t.Errorf("Expected HEAD back at %s, got %s", topic, head)
+	}
+}
+
+func TestExtract_HonorsGitDirAndWorkTree(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target content\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	// Keep the git directory away from the working tree, where only the
+	// environment says where it is
+	gitDir := filepath.Join(t.TempDir(), "repo.git")
+	if err := os.Rename(filepath.Join(repo.Dir, ".git"), gitDir); err != nil {
+		t.Fatalf("Failed to move git directory: %v", err)
+	}
+	t.Setenv("GIT_DIR", gitDir)
+	t.Setenv("GIT_WORK_TREE", repo.Dir)
+
+	// Run from elsewhere, through the interactive rebase, which has to find
+	// its state in the git directory
+	extractor := NewExtractor(t.TempDir(), "target.txt")
+	extractor.SetFastPath(false)
+	extractor.SetNonInteractive(true)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	files := repo.GetCommitFiles("HEAD")
+	if len(files) != 1 || files[0] != "target.txt" {
+		t.Errorf("Expected the extracted commit to hold target.txt, got %v", files)
+	}
+	files = repo.GetCommitFiles("HEAD~1")
+	if len(files) != 1 || files[0] != "other.go" {
+		t.Errorf("Expected the remaining commit to hold other.go, got %v", files)
+	}
+	if inProgress, _ := extractor.checkRebaseConflicts(); inProgress {
+		t.Error("Expected the rebase to be finished")
+	}
+}
+
+func TestExtract_IgnoresInheritedGitEnvironment(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "target content\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+
+	// Left over from a calling script, each of these would derail the rebase
+	t.Setenv("GIT_INDEX_FILE", filepath.Join(t.TempDir(), "index"))
+	t.Setenv("GIT_SEQUENCE_EDITOR", "false")
+	t.Setenv("GIT_EDITOR", "false")
+	t.Setenv("GIT_AUTHOR_NAME", "Someone Else")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetFastPath(false)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	authors := strings.Split(repo.Git("log", "--format=%an", baseCommit+"..HEAD"), "\n")
+	if !slices.Equal(authors, []string{"Test User", "Test User"}) {
+		t.Errorf("Expected both split commits to keep the original author, got %q", authors)
+	}
+}
+
+func TestExtract_WritesFilterRepoCommitMap(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("other.go", "package other\n")
+	mixed := repo.Commit("Mixed change")
+
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	after := repo.Commit("Add main function")
+
+	commitMap := filepath.Join(t.TempDir(), "commit-map")
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetCommitMapPath(commitMap)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	content, err := os.ReadFile(commitMap)
+	if err != nil {
+		t.Fatalf("Failed to read commit map: %v", err)
+	}
+	expected := "old                                      new\n" +
+		mixed + " " + repo.Git("rev-parse", "HEAD~1") + "\n" +
+		after + " " + repo.Git("rev-parse", "HEAD") + "\n"
+	if string(content) != expected {
+		t.Errorf("Expected commit map\n%s\ngot\n%s", expected, content)
+	}
+}
+
+func TestExtract_SpecialFilenames(t *testing.T) {
+	targets := []string{"docs/release notes.md", "ünïcödé.txt", "-leading-dash.txt", `quote"and\backslash.txt`}
+
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			// One mixed commit per target, so each must be recognized on its own
+			for i, target := range targets {
+				repo.WriteFile(target, "content\n")
+				repo.WriteFile(fmt.Sprintf("other file %d.go", i), "package other\n")
+				repo.Commit("Add " + target)
+			}
+
+			extractor := NewExtractor(repo.Dir, targets...)
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			commits := strings.Split(repo.Git("rev-list", "--reverse", baseCommit+"..HEAD"), "\n")
+			if len(commits) != 2*len(targets) {
+				t.Fatalf("Expected every commit to be split into %d commits, got %d", 2*len(targets), len(commits))
+			}
+			for i, target := range targets {
+				if files := repo.GetCommitFiles(commits[2*i]); !slices.Equal(files, []string{fmt.Sprintf("other file %d.go", i)}) {
+					t.Errorf("Expected the remaining commit to hold only the other file, got %q", files)
+				}
+				if files := repo.GetCommitFiles(commits[2*i+1]); !slices.Equal(files, []string{target}) {
+					t.Errorf("Expected the extracted commit to hold %q, got %q", target, files)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_FollowsRenamedTargets(t *testing.T) {
+	for _, follow := range []bool{true, false} {
+		t.Run(fmt.Sprintf("follow=%v", follow), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			repo.WriteFile("src/old.ts", "export const a = 1\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("src/old.ts", "export const a = 2\n")
+			repo.WriteFile("a.go", "package a\n")
+			repo.Commit("Before the rename")
+
+			repo.Git("mv", "src/old.ts", "src/new.ts")
+			repo.Commit("Rename old.ts")
+
+			repo.WriteFile("src/new.ts", "export const a = 3\n")
+			repo.WriteFile("b.go", "package b\n")
+			repo.Commit("After the rename")
+
+			extractor := NewExtractor(repo.Dir, "src/new.ts")
+			extractor.SetFollow(follow)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			subjects := repo.Git("log", "--reverse", "--format=%s", baseCommit+"..HEAD")
+			expected := "Before the rename\nsrc/new.ts: Before the rename\nRename old.ts\nAfter the rename\nsrc/new.ts: After the rename"
+			if !follow {
+				expected = "Before the rename\nRename old.ts\nAfter the rename\nsrc/new.ts: After the rename"
+			}
+			if subjects != expected {
+				t.Errorf("Expected history\n%s\ngot\n%s", expected, subjects)
+			}
+			if follow {
+				if files := repo.GetCommitFiles("HEAD~4"); !slices.Equal(files, []string{"a.go"}) {
+					t.Errorf("Expected the commit before the rename to keep only a.go, got %q", files)
+				}
+				if files := repo.GetCommitFiles("HEAD~3"); !slices.Equal(files, []string{"src/old.ts"}) {
+					t.Errorf("Expected the old name to be extracted, got %q", files)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_MovesWholeRenameOfTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "pure rename", content: "export const a = 1\n"},
+		{name: "rename and modify", content: "export const a = 1\nexport const b = 2\n"},
+	}
+
+	for _, tt := range tests {
+		for _, fastPath := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/fastPath=%v", tt.name, fastPath), func(t *testing.T) {
+				repo := testutils.NewTestRepo(t)
+
+				repo.WriteFile("main.go", "package main\n")
+				repo.WriteFile("src/old.ts", "export const a = 1\n")
+				baseCommit := repo.Commit("Initial commit")
+
+				repo.Git("mv", "src/old.ts", "src/new.ts")
+				repo.WriteFile("src/new.ts", tt.content)
+				repo.WriteFile("other.go", "package other\n")
+				repo.Commit("Rename alongside other work")
+
+				// Not following, so only the rename itself ties the old name to the target
+				extractor := NewExtractor(repo.Dir, "src/new.ts")
+				extractor.SetFollow(false)
+				extractor.SetFastPath(fastPath)
+				if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+
+				if files := repo.Git("diff-tree", "-r", "--no-renames", "--name-only", "--no-commit-id", "HEAD~1"); files != "other.go" {
+					t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+				}
+				if files := repo.Git("diff-tree", "-r", "--no-renames", "--name-only", "--no-commit-id", "HEAD"); files != "src/new.ts\nsrc/old.ts" {
+					t.Errorf("Expected the extracted commit to hold both sides of the rename, got %q", files)
+				}
+				if tree := repo.Git("ls-tree", "-r", "--name-only", "HEAD~1", "src"); tree != "src/old.ts" {
+					t.Errorf("Expected the remaining commit to still have only the old name, got %q", tree)
+				}
+			})
+		}
+	}
+}
+
+func TestExtract_TargetDeletion(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			repo.WriteFile("config/target.txt", "content\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.Git("rm", "-q", "config/target.txt")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Remove target alongside other work")
+
+			extractor := NewExtractor(repo.Dir, "config/target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if changes := repo.Git("diff-tree", "-r", "--name-status", "--no-commit-id", "HEAD~1"); changes != "A\tother.go" {
+				t.Errorf("Expected the remaining commit to only add other.go, got %q", changes)
+			}
+			if changes := repo.Git("diff-tree", "-r", "--name-status", "--no-commit-id", "HEAD"); changes != "D\tconfig/target.txt" {
+				t.Errorf("Expected the extracted commit to delete the target, got %q", changes)
+			}
+		})
+	}
+}
+
+func TestExtract_ModeOnlyChange(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		for _, fileMode := range []string{"true", "false"} {
+			t.Run(fmt.Sprintf("fastPath=%v/core.fileMode=%s", fastPath, fileMode), func(t *testing.T) {
+				repo := testutils.NewTestRepo(t)
+
+				repo.WriteFile("main.go", "package main\n")
+				repo.WriteFile("scripts/build.sh", "#!/bin/sh\n")
+				baseCommit := repo.Commit("Initial commit")
+
+				// Set the mode in the index, as on filesystems that don't track it
+				repo.WriteFile("other.go", "package other\n")
+				repo.Git("add", "other.go")
+				repo.Git("update-index", "--chmod=+x", "scripts/build.sh")
+				repo.Git("commit", "-q", "-m", "Make build.sh executable")
+				repo.Git("config", "core.fileMode", fileMode)
+				repo.Git("reset", "-q", "--hard")
+
+				extractor := NewExtractor(repo.Dir, "scripts/build.sh")
+				extractor.SetFastPath(fastPath)
+				if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+
+				if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+					t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+				}
+				if entry := repo.Git("ls-tree", "HEAD~1", "scripts/build.sh"); !strings.HasPrefix(entry, "100644 ") {
+					t.Errorf("Expected the remaining commit to keep the old mode, got %q", entry)
+				}
+				if changes := repo.Git("diff-tree", "-r", "--summary", "--no-commit-id", "HEAD"); !strings.Contains(changes, "mode change 100644 => 100755 scripts/build.sh") {
+					t.Errorf("Expected the extracted commit to change the mode, got %q", changes)
+				}
+			})
+		}
+	}
+}
+
+func TestExtract_BinaryTargets(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			repo.WriteBinaryFile("assets/logo.png", 1000, 3)
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteBinaryFile("assets/logo.png", 3000, 7)
+			repo.WriteBinaryFile("assets/app.jar", 100, 5)
+			repo.WriteFile("other.go", "package other\n")
+			original := repo.Commit("Update assets")
+
+			extractor := NewExtractor(repo.Dir, "assets/")
+			extractor.SetFastPath(fastPath)
+			report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+			if err != nil {
+				t.Fatalf("DryRun failed: %v", err)
+			}
+			stat := report.Commits[0].ExtractedStat
+			if stat == nil || stat.Files != 2 || len(stat.Binary) != 2 {
+				t.Fatalf("Expected two binary changes in the extracted diffstat, got %+v", stat)
+			}
+			preview := report.String()
+			for _, label := range []string{"binary assets/app.jar none -> 100 B", "binary assets/logo.png 1000 B -> 2.9 KiB"} {
+				if !strings.Contains(preview, label) {
+					t.Errorf("Expected %q in the preview, got:\n%s", label, preview)
+				}
+			}
+
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			for _, path := range []string{"assets/logo.png", "assets/app.jar"} {
+				if blob, expected := repo.Git("rev-parse", "HEAD:"+path), repo.Git("rev-parse", original+":"+path); blob != expected {
+					t.Errorf("Expected %s to be byte-identical (%s), got %s", path, expected, blob)
+				}
+			}
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+				t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+			}
+		})
+	}
+}
+
+func TestDryRun_RefusesOctopusAndForeignMerges(t *testing.T) {
+	t.Run("octopus", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+
+		for _, branch := range []string{"a", "b"} {
+			repo.Git("checkout", "-q", "-b", branch, baseCommit)
+			repo.WriteFile(branch+".go", "package "+branch+"\n")
+			repo.Commit("Add " + branch)
+		}
+		repo.Git("checkout", "-q", "master")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.Commit("Mixed change")
+		repo.Git("merge", "-q", "-m", "Merge a and b", "a", "b")
+		octopus := repo.GetCurrentHead()
+
+		_, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+		if err == nil || !strings.Contains(err.Error(), octopus[:7]+" \"Merge a and b\" is an octopus merge of 3 parents") {
+			t.Errorf("Expected the octopus merge to be refused, got %v", err)
+		}
+	})
+
+	t.Run("merge from outside the range", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+
+		repo.WriteFile("main.go", "package main\n")
+		forkPoint := repo.Commit("Initial commit")
+		repo.WriteFile("main.go", "package main\n\n// two\n")
+		mainline := repo.Commit("Mainline change")
+		repo.WriteFile("main.go", "package main\n\n// three\n")
+		newBase := repo.Commit("Later mainline change")
+
+		// A feature branch that merged an older mainline, rebased onto a newer one
+		repo.Git("checkout", "-q", "-b", "feature", forkPoint)
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.Commit("Mixed change")
+		repo.Git("merge", "-q", "-m", "Merge mainline", mainline)
+
+		_, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), newBase, "HEAD")
+		if err == nil || !strings.Contains(err.Error(), "merges "+mainline[:7]+", which is outside the range") {
+			t.Errorf("Expected the merge from outside the range to be refused, got %v", err)
+		}
+	})
+
+	t.Run("merge that needs splitting", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+		branch := repo.Git("symbolic-ref", "--short", "HEAD")
+
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		repo.Git("checkout", "-q", "-b", "side")
+		repo.WriteFile("side.go", "package side\n")
+		repo.Commit("Side change")
+		repo.Git("checkout", "-q", branch)
+		repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+		repo.Commit("Mainline change")
+
+		// The merge itself changes a target and another file
+		repo.Git("merge", "-q", "--no-commit", "side")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.Git("add", "target.txt", "other.go")
+		repo.Git("commit", "-q", "-m", "Merge side with extras")
+		merge := repo.GetCurrentHead()
+
+		_, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), baseCommit, "HEAD")
+		if err == nil || !strings.Contains(err.Error(), merge[:7]+" \"Merge side with extras\"") || !strings.Contains(err.Error(), "merges can't be split") {
+			t.Errorf("Expected the merge needing a split to be refused, got %v", err)
+		}
+	})
+}
+
+func TestExtract_FirstCommitAfterBase(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Mixed change right after the base")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if parent := repo.Git("rev-parse", "HEAD~2"); parent != baseCommit {
+				t.Errorf("Expected the split to sit directly on the base %s, got %s", baseCommit, parent)
+			}
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+				t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+			}
+			if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit to hold only target.txt, got %q", files)
+			}
+		})
+	}
+}
+
+func TestExtract_BaseIsAMerge(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			initial := repo.Commit("Initial commit")
+
+			repo.Git("checkout", "-q", "-b", "side")
+			repo.WriteFile("side.go", "package side\n")
+			repo.Commit("Side change")
+			repo.Git("checkout", "-q", "master")
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			repo.Commit("Mainline change")
+			repo.Git("merge", "-q", "-m", "Merge side", "side")
+			merge := repo.GetCurrentHead()
+			if parents := repo.Git("rev-list", "--parents", "-n", "1", merge); len(strings.Fields(parents)) != 3 {
+				t.Fatalf("Expected a merge commit on top of %s, got %s", initial, parents)
+			}
+
+			repo.WriteFile("target.txt", "content")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Mixed change")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), merge, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if parent := repo.Git("rev-parse", "HEAD~2"); parent != merge {
+				t.Errorf("Expected the split to sit on the merge %s, got %s", merge, parent)
+			}
+			if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit to hold only target.txt, got %q", files)
+			}
+		})
+	}
+}
+
+func TestExtract_IgnoredTarget(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile(".gitignore", "*.lock\nbuild/\n")
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			// A tracked file that the ignore rules would otherwise exclude
+			repo.WriteFile("deps.lock", "v1\n")
+			repo.Git("add", "--force", "deps.lock")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Git("add", "other.go")
+			repo.Git("commit", "-q", "-m", "Lock dependencies")
+			original := repo.GetCurrentHead()
+
+			// Ignored files lying around must not be swept into either commit
+			repo.WriteFile("stale.lock", "stale\n")
+			repo.WriteFile("build/out.bin", "binary\n")
+
+			extractor := NewExtractor(repo.Dir, "deps.lock", "stale.lock")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"other.go"}) {
+				t.Errorf("Expected the remaining commit to hold only other.go, got %q", files)
+			}
+			if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"deps.lock"}) {
+				t.Errorf("Expected the extracted commit to hold only deps.lock, got %q", files)
+			}
+			if blob, expected := repo.Git("rev-parse", "HEAD:deps.lock"), repo.Git("rev-parse", original+":deps.lock"); blob != expected {
+				t.Errorf("Expected deps.lock to match the original commit, got %s", blob)
+			}
+			if content, err := os.ReadFile(filepath.Join(repo.Dir, "stale.lock")); err != nil || string(content) != "stale\n" {
+				t.Errorf("Expected the ignored stale.lock to be left alone, got %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestExtract_NonASCIIFilenames(t *testing.T) {
+	targets := []string{"文档/说明.md", "🚀 launch.txt"}
+
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+			// The default, which octal-escapes these paths in plain output
+			repo.Git("config", "core.quotePath", "true")
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			for _, target := range targets {
+				repo.WriteFile(target, "content\n")
+			}
+			repo.WriteFile("其他.go", "package other\n")
+			repo.Commit("Mixed change")
+
+			extractor := NewExtractor(repo.Dir, targets...)
+			extractor.SetFastPath(fastPath)
+			extractor.SetShowDiff(true)
+			report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+			if err != nil {
+				t.Fatalf("DryRun failed: %v", err)
+			}
+			if report.SplitCount != 1 {
+				t.Fatalf("Expected the mixed commit to be split, got %d splits", report.SplitCount)
+			}
+			for _, target := range targets {
+				if !strings.Contains(report.Commits[0].ExtractedDiff, "+++ b/"+target) {
+					t.Errorf("Expected %s unescaped in the extracted patch, got:\n%s", target, report.Commits[0].ExtractedDiff)
+				}
+			}
+
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"其他.go"}) {
+				t.Errorf("Expected the remaining commit to hold only 其他.go, got %q", files)
+			}
+			extracted := repo.GetCommitFiles("HEAD")
+			slices.Sort(extracted)
+			expected := slices.Sorted(slices.Values(targets))
+			if !slices.Equal(extracted, expected) {
+				t.Errorf("Expected the extracted commit to hold %q, got %q", expected, extracted)
+			}
+		})
+	}
+}
+
+func TestExtract_EmptyCommits(t *testing.T) {
+	for _, mode := range []string{"keep", "drop"} {
+		for _, fastPath := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/fastPath=%v", mode, fastPath), func(t *testing.T) {
+				repo := testutils.NewTestRepo(t)
+
+				repo.WriteFile("main.go", "package main\n")
+				baseCommit := repo.Commit("Initial commit")
+
+				// One empty commit before the split and one after it
+				repo.Git("commit", "-q", "--allow-empty", "-m", "Start of release")
+				repo.WriteFile("target.txt", "content")
+				repo.WriteFile("other.go", "package other\n")
+				repo.Commit("Mixed change")
+				repo.Git("commit", "-q", "--allow-empty", "-m", "Trigger CI")
+				repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+				repo.Commit("Add main function")
+				original := repo.GetCurrentHead()
+
+				commitMap := filepath.Join(t.TempDir(), "commit-map")
+				extractor := NewExtractor(repo.Dir, "target.txt")
+				extractor.SetFastPath(fastPath)
+				extractor.SetCommitMapPath(commitMap)
+				if err := extractor.SetEmptyCommits(mode); err != nil {
+					t.Fatalf("SetEmptyCommits failed: %v", err)
+				}
+				if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+
+				subjects := strings.Split(repo.Git("log", "--format=%s", baseCommit+"..HEAD"), "\n")
+				expected := []string{"Add main function", "Trigger CI", "target.txt: Mixed change", "Mixed change", "Start of release"}
+				if mode == "drop" {
+					expected = []string{"Add main function", "target.txt: Mixed change", "Mixed change"}
+				}
+				if !slices.Equal(subjects, expected) {
+					t.Errorf("Expected commits %q, got %q", expected, subjects)
+				}
+				if tree := repo.Git("rev-parse", "HEAD^{tree}"); tree != repo.Git("rev-parse", original+"^{tree}") {
+					t.Errorf("Expected the final tree to be unchanged")
+				}
+
+				content, err := os.ReadFile(commitMap)
+				if err != nil {
+					t.Fatalf("Failed to read commit map: %v", err)
+				}
+				dropped := strings.Count(string(content), " "+nullOID+"\n")
+				if want := map[string]int{"keep": 0, "drop": 2}[mode]; dropped != want {
+					t.Errorf("Expected %d dropped commits in the commit map, got:\n%s", want, content)
+				}
+			})
+		}
+	}
+
+	extractor := NewExtractor(".", "target.txt")
+	if err := extractor.SetEmptyCommits("ask"); err == nil {
+		t.Error("Expected an unknown empty commits mode to be rejected")
+	}
+}
+
+func TestExtract_MissingRevisions(t *testing.T) {
+	t.Run("unborn branch", func(t *testing.T) {
+		repo := testutils.NewTestRepo(t)
+		branch := repo.Git("symbolic-ref", "--short", "HEAD")
+
+		extractor := NewExtractor(repo.Dir, "target.txt")
+		expected := "branch '" + branch + "' has no commits yet"
+		if err := extractor.Extract(t.Context(), "HEAD~2", "HEAD"); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected Extract to fail with %q, got %v", expected, err)
+		}
+		if _, err := extractor.DryRun(t.Context(), "HEAD~2", "HEAD"); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected Preview to fail with %q, got %v", expected, err)
+		}
+	})
+
+	repo := testutils.NewTestRepo(t)
+	branch := repo.Git("symbolic-ref", "--short", "HEAD")
+	for i := range 3 {
+		repo.WriteFile("main.go", fmt.Sprintf("package main // %d\n", i))
+		repo.Commit(fmt.Sprintf("Commit %d", i))
+	}
+
+	tests := []struct {
+		from     string
+		expected string
+	}{
+		{"HEAD~5", "revision 'HEAD~5' not found — the branch " + branch + " has only 3 commits"},
+		{"HEAD^^^", "revision 'HEAD^^^' not found — the branch " + branch + " has only 3 commits"},
+		{branch + "~1~4", "revision '" + branch + "~1~4' not found — " + branch + " has only 3 commits"},
+		{"no-such-branch~1", "revision 'no-such-branch~1' not found"},
+		{"no-such-branch", "revision 'no-such-branch' not found"},
+		{"HEAD^{tree}", "revision 'HEAD^{tree}' is not a commit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			err := extractor.Extract(t.Context(), tt.from, "HEAD")
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("Expected %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestExtract_KeepsBlobsUnderFilters(t *testing.T) {
+	setups := map[string]func(repo *testutils.TestRepo){
+		// Checked-out files differ from their blobs, so any step that read
+		// contents back from the worktree would depend on the filter
+		"clean and smudge filters": func(repo *testutils.TestRepo) {
+			repo.Git("config", "filter.shout.clean", "tr A-Z a-z")
+			repo.Git("config", "filter.shout.smudge", "tr a-z A-Z")
+			repo.WriteFile(".gitattributes", "*.txt filter=shout\n")
+		},
+		// Blobs with CRLF line endings that autocrlf would normalize
+		"autocrlf": func(repo *testutils.TestRepo) {
+			repo.Git("config", "core.autocrlf", "false")
+		},
+	}
+
+	for name, setup := range setups {
+		for _, fastPath := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/fastPath=%v", name, fastPath), func(t *testing.T) {
+				repo := testutils.NewTestRepo(t)
+				setup(repo)
+
+				repo.WriteFile("main.go", "package main\r\n")
+				repo.WriteFile("notes.txt", "shared notes\r\n")
+				baseCommit := repo.Commit("Initial commit")
+
+				repo.WriteFile("target.txt", "target content\r\n")
+				repo.WriteFile("notes.txt", "changed notes\r\n")
+				mixed := repo.Commit("Mixed change")
+
+				repo.WriteFile("main.go", "package main\r\n\r\nfunc main() {}\r\n")
+				repo.Commit("Add main function")
+				original := repo.GetCurrentHead()
+				if name == "autocrlf" {
+					repo.Git("config", "core.autocrlf", "true")
+				}
+
+				extractor := NewExtractor(repo.Dir, "target.txt")
+				extractor.SetFastPath(fastPath)
+				if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+
+				if tree := repo.Git("rev-parse", "HEAD^{tree}"); tree != repo.Git("rev-parse", original+"^{tree}") {
+					t.Errorf("Expected the final tree to be byte-identical to the original")
+				}
+				for _, half := range []string{"HEAD~1", "HEAD~2"} {
+					for _, path := range repo.GetCommitFiles(half) {
+						if got, want := repo.Git("rev-parse", half+":"+path), repo.Git("rev-parse", mixed+":"+path); got != want {
+							t.Errorf("Expected %s in %s to keep blob %s, got %s", path, half, want, got)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyRewrite(t *testing.T) {
+	repo := testutils.NewTestRepo(t)
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+	repo.WriteFile("target.txt", "content\r\n")
+	repo.WriteFile("other.go", "package other\n")
+	original := repo.Commit("Mixed change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	if err := extractor.verifyRewrite(baseCommit, original); err != nil {
+		t.Errorf("Expected an unchanged history to verify, got %v", err)
+	}
+
+	// A split whose first half carries a normalized copy of the target
+	repo.Git("checkout", "-q", "--detach", baseCommit)
+	repo.WriteFile("target.txt", "content\n")
+	repo.CommitFile("target.txt", "target.txt: Mixed change")
+	repo.WriteFile("target.txt", "content\r\n")
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Mixed change")
+	err := extractor.verifyRewrite(baseCommit, original)
+	if err == nil || !strings.Contains(err.Error(), "target.txt has content or mode") {
+		t.Errorf("Expected the changed blob to be reported, got %v", err)
+	}
+
+	// A split whose first half lost the executable bit of a script
+	script := filepath.Join(repo.Dir, "run.sh")
+	repo.Git("checkout", "-q", "--detach", baseCommit)
+	repo.WriteFile("run.sh", "#!/bin/sh\n")
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatalf("Failed to make run.sh executable: %v", err)
+	}
+	repo.WriteFile("other.go", "package other\n")
+	executable := repo.Commit("Add run script")
+	repo.Git("checkout", "-q", "--detach", baseCommit)
+	repo.WriteFile("run.sh", "#!/bin/sh\n")
+	if err := os.Chmod(script, 0644); err != nil {
+		t.Fatalf("Failed to make run.sh non-executable: %v", err)
+	}
+	repo.CommitFile("run.sh", "run.sh: Add run script")
+	if err := os.Chmod(script, 0755); err != nil {
+		t.Fatalf("Failed to make run.sh executable: %v", err)
+	}
+	repo.WriteFile("other.go", "package other\n")
+	repo.Commit("Add run script")
+	err = extractor.verifyRewrite(baseCommit, executable)
+	if err == nil || !strings.Contains(err.Error(), "run.sh has content or mode (100644") {
+		t.Errorf("Expected the changed mode to be reported, got %v", err)
+	}
+
+	// A rewrite that doesn't end on the original tree
+	repo.Git("checkout", "-q", "--detach", original)
+	repo.WriteFile("other.go", "package other // changed\n")
+	repo.Commit("Changed")
+	err = extractor.verifyRewrite(baseCommit, original)
+	if err == nil || !strings.Contains(err.Error(), "doesn't have the tree") {
+		t.Errorf("Expected the changed final tree to be reported, got %v", err)
+	}
+}
+
+func TestExtract_PartialClone(t *testing.T) {
+	for _, filter := range []string{"blob:none", "tree:0"} {
+		t.Run(filter, func(t *testing.T) {
+			origin := testutils.NewTestRepo(t)
+			origin.Git("config", "uploadpack.allowFilter", "true")
+			origin.Git("config", "uploadpack.allowAnySHA1InWant", "true")
+
+			origin.WriteFile("main.go", "package main\n")
+			origin.WriteFile("docs/guide.md", "# Guide\n")
+			origin.Commit("Initial commit")
+			origin.WriteFile("target.txt", "content")
+			origin.WriteFile("docs/guide.md", "# Guide\n\nMore.\n")
+			origin.Commit("Mixed change")
+			origin.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			origin.Commit("Add main function")
+
+			repo := origin.Clone("--filter="+filter, "--no-checkout")
+			// Checking out fetches the blobs at HEAD, leaving the older ones missing
+			repo.Git("checkout", "-q", "master")
+
+			// Offline, the missing objects are reported before anything else
+			offline := origin.Dir + ".offline"
+			if err := os.Rename(origin.Dir, offline); err != nil {
+				t.Fatalf("Failed to take the origin offline: %v", err)
+			}
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetBackupPrefix("offline-")
+			err := extractor.Extract(t.Context(), "HEAD~2", "HEAD")
+			if err == nil || !strings.Contains(err.Error(), "this is a partial clone") {
+				t.Errorf("Expected a partial clone error while offline, got %v", err)
+			}
+			if branches := repo.Git("branch", "--list", "offline-*"); branches != "" {
+				t.Errorf("Expected no backup branch after failing early, got %q", branches)
+			}
+			if err := os.Rename(offline, origin.Dir); err != nil {
+				t.Fatalf("Failed to bring the origin back: %v", err)
+			}
+
+			extractor = NewExtractor(repo.Dir, "target.txt")
+			if err := extractor.Extract(t.Context(), "HEAD~2", "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if files := repo.GetCommitFiles("HEAD~1"); !slices.Equal(files, []string{"target.txt"}) {
+				t.Errorf("Expected the extracted commit to hold only target.txt, got %q", files)
+			}
+
+			// Everything was fetched up front, so the range now works offline
+			if err := os.Rename(origin.Dir, offline); err != nil {
+				t.Fatalf("Failed to take the origin offline: %v", err)
+			}
+			defer os.Rename(offline, origin.Dir)
+			if _, err := NewExtractor(repo.Dir, "target.txt").DryRun(t.Context(), "HEAD~3", "HEAD"); err != nil {
+				t.Errorf("Expected the prefetched range to preview offline, got %v", err)
+			}
+		})
+	}
+}
+
+func TestExtract_HiddenLocalChanges(t *testing.T) {
+	for _, bit := range []string{"assume-unchanged", "skip-worktree"} {
+		t.Run(bit, func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			repo.WriteFile("config.local", "debug = false\n")
+			baseCommit := repo.Commit("Initial commit")
+			repo.WriteFile("config.local", "debug = false\nport = 80\n")
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Mixed change")
+
+			// A local setting git has been told not to report
+			repo.Git("update-index", "--"+bit, "config.local")
+			repo.WriteFile("config.local", "debug = true\nport = 8080\n")
+			if status := repo.Git("status", "--porcelain"); status != "" {
+				t.Fatalf("Expected the change to be hidden from git status, got %q", status)
+			}
+
+			extractor := NewExtractor(repo.Dir, "config.local")
+			extractor.SetFastPath(false)
+			extractor.SetBackupPrefix("rebase-")
+			err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+			if err == nil || !strings.Contains(err.Error(), "config.local ("+bit+")") || !strings.Contains(err.Error(), "git update-index --no-"+bit+" -- config.local") {
+				t.Fatalf("Expected the hidden change to stop the rebase, got %v", err)
+			}
+			if branches := repo.Git("branch", "--list", "rebase-*"); branches != "" {
+				t.Errorf("Expected no backup branch after refusing, got %q", branches)
+			}
+
+			// The plumbing path never touches the working tree
+			requireGit(t, git.FeatureMergeTreeWriteTree)
+			extractor = NewExtractor(repo.Dir, "config.local")
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			if files := repo.GetCommitFiles("HEAD"); !slices.Equal(files, []string{"config.local"}) {
+				t.Errorf("Expected the extracted commit to hold only config.local, got %q", files)
+			}
+			content, err := os.ReadFile(filepath.Join(repo.Dir, "config.local"))
+			if err != nil || string(content) != "debug = true\nport = 8080\n" {
+				t.Errorf("Expected the local change to survive, got %q (%v)", content, err)
+			}
+		})
+	}
+}
+
+func TestExtract_SignedCommits(t *testing.T) {
+	setup := func(t *testing.T) (*testutils.TestRepo, string) {
+		repo := testutils.NewTestRepo(t)
+		repo.EnableSigning()
+
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		repo.WriteFile("target.txt", "content")
+		repo.WriteFile("other.go", "package other\n")
+		repo.CommitSigned("Signed mixed change")
+		repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+		repo.CommitSigned("Signed follow-up")
+		return repo, baseCommit
+	}
+	signed := func(repo *testutils.TestRepo, rev string) bool {
+		return isSigned(repo.Git("cat-file", "commit", rev))
+	}
+
+	t.Run("required without signing configured", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+		original := repo.GetCurrentHead()
+
+		extractor := NewExtractor(repo.Dir, "target.txt")
+		extractor.SetRequireSignatures(true)
+		extractor.SetBackupPrefix("required-")
+		err := extractor.Extract(t.Context(), baseCommit, "HEAD")
+		if !errors.Is(err, ErrProtectedBranch) || !strings.Contains(err.Error(), "the signatures of 2 commits would be dropped") {
+			t.Fatalf("Expected the rewrite to be refused, got %v", err)
+		}
+		if head := repo.GetCurrentHead(); head != original {
+			t.Errorf("Expected HEAD to stay at %s, got %s", original, head)
+		}
+		if branches := repo.Git("branch", "--list", "required-*"); branches != "" {
+			t.Errorf("Expected no backup branch after refusing, got %q", branches)
+		}
+	})
+
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("re-signed/fastPath=%v", fastPath), func(t *testing.T) {
+			repo, baseCommit := setup(t)
+			repo.Git("config", "commit.gpgSign", "true")
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetRequireSignatures(true)
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+			for _, rev := range []string{"HEAD", "HEAD~1", "HEAD~2"} {
+				if !signed(repo, rev) {
+					t.Errorf("Expected %s to be signed", rev)
+				}
+			}
+		})
+	}
+
+	t.Run("dropped by default", func(t *testing.T) {
+		repo, baseCommit := setup(t)
+
+		extractor := NewExtractor(repo.Dir, "target.txt")
+		if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+		if signed(repo, "HEAD~1") {
+			t.Errorf("Expected the split commit to be unsigned without commit.gpgSign")
+		}
+	})
+}
+
+func TestExtract_FileTurnedIntoDirectory(t *testing.T) {
+	for _, target := range []string{"config", "config/"} {
+		for _, fastPath := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/fastPath=%v", target, fastPath), func(t *testing.T) {
+				repo := testutils.NewTestRepo(t)
+
+				repo.WriteFile("main.go", "package main\n")
+				repo.WriteFile("config", "port=80\n")
+				baseCommit := repo.Commit("Initial commit")
+
+				repo.WriteFile("main.go", "package main\n\n// v1\n")
+				repo.WriteFile("config", "port=8080\n")
+				repo.Commit("Change port")
+				repo.Git("rm", "-q", "config")
+				repo.WriteFile("config/app.yml", "port: 8080\n")
+				repo.WriteFile("other.go", "package other\n")
+				repo.Commit("Move config into a directory")
+				repo.WriteFile("config/app.yml", "port: 9090\n")
+				repo.WriteFile("main.go", "package main\n\n// v2\n")
+				repo.Commit("Change port again")
+				original := repo.GetCurrentHead()
+
+				extractor := NewExtractor(repo.Dir, target)
+				extractor.SetFastPath(fastPath)
+				if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+					t.Fatalf("Extract failed: %v", err)
+				}
+
+				if tree := repo.Git("rev-parse", "HEAD^{tree}"); tree != repo.Git("rev-parse", original+"^{tree}") {
+					t.Errorf("Expected the final tree to be unchanged")
+				}
+
+				// The file era is always covered, and the directory era only by "config/"
+				expected := map[string]int{"config": 5, "config/": 6}[target]
+				commits := strings.Split(repo.Git("rev-list", baseCommit+"..HEAD"), "\n")
+				if len(commits) != expected {
+					t.Errorf("Expected %d commits, got %d", expected, len(commits))
+				}
+				for _, commit := range commits {
+					files := repo.GetCommitFiles(commit)
+					configs := 0
+					for _, file := range files {
+						if file == "config" || strings.HasPrefix(file, "config/") {
+							configs++
+						}
+					}
+					// "config" leaves the last commit, which only has config/app.yml, alone
+					mixed := configs != 0 && configs != len(files)
+					if mixed && (target == "config/" || commit != commits[0]) {
+						t.Errorf("Expected commit %s to not mix config with other files, got %v", commit[:7], files)
+					}
+				}
+
+				// The conversion stays in one commit: no commit has both or neither
+				for _, commit := range commits {
+					if repo.Git("ls-tree", "--name-only", commit, "config", "config/app.yml") == "" {
+						t.Errorf("Expected config as a file or a directory in every commit, missing in %s", commit[:7])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestExtract_KeepsMergeOfSplitBranch(t *testing.T) {
+	requireGit(t, git.FeatureRebaseMerges)
+
+	repo := testutils.NewTestRepo(t)
+	branch := repo.Git("symbolic-ref", "--short", "HEAD")
+
+	repo.WriteFile("main.go", "package main\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("checkout", "-q", "-b", "side")
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("side.go", "package side\n")
+	repo.Commit("Mixed change on side")
+	repo.Git("checkout", "-q", branch)
+	repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+	mainline := repo.Commit("Mainline change")
+	repo.Git("merge", "-q", "-m", "Merge side", "side")
+	repo.WriteFile("later.go", "package later\n")
+	original := repo.Commit("Later change")
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	extractor.SetFastPath(false)
+	if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+
+	if tree := repo.Git("rev-parse", "HEAD^{tree}"); tree != repo.Git("rev-parse", original+"^{tree}") {
+		t.Errorf("Expected the final tree to be unchanged")
+	}
+	if merges := repo.Git("rev-list", "--merges", "--count", baseCommit+"..HEAD"); merges != "1" {
+		t.Fatalf("Expected the merge to be kept, got %s merges", merges)
+	}
+	// The mainline commit is untouched, and the side branch is split
+	if first := repo.Git("rev-parse", "HEAD~1^1"); first != mainline {
+		t.Errorf("Expected the merge to keep %s as its first parent, got %s", mainline, first)
+	}
+	if files := repo.GetCommitFiles("HEAD~1^2"); !slices.Equal(files, []string{"target.txt"}) {
+		t.Errorf("Expected the side branch to end with the extracted commit, got %q", files)
+	}
+	if files := repo.GetCommitFiles("HEAD~1^2~1"); !slices.Equal(files, []string{"side.go"}) {
+		t.Errorf("Expected the remaining commit below it, got %q", files)
+	}
+}
+
+func TestExtract_PredictsConflictsInRecreatedMerges(t *testing.T) {
+	requireGit(t, git.FeatureRebaseMerges)
+	requireGit(t, git.FeatureMergeTreeWriteTree)
+
+	repo := testutils.NewTestRepo(t)
+	branch := repo.Git("symbolic-ref", "--short", "HEAD")
+
+	repo.WriteFile("shared.txt", "base\n")
+	baseCommit := repo.Commit("Initial commit")
+
+	repo.Git("checkout", "-q", "-b", "side")
+	repo.WriteFile("target.txt", "content")
+	repo.WriteFile("shared.txt", "side\n")
+	repo.Commit("Mixed change on side")
+	repo.Git("checkout", "-q", branch)
+	repo.WriteFile("shared.txt", "main\n")
+	repo.Commit("Mainline change")
+	// The merge's resolution isn't something merging the split side again reproduces
+	repo.Git("merge", "-q", "-X", "ours", "-m", "Merge side", "side")
+	merge := repo.GetCurrentHead()
+
+	extractor := NewExtractor(repo.Dir, "target.txt")
+	report, err := extractor.DryRun(t.Context(), baseCommit, "HEAD")
+	if err != nil {
+		t.Fatalf("DryRun failed: %v", err)
+	}
+	for _, commit := range report.Commits {
+		expected := []string(nil)
+		if commit.Hash == merge {
+			expected = []string{"shared.txt"}
+		}
+		if !slices.Equal(commit.PredictedConflicts, expected) {
+			t.Errorf("Expected %s to predict conflicts %q, got %q", commit.Hash[:7], expected, commit.PredictedConflicts)
+		}
+	}
+
+	var buf bytes.Buffer
+	extractor.SetOutput(&buf)
+	err = extractor.Extract(t.Context(), baseCommit, "HEAD")
+	if !errors.Is(err, ErrConflicts) {
+		t.Fatalf("Expected the rewrite to stop on the predicted conflict, got %v", err)
+	}
+	if output := buf.String(); !strings.Contains(output, "The rewrite will stop for conflicts in:\n  - "+merge[:7]+": shared.txt") {
+		t.Errorf("Expected Extract to report the predicted conflict, got:\n%s", output)
+	}
+}
+
+func TestExtract_PreservesMergesInRange(t *testing.T) {
+	requireGit(t, git.FeatureRebaseMerges)
+
+	for _, order := range []string{"remaining-first", "extracted-first"} {
+		t.Run(order, func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+			branch := repo.Git("symbolic-ref", "--short", "HEAD")
+
+			repo.WriteFile("main.go", "package main\n")
+			repo.WriteFile("target.txt", "v0\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			// The same target change lands on both sides of a merge
+			repo.Git("checkout", "-q", "-b", "side")
+			repo.WriteFile("target.txt", "v1\n")
+			repo.WriteFile("side.go", "package side\n")
+			side := repo.Commit("Bump version on side")
+			repo.Git("checkout", "-q", branch)
+			repo.WriteFile("target.txt", "v1\n")
+			repo.WriteFile("main.go", "package main\n\nfunc main() {}\n")
+			main := repo.Commit("Bump version on main")
+			repo.Git("merge", "-q", "--no-edit", "side")
+			original := repo.GetCurrentHead()
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			if order == "extracted-first" {
+				extractor.SetOverrides(map[string]SplitOverride{side: {ExtractedFirst: true}, main: {ExtractedFirst: true}})
+			}
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			if tree := repo.Git("rev-parse", "HEAD^{tree}"); tree != repo.Git("rev-parse", original+"^{tree}") {
+				t.Errorf("Expected the final tree to be unchanged")
+			}
+			// Both sides are split and the merge is recreated on top of them
+			if parents := strings.Fields(repo.Git("rev-list", "--parents", "-n", "1", "HEAD")); len(parents) != 3 {
+				t.Fatalf("Expected HEAD to stay a merge, got parents %q", parents[1:])
+			}
+			for _, side := range []string{"HEAD^1", "HEAD^2"} {
+				if count := repo.Git("rev-list", "--count", baseCommit+".."+side); count != "2" {
+					t.Errorf("Expected %s to be split into 2 commits, got %s", side, count)
+				}
+			}
+			commits := strings.Split(repo.Git("rev-list", "--no-merges", baseCommit+"..HEAD"), "\n")
+			for _, commit := range commits {
+				if len(repo.GetCommitFiles(commit)) == 0 {
+					t.Errorf("Expected no empty commits, but %s is empty", commit[:7])
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_RestoresModesAfterPreCommitHook(t *testing.T) {
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("fastPath=%v", fastPath), func(t *testing.T) {
+			repo := testutils.NewTestRepo(t)
+
+			repo.WriteFile("main.go", "package main\n")
+			baseCommit := repo.Commit("Initial commit")
+
+			repo.WriteFile("scripts/build.sh", "#!/bin/sh\n")
+			if err := os.Chmod(filepath.Join(repo.Dir, "scripts", "build.sh"), 0755); err != nil {
+				t.Fatalf("Failed to make build.sh executable: %v", err)
+			}
+			repo.WriteFile("other.go", "package other\n")
+			repo.Commit("Add build script")
+
+			// What re-adding the script does on a filesystem without exec bits
+			hook := "#!/bin/sh\ngit update-index --chmod=-x scripts/build.sh 2>/dev/null || true\n"
+			if err := os.WriteFile(filepath.Join(repo.Dir, ".git", "hooks", "pre-commit"), []byte(hook), 0755); err != nil {
+				t.Fatalf("Failed to install pre-commit hook: %v", err)
+			}
+
+			extractor := NewExtractor(repo.Dir, "scripts/build.sh")
+			extractor.SetFastPath(fastPath)
+			if err := extractor.Extract(t.Context(), baseCommit, "HEAD"); err != nil {
+				t.Fatalf("Extract failed: %v", err)
+			}
+
+			for _, rev := range []string{"HEAD~1", "HEAD"} {
+				entry := repo.Git("ls-tree", rev, "scripts/build.sh")
+				if entry != "" && !strings.HasPrefix(entry, "100755 ") {
+					t.Errorf("Expected %s to keep build.sh executable, got %q", rev, entry)
+				}
+			}
+		})
+	}
+}
+
+// cancelOnEvent cancels a context once an event of the given type is emitted
+type cancelOnEvent struct {
+	event  string
+	cancel context.CancelFunc
+}
+
+func (c cancelOnEvent) Write(line []byte) (int, error) {
+	if strings.Contains(string(line), `"event":"`+c.event+`"`) {
+		c.cancel()
+	}
+	return len(line), nil
+}
+
+func TestExtract_Canceled(t *testing.T) {
+	setup := func(t *testing.T) (*testutils.TestRepo, string, string) {
+		repo := testutils.NewTestRepo(t)
+		repo.WriteFile("main.go", "package main\n")
+		baseCommit := repo.Commit("Initial commit")
+		for i := 1; i <= 2; i++ {
+			repo.WriteFile("target.txt", fmt.Sprintf("v%d\n", i))
+			repo.WriteFile(fmt.Sprintf("other%d.go", i), "package other\n")
+			repo.Commit(fmt.Sprintf("Mixed change %d", i))
+		}
+		return repo, baseCommit, repo.GetCurrentHead()
+	}
+
+	t.Run("before starting", func(t *testing.T) {
+		repo, baseCommit, original := setup(t)
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		err := NewExtractor(repo.Dir, "target.txt").Extract(ctx, baseCommit, "HEAD")
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a canceled error, got %v", err)
+		}
+		if head := repo.GetCurrentHead(); head != original {
+			t.Errorf("Expected HEAD to stay at %s, got %s", original[:7], head[:7])
+		}
+	})
+
+	// Canceling after the first split interrupts the rebase while it is
+	// stopped at that commit, or the plumbing path before it moves the branch
+	for _, fastPath := range []bool{true, false} {
+		t.Run(fmt.Sprintf("during the rewrite/fastPath=%v", fastPath), func(t *testing.T) {
+			repo, baseCommit, original := setup(t)
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			extractor := NewExtractor(repo.Dir, "target.txt")
+			extractor.SetFastPath(fastPath)
+			extractor.SetEventStream(cancelOnEvent{event: EventSplitFinished, cancel: cancel})
+			err := extractor.Extract(ctx, baseCommit, "HEAD")
+			if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "rolled back") {
+				t.Fatalf("Expected the rewrite to be canceled and rolled back, got %v", err)
+			}
+
+			if head := repo.GetCurrentHead(); head != original {
+				t.Errorf("Expected HEAD to be rolled back to %s, got %s", original[:7], head[:7])
+			}
+			if _, err := os.Stat(filepath.Join(repo.Dir, ".git", "rebase-merge")); !os.IsNotExist(err) {
+				t.Errorf("Expected the rebase to be aborted")
+			}
+			if status := repo.Git("status", "--porcelain"); status != "" {
+				t.Errorf("Expected a clean working tree, got:\n%s", status)
+			}
+		})
+	}
+}
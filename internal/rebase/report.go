@@ -0,0 +1,214 @@
+// ABOUTME: Structured dry-run report shared by the text and JSON previews
+// ABOUTME: Collects the plan, blast radius, foreign authors, and predicted conflicts in one pass
+
+package rebase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DryRunReport describes everything a run would do, without doing it
+type DryRunReport struct {
+	Commits                 []PlannedCommit   `json:"commits"`
+	SplitCount              int               `json:"splitCount"`
+	UnmatchedTargets        []UnmatchedTarget `json:"unmatchedTargets,omitempty"`
+	BlastRadius             *BlastRadius      `json:"blastRadius,omitempty"`
+	BlastRadiusError        string            `json:"blastRadiusError,omitempty"`
+	ForeignAuthorCommits    []string          `json:"foreignAuthorCommits,omitempty"`
+	ConflictPredictionError string            `json:"conflictPredictionError,omitempty"`
+}
+
+// PlannedCommit is a commit in the range and what would happen to it
+type PlannedCommit struct {
+	Hash               string    `json:"hash"`
+	Message            string    `json:"message"`
+	Author             string    `json:"author"`
+	Files              []string  `json:"files"`
+	Split              bool      `json:"split"`
+	Reason             string    `json:"reason"`
+	RemainingMessage   string    `json:"remainingMessage,omitempty"`
+	ExtractedMessage   string    `json:"extractedMessage,omitempty"`
+	ExtractedFirst     bool      `json:"extractedFirst,omitempty"`
+	RemainingStat      *DiffStat `json:"remainingStat,omitempty"`
+	ExtractedStat      *DiffStat `json:"extractedStat,omitempty"`
+	PredictedConflicts []string  `json:"predictedConflicts,omitempty"`
+	RemainingDiff      string    `json:"remainingDiff,omitempty"`
+	ExtractedDiff      string    `json:"extractedDiff,omitempty"`
+}
+
+// DryRun analyzes the range and reports what a run would do, without
+// changing anything. The report is plain data; render it with Render,
+// RenderJSON, or RenderMarkdown.
+func (e *Extractor) DryRun(ctx context.Context, from, to string) (*DryRunReport, error) {
+	e.ctx = ctx
+	commits, err := e.analyze(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze commits: %w", err)
+	}
+	if e.strictPaths {
+		if err := e.checkTargets(commits); err != nil {
+			return nil, err
+		}
+	}
+	e.applyOverrides(commits)
+
+	report := &DryRunReport{
+		Commits:          make([]PlannedCommit, 0, len(commits)),
+		UnmatchedTargets: e.unmatchedTargets(commits),
+	}
+	conflicts, conflictErr := e.predictConflicts(commits)
+	if conflictErr != nil {
+		report.ConflictPredictionError = conflictErr.Error()
+	}
+
+	for _, commit := range commits {
+		planned := PlannedCommit{
+			Hash:               commit.Hash,
+			Message:            commit.Message,
+			Author:             commit.Author,
+			Files:              commit.Files,
+			Split:              commit.NeedsSplit,
+			Reason:             e.explainCommit(commit),
+			PredictedConflicts: conflicts[commit.Hash],
+		}
+		if commit.NeedsSplit {
+			planned.RemainingMessage, planned.ExtractedMessage = e.splitMessages(commit)
+			planned.ExtractedFirst = e.extractedFirst(commit)
+			// The diffstat is a nicety; leave it out rather than fail the preview
+			if remaining, extracted, err := e.splitStats(commit); err == nil {
+				planned.RemainingStat, planned.ExtractedStat = &remaining, &extracted
+			} else {
+				e.logWarn("diffstat unavailable", err, "commit", commit.Hash)
+			}
+			if e.showDiff {
+				planned.RemainingDiff, planned.ExtractedDiff, err = e.splitDiffs(commit)
+				if err != nil {
+					return nil, fmt.Errorf("failed to preview split of %s: %w", commit.Hash[:7], err)
+				}
+			}
+			report.SplitCount++
+		}
+		report.Commits = append(report.Commits, planned)
+	}
+
+	// Show what else the rewrite touches
+	if report.SplitCount > 0 {
+		if radius, err := e.computeBlastRadius(commits); err == nil {
+			report.BlastRadius = &radius
+		} else {
+			report.BlastRadiusError = err.Error()
+		}
+	}
+
+	// Call out rewrites of other people's commits
+	for _, commit := range e.foreignCommits(commits) {
+		report.ForeignAuthorCommits = append(report.ForeignAuthorCommits, commit.Hash)
+	}
+
+	return report, nil
+}
+
+// RenderJSON renders a dry-run report as indented JSON for editors and bots
+func (e *Extractor) RenderJSON(report *DryRunReport) ([]byte, error) {
+	var output bytes.Buffer
+	encoder := json.NewEncoder(&output)
+	// Messages and diffs stay readable with their <, >, and & intact
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return nil, fmt.Errorf("failed to encode dry run: %w", err)
+	}
+	return output.Bytes(), nil
+}
+
+// String renders the report as the human-readable dry-run preview
+func (r *DryRunReport) String() string {
+	return r.render(style{}, false)
+}
+
+// render renders the human-readable preview with the given styling,
+// optionally listing the reason for every commit's classification
+func (r *DryRunReport) render(s style, explain bool) string {
+	var output strings.Builder
+	for _, target := range r.UnmatchedTargets {
+		fmt.Fprintf(&output, "%s %s\n", s.paint(ansiYellow, "Warning:"), target)
+	}
+	if len(r.UnmatchedTargets) > 0 {
+		output.WriteString("\n")
+	}
+	fmt.Fprintf(&output, "Would split %d out of %d commits:\n\n", r.SplitCount, len(r.Commits))
+
+	if explain {
+		for _, commit := range r.Commits {
+			reason := s.paint(ansiDim, commit.Reason)
+			if commit.Split {
+				reason = s.paint(ansiGreen, commit.Reason)
+			}
+			fmt.Fprintf(&output, "  %s \"%s\" - %s\n", s.paint(ansiYellow, commit.Hash[:7]), subject(commit.Message), reason)
+		}
+		output.WriteString("\n")
+	}
+
+	// Show details for each commit that would be split
+	for _, commit := range r.Commits {
+		if commit.Split {
+			// Show original commit and its splits
+			fmt.Fprintf(&output, "Commit %s: \"%s\"\n", s.paint(ansiYellow, commit.Hash[:7]), s.paint(ansiBold, commit.Message))
+			remaining := fmt.Sprintf("\"%s\"%s", s.paint(ansiGreen, commit.RemainingMessage), renderStat(s, commit.RemainingStat))
+			extracted := fmt.Sprintf("\"%s\"%s", s.paint(ansiCyan, commit.ExtractedMessage), renderStat(s, commit.ExtractedStat))
+			// The halves are listed in the order they're committed
+			first, second := remaining, extracted
+			if commit.ExtractedFirst {
+				first, second = extracted, remaining
+			}
+			fmt.Fprintf(&output, "%s Split into: %s\n", s.paint(ansiDim, "├─"), first)
+			fmt.Fprintf(&output, "%s Split into: %s\n\n", s.paint(ansiDim, "└─"), second)
+			if commit.RemainingDiff != "" || commit.ExtractedDiff != "" {
+				renderPatch(&output, s, "Extracted patch:", commit.ExtractedDiff)
+				renderPatch(&output, s, "Remaining patch:", commit.RemainingDiff)
+				output.WriteString("\n")
+			}
+		}
+	}
+
+	if r.BlastRadius != nil {
+		fmt.Fprintf(&output, "%s\n", r.BlastRadius)
+	} else if r.BlastRadiusError != "" {
+		fmt.Fprintf(&output, "Blast radius unavailable: %s\n\n", r.BlastRadiusError)
+	}
+
+	if len(r.ForeignAuthorCommits) > 0 {
+		fmt.Fprintf(&output, "Would rewrite %d commits authored by others (requires --rewrite-others)\n", len(r.ForeignAuthorCommits))
+	}
+
+	// Report conflicts found by simulating the rewrite
+	predicted := false
+	for _, commit := range r.Commits {
+		if len(commit.PredictedConflicts) > 0 {
+			if !predicted {
+				fmt.Fprintf(&output, "%s\n", s.paint(ansiYellow, "Predicted conflicts:"))
+				predicted = true
+			}
+			fmt.Fprintf(&output, "  Commit %s: %s\n", s.paint(ansiYellow, commit.Hash[:7]), s.paint(ansiRed, strings.Join(commit.PredictedConflicts, ", ")))
+		}
+	}
+	if r.ConflictPredictionError != "" {
+		fmt.Fprintf(&output, "Conflict prediction unavailable: %s\n", r.ConflictPredictionError)
+	} else if !predicted && r.SplitCount > 0 {
+		fmt.Fprintf(&output, "No conflicts predicted.\n")
+	}
+
+	return output.String()
+}
+
+// renderStat renders an optional diffstat as a suffix of a split line
+func renderStat(s style, stat *DiffStat) string {
+	if stat == nil {
+		return ""
+	}
+	return " " + s.paint(ansiDim, "("+stat.String()+")")
+}
@@ -0,0 +1,118 @@
+// ABOUTME: Up-front validation of the revisions that bound the range
+// ABOUTME: Explains unborn branches and ancestors past the root instead of surfacing bare git failures
+
+package rebase
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// checkRevisions fails with a readable error unless both ends of the range
+// name commits
+func (e *Extractor) checkRevisions(from, to string) error {
+	for _, rev := range []string{from, to} {
+		if err := e.checkRevision(rev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRevision explains why rev doesn't name a commit, if it doesn't
+func (e *Extractor) checkRevision(rev string) error {
+	_, err := e.resolveCommit(rev)
+	if err == nil {
+		return nil
+	}
+
+	if _, err := e.resolveCommit("HEAD"); err != nil {
+		if branch := e.currentBranch(); branch != "" {
+			return fmt.Errorf("%w: branch '%s' has no commits yet, so there is no history to split", ErrNothingToSplit, branch)
+		}
+		return fmt.Errorf("%w: HEAD doesn't point at a commit, so there is no history to split", ErrNothingToSplit)
+	}
+	if errors.Is(err, git.ErrNotCommit) {
+		return fmt.Errorf("revision '%s' is not a commit", rev)
+	}
+
+	// Walking back further than the history goes is the usual mistake
+	tip, steps, ok := ancestorOf(rev)
+	if !ok {
+		return fmt.Errorf("revision '%s' not found", rev)
+	}
+	hash, err := e.resolveCommit(tip)
+	if err != nil {
+		return fmt.Errorf("revision '%s' not found", rev)
+	}
+	// Count the first-parent history of tip, stopping once it is longer
+	// than the walk
+	count := 0
+	for ; hash != "" && count <= steps; count++ {
+		parents, err := e.commitParents(hash)
+		if err != nil {
+			return fmt.Errorf("revision '%s' not found", rev)
+		}
+		hash = ""
+		if len(parents) > 0 {
+			hash = parents[0]
+		}
+	}
+	if count > steps {
+		return fmt.Errorf("revision '%s' not found", rev)
+	}
+	name := tip
+	if tip == "HEAD" || tip == "@" {
+		if branch := e.currentBranch(); branch != "" {
+			name = "the branch " + branch
+		}
+	}
+	commits := "commits"
+	if count == 1 {
+		commits = "commit"
+	}
+	return fmt.Errorf("revision '%s' not found — %s has only %d %s", rev, name, count, commits)
+}
+
+// currentBranch returns the short name of the checked-out branch, or "" when
+// HEAD is detached
+func (e *Extractor) currentBranch() string {
+	branch, err := e.history().CurrentBranch(e.ctx)
+	if err != nil {
+		return ""
+	}
+	return branch
+}
+
+// ancestorOf splits a revision like main~5 or HEAD^^ into the revision it
+// starts from and the number of first-parent steps it takes back. It reports
+// false for revisions that don't walk first parents.
+func ancestorOf(rev string) (string, int, bool) {
+	steps := 0
+	for {
+		i := strings.LastIndexAny(rev, "~^")
+		if i <= 0 {
+			break
+		}
+		suffix := rev[i+1:]
+		n := 1
+		if suffix != "" {
+			parsed, err := strconv.Atoi(suffix)
+			if err != nil || parsed < 0 {
+				break
+			}
+			n = parsed
+		}
+		// ^2 and beyond pick other parents of a merge
+		if rev[i] == '^' && n > 1 {
+			return "", 0, false
+		}
+		steps += n
+		rev = rev[:i]
+	}
+	return rev, steps, steps > 0
+}
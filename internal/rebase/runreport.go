@@ -0,0 +1,196 @@
+// ABOUTME: Machine-readable report of a completed run
+// ABOUTME: Maps every original commit to its rewritten commits, for re-stacking and changelog tooling
+
+package rebase
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// RunReport describes the outcome of a completed extraction
+type RunReport struct {
+	OriginalHead string          `json:"originalHead"`
+	NewHead      string          `json:"newHead"`
+	BackupBranch string          `json:"backupBranch,omitempty"`
+	Commits      []CommitMapping `json:"commits"`
+	Stats        RunStats        `json:"stats"`
+}
+
+// CommitMapping maps an original commit to the commits that replaced it.
+// Remaining holds everything except the target files (or the whole commit
+// when it wasn't split); Extracted holds the target files of a split.
+// A Dropped empty commit has no replacement of its own, and Remaining is
+// the commit before it, which now carries its tree.
+type CommitMapping struct {
+	Original  string `json:"original"`
+	Remaining string `json:"remaining"`
+	Extracted string `json:"extracted,omitempty"`
+	Split     bool   `json:"split"`
+	Dropped   bool   `json:"dropped,omitempty"`
+}
+
+// RunStats summarizes a run
+type RunStats struct {
+	Commits    int    `json:"commits"`
+	Split      int    `json:"split"`
+	Rewritten  int    `json:"rewritten"`
+	Dropped    int    `json:"dropped,omitempty"`
+	Engine     string `json:"engine"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// SetReportPath sets a file to write a RunReport to after a successful run;
+// "-" writes it to the regular output
+func (e *Extractor) SetReportPath(path string) {
+	e.reportPath = path
+}
+
+// SetReportFormat sets the format of the run report (json or markdown)
+func (e *Extractor) SetReportFormat(format string) error {
+	switch format {
+	case "json", "markdown":
+		e.reportFormat = format
+		return nil
+	default:
+		return fmt.Errorf("invalid report format %q: must be \"json\" or \"markdown\"", format)
+	}
+}
+
+// writeReport builds the report for a finished run and writes it to the report path
+func (e *Extractor) writeReport(base, originalHead, backupBranch, engine string, commits []CommitInfo, started time.Time) error {
+	if e.reportPath == "" {
+		return nil
+	}
+
+	newHead, err := e.resolveCommit("HEAD")
+	if err != nil {
+		return err
+	}
+	mappings, err := e.mapRewrittenCommits(base, commits)
+	if err != nil {
+		return fmt.Errorf("failed to map rewritten commits: %w", err)
+	}
+
+	report := RunReport{
+		OriginalHead: originalHead,
+		NewHead:      newHead,
+		BackupBranch: backupBranch,
+		Commits:      mappings,
+		Stats: RunStats{
+			Commits:    len(commits),
+			Engine:     engine,
+			DurationMS: time.Since(started).Milliseconds(),
+		},
+	}
+	for _, mapping := range mappings {
+		if mapping.Split {
+			report.Stats.Split++
+		}
+		if mapping.Dropped {
+			report.Stats.Dropped++
+		}
+		if mapping.Original != mapping.Remaining {
+			report.Stats.Rewritten++
+		}
+	}
+
+	var content []byte
+	if e.reportFormat == "markdown" {
+		content = []byte(e.renderMarkdown(report, commits))
+	} else {
+		if content, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+		content = append(content, '\n')
+	}
+
+	if e.reportPath == "-" {
+		if _, err := e.out.Write(content); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(e.reportPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// mapRewrittenCommits pairs the original commits with the new history in
+// base..HEAD. Splitting keeps every original tree as the tree of the commit
+// that replaces it (the second half, for split commits), which is checked
+// so a mismatch is reported rather than producing a wrong mapping.
+func (e *Extractor) mapRewrittenCommits(base string, commits []CommitInfo) ([]CommitMapping, error) {
+	newCommits, err := e.repo.RevList(e.ctx, base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := make([]CommitMapping, 0, len(commits))
+	next := 0
+	previous := base
+	take := func() (string, error) {
+		if next == len(newCommits) {
+			return "", fmt.Errorf("rewritten history has fewer commits than expected")
+		}
+		next++
+		return newCommits[next-1], nil
+	}
+
+	for _, commit := range commits {
+		mapping := CommitMapping{Original: commit.Hash, Split: commit.NeedsSplit}
+		dropped, err := e.dropsCommit(commit.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if dropped {
+			mapping.Remaining, mapping.Dropped = previous, true
+			mappings = append(mappings, mapping)
+			continue
+		}
+		first, err := take()
+		if err != nil {
+			return nil, err
+		}
+		mapping.Remaining = first
+		last := first
+		if commit.NeedsSplit {
+			if last, err = take(); err != nil {
+				return nil, err
+			}
+			mapping.Remaining, mapping.Extracted = first, last
+			if e.extractedFirst(commit) {
+				mapping.Remaining, mapping.Extracted = last, first
+			}
+		}
+
+		same, err := e.sameTree(commit.Hash, last)
+		if err != nil {
+			return nil, err
+		}
+		if !same {
+			return nil, fmt.Errorf("commit %s has no tree-identical counterpart in the rewritten history", commit.Hash[:7])
+		}
+		mappings = append(mappings, mapping)
+		previous = last
+	}
+	if next != len(newCommits) {
+		return nil, fmt.Errorf("rewritten history has more commits than expected")
+	}
+
+	return mappings, nil
+}
+
+// sameTree reports whether two commits record the same tree
+func (e *Extractor) sameTree(a, b string) (bool, error) {
+	output, err := e.repo.GitOutput(e.ctx, "rev-parse", a+"^{tree}", b+"^{tree}")
+	if err != nil {
+		return false, fmt.Errorf("failed to read trees of %s and %s: %w", a[:7], b[:7], err)
+	}
+	trees := strings.Fields(output)
+	return len(trees) == 2 && trees[0] == trees[1], nil
+}
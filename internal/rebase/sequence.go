@@ -0,0 +1,111 @@
+// ABOUTME: Sequence editor that marks the commit to split in git's own rebase todo
+// ABOUTME: Runs by re-executing the tool with a hidden flag as GIT_SEQUENCE_EDITOR, so no scripts are written to disk
+
+package rebase
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// SequenceEditorFlag is the hidden flag that makes the binary act as the
+// rebase sequence editor. git appends the todo file to edit, and the edit
+// itself is passed as JSON in SequenceTodoEnv.
+const SequenceEditorFlag = "sequence-editor-mode"
+
+// SequenceTodoEnv names the environment variable that tells the sequence
+// editor how to change the todo
+const SequenceTodoEnv = "GIT_REBASE_EXTRACT_FILE_TODO"
+
+// todoEdit is the change the sequence editor makes to git's rebase todo
+type todoEdit struct {
+	// Edit lists the commits whose picks become edits
+	Edit []string `json:"edit"`
+}
+
+// sequenceEditor returns the environment that has git stop at hash: the
+// GIT_SEQUENCE_EDITOR that re-executes the tool and the edit it applies
+func sequenceEditor(hash string) ([]string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate own executable: %w", err)
+	}
+	edit, err := json.Marshal(todoEdit{Edit: []string{hash}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the rebase todo edit: %w", err)
+	}
+	return []string{
+		"GIT_SEQUENCE_EDITOR=" + editorCommand(executable, filepath.Separator),
+		SequenceTodoEnv + "=" + string(edit),
+	}, nil
+}
+
+// editorCommand returns the command git runs to have executable edit the
+// todo. git runs the editor through its shell, the one bundled with Git for
+// Windows there, and appends the todo file path. That shell takes
+// C:/Program Files/... but would read the backslashes of C:\Program Files\...
+// as escapes outside quotes, so the path is given with forward slashes.
+func editorCommand(executable string, separator rune) string {
+	return fmt.Sprintf("%s --%s", shellQuote(toSlash(executable, separator)), SequenceEditorFlag)
+}
+
+// RunSequenceEditor implements SequenceEditorFlag. args hold the todo file
+// git asks to be edited, which is changed as SequenceTodoEnv describes.
+func RunSequenceEditor(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: --%s <todo-file>", SequenceEditorFlag)
+	}
+	todoPath := args[0]
+
+	var edit todoEdit
+	if err := json.Unmarshal([]byte(os.Getenv(SequenceTodoEnv)), &edit); err != nil {
+		return fmt.Errorf("failed to read the todo edit from %s: %w", SequenceTodoEnv, err)
+	}
+
+	content, err := os.ReadFile(todoPath) // #nosec G304 -- path is supplied by git rebase
+	if err != nil {
+		return fmt.Errorf("failed to read rebase todo: %w", err)
+	}
+	edited, err := editTodo(string(content), edit)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(todoPath, []byte(edited), 0644); err != nil {
+		return fmt.Errorf("failed to write rebase todo: %w", err)
+	}
+	return nil
+}
+
+// editTodo turns the picks of the commits edit names into edits, leaving
+// every other line as git wrote it. Every named commit has to be in the todo.
+func editTodo(todo string, edit todoEdit) (string, error) {
+	lines := strings.Split(todo, "\n")
+	marked := make([]bool, len(edit.Edit))
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "pick" && fields[0] != "p") {
+			continue
+		}
+		// git abbreviates the hashes in the todo
+		index := slices.IndexFunc(edit.Edit, func(hash string) bool { return strings.HasPrefix(hash, fields[1]) })
+		if index >= 0 {
+			lines[i] = "edit" + strings.TrimPrefix(line, fields[0])
+			marked[index] = true
+		}
+	}
+	for i, hash := range edit.Edit {
+		if !marked[i] {
+			return "", fmt.Errorf("commit %s is not in the rebase todo", hash)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// shellQuote quotes a string for safe use as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,80 @@
+// ABOUTME: Guard against silently turning signed commits into unsigned ones
+// ABOUTME: Re-signs rewritten commits when commit.gpgSign is set, and can refuse to rewrite when it isn't
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetRequireSignatures refuses to rewrite signed commits unless the commits
+// replacing them will be signed too, as branch protection requiring
+// verified commits expects
+func (e *Extractor) SetRequireSignatures(requireSignatures bool) {
+	e.requireSignatures = requireSignatures
+}
+
+// signingConfigured reports whether commit.gpgSign asks for new commits to
+// be signed. git rebase honors it by itself, but commit-tree needs -S.
+func (e *Extractor) signingConfigured() bool {
+	output, err := e.repo.GitOutput(e.ctx, "config", "--bool", "commit.gpgSign")
+	return err == nil && strings.TrimSpace(output) == "true"
+}
+
+// signedCommits returns the commits the rewrite would touch that carry a
+// GPG, SSH, or X.509 signature
+func (e *Extractor) signedCommits(commits []CommitInfo) ([]CommitInfo, error) {
+	var signed []CommitInfo
+	rewritten := false
+	for _, commit := range commits {
+		// Commits before the first split keep their hashes, and signatures
+		rewritten = rewritten || commit.NeedsSplit
+		if !rewritten {
+			continue
+		}
+		_, raw, err := e.repo.ReadObject(e.ctx, commit.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", commit.Hash[:7], err)
+		}
+		if isSigned(string(raw)) {
+			signed = append(signed, commit)
+		}
+	}
+	return signed, nil
+}
+
+// isSigned reports whether a raw commit object has a signature header
+func isSigned(raw string) bool {
+	header, _, _ := strings.Cut(raw, "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(line, "gpgsig ") || strings.HasPrefix(line, "gpgsig-sha256 ") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignatures warns about rewriting signed commits into unsigned ones
+// and refuses when signatures are required
+func (e *Extractor) checkSignatures(commits []CommitInfo) error {
+	signed, err := e.signedCommits(commits)
+	if err != nil || len(signed) == 0 {
+		return err
+	}
+	if e.sign {
+		e.verbosef("Signing the commits that replace %d signed commits (commit.gpgSign)\n", len(signed))
+		return nil
+	}
+
+	e.warnf("This will drop the signatures of %d signed commits, since commit.gpgSign isn't set:\n", len(signed))
+	for _, commit := range signed {
+		e.infof("  - %s %s\n", commit.Hash[:7], subject(commit.Message))
+	}
+	e.infof("\n")
+
+	if e.requireSignatures {
+		return fmt.Errorf("%w: the signatures of %d commits would be dropped; set commit.gpgSign (and user.signingKey) so the rewritten commits are signed, or leave out --require-signatures", ErrProtectedBranch, len(signed))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+// ABOUTME: User-configured commands run before and after each individual split
+// ABOUTME: Pass the original commit and the new commits and messages in GIT_EXTRACT_* variables
+
+package rebase
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetPreSplitCommand sets a shell command run before each commit is split.
+// It gets the original commit in GIT_EXTRACT_ORIGINAL and the target paths,
+// one per line, in GIT_EXTRACT_TARGETS; if it fails, the run stops.
+func (e *Extractor) SetPreSplitCommand(command string) {
+	e.preSplit = command
+}
+
+// SetPostSplitCommand sets a shell command run after each commit is split.
+// Besides what the pre-split command gets, GIT_EXTRACT_REMAINING and
+// GIT_EXTRACT_EXTRACTED hold the new commits and GIT_EXTRACT_REMAINING_MESSAGE
+// and GIT_EXTRACT_EXTRACTED_MESSAGE their messages. A failure is reported,
+// but the split stands.
+func (e *Extractor) SetPostSplitCommand(command string) {
+	e.postSplit = command
+}
+
+// runPreSplit runs the pre-split command, if any, for commit
+func (e *Extractor) runPreSplit(commit CommitInfo) error {
+	if e.preSplit == "" {
+		return nil
+	}
+	if err := e.runUserCommand(e.preSplit, e.splitEnv(commit)); err != nil {
+		return fmt.Errorf("pre-split command failed for %s: %w", commit.Hash[:7], err)
+	}
+	return nil
+}
+
+// runPostSplit runs the post-split command, if any, for the two commits
+// commit was split into, given in history order
+func (e *Extractor) runPostSplit(commit CommitInfo, first, second string) {
+	if e.postSplit == "" {
+		return
+	}
+	remaining, extracted := first, second
+	if e.extractedFirst(commit) {
+		remaining, extracted = second, first
+	}
+	env := e.splitEnv(commit)
+	for _, c := range []struct{ name, hash string }{{"REMAINING", remaining}, {"EXTRACTED", extracted}} {
+		meta, err := e.readCommitMeta(c.hash)
+		if err != nil {
+			e.warnf("Skipping post-split command for %s: %v\n", commit.Hash[:7], err)
+			return
+		}
+		env = append(env, "GIT_EXTRACT_"+c.name+"="+c.hash, "GIT_EXTRACT_"+c.name+"_MESSAGE="+strings.TrimRight(meta.message, "\n"))
+	}
+	if err := e.runUserCommand(e.postSplit, env); err != nil {
+		e.warnf("Post-split command failed for %s: %v\n", commit.Hash[:7], err)
+	}
+}
+
+// splitEnv returns our environment for children plus what every split command gets
+func (e *Extractor) splitEnv(commit CommitInfo) []string {
+	return append(git.Environ(),
+		"GIT_EXTRACT_ORIGINAL="+commit.Hash,
+		"GIT_EXTRACT_TARGETS="+strings.Join(e.targetFiles, "\n"),
+	)
+}
+
+// shellArgs returns the command line that runs command through the shell
+// of the operating system goos: sh elsewhere, as git runs hooks and rebase
+// --exec commands, and PowerShell on Windows, which has no sh of its own
+func shellArgs(goos, command string) []string {
+	if goos == "windows" {
+		return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", command}
+	}
+	return []string{"sh", "-c", command}
+}
+
+// runUserCommand runs command through the shell from the top of the
+// working tree
+func (e *Extractor) runUserCommand(command string, env []string) error {
+	top, err := e.repo.GitOutput(e.ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("failed to locate working tree: %w", err)
+	}
+
+	e.debug("running command", "command", command)
+	args := shellArgs(runtime.GOOS, command)
+	cmd := exec.CommandContext(e.ctx, args[0], args[1:]...) // #nosec G204 -- the command is the user's own
+	cmd.Dir = strings.TrimSpace(top)
+	cmd.Env = env
+	cmd.Stdout = e.errOut
+	cmd.Stderr = e.errOut
+	return cmd.Run()
+}
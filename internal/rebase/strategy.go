@@ -0,0 +1,193 @@
+// ABOUTME: Automatic conflict resolution during the rebase passes
+// ABOUTME: Replays rerere resolutions and applies an ours/theirs strategy to target files
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// SetStrategyOption sets how conflicts in target files are resolved automatically.
+// "ours" keeps the rewritten history's version and "theirs" keeps the version from
+// the commit being replayed, matching git rebase; "" stops for manual resolution.
+func (e *Extractor) SetStrategyOption(option string) error {
+	switch option {
+	case "", "ours", "theirs":
+		e.strategyOption = option
+		return nil
+	default:
+		return fmt.Errorf("invalid strategy option %q: must be \"ours\" or \"theirs\"", option)
+	}
+}
+
+// SetRerere enables or disables recording and replaying conflict resolutions
+// with git rerere across the rebase passes
+func (e *Extractor) SetRerere(rerere bool) {
+	e.rerere = rerere
+}
+
+// runRebase runs git rebase with args, resolving conflicts with rerere and
+// the configured strategy and continuing until the rebase stops or finishes
+func (e *Extractor) runRebase(env []string, args ...string) error {
+	options := git.RebaseOptions{Config: e.rebaseConfig(), Env: env}
+	if e.nonInteractive {
+		options.Env = append(slices.Clip(options.Env), "GIT_EDITOR=true")
+	}
+	if len(args) > 0 && args[0] == "--continue" {
+		e.record(ContinuedEvent{})
+	}
+	err := e.gitBackend.Rebase(e.ctx, options, args...)
+
+	lastStep := ""
+	for err != nil {
+		resolved, resolveErr := e.resolveTargetConflicts()
+		if resolveErr != nil {
+			return resolveErr
+		}
+		if !resolved {
+			// rerere may have staged every resolution already, leaving the
+			// rebase stopped without unmerged paths
+			step := e.rebaseStep()
+			if !e.rerere || step == "" || step == lastStep {
+				return err
+			}
+			files, listErr := e.conflictedFiles()
+			if listErr != nil || len(files) > 0 {
+				return err
+			}
+			lastStep = step
+			e.infof("Resolved conflicts using previous resolutions (rerere)\n")
+		}
+
+		e.record(ContinuedEvent{})
+		err = e.gitBackend.Rebase(e.ctx, git.RebaseOptions{Config: e.rebaseConfig(), Env: []string{"GIT_EDITOR=true"}}, "--continue")
+	}
+
+	return nil
+}
+
+// rebaseConfig returns the config overrides applied to every rebase command
+func (e *Extractor) rebaseConfig() []string {
+	var config []string
+	if e.rerere {
+		config = append(config, "rerere.enabled=true", "rerere.autoUpdate=true")
+	}
+	// Deferred hooks run once the rewrite is done
+	if e.deferHooks {
+		config = append(config, "core.hooksPath="+os.DevNull)
+	}
+	return config
+}
+
+// rebaseStep returns the number of the todo step the rebase stopped at
+func (e *Extractor) rebaseStep() string {
+	path, err := e.gitPath("rebase-merge/msgnum")
+	if err != nil {
+		return ""
+	}
+	content, err := os.ReadFile(path) // #nosec G304 -- path is inside the git directory
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
+
+// resolveTargetConflicts resolves the current conflicts if they are all in
+// target files and a strategy is configured, reporting whether it did so
+func (e *Extractor) resolveTargetConflicts() (bool, error) {
+	if e.strategyOption == "" {
+		return false, nil
+	}
+
+	files, err := e.conflictedFiles()
+	if err != nil || len(files) == 0 {
+		return false, err
+	}
+
+	analyzer := e.newAnalyzer()
+	for _, file := range files {
+		if !analyzer.isTargetFile(file) {
+			e.debug("conflict needs manual resolution", "file", file)
+			return false, nil
+		}
+	}
+
+	for _, file := range files {
+		e.debug("resolving conflict", "file", file, "strategy", e.strategyOption)
+		if err := e.resolveConflictFromStage(file); err != nil {
+			return false, fmt.Errorf("failed to resolve conflict in %s: %w", file, err)
+		}
+		e.infof("Resolved conflict in %s using %s\n", file, e.strategyOption)
+	}
+
+	return true, nil
+}
+
+// conflictedFiles returns the paths with unresolved merge conflicts
+func (e *Extractor) conflictedFiles() ([]string, error) {
+	cmd := e.repo.Command(e.ctx, "diff", "-z", "--name-only", "--diff-filter=U")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conflicted files: %w", err)
+	}
+	return git.SplitNul(string(output)), nil
+}
+
+// resolveConflictFromStage replaces the conflicted index entries of file with
+// the side chosen by the strategy option. It works on the index directly so
+// paths outside a sparse checkout resolve the same way as materialized ones
+func (e *Extractor) resolveConflictFromStage(file string) error {
+	stage := "2"
+	if e.strategyOption == "theirs" {
+		stage = "3"
+	}
+
+	cmd := e.repo.Command(e.ctx, "ls-files", "-u", "-z", "--", ":(literal)"+file)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to read conflict stages: %w", err)
+	}
+
+	// Dropping the path removes every stage; the chosen side, if it still
+	// has the file, is then added back at stage 0
+	indexInfo := fmt.Sprintf("0 %s\t%s\x00", nullOID, file)
+	resolved := false
+	for _, record := range git.SplitNul(string(output)) {
+		fields, path, ok := strings.Cut(record, "\t")
+		entry := strings.Fields(fields)
+		if ok && path == file && len(entry) == 3 && entry[2] == stage {
+			indexInfo += fmt.Sprintf("%s %s\t%s\x00", entry[0], entry[1], file)
+			resolved = true
+		}
+	}
+
+	cmd = e.repo.Command(e.ctx, "update-index", "-z", "--index-info")
+	cmd.Stdin = strings.NewReader(indexInfo)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to update index: %w, output: %s", err, string(output))
+	}
+
+	// Bring the working tree copy in line so the conflict markers don't linger
+	if !resolved {
+		// The chosen side deleted the file
+		top, err := e.workTree()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(top, file)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", file, err)
+		}
+		return nil
+	}
+	cmd = e.repo.Command(e.ctx, "checkout-index", "-f", "--", file)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to check out resolved file: %w, output: %s", err, string(output))
+	}
+	return nil
+}
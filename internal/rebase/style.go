@@ -0,0 +1,46 @@
+// ABOUTME: Terminal styling for Extractor output
+// ABOUTME: Applies ANSI colors and emoji glyphs only when enabled
+
+package rebase
+
+// ANSI SGR codes used in output
+const (
+	ansiBold   = "1"
+	ansiDim    = "2"
+	ansiRed    = "31"
+	ansiGreen  = "32"
+	ansiYellow = "33"
+	ansiCyan   = "36"
+)
+
+// style decides how output is decorated
+type style struct {
+	color bool
+	emoji bool
+}
+
+// SetColor enables or disables ANSI colors in output
+func (e *Extractor) SetColor(color bool) {
+	e.style.color = color
+}
+
+// SetEmoji enables or disables emoji glyphs in output
+func (e *Extractor) SetEmoji(emoji bool) {
+	e.style.emoji = emoji
+}
+
+// paint wraps text in an ANSI color when colors are enabled
+func (s style) paint(code, text string) string {
+	if !s.color {
+		return text
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
+
+// glyph returns an emoji followed by its spacing when emoji are enabled
+func (s style) glyph(emoji string) string {
+	if !s.emoji {
+		return ""
+	}
+	return emoji
+}
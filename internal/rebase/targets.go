@@ -0,0 +1,171 @@
+// ABOUTME: Detection of target paths that match nothing in the range
+// ABOUTME: Suggests near-miss paths so a typo doesn't silently leave every commit alone
+
+package rebase
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions caps the near-miss paths suggested for one target
+const maxSuggestions = 3
+
+// UnmatchedTarget is a target that matches no file changed in the range
+type UnmatchedTarget struct {
+	Target      string   `json:"target"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// String describes the unmatched target and its suggestions
+func (u UnmatchedTarget) String() string {
+	message := fmt.Sprintf("%s matches no file changed in the range", u.Target)
+	if len(u.Suggestions) > 0 {
+		message += fmt.Sprintf(" (did you mean %s?)", strings.Join(u.Suggestions, ", "))
+	}
+	return message
+}
+
+// SetStrictPaths makes a target that matches no file changed in the range an error rather than a warning
+func (e *Extractor) SetStrictPaths(strict bool) {
+	e.strictPaths = strict
+}
+
+// checkTargets warns about targets that match nothing in commits, or fails
+// with strict paths
+func (e *Extractor) checkTargets(commits []CommitInfo) error {
+	unmatched := e.unmatchedTargets(commits)
+	if len(unmatched) == 0 {
+		return nil
+	}
+	if e.strictPaths {
+		messages := make([]string, len(unmatched))
+		for i, target := range unmatched {
+			messages[i] = target.String()
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	for _, target := range unmatched {
+		e.warnf("%s\n", target)
+	}
+	return nil
+}
+
+// unmatchedTargets returns the targets that match no file changed by
+// commits under any of the names they were followed through
+func (e *Extractor) unmatchedTargets(commits []CommitInfo) []UnmatchedTarget {
+	return findUnmatchedTargets(e.targetFiles, e.followedNames, commits)
+}
+
+// findUnmatchedTargets returns the targets that match no file changed by
+// commits, by their own name or any of their other names in followed
+func findUnmatchedTargets(targets []string, followed map[string][]string, commits []CommitInfo) []UnmatchedTarget {
+	changed := make(map[string]bool)
+	for _, commit := range commits {
+		for _, file := range commit.Files {
+			changed[file] = true
+		}
+	}
+
+	var unmatched []UnmatchedTarget
+	for _, target := range targets {
+		matched := false
+		for _, commit := range commits {
+			// A file later turned into a directory still matches "dir/"
+			names := append([]string{target}, followed[target]...)
+			analyzer := &Analyzer{targetFiles: commitTargets(names, commit.Files)}
+			if slices.ContainsFunc(commit.Files, analyzer.isTargetFile) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, UnmatchedTarget{Target: target, Suggestions: suggestPaths(target, changed)})
+		}
+	}
+	return unmatched
+}
+
+// suggestPaths returns the changed paths that target was likely meant to
+// be: case differences, missing or extra leading directories, a directory
+// without its trailing slash, or a small typo. Directory targets are
+// compared with the directories of the changed files.
+func suggestPaths(target string, changed map[string]bool) []string {
+	isDir := strings.HasSuffix(target, "/")
+	candidates := make(map[string]bool)
+	for file := range changed {
+		if !isDir {
+			candidates[file] = true
+			continue
+		}
+		for dir := path.Dir(file); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			candidates[dir+"/"] = true
+		}
+	}
+
+	var suggestions []string
+	for candidate := range candidates {
+		if isNearMiss(target, candidate, isDir) {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+	// A directory given without its trailing slash only matches itself
+	if !isDir {
+		for file := range changed {
+			if strings.HasPrefix(file, target+"/") {
+				suggestions = append(suggestions, target+"/")
+				break
+			}
+		}
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		di, dj := editDistance(target, suggestions[i]), editDistance(target, suggestions[j])
+		if di != dj {
+			return di < dj
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return suggestions
+}
+
+// isNearMiss reports whether candidate is plausibly what target meant
+func isNearMiss(target, candidate string, isDir bool) bool {
+	lowerTarget, lowerCandidate := strings.ToLower(target), strings.ToLower(candidate)
+	switch {
+	case lowerTarget == lowerCandidate:
+		return true
+	case strings.HasSuffix(lowerCandidate, "/"+lowerTarget), strings.HasSuffix(lowerTarget, "/"+lowerCandidate):
+		return true
+	case !isDir && strings.EqualFold(path.Base(target), path.Base(candidate)):
+		return true
+	}
+	return editDistance(lowerTarget, lowerCandidate) <= 2
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,56 @@
+// ABOUTME: Per-run directory inside the git directory for temporary indexes and message files
+// ABOUTME: Removed when the run ends; directories left behind by killed runs are removed by the next run
+
+package rebase
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// tempDirName is the directory inside the git directory that holds the
+// temporary directory of each run
+const tempDirName = "extract-file-tmp"
+
+// createTempDir creates a uniquely named directory for the temporary files
+// of this run in gitDir, after removing those of earlier runs. The caller
+// holds the repository lock, so no run that made them can still be going.
+func (e *Extractor) createTempDir(gitDir string) error {
+	parent := filepath.Join(gitDir, tempDirName)
+	stale, err := os.ReadDir(parent)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read temporary directory: %w", err)
+	}
+	for _, entry := range stale {
+		e.debug("removing temporary files of an earlier run", "path", entry.Name())
+		if err := os.RemoveAll(filepath.Join(parent, entry.Name())); err != nil {
+			e.logWarn("failed to remove stale temporary files", err)
+		}
+	}
+
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(parent, "run-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	e.tempDir = dir
+	e.repo.SetTempDir(dir)
+	return nil
+}
+
+// removeTempDir removes the temporary directory of this run
+func (e *Extractor) removeTempDir() {
+	if e.tempDir == "" {
+		return
+	}
+	if err := os.RemoveAll(e.tempDir); err != nil {
+		e.logWarn("failed to remove temporary files", err)
+	}
+	// Only removed once no run is left using it
+	_ = os.Remove(filepath.Dir(e.tempDir))
+	e.tempDir = ""
+	e.repo.SetTempDir("")
+}
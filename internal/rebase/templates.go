@@ -0,0 +1,39 @@
+// ABOUTME: User-defined templates for the messages of split commits
+// ABOUTME: Expands placeholders for the original message and the extracted targets
+
+package rebase
+
+import "strings"
+
+// MessageTemplates replace the generated messages of split commits. Each
+// template may use {message} (the original message), {subject} (its first
+// line), {body} (everything after the subject), and {targets} (the
+// extracted paths). An empty template keeps the generated message.
+type MessageTemplates struct {
+	Remaining string
+	Extracted string
+}
+
+// SetMessageTemplates sets templates for the messages of split commits
+func (e *Extractor) SetMessageTemplates(templates MessageTemplates) {
+	e.templates = templates
+}
+
+// expandTemplate fills in the placeholders of a message template
+func expandTemplate(template, message string, targets []string) string {
+	subject, body, _ := strings.Cut(message, "\n")
+	return strings.NewReplacer(
+		"{message}", message,
+		"{subject}", subject,
+		"{body}", strings.TrimLeft(body, "\n"),
+		"{targets}", targetDescription(targets),
+	).Replace(template)
+}
+
+// targetDescription names the targets the way generated messages do
+func targetDescription(targets []string) string {
+	if len(targets) == 1 {
+		return targets[0]
+	}
+	return "target files"
+}
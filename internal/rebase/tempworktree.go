@@ -0,0 +1,79 @@
+// ABOUTME: Temporary worktree for splitting a branch that isn't checked out, such as in a bare repository
+// ABOUTME: Checks the branch out in a throwaway directory and removes it, with git's record of it, afterwards
+
+package rebase
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// TemporaryWorktree is a linked worktree with a branch checked out for a
+// single run, so the branch can be split in a bare repository, or without
+// touching the current checkout. Splitting in it updates the branch itself.
+type TemporaryWorktree struct {
+	// Dir is the top of the worktree, the directory to give NewExtractor
+	Dir string
+
+	repo *git.Repository
+}
+
+// AddTemporaryWorktree checks branch out in a new worktree of the
+// repository at repoDir, which may be bare
+func AddTemporaryWorktree(ctx context.Context, repoDir, branch string) (*TemporaryWorktree, error) {
+	repo := git.NewRepository(repoDir)
+	if _, err := repo.GitOutput(ctx, "rev-parse", "--verify", "-q", "refs/heads/"+branch); err != nil {
+		return nil, fmt.Errorf("no branch named %s", branch)
+	}
+	// Removal runs from the common git directory, which stays valid however
+	// the repository was found, GIT_DIR included
+	common, err := repo.GitOutput(ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory: %w", err)
+	}
+	common = strings.TrimSpace(common)
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(repoDir, common)
+	}
+
+	worktree := &TemporaryWorktree{repo: git.NewRepository(common)}
+	// A worktree left by a run that was killed would keep the branch taken
+	if err := worktree.prune(ctx); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "git-rebase-extract-worktree-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary worktree: %w", err)
+	}
+	cmd := repo.Command(ctx, "worktree", "add", "-q", dir, branch)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to check out %s in a temporary worktree: %w, output: %s", branch, err, string(output))
+	}
+	worktree.Dir = dir
+	return worktree, nil
+}
+
+// Remove deletes the worktree and has git forget it. The branch keeps what
+// the run did to it.
+func (w *TemporaryWorktree) Remove(ctx context.Context) error {
+	// git worktree remove needs git 2.17; deleting and pruning works on all
+	if err := os.RemoveAll(w.Dir); err != nil {
+		return fmt.Errorf("failed to remove temporary worktree: %w", err)
+	}
+	return w.prune(ctx)
+}
+
+// prune has git forget worktrees whose directories are gone
+func (w *TemporaryWorktree) prune(ctx context.Context) error {
+	if output, err := w.repo.Command(ctx, "worktree", "prune").CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w, output: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// ABOUTME: Handling of the trailers stacked-diff tools use to track commits
+// ABOUTME: Keeps them on the remaining commit and omits or regenerates them on the extracted one
+
+package rebase
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// stackTrailers are the trailers of ghstack, spr, and Gerrit that tie a
+// commit to a pull request or review; only one commit may carry each value
+var stackTrailers = []string{
+	"ghstack-source-id",
+	"Pull Request resolved",
+	"Pull-Request-resolved",
+	"Pull-Request",
+	"commit-id",
+	"Change-Id",
+}
+
+// SetStackTrailers sets what the extracted commit gets in place of the
+// original commit's stack trailers, which stay with the remaining commit:
+// "omit" leaves them out and "regenerate" gives it new identities where the
+// tool lets a commit pick its own (Change-Id, spr's commit-id)
+func (e *Extractor) SetStackTrailers(policy string) error {
+	switch policy {
+	case "omit", "regenerate":
+		e.stackTrailers = policy
+		return nil
+	default:
+		return fmt.Errorf("invalid stack trailer policy %q: must be \"omit\" or \"regenerate\"", policy)
+	}
+}
+
+// cutStackTrailers removes the stack trailers from the last paragraph of
+// message and returns the rest of the message and the removed lines
+func cutStackTrailers(original string) (string, []string) {
+	message := strings.TrimRight(original, "\n")
+	start := strings.LastIndex(message, "\n\n") + 2
+	if start == 1 {
+		// A single paragraph is only a subject
+		return original, nil
+	}
+
+	var kept, trailers []string
+	for _, line := range strings.Split(message[start:], "\n") {
+		if isStackTrailer(line) {
+			trailers = append(trailers, line)
+		} else {
+			kept = append(kept, line)
+		}
+	}
+	if len(trailers) == 0 {
+		return original, nil
+	}
+	if len(kept) == 0 {
+		return message[:start-2], trailers
+	}
+	return message[:start] + strings.Join(kept, "\n"), trailers
+}
+
+// isStackTrailer reports whether line is one of the stack trailers
+func isStackTrailer(line string) bool {
+	key, _, ok := strings.Cut(line, ":")
+	if !ok {
+		return false
+	}
+	for _, trailer := range stackTrailers {
+		if strings.EqualFold(strings.TrimSpace(key), trailer) {
+			return true
+		}
+	}
+	return false
+}
+
+// regenerateStackTrailers returns fresh identities for the trailers whose
+// values a commit may pick itself; the others are assigned by their tool on
+// the next submit
+func regenerateStackTrailers(trailers []string) []string {
+	var fresh []string
+	for _, line := range trailers {
+		key, _, _ := strings.Cut(line, ":")
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "change-id":
+			fresh = append(fresh, key+": I"+randomHex(20))
+		case "commit-id":
+			fresh = append(fresh, key+": "+randomHex(4))
+		}
+	}
+	return fresh
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	// crypto/rand.Read never returns an error
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// appendTrailers adds trailers to message as its last paragraph
+func appendTrailers(message string, trailers []string) string {
+	if len(trailers) == 0 {
+		return message
+	}
+	return strings.TrimRight(message, "\n") + "\n\n" + strings.Join(trailers, "\n")
+}
@@ -0,0 +1,80 @@
+// ABOUTME: Transcript of every action a run takes, as a sequence of typed events
+// ABOUTME: Lets tests check after the fact exactly what Extract did to the repository
+
+package rebase
+
+import "slices"
+
+// TranscriptEvent is one action in the transcript of a run. Kind names the
+// action: "analyzed", "edited-todo", "staged", "committed", "reset", or
+// "continued".
+type TranscriptEvent interface {
+	Kind() string
+}
+
+// AnalyzedEvent records the analysis of the range
+type AnalyzedEvent struct {
+	Commits []CommitInfo
+}
+
+// EditedTodoEvent records the start of an interactive rebase onto Onto
+// whose todo list was edited to stop at Commit
+type EditedTodoEvent struct {
+	Commit string
+	Onto   string
+}
+
+// StagedEvent records building Tree in a throwaway index from the tree of
+// Base, with Paths set to their state in another commit
+type StagedEvent struct {
+	Base  string
+	Tree  string
+	Paths []string
+}
+
+// CommittedEvent records the creation of a commit
+type CommittedEvent struct {
+	Commit  string
+	Tree    string
+	Parents []string
+	Message string
+}
+
+// ResetEvent records moving Ref from one commit to another
+type ResetEvent struct {
+	Ref  string
+	From string
+	To   string
+}
+
+// ContinuedEvent records a "git rebase --continue"
+type ContinuedEvent struct{}
+
+// Kind returns "analyzed"
+func (AnalyzedEvent) Kind() string { return "analyzed" }
+
+// Kind returns "edited-todo"
+func (EditedTodoEvent) Kind() string { return "edited-todo" }
+
+// Kind returns "staged"
+func (StagedEvent) Kind() string { return "staged" }
+
+// Kind returns "committed"
+func (CommittedEvent) Kind() string { return "committed" }
+
+// Kind returns "reset"
+func (ResetEvent) Kind() string { return "reset" }
+
+// Kind returns "continued"
+func (ContinuedEvent) Kind() string { return "continued" }
+
+// Transcript returns the actions the last call to Extract took, in order,
+// including those of a run that failed part way
+func (e *Extractor) Transcript() []TranscriptEvent {
+	return slices.Clone(e.transcript)
+}
+
+// record appends event to the transcript of the current run
+func (e *Extractor) record(event TranscriptEvent) {
+	e.transcript = append(e.transcript, event)
+}
@@ -0,0 +1,122 @@
+// ABOUTME: Checks after a rewrite that every file kept its exact content
+// ABOUTME: Catches blobs changed by line-ending conversion or clean/smudge filters
+
+package rebase
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+)
+
+// verifyRewrite checks that rewriting base..originalHead into base..HEAD
+// moved content around without changing it: the final trees match, and
+// every blob a new commit introduces at a path was already at that path in
+// the original range or in the base, with the same mode. Splits are built
+// from objects, never from the working tree, so a failure means something
+// rewrote file contents or modes.
+func (e *Extractor) verifyRewrite(base, originalHead string) error {
+	same, err := e.sameTree(originalHead, "HEAD")
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("the rewritten HEAD doesn't have the tree of %s", originalHead[:7])
+	}
+
+	original, err := e.introducedBlobs(base, originalHead)
+	if err != nil {
+		return err
+	}
+	rewritten, err := e.introducedBlobs(base, "HEAD")
+	if err != nil {
+		return err
+	}
+	for path, entries := range rewritten {
+		for entry := range entries {
+			if original[path][entry] {
+				continue
+			}
+			// Unchanged in the range, so it has to come from the base
+			if e.baseEntry(base, path) == entry {
+				continue
+			}
+			mode, oid, _ := strings.Cut(entry, " ")
+			return fmt.Errorf("%s has content or mode (%s blob %.7s) that isn't in the original history", path, mode, oid)
+		}
+	}
+	return nil
+}
+
+// baseEntry returns the "<mode> <oid>" entry of path in base, or "" if it
+// has none
+func (e *Extractor) baseEntry(base, path string) string {
+	output, err := e.repo.GitOutput(e.ctx, "ls-tree", "-z", "--full-tree", base, "--", path)
+	if err != nil {
+		return ""
+	}
+	// <mode> SP <type> SP <oid> TAB <path>
+	info, _, _ := strings.Cut(output, "\t")
+	fields := strings.Fields(info)
+	if len(fields) != 3 {
+		return ""
+	}
+	return fields[0] + " " + fields[2]
+}
+
+// introducedBlobs maps each path changed in from..to to the "<mode> <oid>"
+// entries the commits there set it to, including the results of merges
+func (e *Extractor) introducedBlobs(from, to string) (map[string]map[string]bool, error) {
+	output, err := e.repo.GitOutput(e.ctx, "log", "-m", "--raw", "--no-renames", "--no-abbrev", "-z", "--format=", from+".."+to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changes in %s..%s: %w", from, to, err)
+	}
+
+	blobs := make(map[string]map[string]bool)
+	records := git.SplitNul(output)
+	for i := 0; i+1 < len(records); i += 2 {
+		// :<old mode> <new mode> <old oid> <new oid> <status>, then the path
+		fields := strings.Fields(strings.TrimLeft(records[i], "\n"))
+		path := records[i+1]
+		// Deletions have an all-zero new oid
+		if len(fields) != 5 || strings.Trim(fields[3], "0") == "" {
+			continue
+		}
+		if blobs[path] == nil {
+			blobs[path] = make(map[string]bool)
+		}
+		blobs[path][fields[1]+" "+fields[3]] = true
+	}
+	return blobs, nil
+}
+
+// checkRewrite verifies the rewrite and undoes it if content changed. A
+// pre-commit hook may change what it commits on purpose, so with one
+// run on the split commits a mismatch is only a warning.
+func (e *Extractor) checkRewrite(base, originalHead string) error {
+	// Lost merges are undone even with a pre-commit hook
+	if err := e.checkMergesKept(base, originalHead); err != nil {
+		if resetErr := e.rollBack(originalHead); resetErr != nil {
+			return fmt.Errorf("the rewrite flattened merges (%v) and could not be undone: %w", err, resetErr)
+		}
+		return fmt.Errorf("the rewrite flattened merges, rewrite undone: %w", err)
+	}
+
+	err := e.verifyRewrite(base, originalHead)
+	if err == nil {
+		return nil
+	}
+	if !e.noVerify && !e.deferHooks {
+		if path, hookErr := e.hookPath("pre-commit"); hookErr == nil && path != "" {
+			e.warnf("The rewrite changed file contents, presumably through the pre-commit hook: %v\n", err)
+			return nil
+		}
+	}
+
+	// The working tree matches the rewritten HEAD, so this restores both
+	if resetErr := e.rollBack(originalHead); resetErr != nil {
+		return fmt.Errorf("the rewrite changed file contents (%v) and could not be undone: %w", err, resetErr)
+	}
+	return fmt.Errorf("the rewrite changed file contents, rewrite undone: %w", err)
+}
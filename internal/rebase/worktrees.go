@@ -0,0 +1,143 @@
+// ABOUTME: Detection of the current branch being checked out in another linked worktree
+// ABOUTME: Fails before rewriting, or rewrites a detached HEAD and leaves the branch to that worktree
+
+package rebase
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// worktree is a working tree of the repository and the branch checked out in it
+type worktree struct {
+	path   string
+	branch string
+}
+
+// WorktreeCollisionError reports that the branch being rewritten is also
+// checked out in another worktree, where git won't let it be updated
+type WorktreeCollisionError struct {
+	Branch   string
+	Worktree string
+}
+
+func (e *WorktreeCollisionError) Error() string {
+	return fmt.Sprintf("branch %s is also checked out in the worktree at %s, so git would refuse to update it partway through; "+
+		"switch that worktree to another branch, or rerun with --detach to rewrite a detached HEAD instead", e.Branch, e.Worktree)
+}
+
+// SetDetach rewrites a detached HEAD, leaving the branch alone, when the
+// current branch is also checked out in another worktree
+func (e *Extractor) SetDetach(detach bool) {
+	e.detach = detach
+}
+
+// worktrees lists the working trees of the repository
+func (e *Extractor) worktrees() ([]worktree, error) {
+	output, err := e.repo.GitOutput(e.ctx, "worktree", "list", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+	var trees []worktree
+	for _, line := range strings.Split(output, "\n") {
+		if path, ok := strings.CutPrefix(line, "worktree "); ok {
+			trees = append(trees, worktree{path: path})
+		} else if branch, ok := strings.CutPrefix(line, "branch "); ok && len(trees) > 0 {
+			trees[len(trees)-1].branch = branch
+		}
+	}
+	return trees, nil
+}
+
+// checkedOutBranches lists the branch refs checked out in any worktree
+func (e *Extractor) checkedOutBranches() ([]string, error) {
+	trees, err := e.worktrees()
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, tree := range trees {
+		if tree.branch != "" {
+			refs = append(refs, tree.branch)
+		}
+	}
+	return refs, nil
+}
+
+// worktreeCollision returns the other worktree the current branch is
+// checked out in, if any
+func (e *Extractor) worktreeCollision() (*WorktreeCollisionError, error) {
+	current, err := e.repo.GitOutput(e.ctx, "symbolic-ref", "-q", "HEAD")
+	if err != nil {
+		// A detached HEAD can't collide
+		return nil, nil
+	}
+	current = strings.TrimSpace(current)
+	top, err := e.repo.GitOutput(e.ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate working tree: %w", err)
+	}
+
+	main, err := e.inMainWorktree()
+	if err != nil {
+		return nil, err
+	}
+
+	trees, err := e.worktrees()
+	if err != nil {
+		return nil, err
+	}
+	for i, tree := range trees {
+		// git lists the main worktree first, at the git directory itself
+		// when GIT_DIR and GIT_WORK_TREE put the two apart
+		ours := samePath(tree.path, strings.TrimSpace(top)) || (i == 0 && main)
+		if tree.branch == current && !ours {
+			return &WorktreeCollisionError{Branch: strings.TrimPrefix(current, "refs/heads/"), Worktree: tree.path}, nil
+		}
+	}
+	return nil, nil
+}
+
+// inMainWorktree reports whether we run in the repository's main worktree
+// rather than a linked one, whose git directory is apart from the common one
+func (e *Extractor) inMainWorktree() (bool, error) {
+	gitDir, err := e.gitDir()
+	if err != nil {
+		return false, err
+	}
+	common, err := e.repo.GitOutput(e.ctx, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return false, fmt.Errorf("failed to locate common git directory: %w", err)
+	}
+	common = strings.TrimSpace(common)
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(e.repoDir, common)
+	}
+	return samePath(gitDir, common), nil
+}
+
+// detachHead detaches HEAD at its current commit without touching the
+// index or working tree
+func (e *Extractor) detachHead() error {
+	head, err := e.resolveCommit("HEAD")
+	if err != nil {
+		return err
+	}
+	cmd := e.repo.Command(e.ctx, "update-ref", "--no-deref", "-m", "git-rebase-extract-file: detach", "HEAD", head)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to detach HEAD: %w, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// samePath reports whether two paths name the same directory
+func samePath(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,156 @@
+// ABOUTME: Fixtures for the trickier histories: merges, renames, binary files, signatures, tags, and submodules
+// ABOUTME: Commits can be given their own author, dates, and signature
+
+package testutils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// CommitOptions sets who made a commit, when, and whether it is signed.
+// Zero fields keep the repository's defaults.
+type CommitOptions struct {
+	AuthorName    string
+	AuthorEmail   string
+	AuthorDate    time.Time
+	CommitterDate time.Time
+	// Sign signs the commit; call EnableSigning first
+	Sign bool
+}
+
+// CommitWith adds all files and creates a commit with the given message and options
+func (r *TestRepo) CommitWith(message string, opts CommitOptions) string {
+	r.t.Helper()
+
+	var env []string
+	if opts.AuthorName != "" {
+		env = append(env, "GIT_AUTHOR_NAME="+opts.AuthorName)
+	}
+	if opts.AuthorEmail != "" {
+		env = append(env, "GIT_AUTHOR_EMAIL="+opts.AuthorEmail)
+	}
+	if !opts.AuthorDate.IsZero() {
+		env = append(env, "GIT_AUTHOR_DATE="+gitDate(opts.AuthorDate))
+	}
+	if !opts.CommitterDate.IsZero() {
+		env = append(env, "GIT_COMMITTER_DATE="+gitDate(opts.CommitterDate))
+	}
+	args := []string{"commit", "-q", "-m", message}
+	if opts.Sign {
+		args = append(args, "-S")
+	}
+
+	r.runGit("add", ".")
+	r.runGitEnv(env, args...)
+	return r.GetCurrentHead()
+}
+
+// EnableSigning configures the repository to sign with a fresh SSH key, as
+// CommitWith does with Sign set. It skips the test if ssh-keygen is missing.
+func (r *TestRepo) EnableSigning() {
+	r.t.Helper()
+
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		r.t.Skip("ssh-keygen is needed to sign commits")
+	}
+	key := filepath.Join(r.t.TempDir(), "key")
+	if output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", key).CombinedOutput(); err != nil {
+		r.t.Fatalf("Failed to create a signing key: %v, output: %s", err, output)
+	}
+	r.runGit("config", "gpg.format", "ssh")
+	r.runGit("config", "user.signingKey", key+".pub")
+}
+
+// CommitSigned adds all files and creates a signed commit; call EnableSigning first
+func (r *TestRepo) CommitSigned(message string) string {
+	r.t.Helper()
+	return r.CommitWith(message, CommitOptions{Sign: true})
+}
+
+// Branch creates a branch at rev and checks it out
+func (r *TestRepo) Branch(name, rev string) {
+	r.t.Helper()
+	r.runGit("checkout", "-q", "-b", name, rev)
+}
+
+// Merge merges branches into the current branch with a merge commit, even
+// when a fast-forward is possible, and returns the merge commit
+func (r *TestRepo) Merge(message string, branches ...string) string {
+	r.t.Helper()
+
+	r.runGit(append([]string{"merge", "-q", "--no-ff", "-m", message}, branches...)...)
+	return r.GetCurrentHead()
+}
+
+// Rename renames a tracked file with git mv; commit it with Commit
+func (r *TestRepo) Rename(from, to string) {
+	r.t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(r.Dir, to)), 0755); err != nil {
+		r.t.Fatalf("Failed to create directory for %s: %v", to, err)
+	}
+	r.runGit("mv", from, to)
+}
+
+// WriteBinaryFile writes content git will treat as binary: size bytes
+// derived from seed, starting with a NUL byte
+func (r *TestRepo) WriteBinaryFile(path string, size int, seed byte) {
+	r.t.Helper()
+
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i) * seed
+	}
+	r.WriteFile(path, string(content))
+}
+
+// Tag tags rev, creating an annotated tag if message is set and a
+// lightweight one otherwise
+func (r *TestRepo) Tag(name, rev, message string) {
+	r.t.Helper()
+
+	if message == "" {
+		r.runGit("tag", name, rev)
+		return
+	}
+	r.runGit("tag", "-a", "-m", message, name, rev)
+}
+
+// AddSubmodule adds sub as a submodule at path and stages it; commit it
+// with Commit
+func (r *TestRepo) AddSubmodule(path string, sub *TestRepo) {
+	r.t.Helper()
+
+	// Local clones are refused by default since git 2.38.1
+	r.runGit("-c", "protocol.file.allow=always", "submodule", "add", "-q", "file://"+sub.Dir, path)
+}
+
+// AddWorktree adds a linked worktree with a new branch at HEAD and returns
+// it as a repository of its own, sharing this one's objects and refs
+func (r *TestRepo) AddWorktree(branch string) *TestRepo {
+	r.t.Helper()
+
+	dir := filepath.Join(r.t.TempDir(), branch)
+	r.runGit("worktree", "add", "-q", "-b", branch, dir)
+	return &TestRepo{Dir: dir, t: r.t}
+}
+
+// SeparateGitDir moves the git directory out of the working tree, leaving
+// a .git file pointing at it as git init --separate-git-dir does, and
+// returns its new location
+func (r *TestRepo) SeparateGitDir() string {
+	r.t.Helper()
+
+	gitDir := filepath.Join(r.t.TempDir(), "repo.git")
+	r.runGit("init", "-q", "--separate-git-dir", gitDir)
+	return gitDir
+}
+
+// gitDate formats t as git's raw date format, which keeps the time zone
+func gitDate(t time.Time) string {
+	return fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700"))
+}
@@ -0,0 +1,63 @@
+// ABOUTME: Synthetic history generator for benchmarks and large-range tests
+// ABOUTME: Fabricates commits with configurable counts, file counts, and target mix ratios
+
+package testutils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HistoryOptions configures a generated history
+type HistoryOptions struct {
+	// Commits is the number of commits generated after the base commit
+	Commits int
+	// Files is the number of non-target files in the repository
+	Files int
+	// MixRatio is the fraction of commits that touch the target alongside another file
+	MixRatio float64
+	// Target is the target file path; defaults to "target.txt"
+	Target string
+}
+
+// GenerateHistory creates a base commit followed by opts.Commits commits,
+// spreading the mixed commits evenly, and returns the base commit hash
+func (r *TestRepo) GenerateHistory(opts HistoryOptions) string {
+	r.t.Helper()
+
+	if opts.Files < 1 {
+		opts.Files = 1
+	}
+	if opts.Target == "" {
+		opts.Target = "target.txt"
+	}
+
+	for i := 0; i < opts.Files; i++ {
+		r.WriteFile(generatedFile(i), "package generated\n")
+	}
+	r.WriteFile(opts.Target, "revision 0\n")
+	base := r.Commit("Generated base commit")
+
+	var lines strings.Builder
+	for i := 0; i < opts.Commits; i++ {
+		file := generatedFile(i % opts.Files)
+		fmt.Fprintf(&lines, "// change %d\n", i)
+		r.WriteFile(file, "package generated\n\n"+lines.String())
+
+		// Mixed commits land wherever the running ratio crosses a whole number
+		mixed := int(float64(i+1)*opts.MixRatio) > int(float64(i)*opts.MixRatio)
+		if mixed {
+			r.WriteFile(opts.Target, fmt.Sprintf("revision %d\n", i+1))
+			r.Commit(fmt.Sprintf("Generated mixed commit %d", i))
+		} else {
+			r.Commit(fmt.Sprintf("Generated commit %d", i))
+		}
+	}
+
+	return base
+}
+
+// generatedFile returns the path of the i-th generated non-target file
+func generatedFile(i int) string {
+	return fmt.Sprintf("pkg%d/file%d.go", i%10, i)
+}
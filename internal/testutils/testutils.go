@@ -1,7 +1,10 @@
 // ABOUTME: Test utilities for git operations and repository setup
 // ABOUTME: Provides helper functions to create test repos with various commit scenarios
 
-// Package testutils provides testing utilities for git repository operations.
+// Package testutils provides testing utilities for git repository
+// operations. Its fixtures build real repositories, including merges,
+// renames, binary files, signed commits, tags, and submodules, for the
+// tests of this module.
 package testutils
 
 import (
@@ -15,11 +18,11 @@ import (
 // TestRepo represents a test git repository
 type TestRepo struct {
 	Dir string
-	t   *testing.T
+	t   testing.TB
 }
 
 // NewTestRepo creates a new temporary git repository for testing
-func NewTestRepo(t *testing.T) *TestRepo {
+func NewTestRepo(t testing.TB) *TestRepo {
 	t.Helper()
 
 	dir, err := os.MkdirTemp("", "git-rebase-extract-test-*")
@@ -29,6 +32,8 @@ func NewTestRepo(t *testing.T) *TestRepo {
 
 	repo := &TestRepo{Dir: dir, t: t}
 	repo.runGit("init")
+	// Every git release and init.defaultBranch setting starts on master
+	repo.runGit("symbolic-ref", "HEAD", "refs/heads/master")
 	repo.runGit("config", "user.name", "Test User")
 	repo.runGit("config", "user.email", "test@example.com")
 
@@ -39,6 +44,26 @@ func NewTestRepo(t *testing.T) *TestRepo {
 	return repo
 }
 
+// Clone clones the test repo into a new temporary repository, passing args
+// to git clone (e.g. "--filter=blob:none")
+func (r *TestRepo) Clone(args ...string) *TestRepo {
+	r.t.Helper()
+
+	dir, err := os.MkdirTemp("", "git-rebase-extract-clone-*")
+	if err != nil {
+		r.t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	r.t.Cleanup(func() {
+		_ = os.RemoveAll(dir) // Cleanup errors are not critical in tests
+	})
+
+	clone := &TestRepo{Dir: dir, t: r.t}
+	clone.runGit(append(append([]string{"clone", "-q"}, args...), "file://"+r.Dir, ".")...)
+	clone.runGit("config", "user.name", "Test User")
+	clone.runGit("config", "user.email", "test@example.com")
+	return clone
+}
+
 // WriteFile writes content to a file in the test repo
 func (r *TestRepo) WriteFile(path, content string) {
 	r.t.Helper()
@@ -97,36 +122,82 @@ func (r *TestRepo) GetCommitMessage(commit string) string {
 	return output
 }
 
-// GetCommitFiles returns the list of files changed in a commit
+// GetCommitFiles returns the files changed in a commit, with a rename listed
+// under its new name. A merge lists the changes from its first parent.
 func (r *TestRepo) GetCommitFiles(commit string) []string {
 	r.t.Helper()
 
-	output, err := r.gitOutput("show", "--name-only", "--format=", commit)
+	parents, err := r.gitOutput("rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		r.t.Fatalf("Failed to get commit parents: %v", err)
+	}
+	// show lists only the files a merge resolved, so diff against the
+	// first parent instead
+	args := []string{"show", "-z", "--name-only", "--format=", commit}
+	if len(strings.Fields(parents)) > 2 {
+		args = []string{"diff", "-z", "--name-only", commit + "^1", commit}
+	}
+	// The output isn't trimmed, which would eat spaces at the start of a path
+	output, err := r.gitRawOutput(args...)
 	if err != nil {
 		r.t.Fatalf("Failed to get commit files: %v", err)
 	}
 
-	if output == "" {
-		return []string{}
+	files := []string{}
+	for _, file := range strings.Split(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
 	}
+	return files
+}
+
+// Git runs an arbitrary git command in the test repo and returns its output
+func (r *TestRepo) Git(args ...string) string {
+	r.t.Helper()
 
-	return []string{output} // Simplified for now
+	output, err := r.gitOutput(args...)
+	if err != nil {
+		r.t.Fatalf("Git command failed: git %v, error: %v", args, err)
+	}
+
+	return output
 }
 
 // runGit executes a git command in the test repo
 func (r *TestRepo) runGit(args ...string) {
 	r.t.Helper()
+	r.runGitEnv(nil, args...)
+}
+
+// runGitEnv executes a git command in the test repo with env added to the
+// environment
+func (r *TestRepo) runGitEnv(env []string, args ...string) {
+	r.t.Helper()
 
 	cmd := exec.Command("git", args...)
 	cmd.Dir = r.Dir
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
-	if err := cmd.Run(); err != nil {
-		r.t.Fatalf("Git command failed: git %v, error: %v", args, err)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		r.t.Fatalf("Git command failed: git %v, error: %v, output: %s", args, err, output)
 	}
 }
 
 // gitOutput executes a git command and returns its output
 func (r *TestRepo) gitOutput(args ...string) (string, error) {
+	output, err := r.gitRawOutput(args...)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+// gitRawOutput executes a git command and returns its output as is
+func (r *TestRepo) gitRawOutput(args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
 	cmd.Dir = r.Dir
 
@@ -135,7 +206,7 @@ func (r *TestRepo) gitOutput(args ...string) (string, error) {
 		return "", err
 	}
 
-	return strings.TrimSpace(string(output)), nil
+	return string(output), nil
 }
 
 // GetCurrentHead returns the current HEAD commit hash
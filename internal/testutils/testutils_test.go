@@ -0,0 +1,100 @@
+// ABOUTME: Tests for the test repository fixtures
+// ABOUTME: Checks the histories they build and the files GetCommitFiles reports
+
+package testutils
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetCommitFiles(t *testing.T) {
+	repo := NewTestRepo(t)
+
+	repo.WriteFile("old.txt", "content\n")
+	repo.WriteFile("main.go", "package main\n")
+	base := repo.Commit("Initial commit")
+
+	repo.WriteFile(" leading space.txt", "content\n")
+	if files := repo.GetCommitFiles(repo.Commit("Add a file")); !slices.Equal(files, []string{" leading space.txt"}) {
+		t.Errorf("Expected the path to keep its leading space, got %q", files)
+	}
+
+	repo.Rename("old.txt", "docs/new.txt")
+	if files := repo.GetCommitFiles(repo.Commit("Rename")); !slices.Equal(files, []string{"docs/new.txt"}) {
+		t.Errorf("Expected the rename under its new name, got %q", files)
+	}
+
+	repo.Branch("side", base)
+	repo.WriteFile("side.go", "package side\n")
+	repo.Commit("Side change")
+	repo.Git("checkout", "-q", "-")
+	merge := repo.Merge("Merge side", "side")
+	if files := repo.GetCommitFiles(merge); !slices.Equal(files, []string{"side.go"}) {
+		t.Errorf("Expected the merge to list the changes from its first parent, got %q", files)
+	}
+}
+
+func TestCommitWith(t *testing.T) {
+	repo := NewTestRepo(t)
+
+	date := time.Date(2020, 2, 29, 12, 0, 0, 0, time.FixedZone("", 2*60*60))
+	repo.WriteFile("main.go", "package main\n")
+	commit := repo.CommitWith("Initial commit", CommitOptions{
+		AuthorName:    "Someone Else",
+		AuthorEmail:   "someone@example.com",
+		AuthorDate:    date,
+		CommitterDate: date.Add(time.Hour),
+	})
+
+	got := repo.Git("log", "-1", "--format=%an <%ae> %ai|%ci", commit)
+	if want := "Someone Else <someone@example.com> 2020-02-29 12:00:00 +0200|2020-02-29 13:00:00 +0200"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	sub := NewTestRepo(t)
+	sub.WriteFile("lib.go", "package lib\n")
+	sub.Commit("Library")
+
+	repo := NewTestRepo(t)
+	repo.WriteBinaryFile("logo.png", 100, 3)
+	repo.AddSubmodule("vendor/lib", sub)
+	commit := repo.Commit("Add a logo and a library")
+	repo.Tag("v1.0", commit, "Release 1.0")
+	repo.Tag("latest", commit, "")
+
+	if numstat := repo.Git("show", "--numstat", "--format=", commit, "--", "logo.png"); !strings.HasPrefix(numstat, "-\t-\t") {
+		t.Errorf("Expected logo.png to be binary, got %q", numstat)
+	}
+	if mode := repo.Git("ls-tree", commit, "vendor/lib"); !strings.HasPrefix(mode, "160000 commit ") {
+		t.Errorf("Expected vendor/lib to be a submodule, got %q", mode)
+	}
+	if kind := repo.Git("cat-file", "-t", "v1.0"); kind != "tag" {
+		t.Errorf("Expected v1.0 to be an annotated tag, got %s", kind)
+	}
+	if kind := repo.Git("cat-file", "-t", "latest"); kind != "commit" {
+		t.Errorf("Expected latest to be a lightweight tag, got %s", kind)
+	}
+
+	worktree := repo.AddWorktree("feature")
+	if branch := worktree.Git("symbolic-ref", "--short", "HEAD"); branch != "feature" {
+		t.Errorf("Expected the worktree on feature, got %s", branch)
+	}
+	if head := worktree.GetCurrentHead(); head != commit {
+		t.Errorf("Expected the worktree at %s, got %s", commit, head)
+	}
+
+	gitDir := repo.SeparateGitDir()
+	if got := repo.Git("rev-parse", "--absolute-git-dir"); got != gitDir {
+		t.Errorf("Expected the git directory at %s, got %s", gitDir, got)
+	}
+	if info, err := os.Stat(filepath.Join(repo.Dir, ".git")); err != nil || info.IsDir() {
+		t.Errorf("Expected .git to be a file, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// ABOUTME: Interactive multi-select of extraction targets
+// ABOUTME: Lists the files changed in a range, most often mixed first, for picking without git log spelunking
+
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/obra/git-rebase-extract-file/internal/rebase"
+)
+
+// pickerHeight is the number of files shown at once
+const pickerHeight = 15
+
+// picker is the bubbletea model of the target picker
+type picker struct {
+	candidates []rebase.FileCandidate
+	selected   map[int]bool
+	cursor     int
+	offset     int
+	confirmed  bool
+}
+
+// PickTargets lets the user choose targets among candidates. It returns the
+// chosen paths, in candidate order, or nil if the user quit.
+func PickTargets(candidates []rebase.FileCandidate) ([]string, error) {
+	final, err := tea.NewProgram(newPicker(candidates)).Run()
+	if err != nil {
+		return nil, fmt.Errorf("target picker failed: %w", err)
+	}
+	return final.(picker).chosen(), nil
+}
+
+// newPicker creates a picker with nothing selected
+func newPicker(candidates []rebase.FileCandidate) picker {
+	return picker{candidates: candidates, selected: make(map[int]bool)}
+}
+
+// Init implements tea.Model
+func (p picker) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (p picker) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return p, nil
+	}
+
+	switch key.String() {
+	case "up", "k":
+		if p.cursor > 0 {
+			p.cursor--
+		}
+	case "down", "j":
+		if p.cursor < len(p.candidates)-1 {
+			p.cursor++
+		}
+	case " ", "x":
+		if len(p.candidates) > 0 {
+			p.selected[p.cursor] = !p.selected[p.cursor]
+		}
+	case "enter":
+		p.confirmed = true
+		return p, tea.Quit
+	case "q", "esc", "ctrl+c":
+		return p, tea.Quit
+	}
+
+	// Keep the cursor inside the visible window
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	} else if p.cursor >= p.offset+pickerHeight {
+		p.offset = p.cursor - pickerHeight + 1
+	}
+	return p, nil
+}
+
+// View implements tea.Model
+func (p picker) View() string {
+	var b strings.Builder
+	if len(p.candidates) == 0 {
+		b.WriteString("No files changed in the range.\n\n")
+		b.WriteString(helpStyle.Render("q: quit") + "\n")
+		return b.String()
+	}
+
+	b.WriteString("Choose the files to extract (most often mixed with other changes first):\n\n")
+	end := min(p.offset+pickerHeight, len(p.candidates))
+	for i := p.offset; i < end; i++ {
+		candidate := p.candidates[i]
+		pointer, check := "  ", "[ ]"
+		if i == p.cursor {
+			pointer = cursorStyle.Render("> ")
+		}
+		if p.selected[i] {
+			check = "[x]"
+		}
+		fmt.Fprintf(&b, "%s%s %s %s\n", pointer, check, candidate.Path,
+			dimStyle.Render(fmt.Sprintf("(mixed in %d of %d commits)", candidate.MixedCommits, candidate.Commits)))
+	}
+	if len(p.candidates) > pickerHeight {
+		fmt.Fprintf(&b, "\n%s\n", dimStyle.Render(fmt.Sprintf("%d-%d of %d files", p.offset+1, end, len(p.candidates))))
+	}
+
+	b.WriteString("\n" + helpStyle.Render("space: select • enter: continue • q: quit") + "\n")
+	return b.String()
+}
+
+// chosen returns the selected paths, or nil if the picker wasn't confirmed
+func (p picker) chosen() []string {
+	if !p.confirmed {
+		return nil
+	}
+	var paths []string
+	for i, candidate := range p.candidates {
+		if p.selected[i] {
+			paths = append(paths, candidate.Path)
+		}
+	}
+	return paths
+}
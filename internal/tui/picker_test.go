@@ -0,0 +1,41 @@
+// ABOUTME: Tests for the interactive picker of extraction targets
+// ABOUTME: Covers selecting files, showing how often they are mixed, and quitting without a choice
+
+package tui
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/obra/git-rebase-extract-file/internal/rebase"
+)
+
+func testCandidates() []rebase.FileCandidate {
+	return []rebase.FileCandidate{
+		{Path: "go.sum", Commits: 3, MixedCommits: 3},
+		{Path: "main.go", Commits: 2, MixedCommits: 1},
+		{Path: "README.md", Commits: 1},
+	}
+}
+
+func TestPicker_SelectsTargets(t *testing.T) {
+	p := press(t, newPicker(testCandidates()), " ", "j", "j", "x", "enter")
+
+	if !p.confirmed {
+		t.Fatal("Expected enter to confirm the selection")
+	}
+	if got := p.chosen(); !slices.Equal(got, []string{"go.sum", "README.md"}) {
+		t.Errorf("Expected go.sum and README.md, got %v", got)
+	}
+	if !strings.Contains(p.View(), "mixed in 3 of 3 commits") {
+		t.Errorf("Expected the view to show how often a file is mixed, got:\n%s", p.View())
+	}
+}
+
+func TestPicker_QuitChoosesNothing(t *testing.T) {
+	p := press(t, newPicker(testCandidates()), " ", "q")
+	if p.confirmed {
+		t.Error("Expected q to quit without confirming")
+	}
+}
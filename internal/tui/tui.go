@@ -0,0 +1,256 @@
+// ABOUTME: Interactive terminal editor for the split plan
+// ABOUTME: Toggles splits, edits messages, and orders extracted commits before running
+
+// Package tui provides the interactive plan editor.
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textarea"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/obra/git-rebase-extract-file/internal/rebase"
+)
+
+// Result is the outcome of an editing session
+type Result struct {
+	// Overrides holds the edits, keyed by original commit hash
+	Overrides map[string]rebase.SplitOverride
+	// Confirmed is false when the user quit without applying the plan
+	Confirmed bool
+}
+
+// field identifies the message being edited
+type field int
+
+const (
+	fieldNone field = iota
+	fieldRemaining
+	fieldExtracted
+)
+
+var (
+	cursorStyle = lipgloss.NewStyle().Bold(true)
+	hashStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+	dimStyle    = lipgloss.NewStyle().Faint(true)
+	helpStyle   = lipgloss.NewStyle().Faint(true)
+)
+
+// model is the bubbletea model of the plan editor
+type model struct {
+	commits   []rebase.PlannedCommit
+	overrides map[string]rebase.SplitOverride
+	cursor    int
+	editing   field
+	editor    textarea.Model
+	confirmed bool
+}
+
+// Run shows the commits the report would split and lets the user edit the plan
+func Run(report *rebase.DryRunReport) (Result, error) {
+	final, err := tea.NewProgram(newModel(report)).Run()
+	if err != nil {
+		return Result{}, fmt.Errorf("plan editor failed: %w", err)
+	}
+	m := final.(model)
+	return Result{Overrides: m.overrides, Confirmed: m.confirmed}, nil
+}
+
+// newModel creates an editor for the commits that would be split
+func newModel(report *rebase.DryRunReport) model {
+	m := model{overrides: make(map[string]rebase.SplitOverride), editor: textarea.New()}
+	for _, commit := range report.Commits {
+		if commit.Split {
+			m.commits = append(m.commits, commit)
+		}
+	}
+	m.editor.ShowLineNumbers = false
+	m.editor.SetWidth(72)
+	return m
+}
+
+// Init implements tea.Model
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		if m.editing != fieldNone {
+			var cmd tea.Cmd
+			m.editor, cmd = m.editor.Update(msg)
+			return m, cmd
+		}
+		return m, nil
+	}
+	if m.editing != fieldNone {
+		return m.updateEditor(key)
+	}
+
+	switch key.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.commits)-1 {
+			m.cursor++
+		}
+	case " ", "x":
+		m.edit(func(o *rebase.SplitOverride) { o.Skip = !o.Skip })
+	case "o":
+		m.edit(func(o *rebase.SplitOverride) { o.ExtractedFirst = !o.ExtractedFirst })
+	case "e":
+		return m.startEditing(fieldRemaining)
+	case "E":
+		return m.startEditing(fieldExtracted)
+	case "enter", "y":
+		m.confirmed = true
+		return m, tea.Quit
+	case "q", "esc", "ctrl+c":
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// updateEditor handles keys while a message is being edited
+func (m model) updateEditor(key tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch key.String() {
+	case "ctrl+s":
+		value := strings.TrimSpace(m.editor.Value())
+		commit := m.commits[m.cursor]
+		m.edit(func(o *rebase.SplitOverride) {
+			// An unchanged or emptied message falls back to the generated one
+			if m.editing == fieldRemaining {
+				o.RemainingMessage = overrideValue(value, commit.RemainingMessage)
+			} else {
+				o.ExtractedMessage = overrideValue(value, commit.ExtractedMessage)
+			}
+		})
+		m.editing = fieldNone
+		m.editor.Blur()
+		return m, nil
+	case "esc":
+		m.editing = fieldNone
+		m.editor.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.editor, cmd = m.editor.Update(key)
+	return m, cmd
+}
+
+// startEditing opens the editor on a message of the selected commit
+func (m model) startEditing(f field) (tea.Model, tea.Cmd) {
+	if len(m.commits) == 0 || m.override().Skip {
+		return m, nil
+	}
+	remaining, extracted := m.messages(m.cursor)
+	m.editing = f
+	if f == fieldRemaining {
+		m.editor.SetValue(remaining)
+	} else {
+		m.editor.SetValue(extracted)
+	}
+	return m, m.editor.Focus()
+}
+
+// edit applies change to the override of the selected commit
+func (m *model) edit(change func(*rebase.SplitOverride)) {
+	if len(m.commits) == 0 {
+		return
+	}
+	override := m.override()
+	change(&override)
+	hash := m.commits[m.cursor].Hash
+	if override == (rebase.SplitOverride{}) {
+		delete(m.overrides, hash)
+	} else {
+		m.overrides[hash] = override
+	}
+}
+
+// override returns the current override of the selected commit
+func (m model) override() rebase.SplitOverride {
+	return m.overrides[m.commits[m.cursor].Hash]
+}
+
+// messages returns the remaining and extracted messages of a commit, with edits applied
+func (m model) messages(i int) (string, string) {
+	commit := m.commits[i]
+	override := m.overrides[commit.Hash]
+	remaining, extracted := commit.RemainingMessage, commit.ExtractedMessage
+	if override.RemainingMessage != "" {
+		remaining = override.RemainingMessage
+	}
+	if override.ExtractedMessage != "" {
+		extracted = override.ExtractedMessage
+	}
+	return remaining, extracted
+}
+
+// View implements tea.Model
+func (m model) View() string {
+	var b strings.Builder
+	if len(m.commits) == 0 {
+		b.WriteString("No commits need splitting.\n\n")
+		b.WriteString(helpStyle.Render("q: quit") + "\n")
+		return b.String()
+	}
+
+	b.WriteString("Planned splits:\n\n")
+	for i, commit := range m.commits {
+		override := m.overrides[commit.Hash]
+		pointer, check := "  ", "[x]"
+		if i == m.cursor {
+			pointer = cursorStyle.Render("> ")
+		}
+		if override.Skip {
+			check = "[ ]"
+		}
+		fmt.Fprintf(&b, "%s%s %s %s\n", pointer, check, hashStyle.Render(commit.Hash[:7]), subject(commit.Message))
+		if override.Skip {
+			continue
+		}
+
+		remaining, extracted := m.messages(i)
+		halves := []string{"remaining: " + subject(remaining), "extracted: " + subject(extracted)}
+		if override.ExtractedFirst {
+			halves[0], halves[1] = halves[1], halves[0]
+		}
+		fmt.Fprintf(&b, "      %s %s\n", dimStyle.Render("├─"), halves[0])
+		fmt.Fprintf(&b, "      %s %s\n", dimStyle.Render("└─"), halves[1])
+	}
+
+	b.WriteString("\n")
+	if m.editing != fieldNone {
+		name := "remaining"
+		if m.editing == fieldExtracted {
+			name = "extracted"
+		}
+		fmt.Fprintf(&b, "Editing the %s commit message:\n%s\n", name, m.editor.View())
+		b.WriteString(helpStyle.Render("ctrl+s: save • esc: cancel") + "\n")
+		return b.String()
+	}
+	b.WriteString(helpStyle.Render("space: toggle • e/E: edit remaining/extracted message • o: swap order • enter: apply • q: quit") + "\n")
+	return b.String()
+}
+
+// overrideValue returns value if it differs from the generated message
+func overrideValue(value, generated string) string {
+	if value == "" || value == generated {
+		return ""
+	}
+	return value
+}
+
+// subject returns the first line of a commit message
+func subject(message string) string {
+	first, _, _ := strings.Cut(message, "\n")
+	return first
+}
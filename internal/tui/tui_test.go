@@ -0,0 +1,100 @@
+// ABOUTME: Tests for the interactive plan editor, driven by simulated key presses
+// ABOUTME: Covers listing splits, toggling and reordering, editing messages, and quitting
+
+package tui
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/obra/git-rebase-extract-file/internal/rebase"
+)
+
+func testReport() *rebase.DryRunReport {
+	return &rebase.DryRunReport{Commits: []rebase.PlannedCommit{
+		{Hash: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Message: "First", Split: true,
+			RemainingMessage: "First\n\nsplit notice", ExtractedMessage: "a.txt: First"},
+		{Hash: "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Message: "Untouched"},
+		{Hash: "cccccccccccccccccccccccccccccccccccccccc", Message: "Second", Split: true,
+			RemainingMessage: "Second\n\nsplit notice", ExtractedMessage: "a.txt: Second"},
+	}}
+}
+
+func press[M tea.Model](t *testing.T, m M, keys ...string) M {
+	t.Helper()
+	for _, key := range keys {
+		var msg tea.KeyMsg
+		switch key {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "ctrl+s":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlS}
+		case "ctrl+u":
+			msg = tea.KeyMsg{Type: tea.KeyCtrlU}
+		case " ":
+			msg = tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(M)
+	}
+	return m
+}
+
+func TestModel_ListsOnlySplitCommits(t *testing.T) {
+	m := newModel(testReport())
+	if len(m.commits) != 2 {
+		t.Fatalf("Expected 2 split commits, got %d", len(m.commits))
+	}
+}
+
+func TestModel_TogglesAndReorders(t *testing.T) {
+	m := press(t, newModel(testReport()), " ", "j", "o", "enter")
+
+	if !m.confirmed {
+		t.Error("Expected enter to confirm the plan")
+	}
+	if !m.overrides["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"].Skip {
+		t.Error("Expected the first commit to be skipped")
+	}
+	if !m.overrides["cccccccccccccccccccccccccccccccccccccccc"].ExtractedFirst {
+		t.Error("Expected the second commit to put the extracted half first")
+	}
+
+	// Toggling back removes the override entirely
+	m = press(t, m, "k", " ")
+	if _, ok := m.overrides["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"]; ok {
+		t.Error("Expected toggling twice to drop the override")
+	}
+}
+
+func TestModel_EditsMessages(t *testing.T) {
+	m := press(t, newModel(testReport()), "E", "ctrl+u", "a.txt: Reworded", "ctrl+s")
+
+	if m.editing != fieldNone {
+		t.Fatal("Expected ctrl+s to close the editor")
+	}
+	override := m.overrides["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"]
+	if override.ExtractedMessage != "a.txt: Reworded" {
+		t.Errorf("Expected edited extracted message, got %q", override.ExtractedMessage)
+	}
+	if override.RemainingMessage != "" {
+		t.Errorf("Expected remaining message to stay generated, got %q", override.RemainingMessage)
+	}
+
+	// Cancelling discards the edit
+	m = press(t, m, "e", "ctrl+u", "Discarded", "esc")
+	if m.overrides["aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"].RemainingMessage != "" {
+		t.Error("Expected esc to discard the edit")
+	}
+}
+
+func TestModel_QuitDoesNotConfirm(t *testing.T) {
+	m := press(t, newModel(testReport()), " ", "q")
+	if m.confirmed {
+		t.Error("Expected q to quit without confirming")
+	}
+}
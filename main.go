@@ -5,20 +5,83 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
 
+	"github.com/obra/git-rebase-extract-file/internal/git"
 	"github.com/obra/git-rebase-extract-file/internal/rebase"
+	"github.com/obra/git-rebase-extract-file/internal/tui"
 	"github.com/spf13/cobra"
 )
 
 var (
-	dryRun bool
-	debug  bool
+	dryRun             bool
+	debug              bool
+	autostash          bool
+	strategyOption     string
+	emptyCommits       string
+	noRerere           bool
+	rewriteOthers      bool
+	requireSignatures  bool
+	noFastPath         bool
+	noProgress         bool
+	backend            string
+	format             string
+	reportPath         string
+	commitMap          string
+	quiet              bool
+	noColor            bool
+	noEmoji            bool
+	verbose            int
+	interactive        bool
+	planOut            string
+	applyPlan          string
+	showDiff           bool
+	graph              bool
+	explain            bool
+	strictPaths        bool
+	noVerify           bool
+	deferHooks         bool
+	sequenceEditorMode bool
+	copyNotes          string
+	annotateNotes      bool
+	mapNotes           bool
+	rebaseDeps         bool
+	detach             bool
+	preSplit           string
+	postSplit          string
+	execCommand        string
+	nonInteractive     bool
+	noFollow           bool
+	stackTrailers      string
+	debugLog           string
+	progressFormat     string
+	reportFile         string
+	reportFormat       string
+	directory          string
+	gitPath            string
+	branch             string
+	preset             string
+	profileName        string
+	backupPrefix       string
+	remainingTmpl      string
+	extractedTmpl      string
+	colorMode          string
+	confirm            bool
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "git-rebase-extract-file [--dry-run] [--debug] <previous-rev> <file-path> [file-path...]",
+	Use:   "git-rebase-extract-file [--dry-run] [--debug] [--autostash] <previous-rev> <file-path> [file-path...]",
 	Short: "Split commits by extracting changes to specified files/directories",
 	Long: `git-rebase-extract-file performs an interactive rebase that automatically
 splits commits containing changes to specified files or directories. The changes to the target
@@ -27,19 +90,182 @@ files are extracted into separate commits while preserving all original metadata
 Examples:
   git-rebase-extract-file main~5 src/component.tsx
   git-rebase-extract-file main~5 src/component1.tsx src/component2.tsx
-  git-rebase-extract-file main~5 src/components/ lib/utils.ts`,
-	Args: cobra.MinimumNArgs(2),
+  git-rebase-extract-file main~5 src/components/ lib/utils.ts
+  git-rebase-extract-file --dry-run --plan-out plan.json main~5 src/component.tsx
+  git-rebase-extract-file --apply-plan plan.json`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		// A plan file carries its own revision and paths
+		if applyPlan != "" {
+			return cobra.NoArgs(cmd, args)
+		}
+		// The revision may come from rebaseExtract.base and the paths from a
+		// preset or profile, which are only known once they have been read
+		return nil
+	},
 	RunE: run,
 }
 
 func init() {
+	rootCmd.PersistentFlags().StringVarP(&directory, "directory", "C", "", "Run as if started in this directory, like git -C")
+	rootCmd.PersistentFlags().StringVar(&gitPath, "git-path", "", "The git binary to run (default: git in GIT_EXEC_PATH, then in PATH)")
 	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Preview what would be done without making changes")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors")
+	rootCmd.Flags().CountVarP(&verbose, "verbose", "v", "Print each decision and rewritten commit (repeat for debug output)")
+	rootCmd.Flags().StringVar(&colorMode, "color", "auto", "When to color output (auto|always|never)")
+	rootCmd.Flags().BoolVar(&noColor, "no-color", false, "Disable colored output (also disabled by NO_COLOR or when not writing to a terminal)")
+	rootCmd.Flags().BoolVar(&noEmoji, "no-emoji", false, "Don't decorate output with emoji")
 	rootCmd.Flags().BoolVar(&debug, "debug", false, "Enable detailed debug output")
+	rootCmd.Flags().StringVar(&debugLog, "debug-log", "", "Write a JSON-lines record of every git command run to this file")
+	rootCmd.Flags().BoolVar(&autostash, "autostash", false, "Stash uncommitted changes before the rebase and reapply them afterwards")
+	rootCmd.Flags().StringVar(&strategyOption, "strategy-option", "", "Resolve conflicts in target files automatically (ours|theirs)")
+	rootCmd.Flags().StringVar(&emptyCommits, "empty-commits", "keep", "What to do with commits in the range that change nothing (keep|drop)")
+	rootCmd.Flags().BoolVar(&strictPaths, "strict-paths", false, "Fail instead of warning when a target matches no file changed in the range")
+	rootCmd.Flags().BoolVar(&rewriteOthers, "rewrite-others", false, "Allow rewriting commits authored by someone other than the configured user")
+	rootCmd.Flags().BoolVar(&requireSignatures, "require-signatures", false, "Refuse to rewrite signed commits unless commit.gpgSign is set to re-sign them")
+	rootCmd.Flags().StringVar(&progressFormat, "progress", "text", "Progress output (text|json); json emits line-delimited events on stdout")
+	rootCmd.Flags().BoolVar(&noProgress, "no-progress", false, "Don't report split progress and estimated time remaining")
+	rootCmd.Flags().BoolVar(&noFastPath, "no-fast-path", false, "Always split through an interactive rebase, even when no conflicts are predicted")
+	rootCmd.Flags().StringVar(&backend, "backend", "exec", "Backend for reading history during analysis (exec|go-git); a go-git dry run doesn't need git")
+	rootCmd.Flags().StringVar(&format, "format", "text", "Output format for --dry-run (text|json|markdown)")
+	rootCmd.Flags().StringVar(&reportFile, "report-file", "", "Also write everything printed to this file, without colors")
+	rootCmd.Flags().StringVar(&commitMap, "commit-map", "", "Write the old-to-new commit mapping to this file in git filter-repo's commit-map format")
+	rootCmd.Flags().StringVar(&reportPath, "report", "", "Write a report mapping original commits to rewritten ones to this file (- for stdout)")
+	rootCmd.Flags().StringVar(&reportFormat, "report-format", "json", "Format of the --report file (json|markdown)")
+	rootCmd.Flags().BoolVar(&interactive, "tui", false, "Review and edit the plan interactively before running it")
+	rootCmd.Flags().BoolVar(&showDiff, "show-diff", false, "With --dry-run, show the patch of both commits of every split")
+	rootCmd.Flags().BoolVar(&explain, "explain", false, "With --dry-run, list every commit with the reason it is split or skipped")
+	rootCmd.Flags().BoolVar(&graph, "graph", false, "With --dry-run, show the commit graph before and after the rewrite")
+	rootCmd.Flags().StringVar(&planOut, "plan-out", "", "With --dry-run, write the plan to this file for review and editing")
+	rootCmd.Flags().StringVar(&applyPlan, "apply-plan", "", "Carry out a plan written by --plan-out, if the repository hasn't moved since")
+	rootCmd.Flags().BoolVar(&noVerify, "no-verify", false, "Don't run the pre-commit and commit-msg hooks for split commits")
+	rootCmd.Flags().BoolVar(&deferHooks, "defer-hooks", false, "Hold hooks back while splitting and run pre-commit once on the result; commit-msg still runs for every split commit")
+	rootCmd.Flags().StringVar(&copyNotes, "copy-notes", "both", "Which half of a split gets the original commit's git notes (both|remaining|extracted|none)")
+	rootCmd.Flags().BoolVar(&annotateNotes, "annotate-notes", false, "Add the original commit's hash to every copied note")
+	rootCmd.Flags().BoolVar(&mapNotes, "map-notes", false, "Note the original commit of every new commit under "+rebase.MapNotesRef)
+	rootCmd.Flags().BoolVar(&rebaseDeps, "rebase-dependents", false, "Move other local branches built on rewritten commits onto the new history")
+	rootCmd.Flags().BoolVar(&detach, "detach", false, "Rewrite a detached HEAD when the branch is also checked out in another worktree")
+	rootCmd.Flags().StringVar(&preSplit, "pre-split", "", "Shell command run before each commit is split; the run stops if it fails")
+	rootCmd.Flags().StringVar(&postSplit, "post-split", "", "Shell command run after each commit is split, with the new commits in GIT_EXTRACT_* variables")
+	rootCmd.Flags().StringVarP(&execCommand, "exec", "x", "", "Shell command that must succeed on every commit a split creates; the rewrite is undone if it fails")
+	rootCmd.Flags().BoolVar(&noFollow, "no-follow", false, "Don't follow target files through renames in the range")
+	rootCmd.Flags().BoolVar(&noRerere, "no-rerere", false, "Don't record and replay conflict resolutions with git rerere")
+	rootCmd.Flags().StringVar(&profileName, "profile", "", "Use a profile from .git-rebase-extract.yaml at the repository root")
+	rootCmd.Flags().StringVar(&preset, "preset", "", "Use the paths and settings of a rebaseExtract.<name> git config section")
+	rootCmd.Flags().StringVar(&backupPrefix, "backup-prefix", "", "Name backup branches <prefix><branch>-<pid>")
+	rootCmd.Flags().StringVar(&remainingTmpl, "remaining-template", "", "Message template for the commit without the targets ({message}, {subject}, {body}, {targets})")
+	rootCmd.Flags().StringVar(&extractedTmpl, "extracted-template", "", "Message template for the commit with only the targets ({message}, {subject}, {body}, {targets})")
+	rootCmd.Flags().StringVar(&stackTrailers, "stack-trailers", "omit", "What the extracted commit gets for ghstack/spr/Gerrit trailers, which stay on the remaining commit (omit|regenerate)")
+	rootCmd.Flags().BoolVar(&nonInteractive, "non-interactive", false, "Never prompt or open an editor; on conflicts, roll back and exit with status 3")
+	rootCmd.Flags().BoolVar(&confirm, "confirm", false, "Show the plan and ask before rewriting")
+	rootCmd.Flags().StringVar(&branch, "branch", "", "Split this branch in a temporary worktree rather than the current checkout; required in a bare repository")
+
+	// git runs us with this flag as the rebase sequence editor while splitting
+	rootCmd.Flags().BoolVar(&sequenceEditorMode, rebase.SequenceEditorFlag, false, "Edit the rebase todo file given as the argument")
+	_ = rootCmd.Flags().MarkHidden(rebase.SequenceEditorFlag)
 }
 
-func run(_ *cobra.Command, args []string) error {
-	previousRev := args[0]
-	filePaths := args[1:]
+func run(cmd *cobra.Command, args []string) error {
+	if sequenceEditorMode {
+		return rebase.RunSequenceEditor(args)
+	}
+	if err := changeDirectory(); err != nil {
+		return err
+	}
+	if err := absoluteGitEnv(); err != nil {
+		return err
+	}
+	// Read the config with the git chosen on the command line, too
+	if gitPath != "" {
+		if err := git.SetExecutable(gitPath); err != nil {
+			return err
+		}
+	}
+
+	// Fill in unset flags from the profile, then the preset, then from
+	// rebaseExtract.* itself
+	config, err := loadGitConfig(cmd.Context())
+	if err != nil {
+		return err
+	}
+	var presetPaths []string
+	var profileGroups [][]string
+	if profileName != "" {
+		profile, err := loadProfile(cmd.Context(), profileName)
+		if err != nil {
+			return err
+		}
+		if err := profile.Settings.applyTo(cmd.Flags(), ""); err != nil {
+			return err
+		}
+		if base, ok := profile.Settings.get("base"); ok {
+			config["base"] = append(config["base"], base)
+		}
+		presetPaths = append(presetPaths, profile.Paths...)
+		profileGroups = profile.Groups
+	}
+	if preset != "" {
+		if !config.hasSection(preset) {
+			return fmt.Errorf("unknown preset %q: configure it with git config rebaseExtract.%s.path <path>", preset, preset)
+		}
+		if err := config.applyTo(cmd.Flags(), preset+"."); err != nil {
+			return err
+		}
+		presetPaths = append(presetPaths, config[preset+".path"]...)
+	}
+	if err := config.applyTo(cmd.Flags(), ""); err != nil {
+		return err
+	}
+	if !withoutGit() {
+		if err := useGit(cmd.Context()); err != nil {
+			return err
+		}
+	}
+
+	var plan *rebase.Plan
+	var previousRev string
+	var filePaths []string
+	// Each group of paths is extracted in a pass of its own
+	var groups [][]string
+	if applyPlan != "" {
+		plan, err = rebase.LoadPlan(applyPlan)
+		if err != nil {
+			return err
+		}
+		previousRev, filePaths = plan.Base, plan.Targets
+	} else {
+		previousRev, filePaths, err = resolveArgs(cmd, args, config, presetPaths)
+		if err != nil {
+			return err
+		}
+		if len(profileGroups) > 0 {
+			if len(filePaths) > 0 {
+				return fmt.Errorf("profile %s groups its paths, so no other paths can be given", profileName)
+			}
+			for _, group := range profileGroups {
+				paths := make([]string, len(group))
+				for i, path := range group {
+					paths[i] = rebase.TargetPath(path)
+				}
+				groups = append(groups, paths)
+			}
+			filePaths = groups[0]
+		}
+		if len(filePaths) == 0 {
+			if nonInteractive {
+				return fmt.Errorf("no paths to extract given")
+			}
+			if filePaths, err = pickTargets(cmd.Context(), previousRev); err != nil {
+				return err
+			}
+			if len(filePaths) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "Aborted, no changes made")
+				return nil
+			}
+		}
+	}
+	if len(groups) == 0 {
+		groups = [][]string{filePaths}
+	}
 
 	// Get current working directory
 	wd, err := os.Getwd()
@@ -47,24 +273,451 @@ func run(_ *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get working directory: %w", err)
 	}
 
+	ctx := cmd.Context()
+	if branch == "" && !withoutGit() && isBareRepository(ctx) {
+		return fmt.Errorf("this is a bare repository; name the branch to split with --branch")
+	}
+	if branch != "" {
+		worktree, err := rebase.AddTemporaryWorktree(ctx, wd, branch)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			// Clean up even after Ctrl-C
+			if err := worktree.Remove(context.WithoutCancel(ctx)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}()
+		wd = worktree.Dir
+		// git finds the worktree's own git directory from its .git file;
+		// GIT_DIR would still point at the repository itself
+		for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+			if err := os.Unsetenv(name); err != nil {
+				return fmt.Errorf("failed to unset %s: %w", name, err)
+			}
+		}
+	}
+
 	extractor := rebase.NewExtractor(wd, filePaths...)
-	extractor.SetDebug(debug)
+	defer func() {
+		_ = extractor.Close() // The cat-file process exits with us regardless
+	}()
 
-	if dryRun {
-		output, err := extractor.DryRun(previousRev, "HEAD")
+	// Duplicate human output to the report file, leaving the terminal as is
+	var stdout io.Writer = os.Stdout
+	var stderr io.Writer = os.Stderr
+	if reportFile != "" {
+		file, err := os.Create(reportFile)
 		if err != nil {
-			return fmt.Errorf("dry run failed: %w", err)
+			return fmt.Errorf("failed to create report file: %w", err)
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		plain := plainWriter{file}
+		stdout = io.MultiWriter(os.Stdout, plain)
+		stderr = io.MultiWriter(os.Stderr, plain)
+		extractor.SetOutput(stdout)
+		extractor.SetErrorOutput(stderr)
+	}
+	if debugLog != "" {
+		log, err := git.OpenCommandLog(debugLog)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = log.Close()
+		}()
+		extractor.SetCommandLog(log)
+	}
+	switch progressFormat {
+	case "text":
+	case "json":
+		if dryRun || interactive || verbose > 0 || debug {
+			return fmt.Errorf("--progress=json can't be combined with --dry-run, --tui, --verbose, or --debug")
+		}
+		// Keep stdout clean for the event stream; errors still go to stderr
+		extractor.SetEventStream(os.Stdout)
+		quiet = true
+	default:
+		return fmt.Errorf("invalid progress format %q: must be \"text\" or \"json\"", progressFormat)
+	}
+	switch {
+	case quiet && (verbose > 0 || debug):
+		return fmt.Errorf("--quiet can't be combined with --verbose or --debug")
+	case quiet:
+		extractor.SetVerbosity(rebase.VerbosityQuiet)
+	case debug || verbose > 1:
+		extractor.SetVerbosity(rebase.VerbosityDebug)
+		// The debug trace, including every git command, goes to stderr
+		extractor.SetLogger(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	case verbose == 1:
+		extractor.SetVerbosity(rebase.VerbosityVerbose)
+	}
+	extractor.SetAutostash(autostash)
+	extractor.SetRerere(!noRerere)
+	extractor.SetRewriteOthers(rewriteOthers)
+	extractor.SetRequireSignatures(requireSignatures)
+	extractor.SetFastPath(!noFastPath)
+	extractor.SetProgress(!noProgress)
+	switch colorMode {
+	case "auto", "always", "never", "true", "false":
+	default:
+		return fmt.Errorf("invalid color mode %q: must be \"auto\", \"always\", or \"never\"", colorMode)
+	}
+	extractor.SetColor(useColor())
+	extractor.SetEmoji(!noEmoji)
+	extractor.SetReportPath(reportPath)
+	extractor.SetCommitMapPath(commitMap)
+	extractor.SetBackupPrefix(backupPrefix)
+	extractor.SetMessageTemplates(rebase.MessageTemplates{Remaining: remainingTmpl, Extracted: extractedTmpl})
+	if err := extractor.SetReportFormat(reportFormat); err != nil {
+		return err
+	}
+
+	switch backend {
+	case "exec":
+	case "go-git":
+		repo, err := git.OpenGoGit(wd)
+		if err != nil {
+			return err
+		}
+		extractor.SetBackend(repo)
+		extractor.SetWithoutGit(withoutGit())
+	default:
+		return fmt.Errorf("invalid backend %q: must be \"exec\" or \"go-git\"", backend)
+	}
+	if err := extractor.SetStrategyOption(strategyOption); err != nil {
+		return err
+	}
+	if err := extractor.SetEmptyCommits(emptyCommits); err != nil {
+		return err
+	}
+	if err := extractor.SetStackTrailers(stackTrailers); err != nil {
+		return err
+	}
+	if err := extractor.SetCopyNotes(copyNotes); err != nil {
+		return err
+	}
+	extractor.SetAnnotateNotes(annotateNotes)
+	extractor.SetMapNotes(mapNotes)
+	extractor.SetRebaseDependents(rebaseDeps)
+	extractor.SetDetach(detach)
+	extractor.SetPreSplitCommand(preSplit)
+	extractor.SetPostSplitCommand(postSplit)
+	extractor.SetExec(execCommand)
+	// Nobody can resolve conflicts in a worktree that is about to be removed
+	extractor.SetNonInteractive(nonInteractive || branch != "")
+	extractor.SetFollow(!noFollow)
+
+	switch format {
+	case "text":
+	case "json", "markdown":
+		if !dryRun {
+			return fmt.Errorf("--format=%s is only supported with --dry-run", format)
 		}
-		fmt.Print(output)
+	default:
+		return fmt.Errorf("invalid format %q: must be \"text\", \"json\", or \"markdown\"", format)
+	}
+
+	if planOut != "" && !dryRun {
+		return fmt.Errorf("--plan-out is only supported with --dry-run")
+	}
+	if showDiff && !dryRun {
+		return fmt.Errorf("--show-diff is only supported with --dry-run")
+	}
+	extractor.SetShowDiff(showDiff)
+	if explain && !dryRun {
+		return fmt.Errorf("--explain is only supported with --dry-run")
+	}
+	extractor.SetExplain(explain)
+	extractor.SetStrictPaths(strictPaths)
+	extractor.SetNoVerify(noVerify)
+	extractor.SetDeferHooks(deferHooks)
+	if graph && (!dryRun || format != "text") {
+		return fmt.Errorf("--graph is only supported with --dry-run and text output")
+	}
+	if plan != nil {
+		if err := extractor.UsePlan(ctx, plan); err != nil {
+			return err
+		}
+	}
+
+	if len(groups) > 1 && (interactive || planOut != "" || format != "text" || graph) {
+		return fmt.Errorf("--tui, --plan-out, --format, and --graph can't be combined with profile %s, which groups its paths", profileName)
+	}
+	if interactive {
+		if dryRun || plan != nil || nonInteractive {
+			return fmt.Errorf("--tui can't be combined with --dry-run, --apply-plan, or --non-interactive")
+		}
+		report, err := extractor.DryRun(ctx, previousRev, "HEAD")
+		if err != nil {
+			return fmt.Errorf("failed to plan splits: %w", err)
+		}
+		result, err := tui.Run(report)
+		if err != nil {
+			return err
+		}
+		if !result.Confirmed {
+			fmt.Fprintln(stdout, "Aborted, no changes made")
+			return nil
+		}
+		extractor.SetOverrides(result.Overrides)
+	}
+
+	extractGroup := func() error {
+		if dryRun {
+			report, err := extractor.DryRun(ctx, previousRev, "HEAD")
+			if err != nil {
+				return fmt.Errorf("dry run failed: %w", err)
+			}
+			if planOut != "" {
+				plan, err := extractor.NewPlan(ctx, previousRev, "HEAD", report)
+				if err != nil {
+					return err
+				}
+				if err := plan.Write(planOut); err != nil {
+					return err
+				}
+			}
+			switch format {
+			case "json":
+				output, err := extractor.RenderJSON(report)
+				if err != nil {
+					return err
+				}
+				_, err = stdout.Write(output)
+				return err
+			case "markdown":
+				fmt.Fprint(stdout, extractor.RenderMarkdown(report))
+				return nil
+			}
+			fmt.Fprint(stdout, extractor.Render(report))
+			if graph {
+				output, err := extractor.Graph(ctx, previousRev, "HEAD", report)
+				if err != nil {
+					return err
+				}
+				fmt.Fprint(stdout, "\n"+output)
+			}
+			return nil
+		}
+
+		if confirm && !interactive && !nonInteractive && progressFormat != "json" {
+			report, err := extractor.DryRun(ctx, previousRev, "HEAD")
+			if err != nil {
+				return fmt.Errorf("failed to plan splits: %w", err)
+			}
+			fmt.Fprint(stdout, extractor.Render(report))
+			if report.SplitCount > 0 && !askYesNo(stdout, "Rewrite the history as shown? [y/N] ") {
+				fmt.Fprintln(stdout, "Aborted, no changes made")
+				return nil
+			}
+		}
+
+		run := func() error {
+			if plan != nil {
+				return extractor.Executor().Execute(ctx, plan)
+			}
+			return extractor.Extract(ctx, previousRev, "HEAD")
+		}
+		err = run()
+		var collision *rebase.WorktreeCollisionError
+		if errors.As(err, &collision) && !nonInteractive && progressFormat != "json" && isTerminal(os.Stdin) {
+			fmt.Fprintf(stdout, "%s is also checked out in the worktree at %s.\n", collision.Branch, collision.Worktree)
+			if !askYesNo(stdout, "Rewrite a detached HEAD instead? [y/N] ") {
+				fmt.Fprintln(stdout, "Aborted, no changes made")
+				return nil
+			}
+			extractor.SetDetach(true)
+			err = run()
+		}
+		return err
+	}
+	if len(groups) > 1 && !dryRun {
+		// Every pass moves HEAD, so a base given relative to it is resolved once
+		if previousRev, err = git.NewRepository(wd).ResolveCommit(ctx, previousRev); err != nil {
+			return err
+		}
+	}
+	for i, group := range groups {
+		if len(groups) > 1 {
+			extractor.SetTargetFiles(group...)
+			// The event stream has stdout to itself
+			if !quiet {
+				fmt.Fprintf(stdout, "Group %d of %d: %s\n\n", i+1, len(groups), strings.Join(group, " "))
+			}
+		}
+		if err := extractGroup(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// askYesNo asks a question on stdin, defaulting to no
+func askYesNo(out io.Writer, question string) bool {
+	fmt.Fprint(out, question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// resolveArgs splits the arguments into the base revision and target paths,
+// adding presetPaths. The paths are empty when only a revision is given.
+// rebaseExtract.base stands in for the revision when there are no arguments
+// (a preset supplies the paths) or they start with "--".
+func resolveArgs(cmd *cobra.Command, args []string, config gitConfig, presetPaths []string) (string, []string, error) {
+	paths := append([]string(nil), presetPaths...)
+
+	rev := ""
+	if len(args) == 0 || cmd.ArgsLenAtDash() == 0 {
+		base, ok := config.get("base")
+		if !ok {
+			return "", nil, fmt.Errorf("no base revision given and rebaseExtract.base is not set")
+		}
+		rev = base
+		paths = append(paths, args...)
+	} else {
+		rev = args[0]
+		paths = append(paths, args[1:]...)
+	}
+	for i, path := range paths {
+		paths[i] = rebase.TargetPath(path)
+	}
+	return rev, paths, nil
+}
+
+// pickTargets lets the user choose targets among the files changed since
+// base, when running on a terminal
+func pickTargets(ctx context.Context, base string) ([]string, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return nil, fmt.Errorf("at least one file path is required")
+	}
+	candidates, err := rankCandidates(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+	return tui.PickTargets(candidates)
+}
+
+// changeDirectory moves into the -C directory, so the repository, plan, and
+// report paths all resolve against it as they would for git -C
+func changeDirectory() error {
+	if directory == "" {
 		return nil
 	}
+	if err := os.Chdir(directory); err != nil {
+		return fmt.Errorf("cannot change to %s: %w", directory, err)
+	}
+	return nil
+}
+
+// useGit runs every git command with the binary chosen by --git-path or
+// rebaseExtract.gitPath, failing early if it is missing or too old
+func useGit(ctx context.Context) error {
+	if gitPath != "" {
+		if err := git.SetExecutable(gitPath); err != nil {
+			return err
+		}
+	}
+	version, err := git.NewRepository("").Version(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot run %s: %w", git.Executable(), err)
+	}
+	if !version.AtLeast(git.MinimumVersion) {
+		return fmt.Errorf("git >= %s is required, but %s is git %s", git.MinimumVersion, git.Executable(), version)
+	}
+	return nil
+}
 
-	return extractor.Extract(previousRev, "HEAD")
+// withoutGit reports whether the run is a dry run that reads history with
+// go-git and so never needs git. Showing patches and the graph, and
+// checking out --branch, still take git.
+func withoutGit() bool {
+	return dryRun && backend == "go-git" && !showDiff && !graph && branch == ""
+}
+
+// isBareRepository reports whether we run in a bare repository, which has
+// no working tree to split in
+func isBareRepository(ctx context.Context) bool {
+	output, err := git.NewRepository("").GitOutput(ctx, "rev-parse", "--is-bare-repository")
+	return err == nil && strings.TrimSpace(output) == "true"
+}
+
+// absoluteGitEnv makes relative GIT_DIR and GIT_WORK_TREE values absolute,
+// so git finds the same repository from the top of the working tree and
+// the other directories commands are run in
+func absoluteGitEnv() error {
+	for _, name := range []string{"GIT_DIR", "GIT_WORK_TREE"} {
+		value := os.Getenv(name)
+		if value == "" || filepath.IsAbs(value) {
+			continue
+		}
+		absolute, err := filepath.Abs(value)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+		if err := os.Setenv(name, absolute); err != nil {
+			return fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// useColor reports whether output should be colored: only on a terminal,
+// and never when disabled with --no-color or NO_COLOR (https://no-color.org)
+func useColor() bool {
+	switch colorMode {
+	case "always":
+		return !noColor
+	case "never", "false":
+		return false
+	}
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ansiEscape matches the color sequences the extractor emits
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// plainWriter strips colors from everything written to it
+type plainWriter struct {
+	w io.Writer
+}
+
+func (p plainWriter) Write(b []byte) (int, error) {
+	if _, err := p.w.Write(ansiEscape.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
 }
 
 func main() {
-	if err := rootCmd.Execute(); err != nil {
+	// Ctrl-C and SIGTERM cancel the run, which rolls back a rewrite in progress
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, rebase.ErrConflicts) {
+			os.Exit(3)
+		}
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,48 @@
+// ABOUTME: Hidden man page generator
+// ABOUTME: Writes git-rebase-extract-file(1) so "git help rebase-extract-file" works once installed
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+var manDir string
+
+var genManCmd = &cobra.Command{
+	Use:    "gen-man",
+	Short:  "Generate man pages",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := os.MkdirAll(manDir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", manDir, err)
+		}
+
+		header := &doc.GenManHeader{
+			Title:   "GIT-REBASE-EXTRACT-FILE",
+			Section: "1",
+			Source:  "git-rebase-extract-file",
+			Manual:  "Git Manual",
+		}
+		// Leave out the "Auto generated by spf13/cobra" footer, and escape the
+		// <placeholders> in the usage line, which the markdown-to-man
+		// conversion would otherwise drop as HTML tags
+		rootCmd.DisableAutoGenTag = true
+		rootCmd.Use = strings.NewReplacer("<", `\<`, ">", `\>`).Replace(rootCmd.Use)
+		if err := doc.GenManTree(rootCmd, header, manDir); err != nil {
+			return fmt.Errorf("failed to generate man pages: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	genManCmd.Flags().StringVar(&manDir, "dir", "man", "Directory to write the man pages to")
+	rootCmd.AddCommand(genManCmd)
+}
@@ -0,0 +1,128 @@
+// ABOUTME: Named profiles from a .git-rebase-extract.yaml file at the repository root
+// ABOUTME: Lets a team commit its splitting conventions (paths, grouping, base, message templates) once
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/obra/git-rebase-extract-file/internal/git"
+	"gopkg.in/yaml.v3"
+)
+
+// profileFileName is the name of the profile file at the repository root
+const profileFileName = ".git-rebase-extract.yaml"
+
+// profileSettings are the keys a profile may set besides paths and groups,
+// named as in the rebaseExtract git config section. The profile file comes
+// with the repository, so it only says what to split and how to word the
+// commits; settings that run commands, such as preSplit, postSplit, or
+// gitPath, stay with the user's own git config and command line.
+var profileSettings = []string{"base", "remainingTemplate", "extractedTemplate"}
+
+// profile is one named entry of the profile file. Paths are extraction
+// targets. Groups, used instead of paths, are targets extracted into
+// commits of their own, one group after the other. Settings hold the
+// profileSettings it sets, keyed in lowercase like gitConfig.
+type profile struct {
+	Paths    []string
+	Groups   [][]string
+	Settings gitConfig
+}
+
+// UnmarshalYAML separates the paths and groups from the settings
+func (p *profile) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]yaml.Node
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	p.Settings = gitConfig{}
+	for key, value := range raw {
+		switch key {
+		case "paths":
+			if err := value.Decode(&p.Paths); err != nil {
+				return fmt.Errorf("paths: %w", err)
+			}
+			continue
+		case "groups":
+			if err := value.Decode(&p.Groups); err != nil {
+				return fmt.Errorf("groups: %w", err)
+			}
+			for i, group := range p.Groups {
+				if len(group) == 0 {
+					return fmt.Errorf("groups: group %d has no paths", i+1)
+				}
+			}
+			continue
+		}
+		if !slices.ContainsFunc(profileSettings, func(setting string) bool { return strings.EqualFold(setting, key) }) {
+			return fmt.Errorf("%s can't be set in a profile (only paths, groups, %s)", key, strings.Join(profileSettings, ", "))
+		}
+		if value.Kind != yaml.ScalarNode {
+			return fmt.Errorf("%s: expected a single value", key)
+		}
+		p.Settings[strings.ToLower(key)] = []string{value.Value}
+	}
+	if len(p.Paths) > 0 && len(p.Groups) > 0 {
+		return fmt.Errorf("set either paths or groups, not both")
+	}
+	return nil
+}
+
+// repositoryRoot returns the top of the working tree, found with go-git in
+// a run without git
+func repositoryRoot(ctx context.Context) (string, error) {
+	if withoutGit() {
+		repo, err := git.OpenGoGit(".")
+		if err != nil {
+			return "", err
+		}
+		return repo.WorkTree()
+	}
+	output, err := git.NewRepository("").Command(ctx, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// loadProfile reads the named profile from the profile file at the repository root
+func loadProfile(ctx context.Context, name string) (profile, error) {
+	root, err := repositoryRoot(ctx)
+	if err != nil {
+		return profile{}, fmt.Errorf("failed to find the repository root: %w", err)
+	}
+	path := filepath.Join(root, profileFileName)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return profile{}, fmt.Errorf("--profile %s needs a %s at the repository root", name, profileFileName)
+	}
+	if err != nil {
+		return profile{}, fmt.Errorf("failed to read %s: %w", profileFileName, err)
+	}
+
+	var file struct {
+		Profiles map[string]profile `yaml:"profiles"`
+	}
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return profile{}, fmt.Errorf("failed to parse %s: %w", profileFileName, err)
+	}
+	found, ok := file.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(file.Profiles))
+		for known := range file.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return profile{}, fmt.Errorf("unknown profile %q in %s (available: %s)", name, profileFileName, strings.Join(names, ", "))
+	}
+	return found, nil
+}
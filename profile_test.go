@@ -0,0 +1,125 @@
+// ABOUTME: Tests for named profiles read from .git-rebase-extract.yaml
+// ABOUTME: Covers paths, groups, and settings, and the errors for missing, unknown, malformed, and unsafe profiles
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/obra/git-rebase-extract-file/internal/testutils"
+)
+
+// profileRepo creates a repository whose profile file holds content, if
+// any, and moves into a directory inside it
+func profileRepo(t *testing.T, content string) {
+	t.Helper()
+	repo := testutils.NewTestRepo(t)
+	if content != "" {
+		repo.WriteFile(profileFileName, content)
+	}
+	// Profiles are found from any directory of the repository
+	dir := filepath.Join(repo.Dir, "sub")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", dir, err)
+	}
+	t.Chdir(dir)
+}
+
+func TestLoadProfile(t *testing.T) {
+	profileRepo(t, `profiles:
+  lockfiles:
+    paths: [package-lock.json, yarn.lock]
+    extractedTemplate: "chore(deps): {subject}"
+    base: origin/main
+  deps:
+    groups:
+      - [package-lock.json]
+      - [go.sum, go.mod]
+`)
+
+	lockfiles, err := loadProfile(t.Context(), "lockfiles")
+	if err != nil {
+		t.Fatalf("loadProfile failed: %v", err)
+	}
+	if !slices.Equal(lockfiles.Paths, []string{"package-lock.json", "yarn.lock"}) || lockfiles.Groups != nil {
+		t.Errorf("Expected the lockfiles paths without groups, got %q and %q", lockfiles.Paths, lockfiles.Groups)
+	}
+	// Settings use the lowercased keys of git config
+	if value, _ := lockfiles.Settings.get("extractedtemplate"); value != "chore(deps): {subject}" {
+		t.Errorf("Expected the extracted template setting, got %q", value)
+	}
+	if value, _ := lockfiles.Settings.get("base"); value != "origin/main" {
+		t.Errorf("Expected the base setting, got %q", value)
+	}
+
+	deps, err := loadProfile(t.Context(), "deps")
+	if err != nil {
+		t.Fatalf("loadProfile failed: %v", err)
+	}
+	if len(deps.Paths) != 0 || len(deps.Groups) != 2 || !slices.Equal(deps.Groups[1], []string{"go.sum", "go.mod"}) {
+		t.Errorf("Expected two groups and no paths, got %q and %q", deps.Paths, deps.Groups)
+	}
+}
+
+func TestLoadProfile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "missing file",
+			wantErr: "--profile lockfiles needs a .git-rebase-extract.yaml at the repository root",
+		},
+		{
+			name:    "unknown profile",
+			content: "profiles:\n  deps:\n    paths: [go.sum]\n  docs:\n    paths: [docs/]\n",
+			wantErr: `unknown profile "lockfiles" in .git-rebase-extract.yaml (available: deps, docs)`,
+		},
+		{
+			name:    "malformed YAML",
+			content: "profiles:\n  lockfiles:\n    paths: [package-lock.json\n",
+			wantErr: "failed to parse .git-rebase-extract.yaml",
+		},
+		{
+			name:    "nested setting",
+			content: "profiles:\n  lockfiles:\n    base: [main]\n",
+			wantErr: "base: expected a single value",
+		},
+		{
+			// A cloned repository must not run commands through --profile
+			name:    "command setting",
+			content: "profiles:\n  lockfiles:\n    paths: [yarn.lock]\n    postSplit: make\n",
+			wantErr: "postSplit can't be set in a profile",
+		},
+		{
+			name:    "other setting",
+			content: "profiles:\n  lockfiles:\n    paths: [yarn.lock]\n    gitPath: /tmp/git\n",
+			wantErr: "gitPath can't be set in a profile",
+		},
+		{
+			name:    "paths and groups",
+			content: "profiles:\n  lockfiles:\n    paths: [yarn.lock]\n    groups: [[package-lock.json]]\n",
+			wantErr: "set either paths or groups, not both",
+		},
+		{
+			name:    "empty group",
+			content: "profiles:\n  lockfiles:\n    groups: [[package-lock.json], []]\n",
+			wantErr: "groups: group 2 has no paths",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profileRepo(t, tt.content)
+			_, err := loadProfile(t.Context(), "lockfiles")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}